@@ -1,6 +1,7 @@
 package actualstatelistener
 
 import (
+	"errors"
 	"strconv"
 	"sync"
 	"time"
@@ -98,6 +99,10 @@ func (listener *ActualStateListener) Start() {
 		})
 	})
 
+	if listener.config.IsAckTrackingEnabled() {
+		listener.messageBus.Subscribe(listener.config.SenderNatsAckSubject, listener.saveAck)
+	}
+
 	go listener.syncHeartbeats()
 
 	if listener.storeUsageTracker != nil {
@@ -106,6 +111,31 @@ func (listener *ActualStateListener) Start() {
 	}
 }
 
+//Acks are few and far between (one per start or stop message) so they are saved as they arrive rather than batched like heartbeats
+func (listener *ActualStateListener) saveAck(message *yagnats.Message) {
+	ack, err := models.NewMessageAckFromJSON(message.Payload)
+	if err == nil && ack.MessageId == "" {
+		err = errors.New("ack has no message id")
+	}
+	if err != nil {
+		listener.logger.Error("Could not unmarshal ack", err,
+			map[string]string{
+				"MessageBody": string(message.Payload),
+			})
+		return
+	}
+
+	ack.ReceivedAt = listener.timeProvider.Time().Unix()
+
+	err = listener.store.SaveMessageAcks(ack)
+	if err != nil {
+		listener.logger.Error("Could not put ack in store:", err, ack.LogDescription())
+		return
+	}
+
+	listener.logger.Info("Received an ack", ack.LogDescription())
+}
+
 func (listener *ActualStateListener) syncHeartbeats() {
 	syncInterval := listener.timeProvider.NewTickerChannel(HeartbeatSyncTimer, listener.config.ListenerHeartbeatSyncInterval())
 
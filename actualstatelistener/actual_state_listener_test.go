@@ -110,6 +110,77 @@ var _ = Describe("Actual state listener", func() {
 		})
 	})
 
+	It("should not subscribe to an ack subject", func() {
+		Ω(messageBus.Subscriptions).Should(HaveLen(2))
+	})
+
+	Context("when ack tracking is enabled", func() {
+		var ackMessageBus *fakeyagnats.FakeYagnats
+
+		BeforeEach(func() {
+			conf.SenderNatsAckSubject = "hm9000.ack"
+			ackMessageBus = fakeyagnats.New()
+
+			listener = New(conf, ackMessageBus, store, nil, metricsAccountant, timeProvider, logger)
+			listener.Start()
+		})
+
+		It("should subscribe to the ack subject", func() {
+			Ω(ackMessageBus.Subscriptions).Should(HaveKey("hm9000.ack"))
+			Ω(ackMessageBus.Subscriptions["hm9000.ack"]).Should(HaveLen(1))
+		})
+
+		Context("when it receives an ack", func() {
+			BeforeEach(func() {
+				ackMessageBus.Subscriptions["hm9000.ack"][0].Callback(&yagnats.Message{
+					Payload: []byte(`{"message_id":"message-id","dea":"dea-guid"}`),
+				})
+			})
+
+			It("should save the ack, stamped with the time it was received", func() {
+				acks, err := store.GetMessageAcks()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(acks).Should(HaveLen(1))
+				Ω(acks["message-id"]).Should(Equal(MessageAck{
+					MessageId:  "message-id",
+					DeaGuid:    "dea-guid",
+					ReceivedAt: 100,
+				}))
+			})
+		})
+
+		Context("when it fails to parse the ack", func() {
+			BeforeEach(func() {
+				ackMessageBus.Subscriptions["hm9000.ack"][0].Callback(&yagnats.Message{
+					Payload: []byte("ß"),
+				})
+				ackMessageBus.Subscriptions["hm9000.ack"][0].Callback(&yagnats.Message{
+					Payload: []byte(`{"dea":"dea-guid"}`),
+				})
+			})
+
+			It("should save nothing and log about it", func() {
+				acks, err := store.GetMessageAcks()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(acks).Should(BeEmpty())
+				Ω(logger.LoggedSubjects).Should(ContainElement("Could not unmarshal ack"))
+			})
+		})
+
+		Context("when the ack can't be saved", func() {
+			BeforeEach(func() {
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("acks", errors.New("oops"))
+				ackMessageBus.Subscriptions["hm9000.ack"][0].Callback(&yagnats.Message{
+					Payload: []byte(`{"message_id":"message-id"}`),
+				})
+			})
+
+			It("should log about it", func() {
+				Ω(logger.LoggedSubjects).Should(ContainElement("Could not put ack in store:"))
+			})
+		})
+	})
+
 	Context("When it receives a dea advertisement over the message bus", func() {
 		Context("and no heartbeat has been received recently", func() {
 			BeforeEach(func() {
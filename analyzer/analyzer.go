@@ -4,86 +4,558 @@ import (
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/yagnats"
+
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type Analyzer struct {
-	store store.Store
+	messageBus        yagnats.NATSClient
+	store             store.Store
+	metricsAccountant metricsaccountant.MetricsAccountant
 
 	logger       logger.Logger
 	timeProvider timeprovider.TimeProvider
 	conf         *config.Config
+
+	//random is shared by the backoff strategies of every app, so that apps analyzed together get different jitter
+	random *rand.Rand
+
+	lastFullSweep time.Time
 }
 
-func New(store store.Store, timeProvider timeprovider.TimeProvider, logger logger.Logger, conf *config.Config) *Analyzer {
+func New(messageBus yagnats.NATSClient, store store.Store, metricsAccountant metricsaccountant.MetricsAccountant, timeProvider timeprovider.TimeProvider, logger logger.Logger, conf *config.Config) *Analyzer {
 	return &Analyzer{
-		store:        store,
-		timeProvider: timeProvider,
-		logger:       logger,
-		conf:         conf,
+		messageBus:        messageBus,
+		store:             store,
+		metricsAccountant: metricsAccountant,
+		timeProvider:      timeProvider,
+		logger:            logger,
+		conf:              conf,
+		random:            NewLockedRand(time.Now().UnixNano()),
 	}
 }
 
+//ValidateConfig rejects a config that names a backoff strategy, crash count decay or policy the analyzer does not have.
+//hm9000 calls it when it loads the config, after any alternative policies have registered themselves.
+func ValidateConfig(conf *config.Config) error {
+	_, err := NewBackoffStrategy(conf, nil)
+	if err != nil {
+		return err
+	}
+
+	switch conf.CrashCountDecay {
+	case ResetCrashCountDecayName, DecrementCrashCountDecayName, "":
+	default:
+		return fmt.Errorf("Unknown crash count decay: %s", conf.CrashCountDecay)
+	}
+
+	_, err = NewPolicy(conf.AnalyzerPolicy)
+	if err != nil {
+		return err
+	}
+
+	if conf.AnalyzerShadowPolicy != "" {
+		_, err = NewPolicy(conf.AnalyzerShadowPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (analyzer *Analyzer) Analyze() error {
-	err := analyzer.store.VerifyFreshness(analyzer.timeProvider.Time())
+	plan, err := analyzer.Plan()
 	if err != nil {
-		analyzer.logger.Error("Store is not fresh", err)
 		return err
 	}
 
-	apps, err := analyzer.store.GetApps()
+	return analyzer.Apply(plan)
+}
+
+//Apply saves a plan returned by Plan: it enqueues the plan's messages, saves its crash counts, quarantines and history,
+//and announces its quarantines and stuck stagings
+func (analyzer *Analyzer) Apply(plan Plan) error {
+	analyzer.logger.Info("Analyzed apps", map[string]string{
+		"Duration":                plan.Duration.String(),
+		"Apps analyzed by worker": fmt.Sprintf("%v", plan.AppsAnalyzedByWorker),
+		"Full sweep":              strconv.FormatBool(plan.FullSweep),
+		"Dirty apps":              strconv.Itoa(len(plan.DirtyAppKeys)),
+	})
+
+	err := analyzer.store.SaveCrashCounts(plan.CrashCounts()...)
+
 	if err != nil {
-		analyzer.logger.Error("Failed to fetch apps", err)
+		analyzer.logger.Error("Analyzer failed to save crash counts", err)
+		return err
+	}
+
+	err = analyzer.store.SaveQuarantines(plan.Quarantines()...)
+
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to save quarantines", err)
+		return err
+	}
+
+	err = analyzer.store.SavePendingStartMessages(plan.StartMessages()...)
+
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to enqueue start messages", err)
+		return err
+	}
+
+	err = analyzer.store.SavePendingStopMessages(plan.StopMessages()...)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to enqueue stop messages", err)
+		return err
+	}
+
+	err = analyzer.store.SaveAppHistoryEvents(plan.History()...)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to record app history", err)
+		return err
+	}
+
+	//an app that was marked dirty again during the pass keeps its new mark and is picked up by the next pass
+	//(or, if it was marked while the marks are being cleared, by the next full sweep)
+	err = analyzer.store.ClearDirtyApps(plan.DirtyAppMarks)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to clear dirty apps", err)
+		return err
+	}
+
+	if plan.FullSweep {
+		analyzer.lastFullSweep = time.Unix(plan.Timestamp, 0)
+	}
+
+	err = analyzer.metricsAccountant.TrackAnalysis(plan.Duration, plan.AppsAnalyzedByWorker)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to track analysis metrics", err)
 		return err
 	}
 
+	if plan.MassStopCircuitBreakerTripped {
+		err = analyzer.metricsAccountant.TrackMassStopCircuitBreakerTrip(len(plan.RefusedStopMessages()))
+		if err != nil {
+			analyzer.logger.Error("Analyzer failed to track mass stop circuit breaker trip", err)
+			return err
+		}
+	}
+
+	for _, quarantine := range plan.Quarantines() {
+		err = analyzer.messageBus.Publish(analyzer.conf.AnalyzerNatsQuarantinedSubject, quarantine.ToJSON())
+		if err != nil {
+			analyzer.logger.Error("Analyzer failed to announce quarantine", err, quarantine.LogDescription())
+			return err
+		}
+	}
+
+	reportedStagings := []models.PendingStaging{}
+	for _, pendingStaging := range plan.StuckStagings {
+		analyzer.logger.Info("App is stuck in staging", pendingStaging.LogDescription())
+		err = analyzer.messageBus.Publish(analyzer.conf.AnalyzerNatsStuckStagingSubject, pendingStaging.ToJSON())
+		if err != nil {
+			analyzer.logger.Error("Analyzer failed to announce app stuck in staging", err, pendingStaging.LogDescription())
+			return err
+		}
+
+		pendingStaging.ReportedAt = plan.Timestamp
+		reportedStagings = append(reportedStagings, pendingStaging)
+	}
+
+	err = analyzer.store.SavePendingStagings(reportedStagings...)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to record reported stuck stagings", err)
+		return err
+	}
+
+	if plan.ShadowPolicy != "" {
+		analyzer.recordShadowPolicyDiffs(plan)
+	}
+
+	return nil
+}
+
+//recordShadowPolicyDiffs only logs its failures: comparing against the shadow policy must never fail the real analysis
+func (analyzer *Analyzer) recordShadowPolicyDiffs(plan Plan) {
+	onlyInPolicy, onlyInShadow := 0, 0
+	for _, diff := range plan.ShadowPolicyDiffs {
+		if diff.OnlyIn == models.ShadowPolicyDiffOnlyInPolicy {
+			onlyInPolicy++
+		} else {
+			onlyInShadow++
+		}
+	}
+
+	if len(plan.ShadowPolicyDiffs) > 0 {
+		analyzer.logger.Info("Shadow policy disagrees with policy", map[string]string{
+			"Policy":         analyzer.conf.AnalyzerPolicy,
+			"Shadow policy":  plan.ShadowPolicy,
+			"Only in policy": strconv.Itoa(onlyInPolicy),
+			"Only in shadow": strconv.Itoa(onlyInShadow),
+		})
+	}
+
+	err := analyzer.store.SaveShadowPolicyDiffs(plan.ShadowPolicyDiffs...)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to record shadow policy diffs", err)
+	}
+
+	err = analyzer.metricsAccountant.TrackShadowPolicyDiffs(onlyInPolicy, onlyInShadow)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to track shadow policy diff metrics", err)
+	}
+}
+
+//Plan runs the analysis for every app (or, between full sweeps, every dirty app) but does not write anything to the store.
+//Analyze uses Plan and then saves the result with Apply; the dry-run mode of the analyze command just prints it.
+func (analyzer *Analyzer) Plan() (Plan, error) {
+	err := analyzer.store.VerifyFreshness(analyzer.timeProvider.Time())
+	if err != nil {
+		analyzer.logger.Error("Store is not fresh", err)
+		return Plan{}, err
+	}
+
+	currentTime := analyzer.timeProvider.Time()
+	plan := Plan{
+		Timestamp: currentTime.Unix(),
+		Apps:      []AppPlan{},
+		FullSweep: analyzer.isFullSweepDue(currentTime),
+	}
+
+	apps, err := analyzer.fetchApps(&plan)
+	if err != nil {
+		return Plan{}, err
+	}
+
 	existingPendingStartMessages, err := analyzer.store.GetPendingStartMessages()
 	if err != nil {
 		analyzer.logger.Error("Failed to fetch pending start messages", err)
-		return err
+		return Plan{}, err
 	}
 
 	existingPendingStopMessages, err := analyzer.store.GetPendingStopMessages()
 	if err != nil {
 		analyzer.logger.Error("Failed to fetch pending stop messages", err)
-		return err
+		return Plan{}, err
+	}
+
+	policies, err := analyzer.store.GetAppPolicies()
+	if err != nil {
+		analyzer.logger.Error("Failed to fetch app policies", err)
+		return Plan{}, err
+	}
+
+	deadLetters, err := analyzer.store.GetDeadLetters()
+	if err != nil {
+		analyzer.logger.Error("Failed to fetch dead letters", err)
+		return Plan{}, err
 	}
 
-	allStartMessages := []models.PendingStartMessage{}
-	allStopMessages := []models.PendingStopMessage{}
-	allCrashCounts := []models.CrashCount{}
+	backoffStrategy, err := NewBackoffStrategy(analyzer.conf, analyzer.random)
+	if err != nil {
+		analyzer.logger.Error("Failed to build backoff strategy", err)
+		return Plan{}, err
+	}
+
+	policy, err := NewPolicy(analyzer.conf.AnalyzerPolicy)
+	if err != nil {
+		analyzer.logger.Error("Failed to select analyzer policy", err)
+		return Plan{}, err
+	}
+
+	shadowPolicy := analyzer.shadowPolicy()
+
+	desiredVersions, err := analyzer.desiredVersions(plan, apps)
+	if err != nil {
+		analyzer.logger.Error("Failed to fetch desired versions", err)
+		return Plan{}, err
+	}
 
+	//a desired version is read by the workers analyzing each of its outdated versions, so nothing may be left to build lazily
 	for _, app := range apps {
-		startMessages, stopMessages, crashCounts := newAppAnalyzer(app, analyzer.timeProvider.Time(), existingPendingStartMessages, existingPendingStopMessages, analyzer.logger, analyzer.conf).analyzeApp()
-		for _, startMessage := range startMessages {
-			allStartMessages = append(allStartMessages, startMessage)
+		app.IndexInstanceHeartbeats()
+	}
+	for _, desiredVersion := range desiredVersions {
+		desiredVersion.IndexInstanceHeartbeats()
+	}
+
+	t := time.Now()
+	appKeys := sortedAppKeys(apps)
+	appPlans := make([]AppPlan, len(appKeys))
+	shadowAppPlans := make([]AppPlan, len(appKeys))
+	plan.AppsAnalyzedByWorker = make([]int, analyzer.numberOfWorkers())
+
+	appIndices := make(chan int)
+	waitGroup := &sync.WaitGroup{}
+	for worker := range plan.AppsAnalyzedByWorker {
+		waitGroup.Add(1)
+		go func(worker int) {
+			defer waitGroup.Done()
+			for i := range appIndices {
+				app := apps[appKeys[i]]
+				appPlans[i] = analyzer.analyzeApp(policy, analyzer.logger, app, desiredVersions[app.AppGuid], currentTime, existingPendingStartMessages, existingPendingStopMessages, policies, backoffStrategy)
+				if shadowPolicy != nil {
+					shadowAppPlans[i] = analyzer.analyzeApp(shadowPolicy, shadowLogger{analyzer.logger}, app, desiredVersions[app.AppGuid], currentTime, existingPendingStartMessages, existingPendingStopMessages, policies, backoffStrategy)
+				}
+				plan.AppsAnalyzedByWorker[worker]++
+			}
+		}(worker)
+	}
+
+	for i := range appKeys {
+		appIndices <- i
+	}
+	close(appIndices)
+	waitGroup.Wait()
+
+	plan.Duration = time.Since(t)
+
+	//apps are merged in sorted order so that the plan does not depend on how the work was scheduled
+	for _, appPlan := range appPlans {
+		if !appPlan.hasChanges() && len(appPlan.History) == 0 {
+			continue
 		}
-		for _, stopMessage := range stopMessages {
-			allStopMessages = append(allStopMessages, stopMessage)
+
+		plan.Apps = append(plan.Apps, appPlan)
+	}
+
+	//the comparison is made before the mass stop circuit breaker, which is not part of the policy
+	if shadowPolicy != nil {
+		plan.ShadowPolicy = analyzer.conf.AnalyzerShadowPolicy
+		plan.ShadowPolicyDiffs = analyzer.diffShadowPolicy(currentTime, appPlans, shadowAppPlans)
+	}
+
+	plan.skipDeadLetteredMessages(deadLetters)
+
+	numberOfRunningInstances, err := analyzer.numberOfRunningInstances(plan, apps)
+	if err != nil {
+		analyzer.logger.Error("Failed to count running instances", err)
+		return Plan{}, err
+	}
+
+	analyzer.applyMassStopCircuitBreaker(&plan, numberOfRunningInstances)
+
+	plan.StuckStagings, err = analyzer.newlyStuckStagings(currentTime)
+	if err != nil {
+		analyzer.logger.Error("Failed to fetch pending stagings", err)
+		return Plan{}, err
+	}
+
+	return plan, nil
+}
+
+//newlyStuckStagings returns the apps that have been pending staging for longer than the staging timeout and have not been reported yet.
+//HM9000 does not act on these, it only reports them.
+func (analyzer *Analyzer) newlyStuckStagings(currentTime time.Time) ([]models.PendingStaging, error) {
+	stuckStagings := []models.PendingStaging{}
+	if analyzer.conf.StagingTimeout() == 0 {
+		return stuckStagings, nil
+	}
+
+	pendingStagings, err := analyzer.store.GetPendingStagings()
+	if err != nil {
+		return []models.PendingStaging{}, err
+	}
+
+	keys := sort.StringSlice{}
+	for key := range pendingStagings {
+		keys = append(keys, key)
+	}
+	sort.Sort(keys)
+
+	for _, key := range keys {
+		pendingStaging := pendingStagings[key]
+		if pendingStaging.IsStuck(currentTime, analyzer.conf.StagingTimeout()) && !pendingStaging.IsReported() {
+			stuckStagings = append(stuckStagings, pendingStaging)
 		}
-		allCrashCounts = append(allCrashCounts, crashCounts...)
 	}
 
-	err = analyzer.store.SaveCrashCounts(allCrashCounts...)
+	return stuckStagings, nil
+}
+
+//Without a full sweep interval every pass is a full sweep.  Otherwise the first pass is, and then one every interval.
+func (analyzer *Analyzer) isFullSweepDue(currentTime time.Time) bool {
+	fullSweepInterval := analyzer.conf.AnalyzerFullSweepInterval()
+	return fullSweepInterval == 0 || analyzer.lastFullSweep.IsZero() || currentTime.Sub(analyzer.lastFullSweep) >= fullSweepInterval
+}
+
+//fetchApps fetches every app on a full sweep and only the dirty apps otherwise.
+//The dirty apps' marks are recorded on the plan so that Analyze can clear them once the plan is saved.
+func (analyzer *Analyzer) fetchApps(plan *Plan) (map[string]*models.App, error) {
+	var err error
+	plan.DirtyAppKeys = []string{}
+	plan.DirtyAppMarks = map[string]string{}
+	if analyzer.conf.AnalyzerFullSweepInterval() > 0 {
+		plan.DirtyAppMarks, err = analyzer.store.GetDirtyApps()
+		if err != nil {
+			analyzer.logger.Error("Failed to fetch dirty apps", err)
+			return nil, err
+		}
+
+		for appKey := range plan.DirtyAppMarks {
+			plan.DirtyAppKeys = append(plan.DirtyAppKeys, appKey)
+		}
+		sort.Strings(plan.DirtyAppKeys)
+	}
+
+	var apps map[string]*models.App
+	if plan.FullSweep {
+		apps, err = analyzer.store.GetApps()
+	} else {
+		apps, err = analyzer.store.GetAppsWithKeys(plan.DirtyAppKeys...)
+	}
 
 	if err != nil {
-		analyzer.logger.Error("Analyzer failed to save crash counts", err)
-		return err
+		analyzer.logger.Error("Failed to fetch apps", err)
+		return nil, err
 	}
 
-	err = analyzer.store.SavePendingStartMessages(allStartMessages...)
+	return apps, nil
+}
+
+//An incremental pass only sees the dirty apps, so the mass stop circuit breaker needs to look at every heartbeat instead.
+//That is only worth doing if there is something to stop.
+func (analyzer *Analyzer) numberOfRunningInstances(plan Plan, apps map[string]*models.App) (int, error) {
+	numberOfRunningInstances := 0
+	if plan.FullSweep || len(plan.StopMessages()) == 0 {
+		for _, app := range apps {
+			numberOfRunningInstances += app.NumberOfStartingOrRunningInstances()
+		}
+		return numberOfRunningInstances, nil
+	}
 
+	heartbeats, err := analyzer.store.GetInstanceHeartbeats()
 	if err != nil {
-		analyzer.logger.Error("Analyzer failed to enqueue start messages", err)
-		return err
+		return 0, err
+	}
+
+	for _, heartbeat := range heartbeats {
+		if heartbeat.IsStartingOrRunning() {
+			numberOfRunningInstances++
+		}
+	}
+	return numberOfRunningInstances, nil
+}
+
+//desiredVersions maps each app guid to the app for its desired version, so that instances of an outdated version can be related to it.
+//An incremental pass may not have fetched the desired version of an outdated app it is analyzing, so those are fetched separately.
+func (analyzer *Analyzer) desiredVersions(plan Plan, apps map[string]*models.App) (map[string]*models.App, error) {
+	desiredVersions := map[string]*models.App{}
+	for _, app := range apps {
+		if app.IsDesired() {
+			desiredVersions[app.AppGuid] = app
+		}
 	}
 
-	err = analyzer.store.SavePendingStopMessages(allStopMessages...)
+	if plan.FullSweep {
+		return desiredVersions, nil
+	}
+
+	missingAppGuids := map[string]bool{}
+	for _, app := range apps {
+		if _, found := desiredVersions[app.AppGuid]; !found {
+			missingAppGuids[app.AppGuid] = true
+		}
+	}
+
+	if len(missingAppGuids) == 0 {
+		return desiredVersions, nil
+	}
+
+	desiredStates, err := analyzer.store.GetDesiredState()
 	if err != nil {
-		analyzer.logger.Error("Analyzer failed to enqueue stop messages", err)
-		return err
+		return map[string]*models.App{}, err
 	}
 
-	return nil
+	missingAppKeys := []string{}
+	for key, desiredState := range desiredStates {
+		if _, alreadyFetched := apps[key]; !alreadyFetched && missingAppGuids[desiredState.AppGuid] {
+			missingAppKeys = append(missingAppKeys, key)
+		}
+	}
+
+	missingApps, err := analyzer.store.GetAppsWithKeys(missingAppKeys...)
+	if err != nil {
+		return map[string]*models.App{}, err
+	}
+
+	for _, app := range missingApps {
+		desiredVersions[app.AppGuid] = app
+	}
+
+	return desiredVersions, nil
+}
+
+func (analyzer *Analyzer) numberOfWorkers() int {
+	if analyzer.conf.AnalyzerNumberOfWorkers < 1 {
+		return 1
+	}
+	return analyzer.conf.AnalyzerNumberOfWorkers
+}
+
+//analyzeApp hands a single app to the policy.  It only reads from its arguments so many apps can be analyzed concurrently.
+//An app policy that cannot be applied is logged and ignored: the app is analyzed with the global settings instead.
+func (analyzer *Analyzer) analyzeApp(policy Policy, policyLogger logger.Logger, app *models.App, desiredVersion *models.App, currentTime time.Time, existingPendingStartMessages map[string]models.PendingStartMessage, existingPendingStopMessages map[string]models.PendingStopMessage, appPolicies map[string]models.AppPolicy, backoffStrategy BackoffStrategy) AppPlan {
+	appConf, appBackoffStrategy := analyzer.conf, backoffStrategy
+	appPolicy, hasAppPolicy := appPolicies[app.AppGuid]
+	if hasAppPolicy {
+		policyConf := configForAppPolicy(analyzer.conf, appPolicy)
+		policyBackoffStrategy, err := NewBackoffStrategy(policyConf, analyzer.random)
+		if err != nil {
+			analyzer.logger.Error("Failed to apply app policy, falling back to the global settings", err, appPolicy.LogDescription())
+			appPolicy = models.AppPolicy{AppGuid: app.AppGuid}
+		} else {
+			appConf, appBackoffStrategy = policyConf, policyBackoffStrategy
+		}
+	}
+
+	return policy.Analyze(PolicyInput{
+		App:                          app,
+		DesiredVersion:               desiredVersion,
+		ExistingPendingStartMessages: existingPendingStartMessages,
+		ExistingPendingStopMessages:  existingPendingStopMessages,
+		CurrentTime:                  currentTime,
+		Conf:                         appConf,
+		AppPolicy:                    appPolicy,
+		BackoffStrategy:              appBackoffStrategy,
+		Logger:                       policyLogger,
+	})
+}
+
+//applyMassStopCircuitBreaker refuses every stop in the plan if, together, they would stop too many of the running instances.
+//A bad desired state (e.g. an empty bulk API response) would otherwise have the analyzer stop everything.
+func (analyzer *Analyzer) applyMassStopCircuitBreaker(plan *Plan, numberOfRunningInstances int) {
+	numberOfStops := len(plan.StopMessages())
+
+	if !analyzer.conf.ExceedsMassStopThreshold(numberOfStops, numberOfRunningInstances) {
+		return
+	}
+
+	details := map[string]string{
+		"Number of stops":             strconv.Itoa(numberOfStops),
+		"Number of running instances": strconv.Itoa(numberOfRunningInstances),
+	}
+
+	allowed, err := analyzer.store.AreMassStopsAllowed()
+	if err != nil {
+		analyzer.logger.Error("Failed to check for a mass stop override", err)
+	}
+
+	if allowed {
+		analyzer.logger.Info("Mass stop circuit breaker overridden, enqueuing stop messages", details)
+		return
+	}
+
+	analyzer.logger.Error("Refusing to enqueue stop messages (run `hm9000 allow_mass_stops` to override)", store.MassStopCircuitBreakerTrippedError, details)
+	plan.refuseStopMessages("mass stop circuit breaker tripped")
 }
@@ -7,24 +7,30 @@ import (
 	. "github.com/onsi/gomega"
 
 	"errors"
+	"fmt"
 	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/models"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	"runtime"
 	"time"
 )
 
 var _ = Describe("Analyzer", func() {
 	var (
-		analyzer     *Analyzer
-		storeAdapter *fakestoreadapter.FakeStoreAdapter
-		store        storepackage.Store
-		timeProvider *faketimeprovider.FakeTimeProvider
-		dea          appfixture.DeaFixture
-		app          appfixture.AppFixture
+		analyzer          *Analyzer
+		messageBus        *fakeyagnats.FakeYagnats
+		metricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
+		storeAdapter      *fakestoreadapter.FakeStoreAdapter
+		store             storepackage.Store
+		timeProvider      *faketimeprovider.FakeTimeProvider
+		dea               appfixture.DeaFixture
+		app               appfixture.AppFixture
 	)
 
 	conf, _ := config.DefaultConfig()
@@ -42,7 +48,10 @@ var _ = Describe("Analyzer", func() {
 		store.BumpActualFreshness(time.Unix(100, 0))
 		store.BumpDesiredFreshness(time.Unix(100, 0))
 
-		analyzer = New(store, timeProvider, fakelogger.NewFakeLogger(), conf)
+		messageBus = fakeyagnats.New()
+		metricsAccountant = fakemetricsaccountant.New()
+
+		analyzer = New(messageBus, store, metricsAccountant, timeProvider, fakelogger.NewFakeLogger(), conf)
 	})
 
 	startMessages := func() []models.PendingStartMessage {
@@ -120,6 +129,18 @@ var _ = Describe("Analyzer", func() {
 						Ω(message.Priority).Should(Equal(1.0))
 					}
 				})
+
+				It("should record the enqueued start messages in the app's history", func() {
+					analyzer.Analyze()
+					history, err := store.GetAppHistory(app.AppGuid)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(history).Should(HaveLen(2))
+					for _, event := range history {
+						Ω(event.Component).Should(Equal("analyzer"))
+						Ω(event.EventType).Should(Equal(models.AppHistoryEventStartEnqueued))
+						Ω(event.Timestamp).Should(Equal(timeProvider.Time().Unix()))
+					}
+				})
 			})
 
 			Context("when there is an existing start message", func() {
@@ -136,6 +157,19 @@ var _ = Describe("Analyzer", func() {
 					Ω(startMessages()).Should(HaveLen(2))
 					Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(existingMessage)))
 				})
+
+				It("should record that the start message was skipped in the app's history", func() {
+					history, err := store.GetAppHistory(app.AppGuid)
+					Ω(err).ShouldNot(HaveOccurred())
+					eventTypes := []models.AppHistoryEventType{}
+					for _, event := range history {
+						eventTypes = append(eventTypes, event.EventType)
+						if event.EventType == models.AppHistoryEventStartSkipped {
+							Ω(event.MessageId).Should(Equal(existingMessage.MessageId))
+						}
+					}
+					Ω(eventTypes).Should(ConsistOf(models.AppHistoryEventStartSkipped, models.AppHistoryEventStartEnqueued))
+				})
 			})
 
 			Context("but only some of the instances are running", func() {
@@ -583,6 +617,342 @@ var _ = Describe("Analyzer", func() {
 		})
 	})
 
+	Describe("Handling instances stuck in STARTING", func() {
+		var stuckHeartbeat models.InstanceHeartbeat
+
+		BeforeEach(func() {
+			conf.StartingTimeoutInHeartbeats = 6
+
+			store.SyncDesiredState(app.DesiredState(2))
+
+			stuckHeartbeat = app.InstanceAtIndex(1).Heartbeat()
+			stuckHeartbeat.State = models.InstanceStateStarting
+			stuckHeartbeat.StateTimestamp = float64(timeProvider.Time().Add(-conf.StartingTimeout() - time.Second).Unix())
+		})
+
+		AfterEach(func() {
+			conf.StartingTimeoutInHeartbeats = 0
+		})
+
+		Context("when an instance has been STARTING for longer than the starting timeout", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), stuckHeartbeat))
+			})
+
+			It("should schedule an immediate stop for the stuck instance and a replacement start", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(stopMessages()).Should(HaveLen(1))
+				expectedStopMessage := models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, stuckHeartbeat.InstanceGuid, models.PendingStopMessageReasonStuckStarting)
+				Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedStopMessage)))
+
+				Ω(startMessages()).Should(HaveLen(1))
+				expectedStartMessage := models.NewPendingStartMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, 1, 0.0, models.PendingStartMessageReasonStuckStarting)
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expectedStartMessage)))
+			})
+
+			Context("when stuck instance detection is disabled", func() {
+				BeforeEach(func() {
+					conf.StartingTimeoutInHeartbeats = 0
+				})
+
+				It("should not schedule anything", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(startMessages()).Should(BeEmpty())
+					Ω(stopMessages()).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("when an instance has been STARTING for less than the starting timeout", func() {
+			BeforeEach(func() {
+				stuckHeartbeat.StateTimestamp = float64(timeProvider.Time().Add(-time.Second).Unix())
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), stuckHeartbeat))
+			})
+
+			It("should not schedule anything", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(startMessages()).Should(BeEmpty())
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+		})
+
+		Context("when there is also a RUNNING instance on the stuck instance's index", func() {
+			var runningHeartbeat models.InstanceHeartbeat
+
+			BeforeEach(func() {
+				runningHeartbeat = app.InstanceAtIndex(1).Heartbeat()
+				runningHeartbeat.InstanceGuid = models.Guid()
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), stuckHeartbeat, runningHeartbeat))
+			})
+
+			It("should schedule an immediate stop for the stuck instance, but no replacement start", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(startMessages()).Should(BeEmpty())
+
+				expectedStopMessage := models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, stuckHeartbeat.InstanceGuid, models.PendingStopMessageReasonStuckStarting)
+				Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedStopMessage)))
+			})
+		})
+	})
+
+	Describe("Reporting apps stuck in staging", func() {
+		var pendingStaging models.PendingStaging
+
+		BeforeEach(func() {
+			conf.StagingTimeoutInHeartbeats = 90
+
+			desired := app.DesiredState(1)
+			desired.PackageState = models.AppPackageStatePending
+			store.SyncDesiredState(desired)
+		})
+
+		AfterEach(func() {
+			conf.StagingTimeoutInHeartbeats = 0
+		})
+
+		Context("when an app has been pending staging for longer than the staging timeout", func() {
+			BeforeEach(func() {
+				pendingStaging = models.NewPendingStaging(timeProvider.Time().Add(-conf.StagingTimeout()-time.Second), app.AppGuid, app.AppVersion)
+				store.SavePendingStagings(pendingStaging)
+			})
+
+			It("should announce it over NATS", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(messageBus.PublishedMessages["hm9000.stuck_staging"]).Should(HaveLen(1))
+				Ω(messageBus.PublishedMessages["hm9000.stuck_staging"][0].Payload).Should(MatchJSON(pendingStaging.ToJSON()))
+			})
+
+			It("should only announce it once", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pendingStagings, _ := store.GetPendingStagings()
+				Ω(pendingStagings[pendingStaging.StoreKey()].ReportedAt).Should(Equal(timeProvider.Time().Unix()))
+
+				err = analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.stuck_staging"]).Should(HaveLen(1))
+			})
+
+			It("should not try to start the app", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(BeEmpty())
+			})
+
+			Context("when the staging timeout is disabled", func() {
+				BeforeEach(func() {
+					conf.StagingTimeoutInHeartbeats = 0
+				})
+
+				It("should not announce anything", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(messageBus.PublishedMessages["hm9000.stuck_staging"]).Should(BeEmpty())
+				})
+			})
+
+			Context("when fetching the pending stagings fails", func() {
+				BeforeEach(func() {
+					storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("staging", errors.New("oops"))
+				})
+
+				It("should return the error", func() {
+					err := analyzer.Analyze()
+					Ω(err).Should(Equal(errors.New("oops")))
+				})
+			})
+		})
+
+		Context("when an app has been pending staging for less than the staging timeout", func() {
+			BeforeEach(func() {
+				pendingStaging = models.NewPendingStaging(timeProvider.Time().Add(-conf.StagingTimeout()), app.AppGuid, app.AppVersion)
+				store.SavePendingStagings(pendingStaging)
+			})
+
+			It("should not announce anything", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.stuck_staging"]).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Replacing instances of an outdated version", func() {
+		var outdatedApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			outdatedApp = dea.GetApp(1)
+			outdatedApp.AppGuid = app.AppGuid
+
+			store.SyncDesiredState(app.DesiredState(2))
+		})
+
+		Context("when the desired version has no instances running yet", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					outdatedApp.InstanceAtIndex(0).Heartbeat(),
+					outdatedApp.InstanceAtIndex(1).Heartbeat(),
+				))
+			})
+
+			It("should start the desired version but leave the outdated instances running", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(2))
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the desired version is RUNNING at some of the indices", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					outdatedApp.InstanceAtIndex(0).Heartbeat(),
+					outdatedApp.InstanceAtIndex(1).Heartbeat(),
+				))
+			})
+
+			It("should only stop the outdated instances at those indices", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(stopMessages()).Should(HaveLen(1))
+				expectedStopMessage := models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), outdatedApp.AppGuid, outdatedApp.AppVersion, outdatedApp.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonOutdatedVersion)
+				Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedStopMessage)))
+			})
+		})
+
+		Context("when the desired version is only STARTING at an index", func() {
+			BeforeEach(func() {
+				startingHeartbeat := app.InstanceAtIndex(0).Heartbeat()
+				startingHeartbeat.State = models.InstanceStateStarting
+
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					startingHeartbeat,
+					app.InstanceAtIndex(1).Heartbeat(),
+					outdatedApp.InstanceAtIndex(0).Heartbeat(),
+				))
+			})
+
+			It("should not stop the outdated instance at that index", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the outdated version has instances at indices the desired version no longer wants", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+					outdatedApp.InstanceAtIndex(2).Heartbeat(),
+				))
+			})
+
+			It("should stop them as extra instances", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(stopMessages()).Should(HaveLen(1))
+				expectedStopMessage := models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), outdatedApp.AppGuid, outdatedApp.AppVersion, outdatedApp.InstanceAtIndex(2).InstanceGuid, models.PendingStopMessageReasonExtra)
+				Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedStopMessage)))
+			})
+		})
+
+		Context("when several workers analyze outdated versions alongside the desired version", func() {
+			var (
+				outdatedApps     []appfixture.AppFixture
+				previousMaxProcs int
+			)
+
+			BeforeEach(func() {
+				Ω(conf.AnalyzerNumberOfWorkers).Should(BeNumerically(">", 1))
+				//so that the workers really run in parallel, even on a single CPU
+				previousMaxProcs = runtime.GOMAXPROCS(8)
+
+				heartbeats := []models.InstanceHeartbeat{
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+				}
+				outdatedApps = []appfixture.AppFixture{}
+				for i := 1; i <= 8; i++ {
+					outdated := dea.GetApp(i)
+					outdated.AppGuid = app.AppGuid
+					outdatedApps = append(outdatedApps, outdated)
+					heartbeats = append(heartbeats, outdated.InstanceAtIndex(0).Heartbeat())
+				}
+				store.SyncHeartbeats(dea.HeartbeatWith(heartbeats...))
+			})
+
+			AfterEach(func() {
+				runtime.GOMAXPROCS(previousMaxProcs)
+			})
+
+			//run with -race: the workers share the desired version
+			It("should stop every outdated instance without racing on the desired version", func() {
+				for i := 0; i < 5; i++ {
+					plan, err := analyzer.Plan()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					stoppedInstanceGuids := []string{}
+					for _, message := range plan.StopMessages() {
+						Ω(message.StopReason).Should(Equal(models.PendingStopMessageReasonOutdatedVersion))
+						stoppedInstanceGuids = append(stoppedInstanceGuids, message.InstanceGuid)
+					}
+					Ω(stoppedInstanceGuids).Should(HaveLen(len(outdatedApps)))
+					for _, outdated := range outdatedApps {
+						Ω(stoppedInstanceGuids).Should(ContainElement(outdated.InstanceAtIndex(0).InstanceGuid))
+					}
+				}
+			})
+		})
+
+		Context("when an incremental pass only sees the outdated version", func() {
+			BeforeEach(func() {
+				conf.AnalyzerFullSweepIntervalInHeartbeats = 6
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+				))
+
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+					outdatedApp.InstanceAtIndex(1).Heartbeat(),
+				))
+			})
+
+			AfterEach(func() {
+				conf.AnalyzerFullSweepIntervalInHeartbeats = 0
+			})
+
+			It("should still relate it to the desired version", func() {
+				plan, err := analyzer.Plan()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(plan.FullSweep).Should(BeFalse())
+
+				Ω(plan.StopMessages()).Should(HaveLen(1))
+				Ω(plan.StopMessages()[0].InstanceGuid).Should(Equal(outdatedApp.InstanceAtIndex(1).InstanceGuid))
+				Ω(plan.StopMessages()[0].StopReason).Should(Equal(models.PendingStopMessageReasonOutdatedVersion))
+			})
+		})
+	})
+
 	Describe("Handling crashed instances", func() {
 		var heartbeat models.Heartbeat
 		Context("When there are multiple crashed instances on the same index", func() {
@@ -675,46 +1045,830 @@ var _ = Describe("Analyzer", func() {
 					store.DeletePendingStartMessages(startMessages()...)
 				}
 			})
-		})
 
-		Context("When all instances are crashed", func() {
-			BeforeEach(func() {
-				heartbeat = dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0), app.CrashedInstanceHeartbeatAtIndex(1))
-				store.SyncHeartbeats(heartbeat)
+			Context("when a different backoff strategy is configured", func() {
+				BeforeEach(func() {
+					conf.BackoffStrategy = "linear"
+				})
 
-				store.SyncDesiredState(
-					app.DesiredState(2),
-				)
+				AfterEach(func() {
+					conf.BackoffStrategy = "exponential"
+				})
+
+				It("should back off using that strategy", func() {
+					expectedDelays := []int64{0, 0, 0, 30, 60, 90, 120}
+
+					for _, expectedDelay := range expectedDelays {
+						err := analyzer.Analyze()
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(startMessages()[0].SendOn).Should(Equal(timeProvider.Time().Unix() + expectedDelay))
+						store.DeletePendingStartMessages(startMessages()...)
+					}
+				})
 			})
 
-			It("should only try to start the index 0", func() {
-				err := analyzer.Analyze()
-				Ω(err).ShouldNot(HaveOccurred())
-				Ω(startMessages()).Should(HaveLen(1))
-				Ω(startMessages()[0].IndexToStart).Should(Equal(0))
+			Context("when the configured backoff strategy does not exist", func() {
+				BeforeEach(func() {
+					conf.BackoffStrategy = "whenever"
+				})
+
+				AfterEach(func() {
+					conf.BackoffStrategy = "exponential"
+				})
+
+				It("should return an error and not enqueue anything", func() {
+					err := analyzer.Analyze()
+					Ω(err).Should(HaveOccurred())
+					Ω(startMessages()).Should(BeEmpty())
+				})
 			})
 		})
 
-		Context("When at least one instance is running and all others are crashed", func() {
+		Describe("quarantining crash-looping instances", func() {
+			var crashCount models.CrashCount
+
 			BeforeEach(func() {
-				heartbeat = dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0), app.CrashedInstanceHeartbeatAtIndex(1), app.InstanceAtIndex(2).Heartbeat())
-				store.SyncHeartbeats(heartbeat)
+				conf.NumberOfCrashesBeforeQuarantine = 3
+
+				heartbeat = dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0))
+				store.SyncHeartbeats(heartbeat)
+				store.SyncDesiredState(
+					app.DesiredState(1),
+				)
+
+				crashCount = models.CrashCount{
+					AppGuid:       app.AppGuid,
+					AppVersion:    app.AppVersion,
+					InstanceIndex: 0,
+					CrashCount:    3,
+					CreatedAt:     timeProvider.Time().Unix() - 100,
+				}
+			})
+
+			AfterEach(func() {
+				conf.NumberOfCrashesBeforeQuarantine = 0
+			})
+
+			Context("when the index has crashed enough times within the window", func() {
+				var err error
+
+				JustBeforeEach(func() {
+					store.SaveCrashCounts(crashCount)
+					err = analyzer.Analyze()
+				})
+
+				It("should not start the instance", func() {
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(startMessages()).Should(BeEmpty())
+				})
+
+				It("should quarantine the index", func() {
+					quarantines, _ := store.GetQuarantines()
+					Ω(quarantines).Should(Equal([]models.Quarantine{
+						{
+							AppGuid:       app.AppGuid,
+							AppVersion:    app.AppVersion,
+							InstanceIndex: 0,
+							CrashCount:    3,
+							QuarantinedAt: timeProvider.Time().Unix(),
+						},
+					}))
+				})
+
+				It("should announce the quarantine over NATS", func() {
+					quarantines, _ := store.GetQuarantines()
+					Ω(messageBus.PublishedMessages["hm9000.quarantined"]).Should(HaveLen(1))
+					Ω(messageBus.PublishedMessages["hm9000.quarantined"][0].Payload).Should(MatchJSON(quarantines[0].ToJSON()))
+				})
+
+				It("should record the quarantine in the app's history", func() {
+					history, _ := store.GetAppHistory(app.AppGuid)
+					Ω(history).Should(HaveLen(1))
+					Ω(history[0].EventType).Should(Equal(models.AppHistoryEventQuarantined))
+				})
+
+				Context("when analyzing again", func() {
+					It("should neither start the instance nor announce the quarantine again", func() {
+						err := analyzer.Analyze()
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(startMessages()).Should(BeEmpty())
+						Ω(messageBus.PublishedMessages["hm9000.quarantined"]).Should(HaveLen(1))
+					})
+				})
+
+				Context("when the quarantine cannot be announced", func() {
+					BeforeEach(func() {
+						messageBus.PublishError = errors.New("oops")
+					})
+
+					It("should return an error", func() {
+						Ω(err).Should(Equal(errors.New("oops")))
+					})
+				})
+			})
+
+			Context("when the index has not crashed enough times yet", func() {
+				BeforeEach(func() {
+					crashCount.CrashCount = 2
+					store.SaveCrashCounts(crashCount)
+				})
+
+				It("should start the instance and not quarantine it", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(startMessages()).Should(HaveLen(1))
+					quarantines, _ := store.GetQuarantines()
+					Ω(quarantines).Should(BeEmpty())
+				})
+			})
+
+			Context("when the crashes are spread out over more than the window", func() {
+				BeforeEach(func() {
+					crashCount.CreatedAt = timeProvider.Time().Add(-2 * conf.QuarantineCrashWindow()).Unix()
+					store.SaveCrashCounts(crashCount)
+				})
+
+				It("should start the instance and not quarantine it", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(startMessages()).Should(HaveLen(1))
+					quarantines, _ := store.GetQuarantines()
+					Ω(quarantines).Should(BeEmpty())
+				})
+			})
+
+			Context("when the crash count has decayed since it was created, and the index has crashed enough times since", func() {
+				BeforeEach(func() {
+					crashCount.CreatedAt = timeProvider.Time().Add(-2 * conf.QuarantineCrashWindow()).Unix()
+					crashCount.LastResetAt = timeProvider.Time().Unix() - 100
+					store.SaveCrashCounts(crashCount)
+				})
+
+				It("should measure the crashes from the decay, and quarantine the index", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(startMessages()).Should(BeEmpty())
+					quarantines, _ := store.GetQuarantines()
+					Ω(quarantines).Should(HaveLen(1))
+					Ω(quarantines[0].InstanceIndex).Should(Equal(0))
+				})
+			})
+
+			Context("when quarantining is disabled", func() {
+				BeforeEach(func() {
+					conf.NumberOfCrashesBeforeQuarantine = 0
+					store.SaveCrashCounts(crashCount)
+				})
+
+				It("should keep starting the instance", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(startMessages()).Should(HaveLen(1))
+					Ω(messageBus.PublishedMessages).Should(BeEmpty())
+				})
+			})
+
+			Context("when the index is already quarantined", func() {
+				BeforeEach(func() {
+					store.SaveQuarantines(models.Quarantine{
+						AppGuid:       app.AppGuid,
+						AppVersion:    app.AppVersion,
+						InstanceIndex: 0,
+						CrashCount:    3,
+					})
+				})
+
+				It("should not start the crashed instance", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(startMessages()).Should(BeEmpty())
+				})
+
+				Context("and the crashed instance is no longer reported", func() {
+					BeforeEach(func() {
+						store.SyncHeartbeats(dea.HeartbeatWith())
+					})
+
+					It("should not start a missing instance on that index either", func() {
+						err := analyzer.Analyze()
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(startMessages()).Should(BeEmpty())
+					})
+				})
+			})
+		})
+
+		Describe("decaying crash counts", func() {
+			var (
+				runningHeartbeat models.InstanceHeartbeat
+				crashCount       models.CrashCount
+			)
+
+			crashCountAtIndex0 := func() models.CrashCount {
+				apps, _ := store.GetApps()
+				return apps[app.AppGuid+","+app.AppVersion].CrashCounts[0]
+			}
+
+			BeforeEach(func() {
+				conf.CrashCountStablePeriodInHeartbeats = 6
+
+				runningHeartbeat = app.InstanceAtIndex(0).Heartbeat()
+				runningHeartbeat.StateTimestamp = float64(timeProvider.Time().Unix() - 100)
+				store.SyncDesiredState(app.DesiredState(1))
+
+				crashCount = models.CrashCount{
+					AppGuid:       app.AppGuid,
+					AppVersion:    app.AppVersion,
+					InstanceIndex: 0,
+					CrashCount:    5,
+					CreatedAt:     timeProvider.Time().Unix() - 1000,
+					LastCrashedAt: timeProvider.Time().Unix() - 150,
+				}
+			})
+
+			JustBeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(runningHeartbeat))
+				store.SaveCrashCounts(crashCount)
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				conf.CrashCountStablePeriodInHeartbeats = 0
+				conf.CrashCountDecay = "reset"
+			})
+
+			Context("when the instance has been running for longer than the stable period", func() {
+				It("should reset the crash count", func() {
+					Ω(crashCountAtIndex0().CrashCount).Should(Equal(0))
+					Ω(crashCountAtIndex0().LastResetAt).Should(Equal(timeProvider.Time().Unix()))
+					Ω(crashCountAtIndex0().LastCrashedAt).Should(Equal(crashCount.LastCrashedAt))
+				})
+
+				It("should record the decay in the app's history", func() {
+					history, _ := store.GetAppHistory(app.AppGuid)
+					Ω(history).Should(HaveLen(1))
+					Ω(history[0].EventType).Should(Equal(models.AppHistoryEventCrashCountDecayed))
+				})
+
+				Context("when configured to decrement", func() {
+					BeforeEach(func() {
+						conf.CrashCountDecay = "decrement"
+					})
+
+					It("should decrement the crash count", func() {
+						Ω(crashCountAtIndex0().CrashCount).Should(Equal(4))
+					})
+
+					Context("and the crash count was decayed recently", func() {
+						BeforeEach(func() {
+							crashCount.LastResetAt = timeProvider.Time().Unix() - 30
+						})
+
+						It("should wait for another stable period", func() {
+							Ω(crashCountAtIndex0()).Should(Equal(crashCount))
+						})
+					})
+				})
+			})
+
+			Context("when the instance has not been running for the stable period", func() {
+				BeforeEach(func() {
+					runningHeartbeat.StateTimestamp = float64(timeProvider.Time().Unix() - 30)
+				})
+
+				It("should leave the crash count alone", func() {
+					Ω(crashCountAtIndex0()).Should(Equal(crashCount))
+				})
+			})
+
+			Context("when the instance last crashed within the stable period", func() {
+				BeforeEach(func() {
+					crashCount.LastCrashedAt = timeProvider.Time().Unix() - 30
+				})
+
+				It("should leave the crash count alone", func() {
+					Ω(crashCountAtIndex0()).Should(Equal(crashCount))
+				})
+			})
+
+			Context("when the index is not running", func() {
+				BeforeEach(func() {
+					runningHeartbeat = app.CrashedInstanceHeartbeatAtIndex(0)
+				})
+
+				It("should record when the instance crashed", func() {
+					Ω(crashCountAtIndex0().CrashCount).Should(Equal(6))
+					Ω(crashCountAtIndex0().LastCrashedAt).Should(Equal(timeProvider.Time().Unix()))
+				})
+			})
+
+			Context("when decay is disabled", func() {
+				BeforeEach(func() {
+					conf.CrashCountStablePeriodInHeartbeats = 0
+				})
+
+				It("should leave the crash count alone", func() {
+					Ω(crashCountAtIndex0()).Should(Equal(crashCount))
+				})
+			})
+		})
+
+		Context("When all instances are crashed", func() {
+			BeforeEach(func() {
+				heartbeat = dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0), app.CrashedInstanceHeartbeatAtIndex(1))
+				store.SyncHeartbeats(heartbeat)
+
+				store.SyncDesiredState(
+					app.DesiredState(2),
+				)
+			})
+
+			It("should only try to start the index 0", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0].IndexToStart).Should(Equal(0))
+			})
+		})
+
+		Context("When at least one instance is running and all others are crashed", func() {
+			BeforeEach(func() {
+				heartbeat = dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0), app.CrashedInstanceHeartbeatAtIndex(1), app.InstanceAtIndex(2).Heartbeat())
+				store.SyncHeartbeats(heartbeat)
 
 				store.SyncDesiredState(
 					app.DesiredState(3),
 				)
 			})
 
-			It("should only try to start the index 0", func() {
+			It("should only try to start the index 0", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(2))
+				indexesToStart := []int{}
+				for _, message := range startMessages() {
+					indexesToStart = append(indexesToStart, message.IndexToStart)
+				}
+				Ω(indexesToStart).Should(ContainElement(0))
+				Ω(indexesToStart).Should(ContainElement(1))
+			})
+		})
+	})
+
+	Describe("Applying per-app policies", func() {
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			otherApp = dea.GetApp(1)
+		})
+
+		Context("when the app overrides the grace period", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1), otherApp.DesiredState(1))
+				store.SaveAppPolicies(models.AppPolicy{
+					AppGuid:                 app.AppGuid,
+					GracePeriodInHeartbeats: 6,
+				})
+			})
+
+			It("should delay starting the app's missing instances by the overridden grace period", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(startMessages()).Should(HaveLen(2))
+
+				expectedMessage := models.NewPendingStartMessage(timeProvider.Time(), 60, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expectedMessage)))
+
+				expectedMessage = models.NewPendingStartMessage(timeProvider.Time(), conf.GracePeriod(), 0, otherApp.AppGuid, otherApp.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expectedMessage)))
+			})
+		})
+
+		Context("when the app overrides the backoff settings", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0)))
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SaveAppPolicies(models.AppPolicy{
+					AppGuid:                            app.AppGuid,
+					NumberOfCrashesBeforeBackoffBegins: 1,
+					MaximumBackoffDelayInHeartbeats:    6,
+				})
+			})
+
+			It("should back off using the app's settings", func() {
+				expectedDelays := []int64{0, 30, 60, 60, 60}
+
+				for _, expectedDelay := range expectedDelays {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(startMessages()[0].SendOn).Should(Equal(timeProvider.Time().Unix() + expectedDelay))
+					store.DeletePendingStartMessages(startMessages()...)
+				}
+			})
+		})
+
+		Context("when the app should never be restarted", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.CrashedInstanceHeartbeatAtIndex(0),
+					otherApp.CrashedInstanceHeartbeatAtIndex(0),
+				))
+				store.SyncDesiredState(app.DesiredState(2), otherApp.DesiredState(1))
+				store.SaveAppPolicies(models.AppPolicy{
+					AppGuid:      app.AppGuid,
+					NeverRestart: true,
+				})
+			})
+
+			It("should not restart the app's crashed instances, but should still start its missing instances", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(startMessages()).Should(HaveLen(2))
+
+				expectedMessage := models.NewPendingStartMessage(timeProvider.Time(), conf.GracePeriod(), 0, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonMissing)
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expectedMessage)))
+
+				expectedMessage = models.NewPendingStartMessage(timeProvider.Time(), 0, conf.GracePeriod(), otherApp.AppGuid, otherApp.AppVersion, 0, 1.0, models.PendingStartMessageReasonCrashed)
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expectedMessage)))
+			})
+		})
+
+		Context("when the app should not have its duplicates stopped", func() {
+			BeforeEach(func() {
+				duplicateInstance := app.InstanceAtIndex(0)
+				duplicateInstance.InstanceGuid = models.Guid()
+
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					duplicateInstance.Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+				))
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SaveAppPolicies(models.AppPolicy{
+					AppGuid:             app.AppGuid,
+					DoNotStopDuplicates: true,
+				})
+			})
+
+			It("should leave the duplicates alone but still stop extra instances", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(stopMessages()).Should(HaveLen(1))
+				Ω(stopMessages()[0].InstanceGuid).Should(Equal(app.InstanceAtIndex(1).InstanceGuid))
+				Ω(stopMessages()[0].StopReason).Should(Equal(models.PendingStopMessageReasonExtra))
+			})
+		})
+
+		Context("when the policies cannot be fetched", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1))
+				storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("policies", errors.New("oops"))
+			})
+
+			It("should return an error and not enqueue anything", func() {
+				err := analyzer.Analyze()
+				Ω(err).Should(Equal(errors.New("oops")))
+				Ω(startMessages()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Skipping dead-lettered messages", func() {
+		var deadLetteredStart models.PendingStartMessage
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			otherApp = dea.GetApp(1)
+			store.SyncDesiredState(app.DesiredState(2), otherApp.DesiredState(1))
+			store.SyncHeartbeats(dea.HeartbeatWith(otherApp.InstanceAtIndex(0).Heartbeat(), otherApp.InstanceAtIndex(1).Heartbeat()))
+
+			deadLetteredStart = models.NewPendingStartMessage(time.Unix(1, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1, models.PendingStartMessageReasonMissing)
+			deadLetteredStop := models.NewPendingStopMessage(time.Unix(1, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, otherApp.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonExtra)
+			store.SaveDeadLetters(
+				models.NewStartDeadLetter(time.Unix(1, 0), deadLetteredStart, models.NewStartSendAttempts(deadLetteredStart)),
+				models.NewStopDeadLetter(time.Unix(1, 0), deadLetteredStop, models.NewStopSendAttempts(deadLetteredStop)),
+			)
+		})
+
+		It("should not enqueue messages that have been dead-lettered", func() {
+			err := analyzer.Analyze()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(startMessages()).Should(HaveLen(1))
+			Ω(startMessages()[0].IndexToStart).Should(Equal(1))
+			Ω(stopMessages()).Should(BeEmpty())
+		})
+
+		It("should record that the messages were skipped in the app's history", func() {
+			analyzer.Analyze()
+			history, err := store.GetAppHistory(app.AppGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+			otherHistory, err := store.GetAppHistory(otherApp.AppGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			skipped := []models.AppHistoryEventType{}
+			for _, event := range append(history, otherHistory...) {
+				if event.Description == "message is dead-lettered (see `hm9000 dead_letters`)" {
+					skipped = append(skipped, event.EventType)
+				}
+			}
+			Ω(skipped).Should(ConsistOf(models.AppHistoryEventStartSkipped, models.AppHistoryEventStopSkipped))
+		})
+
+		Context("when the dead-lettered start is for a crashed instance", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0), otherApp.InstanceAtIndex(0).Heartbeat(), otherApp.InstanceAtIndex(1).Heartbeat()))
+				store.SaveCrashCounts(models.CrashCount{
+					AppGuid:       app.AppGuid,
+					AppVersion:    app.AppVersion,
+					InstanceIndex: 0,
+					CrashCount:    2,
+					CreatedAt:     timeProvider.Time().Unix() - 100,
+				})
+			})
+
+			It("should not count the crash again on every pass", func() {
+				for i := 0; i < 3; i++ {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				apps, _ := store.GetApps()
+				Ω(apps[app.AppGuid+","+app.AppVersion].CrashCounts[0].CrashCount).Should(Equal(2))
+				for _, start := range startMessages() {
+					Ω(start.IndexToStart).ShouldNot(Equal(0))
+				}
+			})
+		})
+
+		Context("once the dead letter has been purged", func() {
+			BeforeEach(func() {
+				deadLetters, _ := store.GetDeadLetters()
+				store.DeleteDeadLetters(deadLetters["start-"+deadLetteredStart.StoreKey()])
+			})
+
+			It("should enqueue the message again", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("The mass stop circuit breaker", func() {
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			otherApp = dea.GetApp(1)
+
+			conf.MassStopThresholdPercentage = 50
+
+			store.SyncDesiredState(app.DesiredState(1), otherApp.DesiredState(1))
+			store.SyncHeartbeats(dea.HeartbeatWith(
+				app.InstanceAtIndex(0).Heartbeat(),
+				app.InstanceAtIndex(1).Heartbeat(),
+				app.InstanceAtIndex(2).Heartbeat(),
+				otherApp.InstanceAtIndex(0).Heartbeat(),
+			))
+		})
+
+		AfterEach(func() {
+			conf.MassStopThresholdPercentage = 0
+		})
+
+		Context("when the stops are within the threshold", func() {
+			It("should enqueue the stops", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stopMessages()).Should(HaveLen(2))
+				Ω(metricsAccountant.MassStopCircuitBreakerTrips).Should(BeZero())
+			})
+		})
+
+		Context("when the stops exceed the threshold", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(otherApp.DesiredState(2))
+			})
+
+			It("should refuse to enqueue any stops, but should still enqueue starts", func() {
 				err := analyzer.Analyze()
 				Ω(err).ShouldNot(HaveOccurred())
-				Ω(startMessages()).Should(HaveLen(2))
-				indexesToStart := []int{}
-				for _, message := range startMessages() {
-					indexesToStart = append(indexesToStart, message.IndexToStart)
+				Ω(stopMessages()).Should(BeEmpty())
+				Ω(startMessages()).Should(HaveLen(1))
+			})
+
+			It("should track the trip", func() {
+				analyzer.Analyze()
+				Ω(metricsAccountant.MassStopCircuitBreakerTrips).Should(Equal(1))
+				Ω(metricsAccountant.RefusedStops).Should(Equal(3))
+			})
+
+			It("should record the refused stops in the app's history", func() {
+				analyzer.Analyze()
+				history, _ := store.GetAppHistory(app.AppGuid)
+				Ω(history).Should(HaveLen(3))
+				for _, event := range history {
+					Ω(event.EventType).Should(Equal(models.AppHistoryEventStopRefused))
+					Ω(event.Description).Should(Equal("mass stop circuit breaker tripped"))
 				}
-				Ω(indexesToStart).Should(ContainElement(0))
-				Ω(indexesToStart).Should(ContainElement(1))
+			})
+
+			It("should describe the refused stops when planning", func() {
+				plan, err := analyzer.Plan()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(plan.MassStopCircuitBreakerTripped).Should(BeTrue())
+				Ω(plan.StopMessages()).Should(BeEmpty())
+				Ω(plan.RefusedStopMessages()).Should(HaveLen(3))
+				Ω(plan.Describe()).Should(ContainElement("  Refused Stops (mass stop circuit breaker):"))
+			})
+
+			Context("when mass stops have been allowed", func() {
+				BeforeEach(func() {
+					store.AllowMassStops(timeProvider.Time())
+				})
+
+				It("should enqueue the stops", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(stopMessages()).Should(HaveLen(3))
+					Ω(metricsAccountant.MassStopCircuitBreakerTrips).Should(BeZero())
+				})
+			})
+
+			Context("when the override cannot be fetched", func() {
+				BeforeEach(func() {
+					store.AllowMassStops(timeProvider.Time())
+					storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("mass-stop-override", errors.New("oops"))
+				})
+
+				It("should refuse to enqueue the stops", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(stopMessages()).Should(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Describe("Selecting the policy", func() {
+		BeforeEach(func() {
+			store.SyncDesiredState(app.DesiredState(1))
+		})
+
+		AfterEach(func() {
+			conf.AnalyzerPolicy = "default"
+		})
+
+		Context("when an alternative policy is configured", func() {
+			BeforeEach(func() {
+				RegisterPolicy("never-start", neverStartPolicy{})
+				conf.AnalyzerPolicy = "never-start"
+			})
+
+			It("should use it to analyze the apps", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(BeEmpty())
+			})
+		})
+
+		Context("when an unknown policy is configured", func() {
+			BeforeEach(func() {
+				conf.AnalyzerPolicy = "capricious"
+			})
+
+			It("should return an error and not analyze anything", func() {
+				err := analyzer.Analyze()
+				Ω(err).Should(HaveOccurred())
+				Ω(startMessages()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Comparing against a shadow policy", func() {
+		BeforeEach(func() {
+			RegisterPolicy("never-start", neverStartPolicy{})
+			store.SyncDesiredState(app.DesiredState(3))
+		})
+
+		AfterEach(func() {
+			conf.AnalyzerPolicy = "default"
+			conf.AnalyzerShadowPolicy = ""
+		})
+
+		Context("when no shadow policy is configured", func() {
+			It("should not compare anything", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(metricsAccountant.ShadowPolicyDiffsTracked).Should(BeZero())
+
+				diffs, _ := store.GetShadowPolicyDiffs()
+				Ω(diffs).Should(BeEmpty())
+			})
+		})
+
+		Context("when the shadow policy agrees with the policy", func() {
+			BeforeEach(func() {
+				conf.AnalyzerShadowPolicy = "default"
+			})
+
+			It("should record that there were no diffs", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(3))
+
+				Ω(metricsAccountant.ShadowPolicyDiffsTracked).Should(Equal(1))
+				Ω(metricsAccountant.TrackedDiffsOnlyInPolicy).Should(BeZero())
+				Ω(metricsAccountant.TrackedDiffsOnlyInShadow).Should(BeZero())
+
+				diffs, _ := store.GetShadowPolicyDiffs()
+				Ω(diffs).Should(BeEmpty())
+			})
+		})
+
+		Context("when only the policy produces messages", func() {
+			BeforeEach(func() {
+				conf.AnalyzerShadowPolicy = "never-start"
+			})
+
+			It("should act on the policy and record the diffs", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(3))
+
+				Ω(metricsAccountant.TrackedDiffsOnlyInPolicy).Should(Equal(3))
+				Ω(metricsAccountant.TrackedDiffsOnlyInShadow).Should(BeZero())
+
+				diffs, _ := store.GetShadowPolicyDiffs()
+				Ω(diffs).Should(HaveLen(3))
+				indices := []int{}
+				for _, diff := range diffs {
+					Ω(diff.OnlyIn).Should(Equal(models.ShadowPolicyDiffOnlyInPolicy))
+					Ω(diff.Policy).Should(Equal("default"))
+					Ω(diff.ShadowPolicy).Should(Equal("never-start"))
+					Ω(diff.AppGuid).Should(Equal(app.AppGuid))
+					Ω(diff.MessageType).Should(Equal("start"))
+					indices = append(indices, diff.IndexToStart)
+					Ω(diff.Reason).Should(Equal(string(models.PendingStartMessageReasonMissing)))
+					Ω(diff.Timestamp).Should(BeNumerically("==", 1000))
+				}
+				Ω(indices).Should(ConsistOf(0, 1, 2))
+			})
+		})
+
+		Context("when only the shadow policy produces messages", func() {
+			BeforeEach(func() {
+				conf.AnalyzerPolicy = "never-start"
+				conf.AnalyzerShadowPolicy = "default"
+			})
+
+			It("should never save the shadow policy's messages", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(BeEmpty())
+
+				history, _ := store.GetAppHistory(app.AppGuid)
+				Ω(history).Should(BeEmpty())
+
+				Ω(metricsAccountant.TrackedDiffsOnlyInPolicy).Should(BeZero())
+				Ω(metricsAccountant.TrackedDiffsOnlyInShadow).Should(Equal(3))
+
+				diffs, _ := store.GetShadowPolicyDiffs()
+				Ω(diffs).Should(HaveLen(3))
+				for _, diff := range diffs {
+					Ω(diff.OnlyIn).Should(Equal(models.ShadowPolicyDiffOnlyInShadow))
+				}
+			})
+		})
+
+		Context("when the shadow policy is unknown", func() {
+			BeforeEach(func() {
+				conf.AnalyzerShadowPolicy = "capricious"
+			})
+
+			It("should analyze as usual without comparing anything", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(3))
+				Ω(metricsAccountant.ShadowPolicyDiffsTracked).Should(BeZero())
+			})
+		})
+
+		Context("when the store fails to record the diffs", func() {
+			BeforeEach(func() {
+				conf.AnalyzerShadowPolicy = "never-start"
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("shadow-policy-diffs", errors.New("oops"))
+			})
+
+			It("should not fail the analysis", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(3))
+				Ω(metricsAccountant.TrackedDiffsOnlyInPolicy).Should(Equal(3))
 			})
 		})
 	})
@@ -766,9 +1920,236 @@ var _ = Describe("Analyzer", func() {
 			expectedStopMessage := models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, app.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonExtra)
 			Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedStopMessage)))
 
-			expectedStopMessage = models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), undesiredApp.AppGuid, undesiredApp.AppVersion, undesiredApp.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra)
+			expectedStopMessage = models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), undesiredApp.AppGuid, undesiredApp.AppVersion, undesiredApp.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonOutdatedVersion)
 			Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedStopMessage)))
 		})
+
+		Context("when the apps are analyzed by several workers", func() {
+			summarize := func(plan Plan) []string {
+				summary := []string{}
+				for _, appPlan := range plan.Apps {
+					for _, message := range appPlan.StartMessages {
+						summary = append(summary, fmt.Sprintf("start %s,%s,%d", message.AppGuid, message.AppVersion, message.IndexToStart))
+					}
+					for _, message := range appPlan.StopMessages {
+						summary = append(summary, fmt.Sprintf("stop %s,%s,%s", message.AppGuid, message.AppVersion, message.InstanceGuid))
+					}
+				}
+				return summary
+			}
+
+			AfterEach(func() {
+				conf.AnalyzerNumberOfWorkers = 10
+			})
+
+			It("should produce the same plan as a single worker would", func() {
+				conf.AnalyzerNumberOfWorkers = 1
+				serialPlan, err := analyzer.Plan()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				conf.AnalyzerNumberOfWorkers = 3
+				for i := 0; i < 10; i++ {
+					parallelPlan, err := analyzer.Plan()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(summarize(parallelPlan)).Should(Equal(summarize(serialPlan)))
+				}
+			})
+
+			It("should track how long the pass took and how many apps each worker analyzed", func() {
+				conf.AnalyzerNumberOfWorkers = 3
+
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(metricsAccountant.TrackedAnalysisTime).Should(BeNumerically(">", 0))
+				Ω(metricsAccountant.TrackedAppsAnalyzedByWorker).Should(HaveLen(3))
+
+				totalAppsAnalyzed := 0
+				for _, appsAnalyzed := range metricsAccountant.TrackedAppsAnalyzedByWorker {
+					totalAppsAnalyzed += appsAnalyzed
+				}
+				Ω(totalAppsAnalyzed).Should(Equal(4))
+			})
+		})
+	})
+
+	Describe("Incremental analysis", func() {
+		var otherApp appfixture.AppFixture
+
+		numberOfAppsAnalyzed := func(plan Plan) int {
+			total := 0
+			for _, appsAnalyzed := range plan.AppsAnalyzedByWorker {
+				total += appsAnalyzed
+			}
+			return total
+		}
+
+		BeforeEach(func() {
+			conf.AnalyzerFullSweepIntervalInHeartbeats = 6
+
+			otherApp = dea.GetApp(1)
+			store.SyncDesiredState(
+				app.DesiredState(1),
+				otherApp.DesiredState(1),
+			)
+			store.SyncHeartbeats(dea.HeartbeatWith(
+				app.InstanceAtIndex(0).Heartbeat(),
+				otherApp.InstanceAtIndex(0).Heartbeat(),
+			))
+		})
+
+		AfterEach(func() {
+			conf.AnalyzerFullSweepIntervalInHeartbeats = 0
+		})
+
+		It("should start with a full sweep and clear the dirty apps it analyzed", func() {
+			plan, err := analyzer.Plan()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(plan.FullSweep).Should(BeTrue())
+			Ω(plan.DirtyAppKeys).Should(HaveLen(2))
+			Ω(numberOfAppsAnalyzed(plan)).Should(Equal(2))
+
+			err = analyzer.Analyze()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			dirtyAppKeys, err := store.GetDirtyAppKeys()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dirtyAppKeys).Should(BeEmpty())
+		})
+
+		Context("after the first full sweep", func() {
+			BeforeEach(func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				store.SyncDesiredState(
+					app.DesiredState(2),
+					otherApp.DesiredState(1),
+				)
+			})
+
+			It("should only analyze the apps that changed", func() {
+				plan, err := analyzer.Plan()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(plan.FullSweep).Should(BeFalse())
+				Ω(plan.DirtyAppKeys).Should(Equal([]string{store.AppKey(app.AppGuid, app.AppVersion)}))
+				Ω(numberOfAppsAnalyzed(plan)).Should(Equal(1))
+
+				err = analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0].IndexToStart).Should(Equal(1))
+
+				dirtyAppKeys, err := store.GetDirtyAppKeys()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(dirtyAppKeys).Should(BeEmpty())
+			})
+
+			It("should do another full sweep once the full sweep interval has passed", func() {
+				timeProvider.TimeToProvide = timeProvider.Time().Add(conf.AnalyzerFullSweepInterval())
+
+				plan, err := analyzer.Plan()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(plan.FullSweep).Should(BeTrue())
+				Ω(numberOfAppsAnalyzed(plan)).Should(Equal(2))
+			})
+
+			Context("when fetching the dirty apps fails", func() {
+				BeforeEach(func() {
+					storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("dirty", errors.New("oops"))
+				})
+
+				It("should return the error", func() {
+					_, err := analyzer.Plan()
+					Ω(err).Should(Equal(errors.New("oops")))
+				})
+			})
+		})
+	})
+
+	Describe("Planning without saving (dry run)", func() {
+		BeforeEach(func() {
+			store.SyncDesiredState(
+				app.DesiredState(2),
+			)
+			crashedHeartbeat := app.InstanceAtIndex(1).Heartbeat()
+			crashedHeartbeat.State = models.InstanceStateCrashed
+			store.SyncHeartbeats(dea.HeartbeatWith(
+				app.InstanceAtIndex(0).Heartbeat(),
+				crashedHeartbeat,
+			))
+		})
+
+		It("should return the messages and crash counts it would enqueue", func() {
+			plan, err := analyzer.Plan()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(plan.Timestamp).Should(Equal(timeProvider.Time().Unix()))
+			Ω(plan.Apps).Should(HaveLen(1))
+
+			appPlan := plan.Apps[0]
+			Ω(appPlan.AppGuid).Should(Equal(app.AppGuid))
+			Ω(appPlan.AppVersion).Should(Equal(app.AppVersion))
+
+			expectedMessage := models.NewPendingStartMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, 1, 0.5, models.PendingStartMessageReasonCrashed)
+			Ω(appPlan.StartMessages).Should(HaveLen(1))
+			Ω(appPlan.StartMessages[0]).Should(EqualPendingStartMessage(expectedMessage))
+			Ω(appPlan.StopMessages).Should(BeEmpty())
+
+			Ω(appPlan.CrashCounts).Should(HaveLen(1))
+			Ω(appPlan.CrashCounts[0].InstanceIndex).Should(Equal(1))
+			Ω(appPlan.CrashCounts[0].CrashCount).Should(Equal(1))
+
+			Ω(plan.Describe()).Should(ContainElement("    [1] reason:CRASHED priority:0.50 delay:0s keep_alive:30s"))
+			Ω(plan.Describe()).Should(ContainElement("    [1] 0 -> 1"))
+		})
+
+		It("should not write anything to the store", func() {
+			_, err := analyzer.Plan()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(startMessages()).Should(BeEmpty())
+			Ω(stopMessages()).Should(BeEmpty())
+
+			app, err := store.GetApp(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(app.CrashCounts).Should(BeEmpty())
+		})
+
+		It("should save exactly the plan it returned when the plan is applied", func() {
+			plan, err := analyzer.Plan()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			//the store changes between planning and applying; Apply saves the plan as it was
+			store.SyncHeartbeats(app.Heartbeat(2))
+
+			err = analyzer.Apply(plan)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(startMessages()).Should(HaveLen(1))
+			Ω(startMessages()[0].IndexToStart).Should(Equal(1))
+			Ω(stopMessages()).Should(BeEmpty())
+		})
+
+		Context("when there is nothing to do", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(app.Heartbeat(2))
+			})
+
+			It("should return an empty plan", func() {
+				plan, err := analyzer.Plan()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(plan.IsEmpty()).Should(BeTrue())
+			})
+		})
+
+		Context("when the store is not fresh", func() {
+			BeforeEach(func() {
+				storeAdapter.Reset()
+			})
+
+			It("should return an error", func() {
+				_, err := analyzer.Plan()
+				Ω(err).Should(HaveOccurred())
+			})
+		})
 	})
 
 	Context("When the store is not fresh and/or fails to fetch data", func() {
@@ -825,5 +2206,20 @@ var _ = Describe("Analyzer", func() {
 				Ω(stopMessages()).Should(BeEmpty())
 			})
 		})
+
+		Context("when the dead letters fail to fetch", func() {
+			BeforeEach(func() {
+				store.BumpActualFreshness(time.Unix(10, 0))
+				store.BumpDesiredFreshness(time.Unix(10, 0))
+				storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("dead-letters", errors.New("oops!"))
+			})
+
+			It("should return the store's error and not send any start/stop messages", func() {
+				err := analyzer.Analyze()
+				Ω(err).Should(Equal(errors.New("oops!")))
+				Ω(startMessages()).Should(BeEmpty())
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+		})
 	})
 })
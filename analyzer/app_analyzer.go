@@ -11,43 +11,59 @@ import (
 
 type appAnalyzer struct {
 	app                          *models.App
+	desiredVersion               *models.App
 	conf                         *config.Config
 	existingPendingStartMessages map[string]models.PendingStartMessage
 	existingPendingStopMessages  map[string]models.PendingStopMessage
+	backoffStrategy              BackoffStrategy
+	policy                       models.AppPolicy
 	currentTime                  time.Time
 	logger                       logger.Logger
 
 	startMessages map[string]models.PendingStartMessage
 	stopMessages  map[string]models.PendingStopMessage
 	crashCounts   []models.CrashCount
+	quarantines   []models.Quarantine
+	history       []models.AppHistoryEvent
 }
 
-func newAppAnalyzer(app *models.App, currentTime time.Time, existingPendingStartMessages map[string]models.PendingStartMessage, existingPendingStopMessages map[string]models.PendingStopMessage, logger logger.Logger, conf *config.Config) *appAnalyzer {
+func newAppAnalyzer(app *models.App, desiredVersion *models.App, currentTime time.Time, existingPendingStartMessages map[string]models.PendingStartMessage, existingPendingStopMessages map[string]models.PendingStopMessage, backoffStrategy BackoffStrategy, policy models.AppPolicy, logger logger.Logger, conf *config.Config) *appAnalyzer {
 	return &appAnalyzer{
-		app:  app,
-		conf: conf,
+		app:                          app,
+		desiredVersion:               desiredVersion,
+		conf:                         conf,
 		existingPendingStartMessages: existingPendingStartMessages,
 		existingPendingStopMessages:  existingPendingStopMessages,
+		backoffStrategy:              backoffStrategy,
+		policy:                       policy,
 		currentTime:                  currentTime,
 		logger:                       logger,
 		startMessages:                make(map[string]models.PendingStartMessage, 0),
 		stopMessages:                 make(map[string]models.PendingStopMessage, 0),
 		crashCounts:                  make([]models.CrashCount, 0),
+		quarantines:                  make([]models.Quarantine, 0),
+		history:                      make([]models.AppHistoryEvent, 0),
 	}
 }
 
-func (a *appAnalyzer) analyzeApp() (map[string]models.PendingStartMessage, map[string]models.PendingStopMessage, []models.CrashCount) {
+func (a *appAnalyzer) analyzeApp() AppPlan {
 	priority := a.computePendingStartMessagePriority()
 	a.generatePendingStartsForMissingInstances(priority)
 	a.generatePendingStartsForCrashedInstances(priority)
 	a.generatePendingStartsAndStopsForEvacuatingInstances()
+	a.generatePendingStartsAndStopsForStuckStartingInstances(priority)
+	a.decayCrashCountsForStableInstances()
 
 	if len(a.startMessages) == 0 {
-		a.generatePendingStopsForExtraInstances()
+		if a.isOutdatedVersion() {
+			a.generatePendingStopsForOutdatedVersionInstances()
+		} else {
+			a.generatePendingStopsForExtraInstances()
+		}
 		a.generatePendingStopsForDuplicateInstances()
 	}
 
-	return a.startMessages, a.stopMessages, a.crashCounts
+	return NewAppPlan(a.app, a.startMessages, a.stopMessages, a.crashCounts, a.quarantines, a.history)
 }
 
 func (a *appAnalyzer) generatePendingStartsForMissingInstances(priority float64) {
@@ -56,7 +72,7 @@ func (a *appAnalyzer) generatePendingStartsForMissingInstances(priority float64)
 	}
 
 	for index := 0; a.app.IsIndexDesired(index); index++ {
-		if !a.app.HasStartingOrRunningInstanceAtIndex(index) && !a.app.HasCrashedInstanceAtIndex(index) {
+		if !a.app.HasStartingOrRunningInstanceAtIndex(index) && !a.app.HasCrashedInstanceAtIndex(index) && !a.app.IsIndexQuarantined(index) {
 			message := models.NewPendingStartMessage(a.currentTime, a.conf.GracePeriod(), 0, a.app.AppGuid, a.app.AppVersion, index, priority, models.PendingStartMessageReasonMissing)
 
 			a.appendStartMessageIfNotDuplicate(message, "Identified missing instance", map[string]string{
@@ -69,7 +85,7 @@ func (a *appAnalyzer) generatePendingStartsForMissingInstances(priority float64)
 }
 
 func (a *appAnalyzer) generatePendingStartsForCrashedInstances(priority float64) (crashCounts []models.CrashCount) {
-	if !a.app.IsStaged() {
+	if !a.app.IsStaged() || a.policy.NeverRestart {
 		return
 	}
 
@@ -79,8 +95,17 @@ func (a *appAnalyzer) generatePendingStartsForCrashedInstances(priority float64)
 				continue
 			}
 
+			if a.app.IsIndexQuarantined(index) {
+				continue
+			}
+
 			crashCount := a.app.CrashCountAtIndex(index, a.currentTime)
-			delay := a.computeDelayForCrashCount(crashCount)
+			if a.shouldQuarantine(crashCount) {
+				a.quarantine(crashCount)
+				continue
+			}
+
+			delay := a.backoffStrategy.ComputeDelay(crashCount.CrashCount)
 			message := models.NewPendingStartMessage(a.currentTime, delay, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, index, priority, models.PendingStartMessageReasonCrashed)
 
 			didAppend := a.appendStartMessageIfNotDuplicate(message, "Identified crashed instance", map[string]string{
@@ -90,6 +115,7 @@ func (a *appAnalyzer) generatePendingStartsForCrashedInstances(priority float64)
 
 			if didAppend {
 				crashCount.CrashCount += 1
+				crashCount.LastCrashedAt = a.currentTime.Unix()
 				a.crashCounts = append(a.crashCounts, crashCount)
 			}
 		}
@@ -98,6 +124,121 @@ func (a *appAnalyzer) generatePendingStartsForCrashedInstances(priority float64)
 	return
 }
 
+//An index is quarantined once it has crashed NumberOfCrashesBeforeQuarantine times
+//at a rate of at least that many crashes per QuarantineCrashWindow.
+//The rate is measured from the last time the crash count decayed, if it has, since the count restarted there.
+func (a *appAnalyzer) shouldQuarantine(crashCount models.CrashCount) bool {
+	threshold := a.conf.NumberOfCrashesBeforeQuarantine
+	if threshold <= 0 || crashCount.CrashCount < threshold {
+		return false
+	}
+
+	countingSince := crashCount.CreatedAt
+	if crashCount.LastResetAt != 0 && crashCount.LastResetAt > countingSince {
+		countingSince = crashCount.LastResetAt
+	}
+
+	window := a.conf.QuarantineCrashWindow()
+	elapsed := a.currentTime.Sub(time.Unix(countingSince, 0))
+	if elapsed <= window {
+		return true
+	}
+
+	return float64(crashCount.CrashCount)/elapsed.Seconds() >= float64(threshold)/window.Seconds()
+}
+
+func (a *appAnalyzer) quarantine(crashCount models.CrashCount) {
+	quarantine := models.Quarantine{
+		AppGuid:       a.app.AppGuid,
+		AppVersion:    a.app.AppVersion,
+		InstanceIndex: crashCount.InstanceIndex,
+		CrashCount:    crashCount.CrashCount,
+		QuarantinedAt: a.currentTime.Unix(),
+	}
+
+	a.logger.Info("Quarantining crash-looping instance", quarantine.LogDescription(), map[string]string{
+		"Desired # of Instances": strconv.Itoa(a.app.NumberOfDesiredInstances()),
+	})
+	a.history = append(a.history, models.NewAppHistoryEvent(a.currentTime, "analyzer", models.AppHistoryEventQuarantined, "Quarantining crash-looping instance", models.PendingMessage{
+		AppGuid:    a.app.AppGuid,
+		AppVersion: a.app.AppVersion,
+	}, quarantine.LogDescription()))
+	a.quarantines = append(a.quarantines, quarantine)
+}
+
+const (
+	ResetCrashCountDecayName     = "reset"
+	DecrementCrashCountDecayName = "decrement"
+)
+
+//decayCrashCountsForStableInstances resets (or decrements) the crash count of every index
+//that has been RUNNING, without crashing, for at least the CrashCountStablePeriod
+func (a *appAnalyzer) decayCrashCountsForStableInstances() {
+	stablePeriod := a.conf.CrashCountStablePeriod()
+	if stablePeriod <= 0 {
+		return
+	}
+
+	for index := 0; a.app.IsIndexDesired(index); index++ {
+		crashCount, found := a.app.CrashCounts[index]
+		if !found || crashCount.CrashCount == 0 {
+			continue
+		}
+
+		runningSince, isRunning := a.runningSinceAtIndex(index)
+		if !isRunning {
+			continue
+		}
+
+		stableSince := runningSince
+		if crashCount.LastCrashedAt > stableSince {
+			stableSince = crashCount.LastCrashedAt
+		}
+		if crashCount.LastResetAt > stableSince {
+			stableSince = crashCount.LastResetAt
+		}
+
+		if a.currentTime.Sub(time.Unix(stableSince, 0)) < stablePeriod {
+			continue
+		}
+
+		previousCrashCount := crashCount.CrashCount
+		if a.conf.CrashCountDecay == DecrementCrashCountDecayName {
+			crashCount.CrashCount -= 1
+		} else {
+			crashCount.CrashCount = 0
+		}
+		crashCount.LastResetAt = a.currentTime.Unix()
+		a.crashCounts = append(a.crashCounts, crashCount)
+
+		details := map[string]string{
+			"InstanceIndex":        strconv.Itoa(index),
+			"Previous Crash Count": strconv.Itoa(previousCrashCount),
+			"Crash Count":          strconv.Itoa(crashCount.CrashCount),
+		}
+		a.logger.Info("Decaying crash count for stable instance", a.app.LogDescription(), details)
+		a.history = append(a.history, models.NewAppHistoryEvent(a.currentTime, "analyzer", models.AppHistoryEventCrashCountDecayed, "Decaying crash count for stable instance", models.PendingMessage{
+			AppGuid:    a.app.AppGuid,
+			AppVersion: a.app.AppVersion,
+		}, details))
+	}
+}
+
+//runningSinceAtIndex returns when the longest running RUNNING instance at the index entered the RUNNING state
+func (a *appAnalyzer) runningSinceAtIndex(index int) (runningSince int64, isRunning bool) {
+	for _, heartbeat := range a.app.InstanceHeartbeatsAtIndex(index) {
+		if !heartbeat.IsRunning() {
+			continue
+		}
+		if !isRunning || int64(heartbeat.StateTimestamp) < runningSince {
+			runningSince = int64(heartbeat.StateTimestamp)
+			isRunning = true
+		}
+	}
+
+	return runningSince, isRunning
+}
+
 func (a *appAnalyzer) generatePendingStopsForExtraInstances() {
 	for _, extraInstance := range a.app.ExtraStartingOrRunningInstances() {
 		message := models.NewPendingStopMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, extraInstance.InstanceGuid, models.PendingStopMessageReasonExtra)
@@ -111,11 +252,48 @@ func (a *appAnalyzer) generatePendingStopsForExtraInstances() {
 	return
 }
 
+//An undesired app is an outdated version when a different version of the same app is desired
+func (a *appAnalyzer) isOutdatedVersion() bool {
+	return !a.app.IsDesired() && a.desiredVersion != nil && a.desiredVersion.AppVersion != a.app.AppVersion
+}
+
+//Instances of an outdated version are only stopped once the desired version has a RUNNING instance at their index.
+//This turns a version change into a rolling replacement.  Indices the desired version no longer wants are simply extra.
+func (a *appAnalyzer) generatePendingStopsForOutdatedVersionInstances() {
+	for _, outdatedInstance := range a.app.ExtraStartingOrRunningInstances() {
+		if !a.desiredVersion.IsIndexDesired(outdatedInstance.InstanceIndex) {
+			message := models.NewPendingStopMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, outdatedInstance.InstanceGuid, models.PendingStopMessageReasonExtra)
+
+			a.appendStopMessageIfNotDuplicate(message, "Identified extra running instance of an outdated version", map[string]string{
+				"InstanceIndex":          strconv.Itoa(outdatedInstance.InstanceIndex),
+				"Desired Version":        a.desiredVersion.AppVersion,
+				"Desired # of Instances": strconv.Itoa(a.desiredVersion.NumberOfDesiredInstances()),
+			})
+			continue
+		}
+
+		if !a.desiredVersion.HasRunningInstanceAtIndex(outdatedInstance.InstanceIndex) {
+			continue
+		}
+
+		message := models.NewPendingStopMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, outdatedInstance.InstanceGuid, models.PendingStopMessageReasonOutdatedVersion)
+
+		a.appendStopMessageIfNotDuplicate(message, "Identified instance of an outdated version that has been replaced", map[string]string{
+			"InstanceIndex":   strconv.Itoa(outdatedInstance.InstanceIndex),
+			"Desired Version": a.desiredVersion.AppVersion,
+		})
+	}
+}
+
 func (a *appAnalyzer) generatePendingStopsForDuplicateInstances() {
 	//stop duplicate instances at indices < numDesired
 	//this works by scheduling stops for *all* duplicate instances at increasing delays
 	//the sender will process the stops one at a time and only send stops that don't put
 	//the system in an invalid state
+	if a.policy.DoNotStopDuplicates {
+		return
+	}
+
 	for index := 0; a.app.IsIndexDesired(index); index++ {
 		instances := a.app.StartingOrRunningInstancesAtIndex(index)
 		if len(instances) > 1 {
@@ -124,6 +302,9 @@ func (a *appAnalyzer) generatePendingStopsForDuplicateInstances() {
 			for i, instance := range instances {
 				delay := i*a.conf.GracePeriod() + minimumDuplicateInstanceStopDelay
 				message := models.NewPendingStopMessage(a.currentTime, delay, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, instance.InstanceGuid, models.PendingStopMessageReasonDuplicate)
+				if _, alreadyStopping := a.stopMessages[message.StoreKey()]; alreadyStopping {
+					continue
+				}
 
 				a.appendStopMessageIfNotDuplicate(message, "Identified duplicate running instance", map[string]string{
 					"InstanceIndex": strconv.Itoa(instance.InstanceIndex),
@@ -177,14 +358,48 @@ func (a *appAnalyzer) generatePendingStartsAndStopsForEvacuatingInstances() {
 	}
 }
 
+//An instance that has been STARTING for longer than the StartingTimeout is stopped.
+//If no other instance at its index is healthy, a replacement is started alongside it.
+func (a *appAnalyzer) generatePendingStartsAndStopsForStuckStartingInstances(priority float64) {
+	timeout := a.conf.StartingTimeout()
+	if timeout <= 0 || !a.app.IsStaged() {
+		return
+	}
+
+	for index := 0; a.app.IsIndexDesired(index); index++ {
+		stuckInstances := a.app.StuckStartingInstancesAtIndex(index, a.currentTime, timeout)
+		if len(stuckInstances) == 0 {
+			continue
+		}
+
+		for _, stuckInstance := range stuckInstances {
+			message := models.NewPendingStopMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, stuckInstance.InstanceGuid, models.PendingStopMessageReasonStuckStarting)
+
+			a.appendStopMessageIfNotDuplicate(message, "Identified instance stuck in STARTING", map[string]string{
+				"Starting Timeout": timeout.String(),
+			})
+		}
+
+		if a.app.HasOnlyStuckStartingInstancesAtIndex(index, a.currentTime, timeout) {
+			message := models.NewPendingStartMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, index, priority, models.PendingStartMessageReasonStuckStarting)
+
+			a.appendStartMessageIfNotDuplicate(message, "Replacing instance stuck in STARTING", map[string]string{
+				"Desired # of Instances": strconv.Itoa(a.app.NumberOfDesiredInstances()),
+			})
+		}
+	}
+}
+
 func (a *appAnalyzer) appendStartMessageIfNotDuplicate(message models.PendingStartMessage, loggingMessage string, additionalDetails map[string]string) (didAppend bool) {
 	existingMessage, alreadyQueued := a.existingPendingStartMessages[message.StoreKey()]
 	if !alreadyQueued {
 		a.logger.Info(fmt.Sprintf("Enqueuing Start Message: %s", loggingMessage), message.LogDescription(), additionalDetails)
+		a.recordHistory(models.AppHistoryEventStartEnqueued, loggingMessage, message.PendingMessage, message.LogDescription(), additionalDetails)
 		a.startMessages[message.StoreKey()] = message
 		return true
 	} else {
 		a.logger.Info(fmt.Sprintf("Skipping Already Enqueued Start Message: %s", loggingMessage), existingMessage.LogDescription(), additionalDetails)
+		a.recordHistory(models.AppHistoryEventStartSkipped, loggingMessage, existingMessage.PendingMessage, existingMessage.LogDescription(), additionalDetails)
 		return false
 	}
 }
@@ -193,20 +408,28 @@ func (a *appAnalyzer) appendStopMessageIfNotDuplicate(message models.PendingStop
 	existingMessage, alreadyQueued := a.existingPendingStopMessages[message.StoreKey()]
 	if !alreadyQueued {
 		a.logger.Info(fmt.Sprintf("Enqueuing Stop Message: %s", loggingMessage), message.LogDescription(), additionalDetails)
+		a.recordHistory(models.AppHistoryEventStopEnqueued, loggingMessage, message.PendingMessage, message.LogDescription(), additionalDetails)
 		a.stopMessages[message.StoreKey()] = message
 	} else {
 		a.logger.Info(fmt.Sprintf("Skipping Already Enqueued Stop Message: %s", loggingMessage), existingMessage.LogDescription(), additionalDetails)
+		a.recordHistory(models.AppHistoryEventStopSkipped, loggingMessage, existingMessage.PendingMessage, existingMessage.LogDescription(), additionalDetails)
 	}
 }
 
+func (a *appAnalyzer) recordHistory(eventType models.AppHistoryEventType, description string, message models.PendingMessage, messageDetails map[string]string, additionalDetails map[string]string) {
+	details := map[string]string{}
+	for key, value := range messageDetails {
+		details[key] = value
+	}
+	for key, value := range additionalDetails {
+		details[key] = value
+	}
+
+	a.history = append(a.history, models.NewAppHistoryEvent(a.currentTime, "analyzer", eventType, description, message, details))
+}
+
 func (a *appAnalyzer) computePendingStartMessagePriority() float64 {
 	numberOfMissingIndices := a.app.NumberOfDesiredInstances() - a.app.NumberOfDesiredIndicesWithAStartingOrRunningInstance()
 
 	return float64(numberOfMissingIndices) / float64(a.app.NumberOfDesiredInstances())
 }
-
-func (a *appAnalyzer) computeDelayForCrashCount(crashCount models.CrashCount) (delay int) {
-	startingBackoffDelay := int(a.conf.StartingBackoffDelay().Seconds())
-	maximumBackoffDelay := int(a.conf.MaximumBackoffDelay().Seconds())
-	return ComputeCrashDelay(crashCount.CrashCount, a.conf.NumberOfCrashesBeforeBackoffBegins, startingBackoffDelay, maximumBackoffDelay)
-}
@@ -0,0 +1,26 @@
+package analyzer
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//configForAppPolicy returns a copy of conf with the policy's overrides applied.
+//The rest of the app analyzer then reads grace periods and backoff settings from the copy as usual.
+func configForAppPolicy(conf *config.Config, policy models.AppPolicy) *config.Config {
+	appConf := *conf
+
+	if policy.GracePeriodInHeartbeats > 0 {
+		appConf.GracePeriodInHeartbeats = uint64(policy.GracePeriodInHeartbeats)
+	}
+
+	if policy.MaximumBackoffDelayInHeartbeats > 0 {
+		appConf.MaximumBackoffDelayInHeartbeats = policy.MaximumBackoffDelayInHeartbeats
+	}
+
+	if policy.NumberOfCrashesBeforeBackoffBegins > 0 {
+		appConf.NumberOfCrashesBeforeBackoffBegins = policy.NumberOfCrashesBeforeBackoffBegins
+	}
+
+	return &appConf
+}
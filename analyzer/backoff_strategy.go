@@ -0,0 +1,198 @@
+package analyzer
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/cloudfoundry/hm9000/config"
+)
+
+//A BackoffStrategy computes how long (in seconds) to wait before restarting an instance
+//that has crashed crashCount times
+type BackoffStrategy interface {
+	ComputeDelay(crashCount int) (delay int)
+}
+
+const (
+	ExponentialBackoffStrategyName           = "exponential"
+	ExponentialWithJitterBackoffStrategyName = "exponential_with_jitter"
+	LinearBackoffStrategyName                = "linear"
+	FixedBackoffStrategyName                 = "fixed"
+	FibonacciBackoffStrategyName             = "fibonacci"
+)
+
+//NewBackoffStrategy builds the strategy named by conf.BackoffStrategy.
+//random is only used for jitter; it should be shared by every strategy so that delays computed at the same moment still differ.
+func NewBackoffStrategy(conf *config.Config, random *rand.Rand) (BackoffStrategy, error) {
+	numberOfCrashesBeforeBackoffBegins := conf.NumberOfCrashesBeforeBackoffBegins
+	startingDelay := int(conf.StartingBackoffDelay().Seconds())
+	maximumDelay := int(conf.MaximumBackoffDelay().Seconds())
+
+	switch conf.BackoffStrategy {
+	case ExponentialBackoffStrategyName, "":
+		return NewExponentialBackoffStrategy(numberOfCrashesBeforeBackoffBegins, startingDelay, maximumDelay), nil
+	case ExponentialWithJitterBackoffStrategyName:
+		return NewExponentialWithJitterBackoffStrategy(numberOfCrashesBeforeBackoffBegins, startingDelay, maximumDelay, random), nil
+	case LinearBackoffStrategyName:
+		return NewLinearBackoffStrategy(numberOfCrashesBeforeBackoffBegins, startingDelay, maximumDelay), nil
+	case FixedBackoffStrategyName:
+		return NewFixedBackoffStrategy(numberOfCrashesBeforeBackoffBegins, startingDelay), nil
+	case FibonacciBackoffStrategyName:
+		return NewFibonacciBackoffStrategy(numberOfCrashesBeforeBackoffBegins, startingDelay, maximumDelay), nil
+	default:
+		return nil, fmt.Errorf("Unknown backoff strategy: %s", conf.BackoffStrategy)
+	}
+}
+
+//NewLockedRand returns a rand.Rand that many goroutines can share
+func NewLockedRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{
+		source: rand.NewSource(seed),
+		lock:   &sync.Mutex{},
+	})
+}
+
+type lockedSource struct {
+	source rand.Source
+	lock   *sync.Mutex
+}
+
+func (source *lockedSource) Int63() int64 {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	return source.source.Int63()
+}
+
+func (source *lockedSource) Seed(seed int64) {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	source.source.Seed(seed)
+}
+
+//ExponentialBackoffStrategy doubles the delay with every crash (this is ComputeCrashDelay)
+type ExponentialBackoffStrategy struct {
+	numberOfCrashesBeforeBackoffBegins int
+	startingDelay                      int
+	maximumDelay                       int
+}
+
+func NewExponentialBackoffStrategy(numberOfCrashesBeforeBackoffBegins int, startingDelay int, maximumDelay int) *ExponentialBackoffStrategy {
+	return &ExponentialBackoffStrategy{
+		numberOfCrashesBeforeBackoffBegins: numberOfCrashesBeforeBackoffBegins,
+		startingDelay:                      startingDelay,
+		maximumDelay:                       maximumDelay,
+	}
+}
+
+func (strategy *ExponentialBackoffStrategy) ComputeDelay(crashCount int) int {
+	return ComputeCrashDelay(crashCount, strategy.numberOfCrashesBeforeBackoffBegins, strategy.startingDelay, strategy.maximumDelay)
+}
+
+//ExponentialWithJitterBackoffStrategy picks a random delay between half of the exponential delay and the exponential delay,
+//so that instances that crashed together are not all restarted together.
+//ComputeDelay is only safe for concurrent use if random is (see NewLockedRand).
+type ExponentialWithJitterBackoffStrategy struct {
+	exponential *ExponentialBackoffStrategy
+	random      *rand.Rand
+}
+
+func NewExponentialWithJitterBackoffStrategy(numberOfCrashesBeforeBackoffBegins int, startingDelay int, maximumDelay int, random *rand.Rand) *ExponentialWithJitterBackoffStrategy {
+	return &ExponentialWithJitterBackoffStrategy{
+		exponential: NewExponentialBackoffStrategy(numberOfCrashesBeforeBackoffBegins, startingDelay, maximumDelay),
+		random:      random,
+	}
+}
+
+func (strategy *ExponentialWithJitterBackoffStrategy) ComputeDelay(crashCount int) int {
+	delay := strategy.exponential.ComputeDelay(crashCount)
+	if delay == 0 {
+		return 0
+	}
+
+	halfDelay := delay / 2
+	return delay - halfDelay + strategy.random.Intn(halfDelay+1)
+}
+
+//LinearBackoffStrategy adds the starting delay with every crash
+type LinearBackoffStrategy struct {
+	numberOfCrashesBeforeBackoffBegins int
+	startingDelay                      int
+	maximumDelay                       int
+}
+
+func NewLinearBackoffStrategy(numberOfCrashesBeforeBackoffBegins int, startingDelay int, maximumDelay int) *LinearBackoffStrategy {
+	return &LinearBackoffStrategy{
+		numberOfCrashesBeforeBackoffBegins: numberOfCrashesBeforeBackoffBegins,
+		startingDelay:                      startingDelay,
+		maximumDelay:                       maximumDelay,
+	}
+}
+
+func (strategy *LinearBackoffStrategy) ComputeDelay(crashCount int) int {
+	if crashCount < strategy.numberOfCrashesBeforeBackoffBegins {
+		return 0
+	}
+
+	delay := strategy.startingDelay * (crashCount - strategy.numberOfCrashesBeforeBackoffBegins + 1)
+	if delay > strategy.maximumDelay {
+		return strategy.maximumDelay
+	}
+
+	return delay
+}
+
+//FixedBackoffStrategy always waits for the starting delay
+type FixedBackoffStrategy struct {
+	numberOfCrashesBeforeBackoffBegins int
+	delay                              int
+}
+
+func NewFixedBackoffStrategy(numberOfCrashesBeforeBackoffBegins int, delay int) *FixedBackoffStrategy {
+	return &FixedBackoffStrategy{
+		numberOfCrashesBeforeBackoffBegins: numberOfCrashesBeforeBackoffBegins,
+		delay:                              delay,
+	}
+}
+
+func (strategy *FixedBackoffStrategy) ComputeDelay(crashCount int) int {
+	if crashCount < strategy.numberOfCrashesBeforeBackoffBegins {
+		return 0
+	}
+
+	return strategy.delay
+}
+
+//FibonacciBackoffStrategy grows the delay along the fibonacci sequence (1, 1, 2, 3, 5, ... times the starting delay)
+type FibonacciBackoffStrategy struct {
+	numberOfCrashesBeforeBackoffBegins int
+	startingDelay                      int
+	maximumDelay                       int
+}
+
+func NewFibonacciBackoffStrategy(numberOfCrashesBeforeBackoffBegins int, startingDelay int, maximumDelay int) *FibonacciBackoffStrategy {
+	return &FibonacciBackoffStrategy{
+		numberOfCrashesBeforeBackoffBegins: numberOfCrashesBeforeBackoffBegins,
+		startingDelay:                      startingDelay,
+		maximumDelay:                       maximumDelay,
+	}
+}
+
+func (strategy *FibonacciBackoffStrategy) ComputeDelay(crashCount int) int {
+	if crashCount < strategy.numberOfCrashesBeforeBackoffBegins {
+		return 0
+	}
+
+	previous, current := 0, strategy.startingDelay
+	for i := strategy.numberOfCrashesBeforeBackoffBegins; i < crashCount; i++ {
+		previous, current = current, previous+current
+		if current >= strategy.maximumDelay {
+			return strategy.maximumDelay
+		}
+	}
+
+	if current > strategy.maximumDelay {
+		return strategy.maximumDelay
+	}
+	return current
+}
@@ -0,0 +1,150 @@
+package analyzer_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/analyzer"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/hm9000/config"
+)
+
+var _ = Describe("BackoffStrategy", func() {
+	delaysFor := func(strategy BackoffStrategy, crashCounts ...int) []int {
+		delays := []int{}
+		for _, crashCount := range crashCounts {
+			delays = append(delays, strategy.ComputeDelay(crashCount))
+		}
+		return delays
+	}
+
+	Describe("NewBackoffStrategy", func() {
+		var conf *config.Config
+
+		BeforeEach(func() {
+			conf, _ = config.DefaultConfig()
+		})
+
+		It("should default to the exponential strategy", func() {
+			strategy, err := NewBackoffStrategy(conf, NewLockedRand(17))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(strategy).Should(BeAssignableToTypeOf(&ExponentialBackoffStrategy{}))
+		})
+
+		It("should build the strategy named in the config", func() {
+			conf.BackoffStrategy = "exponential_with_jitter"
+			strategy, _ := NewBackoffStrategy(conf, NewLockedRand(17))
+			Ω(strategy).Should(BeAssignableToTypeOf(&ExponentialWithJitterBackoffStrategy{}))
+
+			conf.BackoffStrategy = "linear"
+			strategy, _ = NewBackoffStrategy(conf, NewLockedRand(17))
+			Ω(strategy).Should(BeAssignableToTypeOf(&LinearBackoffStrategy{}))
+
+			conf.BackoffStrategy = "fixed"
+			strategy, _ = NewBackoffStrategy(conf, NewLockedRand(17))
+			Ω(strategy).Should(BeAssignableToTypeOf(&FixedBackoffStrategy{}))
+
+			conf.BackoffStrategy = "fibonacci"
+			strategy, _ = NewBackoffStrategy(conf, NewLockedRand(17))
+			Ω(strategy).Should(BeAssignableToTypeOf(&FibonacciBackoffStrategy{}))
+		})
+
+		It("should use the backoff settings from the config", func() {
+			strategy, _ := NewBackoffStrategy(conf, NewLockedRand(17))
+			Ω(delaysFor(strategy, 2, 3, 4, 100)).Should(Equal([]int{0, 30, 60, 960}))
+		})
+
+		Context("when the strategy is unknown", func() {
+			It("should error", func() {
+				conf.BackoffStrategy = "whenever"
+				strategy, err := NewBackoffStrategy(conf, NewLockedRand(17))
+				Ω(err).Should(HaveOccurred())
+				Ω(strategy).Should(BeNil())
+			})
+		})
+	})
+
+	Describe("Exponential", func() {
+		It("should match ComputeCrashDelay", func() {
+			strategy := NewExponentialBackoffStrategy(3, 30, 960)
+			for crashCount := 0; crashCount < 12; crashCount++ {
+				Ω(strategy.ComputeDelay(crashCount)).Should(Equal(ComputeCrashDelay(crashCount, 3, 30, 960)))
+			}
+		})
+	})
+
+	Describe("Exponential with jitter", func() {
+		var strategy *ExponentialWithJitterBackoffStrategy
+
+		BeforeEach(func() {
+			strategy = NewExponentialWithJitterBackoffStrategy(3, 30, 960, NewLockedRand(17))
+		})
+
+		It("should not delay before the backoff begins", func() {
+			Ω(delaysFor(strategy, 0, 1, 2)).Should(Equal([]int{0, 0, 0}))
+		})
+
+		It("should pick a delay between half the exponential delay and the exponential delay", func() {
+			for i := 0; i < 100; i++ {
+				Ω(strategy.ComputeDelay(4)).Should(BeNumerically(">=", 30))
+				Ω(strategy.ComputeDelay(4)).Should(BeNumerically("<=", 60))
+				Ω(strategy.ComputeDelay(100)).Should(BeNumerically(">=", 480))
+				Ω(strategy.ComputeDelay(100)).Should(BeNumerically("<=", 960))
+			}
+		})
+
+		It("should spread out the delays", func() {
+			delays := map[int]bool{}
+			for i := 0; i < 100; i++ {
+				delays[strategy.ComputeDelay(100)] = true
+			}
+			Ω(len(delays)).Should(BeNumerically(">", 10))
+		})
+
+		It("should not repeat the delays of another strategy built from the same rand", func() {
+			random := NewLockedRand(17)
+			strategy = NewExponentialWithJitterBackoffStrategy(3, 30, 960, random)
+			otherStrategy := NewExponentialWithJitterBackoffStrategy(3, 30, 960, random)
+
+			Ω(delaysFor(strategy, 100, 100, 100, 100, 100)).ShouldNot(Equal(delaysFor(otherStrategy, 100, 100, 100, 100, 100)))
+		})
+
+		It("should be safe to share the rand between goroutines", func() {
+			random := NewLockedRand(17)
+			done := make(chan bool)
+			for i := 0; i < 10; i++ {
+				go func() {
+					defer GinkgoRecover()
+					strategy := NewExponentialWithJitterBackoffStrategy(3, 30, 960, random)
+					for j := 0; j < 100; j++ {
+						Ω(strategy.ComputeDelay(100)).Should(BeNumerically(">=", 480))
+					}
+					done <- true
+				}()
+			}
+			for i := 0; i < 10; i++ {
+				<-done
+			}
+		})
+	})
+
+	Describe("Linear", func() {
+		It("should add the starting delay with each crash and plateau at the maximum", func() {
+			strategy := NewLinearBackoffStrategy(3, 30, 100)
+			Ω(delaysFor(strategy, 0, 1, 2, 3, 4, 5, 6, 1000)).Should(Equal([]int{0, 0, 0, 30, 60, 90, 100, 100}))
+		})
+	})
+
+	Describe("Fixed", func() {
+		It("should always use the same delay once the backoff begins", func() {
+			strategy := NewFixedBackoffStrategy(3, 30)
+			Ω(delaysFor(strategy, 0, 2, 3, 4, 1000)).Should(Equal([]int{0, 0, 30, 30, 30}))
+		})
+	})
+
+	Describe("Fibonacci", func() {
+		It("should grow along the fibonacci sequence and plateau at the maximum", func() {
+			strategy := NewFibonacciBackoffStrategy(3, 30, 200)
+			Ω(delaysFor(strategy, 0, 2, 3, 4, 5, 6, 7, 8, 1000)).Should(Equal([]int{0, 0, 30, 30, 60, 90, 150, 200, 200}))
+		})
+	})
+})
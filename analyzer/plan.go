@@ -0,0 +1,301 @@
+package analyzer
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//A Plan describes everything a single analysis pass decided to do.
+//Apps the analyzer had nothing to say about are omitted.
+type Plan struct {
+	Timestamp int64
+	Apps      []AppPlan
+
+	MassStopCircuitBreakerTripped bool
+
+	//StuckStagings are apps that have just exceeded the staging timeout; they are reported, not acted upon
+	StuckStagings []models.PendingStaging
+
+	//FullSweep is false for incremental passes, which only analyze the apps in DirtyAppKeys.
+	//DirtyAppMarks holds the marks those apps had when they were fetched.
+	FullSweep     bool
+	DirtyAppKeys  []string
+	DirtyAppMarks map[string]string
+
+	//ShadowPolicy names the shadow policy that ran alongside the policy (if any); its plans are never saved, only compared
+	ShadowPolicy      string
+	ShadowPolicyDiffs []models.ShadowPolicyDiff
+
+	//Duration and AppsAnalyzedByWorker describe the analysis pass itself
+	Duration             time.Duration
+	AppsAnalyzedByWorker []int
+}
+
+type AppPlan struct {
+	AppGuid    string
+	AppVersion string
+
+	StartMessages []models.PendingStartMessage
+	StopMessages  []models.PendingStopMessage
+	CrashCounts   []models.CrashCount
+	Quarantines   []models.Quarantine
+	History       []models.AppHistoryEvent
+
+	RefusedStopMessages []models.PendingStopMessage
+}
+
+//NewAppPlan builds the plan for a single app; the messages are ordered by store key so that plans are deterministic
+func NewAppPlan(app *models.App, startMessages map[string]models.PendingStartMessage, stopMessages map[string]models.PendingStopMessage, crashCounts []models.CrashCount, quarantines []models.Quarantine, history []models.AppHistoryEvent) AppPlan {
+	appPlan := AppPlan{
+		AppGuid:       app.AppGuid,
+		AppVersion:    app.AppVersion,
+		StartMessages: []models.PendingStartMessage{},
+		StopMessages:  []models.PendingStopMessage{},
+		CrashCounts:   crashCounts,
+		Quarantines:   quarantines,
+		History:       history,
+
+		RefusedStopMessages: []models.PendingStopMessage{},
+	}
+
+	startKeys := sort.StringSlice{}
+	for key := range startMessages {
+		startKeys = append(startKeys, key)
+	}
+	sort.Sort(startKeys)
+	for _, key := range startKeys {
+		appPlan.StartMessages = append(appPlan.StartMessages, startMessages[key])
+	}
+
+	stopKeys := sort.StringSlice{}
+	for key := range stopMessages {
+		stopKeys = append(stopKeys, key)
+	}
+	sort.Sort(stopKeys)
+	for _, key := range stopKeys {
+		appPlan.StopMessages = append(appPlan.StopMessages, stopMessages[key])
+	}
+
+	return appPlan
+}
+
+func (plan Plan) StartMessages() []models.PendingStartMessage {
+	messages := []models.PendingStartMessage{}
+	for _, appPlan := range plan.Apps {
+		messages = append(messages, appPlan.StartMessages...)
+	}
+	return messages
+}
+
+func (plan Plan) StopMessages() []models.PendingStopMessage {
+	messages := []models.PendingStopMessage{}
+	for _, appPlan := range plan.Apps {
+		messages = append(messages, appPlan.StopMessages...)
+	}
+	return messages
+}
+
+func (plan Plan) RefusedStopMessages() []models.PendingStopMessage {
+	messages := []models.PendingStopMessage{}
+	for _, appPlan := range plan.Apps {
+		messages = append(messages, appPlan.RefusedStopMessages...)
+	}
+	return messages
+}
+
+//refuseStopMessages pulls every stop message out of the plan and records why in each app's history
+func (plan *Plan) refuseStopMessages(description string) {
+	for i := range plan.Apps {
+		appPlan := &plan.Apps[i]
+
+		refusedMessageIds := map[string]bool{}
+		for _, stop := range appPlan.StopMessages {
+			refusedMessageIds[stop.MessageId] = true
+		}
+
+		for j, event := range appPlan.History {
+			if event.EventType == models.AppHistoryEventStopEnqueued && refusedMessageIds[event.MessageId] {
+				appPlan.History[j].EventType = models.AppHistoryEventStopRefused
+				appPlan.History[j].Description = description
+			}
+		}
+
+		appPlan.RefusedStopMessages = append(appPlan.RefusedStopMessages, appPlan.StopMessages...)
+		appPlan.StopMessages = []models.PendingStopMessage{}
+	}
+	plan.MassStopCircuitBreakerTripped = true
+}
+
+//skipDeadLetteredMessages pulls the messages the sender has dead-lettered out of the plan and records why in each app's history.
+//They are enqueued again once the dead letter is requeued or purged.
+//A skipped start for a crashed instance takes its crash count increment with it, so the count doesn't climb on every pass.
+func (plan *Plan) skipDeadLetteredMessages(deadLetters map[string]models.DeadLetter) {
+	if len(deadLetters) == 0 {
+		return
+	}
+
+	for i := range plan.Apps {
+		appPlan := &plan.Apps[i]
+		skippedMessageIds := map[string]bool{}
+		skippedCrashedIndices := map[int]bool{}
+
+		startMessages := []models.PendingStartMessage{}
+		for _, start := range appPlan.StartMessages {
+			_, deadLettered := deadLetters[models.NewStartSendAttempts(start).StoreKey()]
+			if deadLettered {
+				skippedMessageIds[start.MessageId] = true
+				if start.StartReason == models.PendingStartMessageReasonCrashed {
+					skippedCrashedIndices[start.IndexToStart] = true
+				}
+			} else {
+				startMessages = append(startMessages, start)
+			}
+		}
+		appPlan.StartMessages = startMessages
+
+		crashCounts := []models.CrashCount{}
+		for _, crashCount := range appPlan.CrashCounts {
+			if !skippedCrashedIndices[crashCount.InstanceIndex] {
+				crashCounts = append(crashCounts, crashCount)
+			}
+		}
+		appPlan.CrashCounts = crashCounts
+
+		stopMessages := []models.PendingStopMessage{}
+		for _, stop := range appPlan.StopMessages {
+			_, deadLettered := deadLetters[models.NewStopSendAttempts(stop).StoreKey()]
+			if deadLettered {
+				skippedMessageIds[stop.MessageId] = true
+			} else {
+				stopMessages = append(stopMessages, stop)
+			}
+		}
+		appPlan.StopMessages = stopMessages
+
+		for j, event := range appPlan.History {
+			if !skippedMessageIds[event.MessageId] {
+				continue
+			}
+			if event.EventType == models.AppHistoryEventStartEnqueued {
+				appPlan.History[j].EventType = models.AppHistoryEventStartSkipped
+				appPlan.History[j].Description = "message is dead-lettered (see `hm9000 dead_letters`)"
+			} else if event.EventType == models.AppHistoryEventStopEnqueued {
+				appPlan.History[j].EventType = models.AppHistoryEventStopSkipped
+				appPlan.History[j].Description = "message is dead-lettered (see `hm9000 dead_letters`)"
+			}
+		}
+	}
+}
+
+func (plan Plan) CrashCounts() []models.CrashCount {
+	crashCounts := []models.CrashCount{}
+	for _, appPlan := range plan.Apps {
+		crashCounts = append(crashCounts, appPlan.CrashCounts...)
+	}
+	return crashCounts
+}
+
+func (plan Plan) Quarantines() []models.Quarantine {
+	quarantines := []models.Quarantine{}
+	for _, appPlan := range plan.Apps {
+		quarantines = append(quarantines, appPlan.Quarantines...)
+	}
+	return quarantines
+}
+
+func (plan Plan) History() []models.AppHistoryEvent {
+	history := []models.AppHistoryEvent{}
+	for _, appPlan := range plan.Apps {
+		history = append(history, appPlan.History...)
+	}
+	return history
+}
+
+func (plan Plan) IsEmpty() bool {
+	for _, appPlan := range plan.Apps {
+		if appPlan.hasChanges() {
+			return false
+		}
+	}
+	return true
+}
+
+//hasChanges is false for apps that only have history to record
+func (appPlan AppPlan) hasChanges() bool {
+	return len(appPlan.StartMessages) > 0 || len(appPlan.StopMessages) > 0 || len(appPlan.CrashCounts) > 0 || len(appPlan.Quarantines) > 0 || len(appPlan.RefusedStopMessages) > 0
+}
+
+//Describe renders the plan as indented, human readable lines (in the same spirit as `hm9000 dump`)
+func (plan Plan) Describe() []string {
+	lines := []string{}
+	for _, appPlan := range plan.Apps {
+		if !appPlan.hasChanges() {
+			continue
+		}
+
+		lines = append(lines, "Guid: "+appPlan.AppGuid+" | Version: "+appPlan.AppVersion)
+
+		if len(appPlan.StartMessages) > 0 {
+			lines = append(lines, "  Starts:")
+			for _, start := range appPlan.StartMessages {
+				lines = append(lines, "    ["+strconv.Itoa(start.IndexToStart)+"]"+
+					" reason:"+string(start.StartReason)+
+					" priority:"+strconv.FormatFloat(start.Priority, 'f', 2, 64)+
+					" delay:"+strconv.FormatInt(start.SendOn-plan.Timestamp, 10)+"s"+
+					" keep_alive:"+strconv.Itoa(start.KeepAlive)+"s")
+			}
+		}
+
+		if len(appPlan.StopMessages) > 0 {
+			lines = append(lines, "  Stops:")
+			for _, stop := range appPlan.StopMessages {
+				lines = append(lines, "    "+stop.InstanceGuid+
+					" reason:"+string(stop.StopReason)+
+					" delay:"+strconv.FormatInt(stop.SendOn-plan.Timestamp, 10)+"s"+
+					" keep_alive:"+strconv.Itoa(stop.KeepAlive)+"s")
+			}
+		}
+
+		if len(appPlan.RefusedStopMessages) > 0 {
+			lines = append(lines, "  Refused Stops (mass stop circuit breaker):")
+			for _, stop := range appPlan.RefusedStopMessages {
+				lines = append(lines, "    "+stop.InstanceGuid+
+					" reason:"+string(stop.StopReason))
+			}
+		}
+
+		if len(appPlan.CrashCounts) > 0 {
+			lines = append(lines, "  CrashCounts:")
+			for _, crashCount := range appPlan.CrashCounts {
+				if crashCount.LastResetAt == plan.Timestamp {
+					lines = append(lines, "    ["+strconv.Itoa(crashCount.InstanceIndex)+"]"+
+						" decayed to "+strconv.Itoa(crashCount.CrashCount))
+				} else {
+					lines = append(lines, "    ["+strconv.Itoa(crashCount.InstanceIndex)+"]"+
+						" "+strconv.Itoa(crashCount.CrashCount-1)+" -> "+strconv.Itoa(crashCount.CrashCount))
+				}
+			}
+		}
+
+		if len(appPlan.Quarantines) > 0 {
+			lines = append(lines, "  Quarantines:")
+			for _, quarantine := range appPlan.Quarantines {
+				lines = append(lines, "    ["+strconv.Itoa(quarantine.InstanceIndex)+"]"+
+					" crash_count:"+strconv.Itoa(quarantine.CrashCount))
+			}
+		}
+	}
+	return lines
+}
+
+func sortedAppKeys(apps map[string]*models.App) []string {
+	appKeys := sort.StringSlice{}
+	for appKey := range apps {
+		appKeys = append(appKeys, appKey)
+	}
+	sort.Sort(appKeys)
+	return appKeys
+}
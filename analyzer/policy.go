@@ -0,0 +1,68 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//A Policy decides what should happen to a single app: which instances to start and stop, and how its crash counts change.
+//The analyzer takes care of everything around it (fetching apps, the mass stop circuit breaker, saving the plan),
+//and calls Analyze for many apps concurrently, so a Policy must be safe for concurrent use.
+type Policy interface {
+	Analyze(input PolicyInput) AppPlan
+}
+
+//PolicyInput is everything a Policy gets to look at when analyzing an app
+type PolicyInput struct {
+	App *models.App
+	//DesiredVersion is the desired version of the app when App is not desired itself (nil if no version is desired)
+	DesiredVersion *models.App
+
+	ExistingPendingStartMessages map[string]models.PendingStartMessage
+	ExistingPendingStopMessages  map[string]models.PendingStopMessage
+
+	CurrentTime time.Time
+
+	//Conf already has the overrides of the app's AppPolicy applied, and BackoffStrategy is built from it
+	Conf            *config.Config
+	AppPolicy       models.AppPolicy
+	BackoffStrategy BackoffStrategy
+
+	Logger logger.Logger
+}
+
+const DefaultPolicyName = "default"
+
+var registeredPolicies = map[string]Policy{}
+
+//RegisterPolicy makes an alternative policy selectable by name (see `analyzer_policy` in the config).
+//It is meant to be called from an init function, before any analysis runs.
+func RegisterPolicy(name string, policy Policy) {
+	registeredPolicies[name] = policy
+}
+
+//NewPolicy returns the policy with the given name
+func NewPolicy(name string) (Policy, error) {
+	switch name {
+	case DefaultPolicyName, "":
+		return DefaultPolicy{}, nil
+	}
+
+	policy, found := registeredPolicies[name]
+	if !found {
+		return nil, fmt.Errorf("Unknown analyzer policy: %s", name)
+	}
+	return policy, nil
+}
+
+//DefaultPolicy is HM9000's standard behaviour: start missing and crashed instances (with backoff and quarantining),
+//stop extra, duplicate and outdated instances, and handle evacuating and stuck instances
+type DefaultPolicy struct{}
+
+func (policy DefaultPolicy) Analyze(input PolicyInput) AppPlan {
+	return newAppAnalyzer(input.App, input.DesiredVersion, input.CurrentTime, input.ExistingPendingStartMessages, input.ExistingPendingStopMessages, input.BackoffStrategy, input.AppPolicy, input.Logger, input.Conf).analyzeApp()
+}
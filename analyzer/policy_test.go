@@ -0,0 +1,92 @@
+package analyzer_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/analyzer"
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type neverStartPolicy struct{}
+
+func (policy neverStartPolicy) Analyze(input PolicyInput) AppPlan {
+	return AppPlan{AppGuid: input.App.AppGuid, AppVersion: input.App.AppVersion}
+}
+
+var _ = Describe("Policy", func() {
+	Describe("NewPolicy", func() {
+		It("should default to the default policy", func() {
+			policy, err := NewPolicy("")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy).Should(Equal(DefaultPolicy{}))
+
+			policy, err = NewPolicy("default")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy).Should(Equal(DefaultPolicy{}))
+		})
+
+		It("should return registered policies by name", func() {
+			RegisterPolicy("never-start", neverStartPolicy{})
+
+			policy, err := NewPolicy("never-start")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy).Should(Equal(neverStartPolicy{}))
+		})
+
+		It("should error for unknown policies", func() {
+			policy, err := NewPolicy("capricious")
+			Ω(err).Should(HaveOccurred())
+			Ω(policy).Should(BeNil())
+		})
+	})
+
+	Describe("ValidateConfig", func() {
+		var conf *config.Config
+
+		BeforeEach(func() {
+			conf, _ = config.DefaultConfig()
+		})
+
+		It("should accept the defaults", func() {
+			Ω(ValidateConfig(conf)).Should(Succeed())
+		})
+
+		It("should accept every backoff strategy and crash count decay, and the empty name as the default", func() {
+			for _, strategy := range []string{"", "exponential", "exponential_with_jitter", "linear", "fixed", "fibonacci"} {
+				conf.BackoffStrategy = strategy
+				Ω(ValidateConfig(conf)).Should(Succeed())
+			}
+			for _, decay := range []string{"", "reset", "decrement"} {
+				conf.CrashCountDecay = decay
+				Ω(ValidateConfig(conf)).Should(Succeed())
+			}
+		})
+
+		It("should accept registered policies, and no shadow policy", func() {
+			RegisterPolicy("never-start", neverStartPolicy{})
+			conf.AnalyzerPolicy = "never-start"
+			conf.AnalyzerShadowPolicy = "never-start"
+			Ω(ValidateConfig(conf)).Should(Succeed())
+
+			conf.AnalyzerShadowPolicy = ""
+			Ω(ValidateConfig(conf)).Should(Succeed())
+		})
+
+		It("should reject names the analyzer does not have", func() {
+			conf.BackoffStrategy = "whenever"
+			Ω(ValidateConfig(conf)).Should(MatchError("Unknown backoff strategy: whenever"))
+			conf.BackoffStrategy = ""
+
+			conf.CrashCountDecay = "halve"
+			Ω(ValidateConfig(conf)).Should(MatchError("Unknown crash count decay: halve"))
+			conf.CrashCountDecay = ""
+
+			conf.AnalyzerPolicy = "capricious"
+			Ω(ValidateConfig(conf)).Should(MatchError("Unknown analyzer policy: capricious"))
+			conf.AnalyzerPolicy = ""
+
+			conf.AnalyzerShadowPolicy = "capricious"
+			Ω(ValidateConfig(conf)).Should(MatchError("Unknown analyzer policy: capricious"))
+		})
+	})
+})
@@ -0,0 +1,97 @@
+package analyzer
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//shadowPolicy returns the configured shadow policy, or nil if there is none.
+//The shadow policy must never get in the way of the real analysis, so an unknown shadow policy is logged and ignored.
+func (analyzer *Analyzer) shadowPolicy() Policy {
+	if analyzer.conf.AnalyzerShadowPolicy == "" {
+		return nil
+	}
+
+	policy, err := NewPolicy(analyzer.conf.AnalyzerShadowPolicy)
+	if err != nil {
+		analyzer.logger.Error("Failed to select shadow analyzer policy, not running it", err)
+		return nil
+	}
+
+	return policy
+}
+
+//diffShadowPolicy compares, app by app, the messages the policy and the shadow policy produced from the same snapshot.
+//Only messages one side produced and the other did not are recorded; a message both produced for a different reason counts on both sides.
+func (analyzer *Analyzer) diffShadowPolicy(currentTime time.Time, appPlans []AppPlan, shadowAppPlans []AppPlan) []models.ShadowPolicyDiff {
+	policyName, shadowPolicyName := analyzer.conf.AnalyzerPolicy, analyzer.conf.AnalyzerShadowPolicy
+	diffs := []models.ShadowPolicyDiff{}
+
+	for i := range appPlans {
+		policyStarts, shadowStarts := startMessageKeys(appPlans[i]), startMessageKeys(shadowAppPlans[i])
+		for _, start := range appPlans[i].StartMessages {
+			if !shadowStarts[startMessageKey(start)] {
+				diffs = append(diffs, models.NewShadowPolicyStartDiff(currentTime, policyName, shadowPolicyName, models.ShadowPolicyDiffOnlyInPolicy, start))
+			}
+		}
+		for _, start := range shadowAppPlans[i].StartMessages {
+			if !policyStarts[startMessageKey(start)] {
+				diffs = append(diffs, models.NewShadowPolicyStartDiff(currentTime, policyName, shadowPolicyName, models.ShadowPolicyDiffOnlyInShadow, start))
+			}
+		}
+
+		policyStops, shadowStops := stopMessageKeys(appPlans[i]), stopMessageKeys(shadowAppPlans[i])
+		for _, stop := range appPlans[i].StopMessages {
+			if !shadowStops[stopMessageKey(stop)] {
+				diffs = append(diffs, models.NewShadowPolicyStopDiff(currentTime, policyName, shadowPolicyName, models.ShadowPolicyDiffOnlyInPolicy, stop))
+			}
+		}
+		for _, stop := range shadowAppPlans[i].StopMessages {
+			if !policyStops[stopMessageKey(stop)] {
+				diffs = append(diffs, models.NewShadowPolicyStopDiff(currentTime, policyName, shadowPolicyName, models.ShadowPolicyDiffOnlyInShadow, stop))
+			}
+		}
+	}
+
+	return diffs
+}
+
+func startMessageKey(start models.PendingStartMessage) string {
+	return start.StoreKey() + "/" + string(start.StartReason)
+}
+
+func stopMessageKey(stop models.PendingStopMessage) string {
+	return stop.StoreKey() + "/" + string(stop.StopReason)
+}
+
+func startMessageKeys(appPlan AppPlan) map[string]bool {
+	keys := map[string]bool{}
+	for _, start := range appPlan.StartMessages {
+		keys[startMessageKey(start)] = true
+	}
+	return keys
+}
+
+func stopMessageKeys(appPlan AppPlan) map[string]bool {
+	keys := map[string]bool{}
+	for _, stop := range appPlan.StopMessages {
+		keys[stopMessageKey(stop)] = true
+	}
+	return keys
+}
+
+//shadowLogger keeps the shadow policy quiet: its decisions are never acted upon, so logging them like the real policy's would mislead.
+//Errors are still worth seeing.
+type shadowLogger struct {
+	logger logger.Logger
+}
+
+func (l shadowLogger) Info(subject string, messages ...map[string]string) {}
+
+func (l shadowLogger) Debug(subject string, messages ...map[string]string) {}
+
+func (l shadowLogger) Error(subject string, err error, messages ...map[string]string) {
+	l.logger.Error("Shadow policy: "+subject, err, messages...)
+}
@@ -104,6 +104,7 @@ var _ = Describe("Apiserver", func() {
 					app.DesiredState(3),
 					instanceHeartbeats,
 					map[int]models.CrashCount{1: crashCount},
+					map[int]models.Quarantine{},
 				)
 
 				store.SyncDesiredState(app.DesiredState(3))
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/cloudfoundry/gosteno"
 	"io/ioutil"
 	"path/filepath"
@@ -25,6 +26,13 @@ type Config struct {
 	AnalyzerPollingIntervalInHeartbeats int `json:"analyzer_polling_interval_in_heartbeats"`
 	AnalyzerTimeoutInHeartbeats         int `json:"analyzer_timeout_in_heartbeats"`
 
+	AnalyzerNumberOfWorkers               int `json:"analyzer_number_of_workers"`
+	AnalyzerFullSweepIntervalInHeartbeats int `json:"analyzer_full_sweep_interval_in_heartbeats"`
+
+	AnalyzerPolicy                        string `json:"analyzer_policy"`
+	AnalyzerShadowPolicy                  string `json:"analyzer_shadow_policy"`
+	AnalyzerShadowPolicyDiffLogMaxEntries int    `json:"analyzer_shadow_policy_diff_log_max_entries"`
+
 	ListenerHeartbeatSyncIntervalInMilliseconds      int `json:"listener_heartbeat_sync_interval_in_milliseconds"`
 	StoreHeartbeatCacheRefreshIntervalInMilliseconds int `json:"store_heartbeat_cache_refresh_interval_in_milliseconds"`
 
@@ -37,6 +45,8 @@ type Config struct {
 	CCBaseURL                      string `json:"cc_base_url"`
 	SkipSSLVerification            bool   `json:"skip_cert_verify"`
 
+	DesiredStateShrinkThresholdPercentage int `json:"desired_state_shrink_threshold_percentage"`
+
 	StoreSchemaVersion         int      `json:"store_schema_version"`
 	StoreURLs                  []string `json:"store_urls"`
 	StoreMaxConcurrentRequests int      `json:"store_max_concurrent_requests"`
@@ -44,10 +54,57 @@ type Config struct {
 	SenderNatsStartSubject string `json:"sender_nats_start_subject"`
 	SenderNatsStopSubject  string `json:"sender_nats_stop_subject"`
 	SenderMessageLimit     int    `json:"sender_message_limit"`
+	SenderStopMessageLimit int    `json:"sender_stop_message_limit"`
+
+	SenderPerAppRateLimit             int `json:"sender_per_app_rate_limit"`
+	SenderPerDeaRateLimit             int `json:"sender_per_dea_rate_limit"`
+	SenderRateLimitPeriodInHeartbeats int `json:"sender_rate_limit_period_in_heartbeats"`
+
+	SenderNatsAckSubject         string `json:"sender_nats_ack_subject"`
+	SenderAckTimeoutInHeartbeats int    `json:"sender_ack_timeout_in_heartbeats"`
+
+	SenderDeadLetterThreshold          int `json:"sender_dead_letter_threshold"`
+	SenderDeadLetterWindowInHeartbeats int `json:"sender_dead_letter_window_in_heartbeats"`
+
+	SenderPublishRetries                       int `json:"sender_publish_retries"`
+	SenderPublishRetryBackoffInMilliseconds    int `json:"sender_publish_retry_backoff_in_milliseconds"`
+	SenderPublishMaxRetryBackoffInMilliseconds int `json:"sender_publish_max_retry_backoff_in_milliseconds"`
+	SenderPublishFailuresBeforeGivingUp        int `json:"sender_publish_failures_before_giving_up"`
+
+	SenderTransport                    string `json:"sender_transport"`
+	SenderWebhookStartURL              string `json:"sender_webhook_start_url"`
+	SenderWebhookStopURL               string `json:"sender_webhook_stop_url"`
+	SenderWebhookTimeoutInMilliseconds int    `json:"sender_webhook_timeout_in_milliseconds"`
+	SenderTransportFile                string `json:"sender_transport_file"`
+
+	SenderMessageSigningSecret              string `json:"sender_message_signing_secret"`
+	SenderSignatureReplayWindowInHeartbeats int    `json:"sender_signature_replay_window_in_heartbeats"`
+
+	StartPriorityAgingPerHeartbeat float64 `json:"start_priority_aging_per_heartbeat"`
+
+	NumberOfCrashesBeforeBackoffBegins int    `json:"number_of_crashes_before_backoff_begins"`
+	StartingBackoffDelayInHeartbeats   int    `json:"starting_backoff_delay_in_heartbeats"`
+	MaximumBackoffDelayInHeartbeats    int    `json:"maximum_backoff_delay_in_heartbeats"`
+	BackoffStrategy                    string `json:"backoff_strategy"`
 
-	NumberOfCrashesBeforeBackoffBegins int `json:"number_of_crashes_before_backoff_begins"`
-	StartingBackoffDelayInHeartbeats   int `json:"starting_backoff_delay_in_heartbeats"`
-	MaximumBackoffDelayInHeartbeats    int `json:"maximum_backoff_delay_in_heartbeats"`
+	CrashCountStablePeriodInHeartbeats int    `json:"crash_count_stable_period_in_heartbeats"`
+	CrashCountDecay                    string `json:"crash_count_decay"`
+
+	StartingTimeoutInHeartbeats int `json:"starting_timeout_in_heartbeats"`
+
+	StagingTimeoutInHeartbeats      int    `json:"staging_timeout_in_heartbeats"`
+	AnalyzerNatsStuckStagingSubject string `json:"analyzer_nats_stuck_staging_subject"`
+
+	NumberOfCrashesBeforeQuarantine   int    `json:"number_of_crashes_before_quarantine"`
+	QuarantineCrashWindowInHeartbeats int    `json:"quarantine_crash_window_in_heartbeats"`
+	AnalyzerNatsQuarantinedSubject    string `json:"analyzer_nats_quarantined_subject"`
+
+	MassStopThresholdInstances           int `json:"mass_stop_threshold_instances"`
+	MassStopThresholdPercentage          int `json:"mass_stop_threshold_percentage"`
+	MassStopOverrideDurationInHeartbeats int `json:"mass_stop_override_duration_in_heartbeats"`
+
+	AppHistoryTTLInHeartbeats int `json:"app_history_ttl_in_heartbeats"`
+	AppHistoryMaxEvents       int `json:"app_history_max_events"`
 
 	MetricsServerPort     int    `json:"metrics_server_port"`
 	MetricsServerUser     string `json:"metrics_server_user"`
@@ -74,9 +131,35 @@ func defaults() Config {
 
 		StoreMaxConcurrentRequests: 30,
 
+		DesiredStateShrinkThresholdPercentage: 0, // disabled
+
 		SenderNatsStartSubject: "hm9000.start",
 		SenderNatsStopSubject:  "hm9000.stop",
 		SenderMessageLimit:     60, // TODO: unit
+		SenderStopMessageLimit: 0,  // no limit
+
+		SenderPerAppRateLimit:             0, // disabled
+		SenderPerDeaRateLimit:             0, // disabled
+		SenderRateLimitPeriodInHeartbeats: 6,
+
+		SenderNatsAckSubject:         "", // disabled
+		SenderAckTimeoutInHeartbeats: 3,
+
+		SenderDeadLetterThreshold:          0, // disabled
+		SenderDeadLetterWindowInHeartbeats: 60,
+
+		SenderPublishRetries:                       2,
+		SenderPublishRetryBackoffInMilliseconds:    100,
+		SenderPublishMaxRetryBackoffInMilliseconds: 1000,
+		SenderPublishFailuresBeforeGivingUp:        3,
+
+		SenderTransport:                    "nats",
+		SenderWebhookTimeoutInMilliseconds: 5000,
+
+		SenderMessageSigningSecret:              "", // disabled
+		SenderSignatureReplayWindowInHeartbeats: 6,
+
+		StartPriorityAgingPerHeartbeat: 0, // disabled
 
 		SenderPollingIntervalInHeartbeats:   1,   // why?
 		SenderTimeoutInHeartbeats:           10,  // why?
@@ -87,9 +170,36 @@ func defaults() Config {
 		AnalyzerPollingIntervalInHeartbeats: 1,   // why?
 		AnalyzerTimeoutInHeartbeats:         10,  // why?
 
+		AnalyzerNumberOfWorkers:               10,
+		AnalyzerFullSweepIntervalInHeartbeats: 0, // disabled: every pass is a full sweep
+
+		AnalyzerPolicy:                        "default",
+		AnalyzerShadowPolicy:                  "", // disabled
+		AnalyzerShadowPolicyDiffLogMaxEntries: 1000,
+
 		NumberOfCrashesBeforeBackoffBegins: 3,
 		StartingBackoffDelayInHeartbeats:   3,  // why?
 		MaximumBackoffDelayInHeartbeats:    96, // why?
+		BackoffStrategy:                    "exponential",
+
+		CrashCountStablePeriodInHeartbeats: 0, // disabled
+		CrashCountDecay:                    "reset",
+
+		StartingTimeoutInHeartbeats: 0, // disabled
+
+		StagingTimeoutInHeartbeats:      0, // disabled
+		AnalyzerNatsStuckStagingSubject: "hm9000.stuck_staging",
+
+		NumberOfCrashesBeforeQuarantine:   0,    // disabled
+		QuarantineCrashWindowInHeartbeats: 8640, // one day
+		AnalyzerNatsQuarantinedSubject:    "hm9000.quarantined",
+
+		MassStopThresholdInstances:           0,  // disabled
+		MassStopThresholdPercentage:          0,  // disabled
+		MassStopOverrideDurationInHeartbeats: 30, // five minutes
+
+		AppHistoryTTLInHeartbeats: 8640, // one day
+		AppHistoryMaxEvents:       500,
 
 		ListenerHeartbeatSyncIntervalInMilliseconds:      1000,  // TODO: convert to time.Duration
 		StoreHeartbeatCacheRefreshIntervalInMilliseconds: 20000, // TODO: convert to time.Duration
@@ -131,6 +241,43 @@ func (conf *Config) SenderTimeout() time.Duration {
 	return time.Duration(conf.SenderTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
 }
 
+func (conf *Config) SenderRateLimitPeriod() time.Duration {
+	return time.Duration(conf.SenderRateLimitPeriodInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+//IsAckTrackingEnabled is true when the sender should wait for DEAs to acknowledge the messages it sends
+func (conf *Config) IsAckTrackingEnabled() bool {
+	return conf.SenderNatsAckSubject != ""
+}
+
+func (conf *Config) SenderAckTimeout() time.Duration {
+	return time.Duration(conf.SenderAckTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+func (conf *Config) SenderDeadLetterWindow() time.Duration {
+	return time.Duration(conf.SenderDeadLetterWindowInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+func (conf *Config) SenderPublishRetryBackoff() time.Duration {
+	return time.Millisecond * time.Duration(conf.SenderPublishRetryBackoffInMilliseconds)
+}
+
+func (conf *Config) SenderPublishMaxRetryBackoff() time.Duration {
+	return time.Millisecond * time.Duration(conf.SenderPublishMaxRetryBackoffInMilliseconds)
+}
+
+func (conf *Config) SenderWebhookTimeout() time.Duration {
+	return time.Millisecond * time.Duration(conf.SenderWebhookTimeoutInMilliseconds)
+}
+
+func (conf *Config) IsMessageSigningEnabled() bool {
+	return conf.SenderMessageSigningSecret != ""
+}
+
+func (conf *Config) SenderSignatureReplayWindow() time.Duration {
+	return time.Duration(conf.SenderSignatureReplayWindowInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
 func (conf *Config) FetcherPollingInterval() time.Duration {
 	return time.Duration(conf.FetcherPollingIntervalInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
 }
@@ -155,6 +302,10 @@ func (conf *Config) AnalyzerTimeout() time.Duration {
 	return time.Duration(conf.AnalyzerTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
 }
 
+func (conf *Config) AnalyzerFullSweepInterval() time.Duration {
+	return time.Duration(conf.AnalyzerFullSweepIntervalInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
 func (conf *Config) StartingBackoffDelay() time.Duration {
 	return time.Duration(conf.StartingBackoffDelayInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
 }
@@ -163,6 +314,62 @@ func (conf *Config) MaximumBackoffDelay() time.Duration {
 	return time.Duration(conf.MaximumBackoffDelayInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
 }
 
+func (conf *Config) CrashCountStablePeriod() time.Duration {
+	return time.Duration(conf.CrashCountStablePeriodInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+func (conf *Config) StartingTimeout() time.Duration {
+	return time.Duration(conf.StartingTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+func (conf *Config) StagingTimeout() time.Duration {
+	return time.Duration(conf.StagingTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+func (conf *Config) QuarantineCrashWindow() time.Duration {
+	return time.Duration(conf.QuarantineCrashWindowInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+func (conf *Config) StartPriorityAgingPerSecond() float64 {
+	return conf.StartPriorityAgingPerHeartbeat / float64(conf.HeartbeatPeriod)
+}
+
+func (conf *Config) MassStopOverrideDuration() time.Duration {
+	return time.Duration(conf.MassStopOverrideDurationInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
+//ExceedsDesiredStateShrinkThreshold is true when going from currentNumberOfApps to fetchedNumberOfApps
+//desired apps drops more apps than the desired state fetcher is willing to sync
+func (conf *Config) ExceedsDesiredStateShrinkThreshold(currentNumberOfApps int, fetchedNumberOfApps int) bool {
+	if conf.DesiredStateShrinkThresholdPercentage == 0 || fetchedNumberOfApps >= currentNumberOfApps {
+		return false
+	}
+
+	return (currentNumberOfApps-fetchedNumberOfApps)*100 > conf.DesiredStateShrinkThresholdPercentage*currentNumberOfApps
+}
+
+//ExceedsMassStopThreshold is true when stopping numberOfStops of the numberOfRunningInstances
+//in a single pass should trip the mass-stop circuit breaker
+func (conf *Config) ExceedsMassStopThreshold(numberOfStops int, numberOfRunningInstances int) bool {
+	if numberOfStops == 0 {
+		return false
+	}
+
+	if conf.MassStopThresholdInstances > 0 && numberOfStops > conf.MassStopThresholdInstances {
+		return true
+	}
+
+	if conf.MassStopThresholdPercentage > 0 && numberOfStops*100 > conf.MassStopThresholdPercentage*numberOfRunningInstances {
+		return true
+	}
+
+	return false
+}
+
+func (conf *Config) AppHistoryTTL() time.Duration {
+	return time.Duration(conf.AppHistoryTTLInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+}
+
 func (conf *Config) ListenerHeartbeatSyncInterval() time.Duration {
 	return time.Millisecond * time.Duration(conf.ListenerHeartbeatSyncIntervalInMilliseconds)
 }
@@ -201,9 +408,25 @@ func FromFile(path string) (*Config, error) {
 func FromJSON(JSON []byte) (*Config, error) {
 	config := defaults()
 	err := json.Unmarshal(JSON, &config)
-	if err == nil {
-		return &config, nil
-	} else {
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.validate()
+	if err != nil {
 		return nil, err
 	}
+
+	return &config, nil
+}
+
+//validate rejects settings that parse but that hm9000 cannot run with, so that they fail at startup rather than on every pass.
+//The names of strategies, policies and transports are checked by the packages that define them (see analyzer.ValidateConfig and sender.ValidateConfig).
+func (conf *Config) validate() error {
+	if conf.MassStopOverrideDurationInHeartbeats <= 0 {
+		//the override would be stored without a TTL and never expire
+		return errors.New("mass_stop_override_duration_in_heartbeats must be greater than 0")
+	}
+
+	return nil
 }
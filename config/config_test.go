@@ -1,6 +1,7 @@
 package config_test
 
 import (
+	"fmt"
 	"github.com/cloudfoundry/gosteno"
 	. "github.com/cloudfoundry/hm9000/config"
 	. "github.com/onsi/ginkgo"
@@ -26,12 +27,33 @@ var _ = Describe("Config", func() {
         "cc_auth_password": "testing",
         "cc_base_url": "http://127.0.0.1:6001",
         "skip_cert_verify": true,
+        "desired_state_shrink_threshold_percentage": 0,
         "store_schema_version": 1,
         "store_urls": ["http://127.0.0.1:4001"],
         "store_max_concurrent_requests": 30,
         "sender_nats_start_subject": "hm9000.start",
         "sender_nats_stop_subject": "hm9000.stop",
         "sender_message_limit": 60,
+        "sender_stop_message_limit": 0,
+        "sender_per_app_rate_limit": 0,
+        "sender_per_dea_rate_limit": 0,
+        "sender_rate_limit_period_in_heartbeats": 6,
+        "sender_nats_ack_subject": "",
+        "sender_ack_timeout_in_heartbeats": 3,
+        "sender_dead_letter_threshold": 0,
+        "sender_dead_letter_window_in_heartbeats": 60,
+        "sender_publish_retries": 2,
+        "sender_publish_retry_backoff_in_milliseconds": 100,
+        "sender_publish_max_retry_backoff_in_milliseconds": 1000,
+        "sender_publish_failures_before_giving_up": 3,
+        "sender_transport": "nats",
+        "sender_webhook_start_url": "",
+        "sender_webhook_stop_url": "",
+        "sender_webhook_timeout_in_milliseconds": 5000,
+        "sender_transport_file": "",
+        "sender_message_signing_secret": "",
+        "sender_signature_replay_window_in_heartbeats": 6,
+        "start_priority_aging_per_heartbeat": 0,
         "sender_polling_interval_in_heartbeats": 1,
         "sender_timeout_in_heartbeats": 10,
         "fetcher_polling_interval_in_heartbeats": 6,
@@ -40,11 +62,30 @@ var _ = Describe("Config", func() {
         "shredder_timeout_in_heartbeats": 6,
         "analyzer_polling_interval_in_heartbeats": 1,
         "analyzer_timeout_in_heartbeats": 10,
+        "analyzer_number_of_workers": 10,
+        "analyzer_full_sweep_interval_in_heartbeats": 0,
+        "analyzer_policy": "default",
+        "analyzer_shadow_policy": "",
+        "analyzer_shadow_policy_diff_log_max_entries": 1000,
         "number_of_crashes_before_backoff_begins": 3,
         "listener_heartbeat_sync_interval_in_milliseconds": 1000,
         "store_heartbeat_cache_refresh_interval_in_milliseconds": 20000,
         "starting_backoff_delay_in_heartbeats": 3,
         "maximum_backoff_delay_in_heartbeats": 96,
+        "backoff_strategy": "exponential",
+        "crash_count_stable_period_in_heartbeats": 0,
+        "crash_count_decay": "reset",
+        "starting_timeout_in_heartbeats": 0,
+        "staging_timeout_in_heartbeats": 0,
+        "analyzer_nats_stuck_staging_subject": "hm9000.stuck_staging",
+        "number_of_crashes_before_quarantine": 0,
+        "quarantine_crash_window_in_heartbeats": 8640,
+        "analyzer_nats_quarantined_subject": "hm9000.quarantined",
+        "mass_stop_threshold_instances": 0,
+        "mass_stop_threshold_percentage": 0,
+        "mass_stop_override_duration_in_heartbeats": 30,
+        "app_history_ttl_in_heartbeats": 8640,
+        "app_history_max_events": 500,
         "metrics_server_port": 7879,
         "metrics_server_user": "metrics_server_user",
         "metrics_server_password": "canHazMetrics?",
@@ -79,10 +120,35 @@ var _ = Describe("Config", func() {
 			Ω(config.ShredderTimeout().Minutes()).Should(BeNumerically("==", 1))
 			Ω(config.AnalyzerPollingInterval().Seconds()).Should(BeNumerically("==", 10))
 			Ω(config.AnalyzerTimeout().Seconds()).Should(BeNumerically("==", 100))
+			Ω(config.AnalyzerNumberOfWorkers).Should(Equal(10))
+			Ω(config.AnalyzerFullSweepInterval()).Should(BeZero())
+			Ω(config.AnalyzerPolicy).Should(Equal("default"))
+			Ω(config.AnalyzerShadowPolicy).Should(BeEmpty())
+			Ω(config.AnalyzerShadowPolicyDiffLogMaxEntries).Should(Equal(1000))
 
 			Ω(config.NumberOfCrashesBeforeBackoffBegins).Should(BeNumerically("==", 3))
 			Ω(config.StartingBackoffDelay().Seconds()).Should(BeNumerically("==", 30))
 			Ω(config.MaximumBackoffDelay().Seconds()).Should(BeNumerically("==", 960))
+			Ω(config.BackoffStrategy).Should(Equal("exponential"))
+
+			Ω(config.CrashCountStablePeriod()).Should(BeZero())
+			Ω(config.CrashCountDecay).Should(Equal("reset"))
+
+			Ω(config.StartingTimeout()).Should(BeZero())
+
+			Ω(config.StagingTimeout()).Should(BeZero())
+			Ω(config.AnalyzerNatsStuckStagingSubject).Should(Equal("hm9000.stuck_staging"))
+
+			Ω(config.NumberOfCrashesBeforeQuarantine).Should(Equal(0))
+			Ω(config.QuarantineCrashWindow().Hours()).Should(BeNumerically("==", 24))
+			Ω(config.AnalyzerNatsQuarantinedSubject).Should(Equal("hm9000.quarantined"))
+
+			Ω(config.MassStopThresholdInstances).Should(Equal(0))
+			Ω(config.MassStopThresholdPercentage).Should(Equal(0))
+			Ω(config.MassStopOverrideDuration().Minutes()).Should(BeNumerically("==", 5))
+
+			Ω(config.AppHistoryTTL().Hours()).Should(BeNumerically("==", 24))
+			Ω(config.AppHistoryMaxEvents).Should(Equal(500))
 
 			Ω(config.DesiredStateBatchSize).Should(BeNumerically("==", 500))
 			Ω(config.FetcherNetworkTimeout().Seconds()).Should(BeNumerically("==", 10))
@@ -92,6 +158,7 @@ var _ = Describe("Config", func() {
 			Ω(config.CCAuthPassword).Should(Equal("testing"))
 			Ω(config.CCBaseURL).Should(Equal("http://127.0.0.1:6001"))
 			Ω(config.SkipSSLVerification).Should(BeTrue())
+			Ω(config.DesiredStateShrinkThresholdPercentage).Should(Equal(0))
 
 			Ω(config.ListenerHeartbeatSyncInterval()).Should(Equal(time.Second))
 			Ω(config.StoreHeartbeatCacheRefreshInterval()).Should(Equal(20 * time.Second))
@@ -103,6 +170,28 @@ var _ = Describe("Config", func() {
 			Ω(config.SenderNatsStartSubject).Should(Equal("hm9000.start"))
 			Ω(config.SenderNatsStopSubject).Should(Equal("hm9000.stop"))
 			Ω(config.SenderMessageLimit).Should(Equal(60))
+			Ω(config.SenderStopMessageLimit).Should(Equal(0))
+			Ω(config.SenderPerAppRateLimit).Should(BeZero())
+			Ω(config.SenderPerDeaRateLimit).Should(BeZero())
+			Ω(config.SenderRateLimitPeriod().Seconds()).Should(BeNumerically("==", 60))
+			Ω(config.SenderNatsAckSubject).Should(BeEmpty())
+			Ω(config.IsAckTrackingEnabled()).Should(BeFalse())
+			Ω(config.SenderAckTimeout().Seconds()).Should(BeNumerically("==", 30))
+			Ω(config.SenderDeadLetterThreshold).Should(BeZero())
+			Ω(config.SenderDeadLetterWindow().Seconds()).Should(BeNumerically("==", 600))
+			Ω(config.SenderPublishRetries).Should(Equal(2))
+			Ω(config.SenderPublishRetryBackoff()).Should(Equal(100 * time.Millisecond))
+			Ω(config.SenderPublishMaxRetryBackoff()).Should(Equal(time.Second))
+			Ω(config.SenderPublishFailuresBeforeGivingUp).Should(Equal(3))
+			Ω(config.SenderTransport).Should(Equal("nats"))
+			Ω(config.SenderWebhookStartURL).Should(BeEmpty())
+			Ω(config.SenderWebhookStopURL).Should(BeEmpty())
+			Ω(config.SenderWebhookTimeout()).Should(Equal(5 * time.Second))
+			Ω(config.SenderTransportFile).Should(BeEmpty())
+			Ω(config.SenderMessageSigningSecret).Should(BeEmpty())
+			Ω(config.IsMessageSigningEnabled()).Should(BeFalse())
+			Ω(config.SenderSignatureReplayWindow().Seconds()).Should(BeNumerically("==", 60))
+			Ω(config.StartPriorityAgingPerSecond()).Should(BeZero())
 
 			Ω(config.MetricsServerPort).Should(Equal(7879))
 			Ω(config.MetricsServerUser).Should(Equal("metrics_server_user"))
@@ -129,6 +218,72 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("ExceedsDesiredStateShrinkThreshold", func() {
+		var config *Config
+
+		BeforeEach(func() {
+			config, _ = FromJSON([]byte(configJSON))
+		})
+
+		Context("when no threshold is configured", func() {
+			It("should never be exceeded", func() {
+				Ω(config.ExceedsDesiredStateShrinkThreshold(1000, 0)).Should(BeFalse())
+			})
+		})
+
+		Context("when a threshold is configured", func() {
+			BeforeEach(func() {
+				config.DesiredStateShrinkThresholdPercentage = 25
+			})
+
+			It("should be exceeded when more than that percentage of the apps disappear", func() {
+				Ω(config.ExceedsDesiredStateShrinkThreshold(0, 0)).Should(BeFalse())
+				Ω(config.ExceedsDesiredStateShrinkThreshold(100, 200)).Should(BeFalse())
+				Ω(config.ExceedsDesiredStateShrinkThreshold(100, 75)).Should(BeFalse())
+				Ω(config.ExceedsDesiredStateShrinkThreshold(100, 74)).Should(BeTrue())
+				Ω(config.ExceedsDesiredStateShrinkThreshold(100, 0)).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("ExceedsMassStopThreshold", func() {
+		var config *Config
+
+		BeforeEach(func() {
+			config, _ = FromJSON([]byte(configJSON))
+		})
+
+		Context("when no threshold is configured", func() {
+			It("should never be exceeded", func() {
+				Ω(config.ExceedsMassStopThreshold(1000, 1000)).Should(BeFalse())
+			})
+		})
+
+		Context("when an instance threshold is configured", func() {
+			BeforeEach(func() {
+				config.MassStopThresholdInstances = 10
+			})
+
+			It("should be exceeded by more stops than the threshold", func() {
+				Ω(config.ExceedsMassStopThreshold(10, 1000)).Should(BeFalse())
+				Ω(config.ExceedsMassStopThreshold(11, 1000)).Should(BeTrue())
+			})
+		})
+
+		Context("when a percentage threshold is configured", func() {
+			BeforeEach(func() {
+				config.MassStopThresholdPercentage = 20
+			})
+
+			It("should be exceeded by stopping more than that percentage of the running instances", func() {
+				Ω(config.ExceedsMassStopThreshold(0, 0)).Should(BeFalse())
+				Ω(config.ExceedsMassStopThreshold(20, 100)).Should(BeFalse())
+				Ω(config.ExceedsMassStopThreshold(21, 100)).Should(BeTrue())
+				Ω(config.ExceedsMassStopThreshold(1, 0)).Should(BeTrue())
+			})
+		})
+	})
+
 	Describe("loading up the default config", func() {
 		It("should load up the JSON in default_config.json", func() {
 			config, err := DefaultConfig()
@@ -151,6 +306,16 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Context("when the mass stop override duration is not positive", func() {
+		It("should refuse the config, since the override would never expire", func() {
+			for _, duration := range []int{0, -1} {
+				config, err := FromJSON([]byte(fmt.Sprintf(`{"mass_stop_override_duration_in_heartbeats":%d}`, duration)))
+				Ω(err).Should(MatchError("mass_stop_override_duration_in_heartbeats must be greater than 0"))
+				Ω(config).Should(BeNil())
+			}
+		})
+	})
+
 	Context("when passed invalid JSON", func() {
 		It("should not deserialize", func() {
 			config, err := FromJSON([]byte("¥"))
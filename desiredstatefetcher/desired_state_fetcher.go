@@ -1,6 +1,7 @@
 package desiredstatefetcher
 
 import (
+	"errors"
 	"fmt"
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
@@ -25,6 +26,8 @@ type DesiredStateFetcherResult struct {
 
 const initialBulkToken = "{}"
 
+var DesiredStateShrankTooMuchError = errors.New("Desired state shrank by more than the configured threshold")
+
 type DesiredStateFetcher struct {
 	config            *config.Config
 	httpClient        httpclient.HttpClient
@@ -109,6 +112,10 @@ func (fetcher *DesiredStateFetcher) fetchBatch(authorization string, token strin
 			tSync := time.Now()
 			err = fetcher.syncStore()
 			fetcher.metricsAccountant.TrackDesiredStateSyncTime(time.Since(tSync))
+			if err == DesiredStateShrankTooMuchError {
+				resultChan <- DesiredStateFetcherResult{Message: "Refusing to sync desired state: too many apps have disappeared", Error: err}
+				return
+			}
 			if err != nil {
 				resultChan <- DesiredStateFetcherResult{Message: "Failed to sync desired state to the store", Error: err}
 				return
@@ -145,7 +152,13 @@ func (fetcher *DesiredStateFetcher) syncStore() error {
 		desiredStates[i] = desiredState
 		i++
 	}
-	err := fetcher.store.SyncDesiredState(desiredStates...)
+
+	err := fetcher.guardAgainstShrinking(len(desiredStates))
+	if err != nil {
+		return err
+	}
+
+	err = fetcher.store.SyncDesiredState(desiredStates...)
 	if err != nil {
 		fetcher.logger.Error("Failed to Sync Desired State", err, map[string]string{
 			"Number of Entries": strconv.Itoa(len(desiredStates)),
@@ -154,9 +167,57 @@ func (fetcher *DesiredStateFetcher) syncStore() error {
 		return err
 	}
 
+	//pending stagings are only tracked to report the apps stuck in staging
+	if fetcher.config.StagingTimeout() == 0 {
+		return nil
+	}
+
+	err = fetcher.store.SyncPendingStagings(fetcher.timeProvider.Time(), desiredStates...)
+	if err != nil {
+		fetcher.logger.Error("Failed to Sync Pending Stagings", err)
+		return err
+	}
+
 	return nil
 }
 
+//guardAgainstShrinking refuses to replace the desired state when a large fraction of the desired apps have disappeared.
+//A degraded CC returning a partial bulk response would otherwise cause the analyzer to stop the missing apps.
+//Operators can confirm a legitimate drop with `hm9000 allow_mass_stops`.
+func (fetcher *DesiredStateFetcher) guardAgainstShrinking(fetchedNumberOfApps int) error {
+	if fetcher.config.DesiredStateShrinkThresholdPercentage == 0 {
+		return nil
+	}
+
+	currentDesiredStates, err := fetcher.store.GetDesiredState()
+	if err != nil {
+		fetcher.logger.Error("Failed to fetch current desired state", err)
+		return err
+	}
+
+	if !fetcher.config.ExceedsDesiredStateShrinkThreshold(len(currentDesiredStates), fetchedNumberOfApps) {
+		return nil
+	}
+
+	details := map[string]string{
+		"Current Number of Apps": strconv.Itoa(len(currentDesiredStates)),
+		"Fetched Number of Apps": strconv.Itoa(fetchedNumberOfApps),
+	}
+
+	allowed, err := fetcher.store.AreMassStopsAllowed()
+	if err != nil {
+		fetcher.logger.Error("Failed to check for a mass stop override", err)
+	}
+
+	if allowed {
+		fetcher.logger.Info("Desired state shrank, but mass stops are allowed: syncing", details)
+		return nil
+	}
+
+	fetcher.logger.Error("Refusing to sync desired state", DesiredStateShrankTooMuchError, details)
+	return DesiredStateShrankTooMuchError
+}
+
 func (fetcher *DesiredStateFetcher) cacheResponse(response DesiredStateServerResponse) {
 	for _, desiredState := range response.Results {
 		if desiredState.State == models.AppStateStarted && (desiredState.PackageState == models.AppPackageStateStaged || desiredState.PackageState == models.AppPackageStatePending) {
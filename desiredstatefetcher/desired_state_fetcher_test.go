@@ -48,6 +48,7 @@ var _ = Describe("DesiredStateFetcher", func() {
 		var err error
 		conf, err = config.DefaultConfig()
 		Ω(err).ShouldNot(HaveOccurred())
+		conf.StagingTimeoutInHeartbeats = 90
 
 		metricsAccountant = fakemetricsaccountant.New()
 
@@ -219,6 +220,52 @@ var _ = Describe("DesiredStateFetcher", func() {
 					Ω(desired).Should(ContainElement(EqualDesiredState(pendingStagingDesiredState)))
 				})
 
+				It("should record when it first saw apps that are pending staging", func() {
+					pendingStagings, err := store.GetPendingStagings()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(pendingStagings).Should(HaveLen(1))
+					Ω(pendingStagings[pendingStagingDesiredState.StoreKey()]).Should(Equal(models.NewPendingStaging(timeProvider.Time(), pendingStagingApp.AppGuid, pendingStagingApp.AppVersion)))
+				})
+
+				Context("when the app was already pending staging", func() {
+					var firstSeen models.PendingStaging
+
+					BeforeEach(func() {
+						firstSeen = models.NewPendingStaging(time.Unix(10, 0), pendingStagingApp.AppGuid, pendingStagingApp.AppVersion)
+						store.SavePendingStagings(firstSeen)
+					})
+
+					It("should keep the original timestamp", func() {
+						pendingStagings, err := store.GetPendingStagings()
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(pendingStagings[pendingStagingDesiredState.StoreKey()]).Should(Equal(firstSeen))
+					})
+				})
+
+				Context("when an app that was pending staging has finished staging", func() {
+					BeforeEach(func() {
+						store.SavePendingStagings(models.NewPendingStaging(time.Unix(10, 0), a1.AppGuid, a1.AppVersion))
+					})
+
+					It("should forget about it", func() {
+						pendingStagings, err := store.GetPendingStagings()
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(pendingStagings).ShouldNot(HaveKey(a1.DesiredState(1).StoreKey()))
+					})
+				})
+
+				Context("when the staging timeout is disabled", func() {
+					BeforeEach(func() {
+						conf.StagingTimeoutInHeartbeats = 0
+					})
+
+					It("should not record apps that are pending staging", func() {
+						pendingStagings, err := store.GetPendingStagings()
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(pendingStagings).Should(BeEmpty())
+					})
+				})
+
 				It("should track the time taken to sync desired state", func() {
 					Ω(metricsAccountant.TrackedDesiredStateSyncTime).ShouldNot(BeZero())
 				})
@@ -239,6 +286,14 @@ var _ = Describe("DesiredStateFetcher", func() {
 					assertFailure("Failed to sync desired state to the store", 2)
 				})
 
+				Context("and it fails to record the apps that are pending staging", func() {
+					BeforeEach(func() {
+						storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("staging", errors.New("oops!"))
+					})
+
+					assertFailure("Failed to sync desired state to the store", 2)
+				})
+
 				Context("and it fails to read from the store", func() {
 					BeforeEach(func() {
 						storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("apps", errors.New("oops!"))
@@ -246,6 +301,67 @@ var _ = Describe("DesiredStateFetcher", func() {
 
 					assertFailure("Failed to sync desired state to the store", 2)
 				})
+
+				Context("and far fewer apps are desired than before", func() {
+					var previouslyDesiredStates []models.DesiredAppState
+
+					BeforeEach(func() {
+						previouslyDesiredStates = []models.DesiredAppState{deletedApp.DesiredState(1)}
+						for i := 0; i < 6; i++ {
+							previouslyDesiredStates = append(previouslyDesiredStates, appfixture.NewAppFixture().DesiredState(1))
+						}
+						store.SyncDesiredState(previouslyDesiredStates...)
+					})
+
+					Context("and the drop is within the shrink threshold", func() {
+						BeforeEach(func() {
+							conf.DesiredStateShrinkThresholdPercentage = 60
+						})
+
+						It("should sync the desired state", func() {
+							desired, _ := store.GetDesiredState()
+							Ω(desired).Should(HaveLen(3))
+						})
+					})
+
+					Context("and the drop exceeds the shrink threshold", func() {
+						BeforeEach(func() {
+							conf.DesiredStateShrinkThresholdPercentage = 50
+						})
+
+						It("should not touch the desired state", func() {
+							desired, _ := store.GetDesiredState()
+							Ω(desired).Should(HaveLen(7))
+						})
+
+						It("should not bump the freshness", func() {
+							fresh, _ := store.IsDesiredStateFresh()
+							Ω(fresh).Should(BeFalse())
+						})
+
+						It("should send a distinct error down the result channel", func(done Done) {
+							result := <-resultChan
+							Ω(result.Success).Should(BeFalse())
+							Ω(result.Message).Should(Equal("Refusing to sync desired state: too many apps have disappeared"))
+							Ω(result.Error).Should(Equal(DesiredStateShrankTooMuchError))
+							close(done)
+						}, 0.1)
+
+						Context("when mass stops have been allowed", func() {
+							BeforeEach(func() {
+								store.AllowMassStops(timeProvider.Time())
+							})
+
+							It("should sync the desired state", func() {
+								desired, _ := store.GetDesiredState()
+								Ω(desired).Should(HaveLen(3))
+
+								fresh, _ := store.IsDesiredStateFresh()
+								Ω(fresh).Should(BeTrue())
+							})
+						})
+					})
+				})
 			})
 		})
 
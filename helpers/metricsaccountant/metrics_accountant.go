@@ -1,6 +1,7 @@
 package metricsaccountant
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/cloudfoundry/hm9000/models"
@@ -14,23 +15,88 @@ type UsageTracker interface {
 }
 
 var startMetrics = map[models.PendingStartMessageReason]string{
-	models.PendingStartMessageReasonCrashed:    "StartCrashed",
-	models.PendingStartMessageReasonMissing:    "StartMissing",
-	models.PendingStartMessageReasonEvacuating: "StartEvacuating",
+	models.PendingStartMessageReasonCrashed:       "StartCrashed",
+	models.PendingStartMessageReasonMissing:       "StartMissing",
+	models.PendingStartMessageReasonEvacuating:    "StartEvacuating",
+	models.PendingStartMessageReasonStuckStarting: "StartStuckStarting",
 }
 
 var stopMetrics = map[models.PendingStopMessageReason]string{
 	models.PendingStopMessageReasonDuplicate:          "StopDuplicate",
 	models.PendingStopMessageReasonExtra:              "StopExtra",
 	models.PendingStopMessageReasonEvacuationComplete: "StopEvacuationComplete",
+	models.PendingStopMessageReasonStuckStarting:      "StopStuckStarting",
+	models.PendingStopMessageReasonOutdatedVersion:    "StopOutdatedVersion",
+}
+
+var startAckMetrics = map[models.PendingMessageAckState]string{
+	models.PendingMessageAckStateAcknowledged: "StartMessagesAcknowledged",
+	models.PendingMessageAckStateTimedOut:     "StartMessagesAckTimedOut",
+	models.PendingMessageAckStateSuperseded:   "StartMessagesAckSuperseded",
+}
+
+var stopAckMetrics = map[models.PendingMessageAckState]string{
+	models.PendingMessageAckStateAcknowledged: "StopMessagesAcknowledged",
+	models.PendingMessageAckStateTimedOut:     "StopMessagesAckTimedOut",
+	models.PendingMessageAckStateSuperseded:   "StopMessagesAckSuperseded",
+}
+
+//Send latencies (from enqueue to send) are counted in cumulative buckets, per reason.
+//A start sent 20 seconds after being enqueued counts towards StartCrashedSendLatencyWithin30s, ...Within60s and ...Within300s;
+//one sent more than 300 seconds after being enqueued only counts towards StartCrashedSendLatencyOver300s.
+//StartCrashedSendLatencySecondsTotal divided by the number of messages in the buckets gives the mean.
+var sendLatencyBucketsInSeconds = []int{10, 30, 60, 300}
+
+func sendLatencyWithinMetric(reasonMetric string, bucketInSeconds int) string {
+	return reasonMetric + "SendLatencyWithin" + strconv.Itoa(bucketInSeconds) + "s"
+}
+
+func sendLatencyOverMetric(reasonMetric string) string {
+	return reasonMetric + "SendLatencyOver" + strconv.Itoa(sendLatencyBucketsInSeconds[len(sendLatencyBucketsInSeconds)-1]) + "s"
+}
+
+func sendLatencyTotalMetric(reasonMetric string) string {
+	return reasonMetric + "SendLatencySecondsTotal"
+}
+
+func sendLatencyMetrics(reasonMetric string) []string {
+	keys := []string{sendLatencyTotalMetric(reasonMetric), sendLatencyOverMetric(reasonMetric)}
+	for _, bucket := range sendLatencyBucketsInSeconds {
+		keys = append(keys, sendLatencyWithinMetric(reasonMetric, bucket))
+	}
+	return keys
+}
+
+func addSendLatency(increments map[string]float64, reasonMetric string, latency time.Duration) {
+	increments[sendLatencyTotalMetric(reasonMetric)] += latency.Seconds()
+
+	isWithinABucket := false
+	for _, bucket := range sendLatencyBucketsInSeconds {
+		if latency <= time.Duration(bucket)*time.Second {
+			increments[sendLatencyWithinMetric(reasonMetric, bucket)] += 1
+			isWithinABucket = true
+		}
+	}
+
+	if !isWithinABucket {
+		increments[sendLatencyOverMetric(reasonMetric)] += 1
+	}
 }
 
 type MetricsAccountant interface {
 	TrackReceivedHeartbeats(metric int) error
 	TrackSavedHeartbeats(metric int) error
 	IncrementSentMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error
+	IncrementSendLatencyMetrics(sentAt time.Time, starts []models.PendingStartMessage, stops []models.PendingStopMessage) error
+	IncrementDeletedMessageMetrics(notSentStarts []models.PendingStartMessage, expiredStarts []models.PendingStartMessage, notSentStops []models.PendingStopMessage, expiredStops []models.PendingStopMessage) error
+	IncrementAckOutcomeMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error
+	IncrementDeadLetterMetrics(deadLetters []models.DeadLetter) error
+	IncrementPublishFailureMetrics(startFailures int, stopFailures int, messageBusDown bool) error
 	TrackDesiredStateSyncTime(dt time.Duration) error
 	TrackActualStateListenerStoreUsageFraction(usage float64) error
+	TrackMassStopCircuitBreakerTrip(refusedStops int) error
+	TrackAnalysis(dt time.Duration, appsAnalyzedByWorker []int) error
+	TrackShadowPolicyDiffs(onlyInPolicy int, onlyInShadow int) error
 	GetMetrics() (map[string]float64, error)
 }
 
@@ -60,22 +126,121 @@ func (m *RealMetricsAccountant) TrackActualStateListenerStoreUsageFraction(usage
 	return m.store.SaveMetric("ActualStateListenerStoreUsagePercentage", usage*100.0)
 }
 
-func (m *RealMetricsAccountant) IncrementSentMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
-	metrics, err := m.GetMetrics()
+func (m *RealMetricsAccountant) TrackMassStopCircuitBreakerTrip(refusedStops int) error {
+	return m.incrementMetrics(map[string]float64{
+		"MassStopCircuitBreakerTrips":                 1,
+		"StopMessagesRefusedByMassStopCircuitBreaker": float64(refusedStops),
+	})
+}
+
+//TrackAnalysis records how long an analysis pass took and how many apps per second its workers got through,
+//both on average and for the slowest worker.
+func (m *RealMetricsAccountant) TrackAnalysis(dt time.Duration, appsAnalyzedByWorker []int) error {
+	err := m.store.SaveMetric("AnalysisTimeInMilliseconds", float64(dt)/float64(time.Millisecond))
+	if err != nil {
+		return err
+	}
+
+	appsPerSecondPerWorker, appsPerSecondBySlowestWorker := 0.0, 0.0
+	if dt > 0 && len(appsAnalyzedByWorker) > 0 {
+		totalAppsAnalyzed, slowestWorkerAppsAnalyzed := 0, appsAnalyzedByWorker[0]
+		for _, appsAnalyzed := range appsAnalyzedByWorker {
+			totalAppsAnalyzed += appsAnalyzed
+			if appsAnalyzed < slowestWorkerAppsAnalyzed {
+				slowestWorkerAppsAnalyzed = appsAnalyzed
+			}
+		}
+
+		appsPerSecondPerWorker = float64(totalAppsAnalyzed) / dt.Seconds() / float64(len(appsAnalyzedByWorker))
+		appsPerSecondBySlowestWorker = float64(slowestWorkerAppsAnalyzed) / dt.Seconds()
+	}
+
+	err = m.store.SaveMetric("AnalyzedAppsPerSecondPerWorker", appsPerSecondPerWorker)
+	if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric("AnalyzedAppsPerSecondBySlowestWorker", appsPerSecondBySlowestWorker)
+}
+
+//TrackShadowPolicyDiffs records how many messages only the policy and only the shadow policy produced in the last analysis pass,
+//and counts the passes in which they disagreed.
+func (m *RealMetricsAccountant) TrackShadowPolicyDiffs(onlyInPolicy int, onlyInShadow int) error {
+	err := m.store.SaveMetric("ShadowPolicyDiffsOnlyInPolicy", float64(onlyInPolicy))
 	if err != nil {
 		return err
 	}
 
+	err = m.store.SaveMetric("ShadowPolicyDiffsOnlyInShadow", float64(onlyInShadow))
+	if err != nil {
+		return err
+	}
+
+	if onlyInPolicy == 0 && onlyInShadow == 0 {
+		return nil
+	}
+
+	return m.incrementMetrics(map[string]float64{"ShadowPolicyPassesWithDiffs": 1})
+}
+
+func (m *RealMetricsAccountant) IncrementSentMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
+	increments := map[string]float64{}
 	for _, start := range starts {
-		metrics[startMetrics[start.StartReason]] += 1
+		increments[startMetrics[start.StartReason]] += 1
 	}
 
 	for _, stop := range stops {
-		metrics[stopMetrics[stop.StopReason]] += 1
+		increments[stopMetrics[stop.StopReason]] += 1
 	}
 
-	for key, value := range metrics {
-		err := m.store.SaveMetric(key, float64(value))
+	return m.incrementMetrics(increments)
+}
+
+//IncrementSendLatencyMetrics adds the latencies of messages sent at sentAt to the per-reason latency buckets.
+//Messages enqueued before the enqueue time was recorded are left out.
+func (m *RealMetricsAccountant) IncrementSendLatencyMetrics(sentAt time.Time, starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
+	increments := map[string]float64{}
+	for _, start := range starts {
+		if start.EnqueuedOn == 0 {
+			continue
+		}
+		addSendLatency(increments, startMetrics[start.StartReason], start.SendLatency(sentAt))
+	}
+
+	for _, stop := range stops {
+		if stop.EnqueuedOn == 0 {
+			continue
+		}
+		addSendLatency(increments, stopMetrics[stop.StopReason], stop.SendLatency(sentAt))
+	}
+
+	return m.incrementMetrics(increments)
+}
+
+//IncrementDeletedMessageMetrics counts the messages the sender deleted without sending them (they will not be sent)
+//and the sent messages it deleted once their keep alive expired
+func (m *RealMetricsAccountant) IncrementDeletedMessageMetrics(notSentStarts []models.PendingStartMessage, expiredStarts []models.PendingStartMessage, notSentStops []models.PendingStopMessage, expiredStops []models.PendingStopMessage) error {
+	return m.incrementMetrics(map[string]float64{
+		"StartMessagesDeletedNotSent": float64(len(notSentStarts)),
+		"StartMessagesDeletedExpired": float64(len(expiredStarts)),
+		"StopMessagesDeletedNotSent":  float64(len(notSentStops)),
+		"StopMessagesDeletedExpired":  float64(len(expiredStops)),
+	})
+}
+
+//incrementMetrics reads and writes only the metrics it increments, and only touches the store if there is something to increment
+func (m *RealMetricsAccountant) incrementMetrics(increments map[string]float64) error {
+	for key, increment := range increments {
+		if increment == 0 {
+			continue
+		}
+
+		value, err := m.getMetric(key)
+		if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+increment)
 		if err != nil {
 			return err
 		}
@@ -84,6 +249,56 @@ func (m *RealMetricsAccountant) IncrementSentMessageMetrics(starts []models.Pend
 	return nil
 }
 
+//getMetric treats a metric that has never been saved as 0
+func (m *RealMetricsAccountant) getMetric(key string) (float64, error) {
+	value, err := m.store.GetMetric(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		return 0, nil
+	}
+	return value, err
+}
+
+//IncrementAckOutcomeMetrics counts the sent messages whose ack state was resolved, by outcome
+func (m *RealMetricsAccountant) IncrementAckOutcomeMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
+	increments := map[string]float64{}
+	for _, start := range starts {
+		increments[startAckMetrics[start.AckState]] += 1
+	}
+
+	for _, stop := range stops {
+		increments[stopAckMetrics[stop.AckState]] += 1
+	}
+
+	return m.incrementMetrics(increments)
+}
+
+func (m *RealMetricsAccountant) IncrementDeadLetterMetrics(deadLetters []models.DeadLetter) error {
+	increments := map[string]float64{}
+	for _, deadLetter := range deadLetters {
+		key := "DeadLetteredStartMessages"
+		if deadLetter.MessageType == "stop" {
+			key = "DeadLetteredStopMessages"
+		}
+		increments[key] += 1
+	}
+
+	return m.incrementMetrics(increments)
+}
+
+//IncrementPublishFailureMetrics counts failed publishes (every failed attempt, retries included) on the start and stop subjects,
+//and the sender passes that stopped publishing because the message bus looked down
+func (m *RealMetricsAccountant) IncrementPublishFailureMetrics(startFailures int, stopFailures int, messageBusDown bool) error {
+	increments := map[string]float64{
+		"StartMessagePublishFailures": float64(startFailures),
+		"StopMessagePublishFailures":  float64(stopFailures),
+	}
+	if messageBusDown {
+		increments["SenderPassesStoppedWithMessageBusDown"] = 1
+	}
+
+	return m.incrementMetrics(increments)
+}
+
 func (m *RealMetricsAccountant) GetMetrics() (map[string]float64, error) {
 	metrics := map[string]float64{}
 	for _, key := range startMetrics {
@@ -92,17 +307,48 @@ func (m *RealMetricsAccountant) GetMetrics() (map[string]float64, error) {
 	for _, key := range stopMetrics {
 		metrics[key] = 0
 	}
+	for _, key := range startMetrics {
+		for _, latencyKey := range sendLatencyMetrics(key) {
+			metrics[latencyKey] = 0
+		}
+	}
+	for _, key := range stopMetrics {
+		for _, latencyKey := range sendLatencyMetrics(key) {
+			metrics[latencyKey] = 0
+		}
+	}
+	for _, key := range startAckMetrics {
+		metrics[key] = 0
+	}
+	for _, key := range stopAckMetrics {
+		metrics[key] = 0
+	}
 
 	metrics["DesiredStateSyncTimeInMilliseconds"] = 0
 	metrics["ActualStateListenerStoreUsagePercentage"] = 0
 	metrics["SavedHeartbeats"] = 0
 	metrics["ReceivedHeartbeats"] = 0
+	metrics["MassStopCircuitBreakerTrips"] = 0
+	metrics["StopMessagesRefusedByMassStopCircuitBreaker"] = 0
+	metrics["AnalysisTimeInMilliseconds"] = 0
+	metrics["AnalyzedAppsPerSecondPerWorker"] = 0
+	metrics["AnalyzedAppsPerSecondBySlowestWorker"] = 0
+	metrics["ShadowPolicyDiffsOnlyInPolicy"] = 0
+	metrics["ShadowPolicyDiffsOnlyInShadow"] = 0
+	metrics["ShadowPolicyPassesWithDiffs"] = 0
+	metrics["DeadLetteredStartMessages"] = 0
+	metrics["DeadLetteredStopMessages"] = 0
+	metrics["StartMessagesDeletedNotSent"] = 0
+	metrics["StartMessagesDeletedExpired"] = 0
+	metrics["StopMessagesDeletedNotSent"] = 0
+	metrics["StopMessagesDeletedExpired"] = 0
+	metrics["StartMessagePublishFailures"] = 0
+	metrics["StopMessagePublishFailures"] = 0
+	metrics["SenderPassesStoppedWithMessageBusDown"] = 0
 
 	for key := range metrics {
-		value, err := m.store.GetMetric(key)
-		if err == storeadapter.ErrorKeyNotFound {
-			value = 0
-		} else if err != nil {
+		value, err := m.getMetric(key)
+		if err != nil {
 			return map[string]float64{}, err
 		}
 		metrics[key] = value
@@ -31,18 +31,52 @@ var _ = Describe("Metrics Accountant", func() {
 			It("should return a map of 0s", func() {
 				metrics, err := accountant.GetMetrics()
 				Ω(err).ShouldNot(HaveOccurred())
-				Ω(metrics).Should(Equal(map[string]float64{
-					"StartCrashed":                            0,
-					"StartMissing":                            0,
-					"StartEvacuating":                         0,
-					"StopExtra":                               0,
-					"StopDuplicate":                           0,
-					"StopEvacuationComplete":                  0,
-					"DesiredStateSyncTimeInMilliseconds":      0,
-					"ActualStateListenerStoreUsagePercentage": 0,
-					"ReceivedHeartbeats":                      0,
-					"SavedHeartbeats":                         0,
-				}))
+
+				expectedMetrics := map[string]float64{
+					"StartCrashed":                                0,
+					"StartMissing":                                0,
+					"StartEvacuating":                             0,
+					"StartStuckStarting":                          0,
+					"StopExtra":                                   0,
+					"StopDuplicate":                               0,
+					"StopEvacuationComplete":                      0,
+					"StopStuckStarting":                           0,
+					"StopOutdatedVersion":                         0,
+					"DesiredStateSyncTimeInMilliseconds":          0,
+					"ActualStateListenerStoreUsagePercentage":     0,
+					"ReceivedHeartbeats":                          0,
+					"SavedHeartbeats":                             0,
+					"MassStopCircuitBreakerTrips":                 0,
+					"StopMessagesRefusedByMassStopCircuitBreaker": 0,
+					"AnalysisTimeInMilliseconds":                  0,
+					"AnalyzedAppsPerSecondPerWorker":              0,
+					"AnalyzedAppsPerSecondBySlowestWorker":        0,
+					"ShadowPolicyDiffsOnlyInPolicy":               0,
+					"ShadowPolicyDiffsOnlyInShadow":               0,
+					"ShadowPolicyPassesWithDiffs":                 0,
+					"StartMessagesAcknowledged":                   0,
+					"StartMessagesAckTimedOut":                    0,
+					"StartMessagesAckSuperseded":                  0,
+					"StopMessagesAcknowledged":                    0,
+					"StopMessagesAckTimedOut":                     0,
+					"StopMessagesAckSuperseded":                   0,
+					"DeadLetteredStartMessages":                   0,
+					"DeadLetteredStopMessages":                    0,
+					"StartMessagePublishFailures":                 0,
+					"StopMessagePublishFailures":                  0,
+					"SenderPassesStoppedWithMessageBusDown":       0,
+					"StartMessagesDeletedNotSent":                 0,
+					"StartMessagesDeletedExpired":                 0,
+					"StopMessagesDeletedNotSent":                  0,
+					"StopMessagesDeletedExpired":                  0,
+				}
+				for _, reasonMetric := range []string{"StartCrashed", "StartMissing", "StartEvacuating", "StartStuckStarting", "StopExtra", "StopDuplicate", "StopEvacuationComplete", "StopStuckStarting", "StopOutdatedVersion"} {
+					for _, latencyMetric := range []string{"SendLatencySecondsTotal", "SendLatencyWithin10s", "SendLatencyWithin30s", "SendLatencyWithin60s", "SendLatencyWithin300s", "SendLatencyOver300s"} {
+						expectedMetrics[reasonMetric+latencyMetric] = 0
+					}
+				}
+
+				Ω(metrics).Should(Equal(expectedMetrics))
 			})
 		})
 
@@ -89,6 +123,29 @@ var _ = Describe("Metrics Accountant", func() {
 		})
 	})
 
+	Describe("TrackAnalysis", func() {
+		It("should record the duration of the pass and the throughput of its workers", func() {
+			err := accountant.TrackAnalysis(2*time.Second, []int{30, 10, 20})
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AnalysisTimeInMilliseconds"]).Should(BeNumerically("==", 2000))
+			Ω(metrics["AnalyzedAppsPerSecondPerWorker"]).Should(BeNumerically("==", 10))
+			Ω(metrics["AnalyzedAppsPerSecondBySlowestWorker"]).Should(BeNumerically("==", 5))
+		})
+
+		Context("when the pass took no time at all", func() {
+			It("should record zero throughput", func() {
+				err := accountant.TrackAnalysis(0, []int{})
+				Ω(err).ShouldNot(HaveOccurred())
+				metrics, err := accountant.GetMetrics()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(metrics["AnalyzedAppsPerSecondPerWorker"]).Should(BeZero())
+				Ω(metrics["AnalyzedAppsPerSecondBySlowestWorker"]).Should(BeZero())
+			})
+		})
+	})
+
 	Describe("TrackActualStateListenerStoreUsageFraction", func() {
 		It("should record the passed in time duration appropriately", func() {
 			err := accountant.TrackActualStateListenerStoreUsageFraction(0.723)
@@ -119,6 +176,257 @@ var _ = Describe("Metrics Accountant", func() {
 		})
 	})
 
+	Describe("TrackMassStopCircuitBreakerTrip", func() {
+		It("should count the trips and the refused stop messages", func() {
+			err := accountant.TrackMassStopCircuitBreakerTrip(12)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackMassStopCircuitBreakerTrip(7)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["MassStopCircuitBreakerTrips"]).Should(BeNumerically("==", 2))
+			Ω(metrics["StopMessagesRefusedByMassStopCircuitBreaker"]).Should(BeNumerically("==", 19))
+		})
+
+		Context("when the store fails to save the metric", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				err := accountant.TrackMassStopCircuitBreakerTrip(12)
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+		})
+	})
+
+	Describe("TrackShadowPolicyDiffs", func() {
+		It("should record the last pass's diffs and count the passes with diffs", func() {
+			err := accountant.TrackShadowPolicyDiffs(3, 1)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackShadowPolicyDiffs(0, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackShadowPolicyDiffs(0, 2)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["ShadowPolicyDiffsOnlyInPolicy"]).Should(BeNumerically("==", 0))
+			Ω(metrics["ShadowPolicyDiffsOnlyInShadow"]).Should(BeNumerically("==", 2))
+			Ω(metrics["ShadowPolicyPassesWithDiffs"]).Should(BeNumerically("==", 2))
+		})
+
+		Context("when the store fails to save the metric", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				err := accountant.TrackShadowPolicyDiffs(3, 1)
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+		})
+	})
+
+	Describe("IncrementAckOutcomeMetrics", func() {
+		var starts []models.PendingStartMessage
+		var stops []models.PendingStopMessage
+		BeforeEach(func() {
+			starts = []models.PendingStartMessage{
+				{PendingMessage: models.PendingMessage{AckState: models.PendingMessageAckStateAcknowledged}},
+				{PendingMessage: models.PendingMessage{AckState: models.PendingMessageAckStateAcknowledged}},
+				{PendingMessage: models.PendingMessage{AckState: models.PendingMessageAckStateTimedOut}},
+			}
+
+			stops = []models.PendingStopMessage{
+				{PendingMessage: models.PendingMessage{AckState: models.PendingMessageAckStateAcknowledged}},
+				{PendingMessage: models.PendingMessage{AckState: models.PendingMessageAckStateSuperseded}},
+				{PendingMessage: models.PendingMessage{AckState: models.PendingMessageAckStateSuperseded}},
+			}
+		})
+
+		It("should count the outcomes, adding to the existing counts", func() {
+			err := accountant.IncrementAckOutcomeMetrics(starts, stops)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementAckOutcomeMetrics(starts, []models.PendingStopMessage{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["StartMessagesAcknowledged"]).Should(BeNumerically("==", 4))
+			Ω(metrics["StartMessagesAckTimedOut"]).Should(BeNumerically("==", 2))
+			Ω(metrics["StartMessagesAckSuperseded"]).Should(BeNumerically("==", 0))
+			Ω(metrics["StopMessagesAcknowledged"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopMessagesAckTimedOut"]).Should(BeNumerically("==", 0))
+			Ω(metrics["StopMessagesAckSuperseded"]).Should(BeNumerically("==", 2))
+		})
+
+		Context("when there are no outcomes", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should not touch the store", func() {
+				err := accountant.IncrementAckOutcomeMetrics([]models.PendingStartMessage{}, []models.PendingStopMessage{})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("when the store fails to save the metric", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				err := accountant.IncrementAckOutcomeMetrics(starts, stops)
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+		})
+	})
+
+	Describe("IncrementDeadLetterMetrics", func() {
+		var deadLetters []models.DeadLetter
+		BeforeEach(func() {
+			deadLetters = []models.DeadLetter{
+				{MessageType: "start", MessageKey: "a"},
+				{MessageType: "start", MessageKey: "b"},
+				{MessageType: "stop", MessageKey: "c"},
+			}
+		})
+
+		It("should count the dead letters by message type, adding to the existing counts", func() {
+			err := accountant.IncrementDeadLetterMetrics(deadLetters)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementDeadLetterMetrics(deadLetters[2:])
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["DeadLetteredStartMessages"]).Should(BeNumerically("==", 2))
+			Ω(metrics["DeadLetteredStopMessages"]).Should(BeNumerically("==", 2))
+		})
+
+		Context("when the store fails to save the metric", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				err := accountant.IncrementDeadLetterMetrics(deadLetters)
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+		})
+	})
+
+	Describe("IncrementSendLatencyMetrics", func() {
+		It("should add each message's latency to its reason's buckets and total", func() {
+			fastStart := models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", 0, 1, models.PendingStartMessageReasonCrashed)
+			slowStart := models.NewPendingStartMessage(time.Unix(80, 0), 0, 0, "app-guid", "app-version", 1, 1, models.PendingStartMessageReasonCrashed)
+			legacyStart := models.NewPendingStartMessage(time.Unix(80, 0), 0, 0, "app-guid", "app-version", 2, 1, models.PendingStartMessageReasonCrashed)
+			legacyStart.EnqueuedOn = 0
+			stop := models.NewPendingStopMessage(time.Unix(100-400, 0), 0, 0, "app-guid", "app-version", "instance-guid", models.PendingStopMessageReasonExtra)
+
+			err := accountant.IncrementSendLatencyMetrics(time.Unix(105, 0), []models.PendingStartMessage{fastStart, slowStart, legacyStart}, []models.PendingStopMessage{stop})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["StartCrashedSendLatencySecondsTotal"]).Should(BeNumerically("==", 30))
+			Ω(metrics["StartCrashedSendLatencyWithin10s"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StartCrashedSendLatencyWithin30s"]).Should(BeNumerically("==", 2))
+			Ω(metrics["StartCrashedSendLatencyWithin300s"]).Should(BeNumerically("==", 2))
+			Ω(metrics["StartCrashedSendLatencyOver300s"]).Should(BeZero())
+
+			Ω(metrics["StopExtraSendLatencySecondsTotal"]).Should(BeNumerically("==", 405))
+			Ω(metrics["StopExtraSendLatencyWithin300s"]).Should(BeZero())
+			Ω(metrics["StopExtraSendLatencyOver300s"]).Should(BeNumerically("==", 1))
+
+			err = accountant.IncrementSendLatencyMetrics(time.Unix(105, 0), []models.PendingStartMessage{fastStart}, []models.PendingStopMessage{})
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, _ = accountant.GetMetrics()
+			Ω(metrics["StartCrashedSendLatencyWithin10s"]).Should(BeNumerically("==", 2))
+		})
+
+		Context("when the store fails to save the metric", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				start := models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", 0, 1, models.PendingStartMessageReasonCrashed)
+				err := accountant.IncrementSendLatencyMetrics(time.Unix(105, 0), []models.PendingStartMessage{start}, []models.PendingStopMessage{})
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+		})
+	})
+
+	Describe("IncrementDeletedMessageMetrics", func() {
+		It("should count the deleted messages by type and cause, adding to the existing counts", func() {
+			start := models.PendingStartMessage{}
+			stop := models.PendingStopMessage{}
+
+			err := accountant.IncrementDeletedMessageMetrics([]models.PendingStartMessage{start, start}, []models.PendingStartMessage{start}, []models.PendingStopMessage{}, []models.PendingStopMessage{stop})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementDeletedMessageMetrics([]models.PendingStartMessage{start}, []models.PendingStartMessage{}, []models.PendingStopMessage{stop}, []models.PendingStopMessage{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["StartMessagesDeletedNotSent"]).Should(BeNumerically("==", 3))
+			Ω(metrics["StartMessagesDeletedExpired"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopMessagesDeletedNotSent"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopMessagesDeletedExpired"]).Should(BeNumerically("==", 1))
+		})
+
+		Context("when the store fails to save the metric", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				err := accountant.IncrementDeletedMessageMetrics([]models.PendingStartMessage{{}}, []models.PendingStartMessage{}, []models.PendingStopMessage{}, []models.PendingStopMessage{})
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+
+			It("should not touch the store when there is nothing to count", func() {
+				err := accountant.IncrementDeletedMessageMetrics([]models.PendingStartMessage{}, []models.PendingStartMessage{}, []models.PendingStopMessage{}, []models.PendingStopMessage{})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("IncrementPublishFailureMetrics", func() {
+		It("should count the failures by subject, adding to the existing counts", func() {
+			err := accountant.IncrementPublishFailureMetrics(3, 1, false)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementPublishFailureMetrics(2, 0, true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["StartMessagePublishFailures"]).Should(BeNumerically("==", 5))
+			Ω(metrics["StopMessagePublishFailures"]).Should(BeNumerically("==", 1))
+			Ω(metrics["SenderPassesStoppedWithMessageBusDown"]).Should(BeNumerically("==", 1))
+		})
+
+		Context("when the store fails to save the metric", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				err := accountant.IncrementPublishFailureMetrics(1, 0, false)
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+
+			It("should not touch the store when there is nothing to count", func() {
+				err := accountant.IncrementPublishFailureMetrics(0, 0, false)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("IncrementSentMessageMetrics", func() {
 		var starts []models.PendingStartMessage
 		var stops []models.PendingStopMessage
@@ -130,6 +438,7 @@ var _ = Describe("Metrics Accountant", func() {
 				{StartReason: models.PendingStartMessageReasonEvacuating},
 				{StartReason: models.PendingStartMessageReasonEvacuating},
 				{StartReason: models.PendingStartMessageReasonEvacuating},
+				{StartReason: models.PendingStartMessageReasonStuckStarting},
 			}
 
 			stops = []models.PendingStopMessage{
@@ -139,6 +448,8 @@ var _ = Describe("Metrics Accountant", func() {
 				{StopReason: models.PendingStopMessageReasonEvacuationComplete},
 				{StopReason: models.PendingStopMessageReasonEvacuationComplete},
 				{StopReason: models.PendingStopMessageReasonEvacuationComplete},
+				{StopReason: models.PendingStopMessageReasonStuckStarting},
+				{StopReason: models.PendingStopMessageReasonOutdatedVersion},
 			}
 		})
 
@@ -154,9 +465,12 @@ var _ = Describe("Metrics Accountant", func() {
 				Ω(metrics["StartCrashed"]).Should(BeNumerically("==", 1))
 				Ω(metrics["StartMissing"]).Should(BeNumerically("==", 2))
 				Ω(metrics["StartEvacuating"]).Should(BeNumerically("==", 3))
+				Ω(metrics["StartStuckStarting"]).Should(BeNumerically("==", 1))
 				Ω(metrics["StopExtra"]).Should(BeNumerically("==", 1))
 				Ω(metrics["StopDuplicate"]).Should(BeNumerically("==", 2))
 				Ω(metrics["StopEvacuationComplete"]).Should(BeNumerically("==", 3))
+				Ω(metrics["StopStuckStarting"]).Should(BeNumerically("==", 1))
+				Ω(metrics["StopOutdatedVersion"]).Should(BeNumerically("==", 1))
 			})
 		})
 
@@ -174,9 +488,12 @@ var _ = Describe("Metrics Accountant", func() {
 				Ω(metrics["StartCrashed"]).Should(BeNumerically("==", 2))
 				Ω(metrics["StartMissing"]).Should(BeNumerically("==", 4))
 				Ω(metrics["StartEvacuating"]).Should(BeNumerically("==", 6))
+				Ω(metrics["StartStuckStarting"]).Should(BeNumerically("==", 2))
 				Ω(metrics["StopExtra"]).Should(BeNumerically("==", 2))
 				Ω(metrics["StopDuplicate"]).Should(BeNumerically("==", 4))
 				Ω(metrics["StopEvacuationComplete"]).Should(BeNumerically("==", 6))
+				Ω(metrics["StopStuckStarting"]).Should(BeNumerically("==", 2))
+				Ω(metrics["StopOutdatedVersion"]).Should(BeNumerically("==", 2))
 			})
 		})
 
@@ -201,5 +518,21 @@ var _ = Describe("Metrics Accountant", func() {
 				Ω(err).Should(Equal(errors.New("oops")))
 			})
 		})
+
+		Context("when the store fails to get a metric that is not being incremented", func() {
+			BeforeEach(func() {
+				fakeStoreAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("ReceivedHeartbeats|SendLatency|Ack", errors.New("oops"))
+				fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("ReceivedHeartbeats|SendLatency|Ack", errors.New("oops"))
+			})
+
+			It("should read and write only the metrics it increments", func() {
+				err := accountant.IncrementSentMessageMetrics(starts, stops)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				value, err := store.GetMetric("StartMissing")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(value).Should(BeNumerically("==", 2))
+			})
+		})
 	})
 })
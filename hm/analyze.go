@@ -4,20 +4,25 @@ import (
 	"github.com/cloudfoundry/hm9000/analyzer"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/yagnats"
 
+	"fmt"
 	"os"
+	"time"
 )
 
 func Analyze(l logger.Logger, conf *config.Config, poll bool) {
 	store, _ := connectToStore(l, conf)
+	messageBus := connectToMessageBus(l, conf)
 
 	if poll {
 		l.Info("Starting Analyze Daemon...")
 
 		adapter, _ := connectToStoreAdapter(l, conf)
 		err := Daemonize("Analyzer", func() error {
-			return analyze(l, conf, store)
+			return analyze(l, conf, messageBus, store)
 		}, conf.AnalyzerPollingInterval(), conf.AnalyzerTimeout(), l, adapter)
 
 		if err != nil {
@@ -26,7 +31,7 @@ func Analyze(l logger.Logger, conf *config.Config, poll bool) {
 		l.Info("Analyze Daemon is Down")
 		os.Exit(1)
 	} else {
-		err := analyze(l, conf, store)
+		err := analyze(l, conf, messageBus, store)
 		if err != nil {
 			os.Exit(1)
 		} else {
@@ -35,10 +40,43 @@ func Analyze(l logger.Logger, conf *config.Config, poll bool) {
 	}
 }
 
-func analyze(l logger.Logger, conf *config.Config, store store.Store) error {
+func AnalyzeDryRun(l logger.Logger, conf *config.Config) {
+	store, _ := connectToStore(l, conf)
+
+	//Plan never publishes, so the dry run does not need the message bus
+	plan, err := analyzer.New(nil, store, metricsaccountant.New(store), buildTimeProvider(l), l, conf).Plan()
+	if err != nil {
+		fmt.Printf("Failed to analyze: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Analysis Plan (dry run) - Current timestamp %d - Policy %s\n", plan.Timestamp, conf.AnalyzerPolicy)
+	fmt.Printf("====================\n")
+	if plan.IsEmpty() {
+		fmt.Printf("Nothing to do\n")
+	}
+	for _, line := range plan.Describe() {
+		fmt.Printf("%s\n", line)
+	}
+	if plan.MassStopCircuitBreakerTripped {
+		fmt.Printf("Mass stop circuit breaker tripped: %d stop messages would be refused\n", len(plan.RefusedStopMessages()))
+	}
+	for _, pendingStaging := range plan.StuckStagings {
+		fmt.Printf("Would report app stuck in staging: Guid: %s | Version: %s | pending since %s\n", pendingStaging.AppGuid, pendingStaging.AppVersion, time.Unix(pendingStaging.PendingSince, 0).UTC().Format(time.RFC3339))
+	}
+	if plan.ShadowPolicy != "" {
+		fmt.Printf("Shadow policy %s: %d diffs\n", plan.ShadowPolicy, len(plan.ShadowPolicyDiffs))
+		for _, diff := range plan.ShadowPolicyDiffs {
+			fmt.Printf("  %s\n", describeShadowPolicyDiff(diff))
+		}
+	}
+	os.Exit(0)
+}
+
+func analyze(l logger.Logger, conf *config.Config, messageBus yagnats.NATSClient, store store.Store) error {
 	l.Info("Analyzing...")
 
-	analyzer := analyzer.New(store, buildTimeProvider(l), l, conf)
+	analyzer := analyzer.New(messageBus, store, metricsaccountant.New(store), buildTimeProvider(l), l, conf)
 	err := analyzer.Analyze()
 
 	if err != nil {
@@ -0,0 +1,72 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//AppPolicy shows, sets or deletes the policy overriding HM9000's restart behaviour for the given app.
+//Pass the policy as JSON to set it.
+func AppPolicy(l logger.Logger, conf *config.Config, appGuid string, encodedPolicy string, deletePolicy bool) {
+	if appGuid == "" {
+		fmt.Printf("App guid required\n")
+		os.Exit(1)
+	}
+
+	store, _ := connectToStore(l, conf)
+
+	policies, err := store.GetAppPolicies()
+	if err != nil {
+		fmt.Printf("Failed to fetch app policies: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	existingPolicy, hasPolicy := policies[appGuid]
+
+	if deletePolicy {
+		if !hasPolicy {
+			fmt.Printf("No policy for %s\n", appGuid)
+			os.Exit(1)
+		}
+
+		err = store.DeleteAppPolicies(existingPolicy)
+		if err != nil {
+			fmt.Printf("Failed to delete app policy: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		l.Info("Deleted app policy", existingPolicy.LogDescription())
+		fmt.Printf("Deleted policy for %s\n", appGuid)
+		return
+	}
+
+	if encodedPolicy != "" {
+		policy, err := models.NewAppPolicyFromJSON([]byte(encodedPolicy))
+		if err != nil {
+			fmt.Printf("Failed to parse app policy: %s\n", err.Error())
+			os.Exit(1)
+		}
+		policy.AppGuid = appGuid
+
+		err = store.SaveAppPolicies(policy)
+		if err != nil {
+			fmt.Printf("Failed to save app policy: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		l.Info("Saved app policy", policy.LogDescription())
+		fmt.Printf("Saved policy for %s: %s\n", appGuid, policy.ToJSON())
+		return
+	}
+
+	if !hasPolicy {
+		fmt.Printf("No policy for %s\n", appGuid)
+		return
+	}
+
+	fmt.Printf("%s\n", existingPolicy.ToJSON())
+}
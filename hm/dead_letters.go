@@ -0,0 +1,128 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+//DeadLetters lists the messages the sender has given up on.
+//Requeueing a dead letter puts its message back in the queue to be sent right away;
+//purging it lets the analyzer enqueue the message again if it is still needed.
+func DeadLetters(l logger.Logger, conf *config.Config, requeueKey string, purgeKey string, purgeAll bool) {
+	store, _ := connectToStore(l, conf)
+
+	deadLetters, err := store.GetDeadLetters()
+	if err != nil {
+		fmt.Printf("Failed to fetch dead letters: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if requeueKey != "" {
+		deadLetter, found := deadLetters[requeueKey]
+		if !found {
+			fmt.Printf("No dead letter %s\n", requeueKey)
+			os.Exit(1)
+		}
+
+		requeueDeadLetter(l, store, buildTimeProvider(l).Time(), deadLetter)
+		fmt.Printf("Requeued %s\n", requeueKey)
+		return
+	}
+
+	if purgeKey != "" || purgeAll {
+		deadLettersToPurge := []models.DeadLetter{}
+		for key, deadLetter := range deadLetters {
+			if purgeAll || key == purgeKey {
+				deadLettersToPurge = append(deadLettersToPurge, deadLetter)
+			}
+		}
+
+		if len(deadLettersToPurge) == 0 && !purgeAll {
+			fmt.Printf("No dead letter %s\n", purgeKey)
+			os.Exit(1)
+		}
+
+		for _, deadLetter := range deadLettersToPurge {
+			purgeDeadLetter(l, store, deadLetter)
+		}
+		fmt.Printf("Purged %d dead letter(s)\n", len(deadLettersToPurge))
+		return
+	}
+
+	if len(deadLetters) == 0 {
+		fmt.Printf("No dead letters\n")
+		return
+	}
+
+	for _, deadLetter := range models.SortDeadLettersByDeadLetteredAt(deadLetters) {
+		fmt.Printf("%s\n", deadLetter.StoreKey())
+		fmt.Printf("  %s,%s", deadLetter.AppGuid, deadLetter.AppVersion)
+		if deadLetter.StartMessage != nil {
+			fmt.Printf(" start [%d] reason:%s", deadLetter.StartMessage.IndexToStart, deadLetter.StartMessage.StartReason)
+		}
+		if deadLetter.StopMessage != nil {
+			fmt.Printf(" stop %s reason:%s", deadLetter.StopMessage.InstanceGuid, deadLetter.StopMessage.StopReason)
+		}
+		fmt.Printf("\n")
+		fmt.Printf("  sent %d times between %s and %s, dead-lettered %s\n",
+			deadLetter.Attempts,
+			time.Unix(deadLetter.FirstAttemptAt, 0).Format(time.RFC3339),
+			time.Unix(deadLetter.LastAttemptAt, 0).Format(time.RFC3339),
+			time.Unix(deadLetter.DeadLetteredAt, 0).Format(time.RFC3339))
+	}
+}
+
+//requeueDeadLetter saves the dead-lettered message as a fresh message (with a new MessageId) that is due right away
+func requeueDeadLetter(l logger.Logger, store store.Store, now time.Time, deadLetter models.DeadLetter) {
+	var err error
+
+	if deadLetter.StartMessage != nil {
+		startMessage := *deadLetter.StartMessage
+		startMessage.PendingMessage = requeuedPendingMessage(now, startMessage.PendingMessage)
+		err = store.SavePendingStartMessages(startMessage)
+	} else if deadLetter.StopMessage != nil {
+		stopMessage := *deadLetter.StopMessage
+		stopMessage.PendingMessage = requeuedPendingMessage(now, stopMessage.PendingMessage)
+		err = store.SavePendingStopMessages(stopMessage)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed to requeue dead letter: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	l.Info("Requeued dead letter", deadLetter.LogDescription())
+	purgeDeadLetter(l, store, deadLetter)
+}
+
+func requeuedPendingMessage(now time.Time, message models.PendingMessage) models.PendingMessage {
+	message.MessageId = models.Guid()
+	message.EnqueuedOn = now.Unix()
+	message.SendOn = now.Unix()
+	message.SentOn = 0
+	message.AckState = models.PendingMessageAckStateNone
+	return message
+}
+
+//purgeDeadLetter also deletes the message's send attempts, so that the count starts afresh
+func purgeDeadLetter(l logger.Logger, store store.Store, deadLetter models.DeadLetter) {
+	err := store.DeleteDeadLetters(deadLetter)
+	if err != nil {
+		fmt.Printf("Failed to purge dead letter: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	err = store.DeleteSendAttempts(models.SendAttempts{MessageType: deadLetter.MessageType, MessageKey: deadLetter.MessageKey})
+	if err != nil {
+		fmt.Printf("Failed to delete send attempts: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	l.Info("Purged dead letter", deadLetter.LogDescription())
+}
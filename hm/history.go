@@ -0,0 +1,49 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+func History(l logger.Logger, conf *config.Config, appGuid string) {
+	if appGuid == "" {
+		fmt.Printf("App guid required\n")
+		os.Exit(1)
+	}
+
+	store, _ := connectToStore(l, conf)
+
+	events, err := store.GetAppHistory(appGuid)
+	if err != nil {
+		fmt.Printf("Failed to fetch history: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("History for %s - %d events\n", appGuid, len(events))
+	fmt.Printf("====================\n")
+
+	for _, event := range events {
+		fmt.Printf("%s [%s] %s %s: %s\n", time.Unix(event.Timestamp, 0).UTC().Format(time.RFC3339), event.Component, event.EventType, event.AppVersion, event.Description)
+		if event.Repeats > 0 {
+			fmt.Printf("    repeated %d times since %s\n", event.Repeats, time.Unix(event.FirstTimestamp, 0).UTC().Format(time.RFC3339))
+		}
+
+		keys := sort.StringSlice{}
+		for key := range event.Details {
+			keys = append(keys, key)
+		}
+		sort.Sort(keys)
+
+		details := []string{}
+		for _, key := range keys {
+			details = append(details, fmt.Sprintf("%s:%s", key, event.Details[key]))
+		}
+		fmt.Printf("    %s\n", strings.Join(details, " "))
+	}
+}
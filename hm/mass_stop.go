@@ -0,0 +1,36 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+//AllowMassStops overrides the mass-stop circuit breaker for mass_stop_override_duration_in_heartbeats.
+//Pass revoke to put the circuit breaker back in place early.
+func AllowMassStops(l logger.Logger, conf *config.Config, revoke bool) {
+	store, _ := connectToStore(l, conf)
+
+	if revoke {
+		err := store.RevokeMassStopOverride()
+		if err != nil {
+			fmt.Printf("Failed to revoke the mass stop override: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		l.Info("Revoked mass stop override")
+		fmt.Printf("Revoked the mass stop override\n")
+		return
+	}
+
+	err := store.AllowMassStops(buildTimeProvider(l).Time())
+	if err != nil {
+		fmt.Printf("Failed to allow mass stops: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	l.Info("Allowed mass stops", map[string]string{"Duration": conf.MassStopOverrideDuration().String()})
+	fmt.Printf("Allowing mass stops for %s\n", conf.MassStopOverrideDuration())
+}
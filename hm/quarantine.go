@@ -0,0 +1,54 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//LiftQuarantine lifts the quarantine on the given app version.
+//Pass a negative index to lift the quarantine on every index of the app.
+func LiftQuarantine(l logger.Logger, conf *config.Config, appGuid string, appVersion string, index int) {
+	if appGuid == "" || appVersion == "" {
+		fmt.Printf("App guid and app version required\n")
+		os.Exit(1)
+	}
+
+	store, _ := connectToStore(l, conf)
+
+	quarantines, err := store.GetQuarantines()
+	if err != nil {
+		fmt.Printf("Failed to fetch quarantines: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	quarantinesToLift := []models.Quarantine{}
+	for _, quarantine := range quarantines {
+		if quarantine.AppGuid != appGuid || quarantine.AppVersion != appVersion {
+			continue
+		}
+		if index >= 0 && quarantine.InstanceIndex != index {
+			continue
+		}
+		quarantinesToLift = append(quarantinesToLift, quarantine)
+	}
+
+	if len(quarantinesToLift) == 0 {
+		fmt.Printf("No matching quarantines for %s,%s\n", appGuid, appVersion)
+		os.Exit(1)
+	}
+
+	err = store.LiftQuarantines(quarantinesToLift...)
+	if err != nil {
+		fmt.Printf("Failed to lift quarantines: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	for _, quarantine := range quarantinesToLift {
+		l.Info("Lifted quarantine", quarantine.LogDescription())
+		fmt.Printf("Lifted quarantine on [%d] for %s,%s\n", quarantine.InstanceIndex, appGuid, appVersion)
+	}
+}
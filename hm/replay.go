@@ -0,0 +1,125 @@
+package hm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/analyzer"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/sender"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+//Replay restores a snapshot into an in-memory store and runs a single analyzer and sender pass against it at the given time.
+//Nothing leaves the process: the start and stop messages the sender would have published are printed instead.
+func Replay(l logger.Logger, conf *config.Config, snapshotPath string, replayTime string) {
+	if snapshotPath == "" {
+		fmt.Printf("Snapshot file required\n")
+		os.Exit(1)
+	}
+
+	encoded, err := ioutil.ReadFile(snapshotPath)
+	if err != nil {
+		fmt.Printf("Failed to read snapshot: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	snapshot, err := store.NewSnapshotFromJSON(encoded)
+	if err != nil {
+		fmt.Printf("Failed to parse snapshot: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	replayAt := time.Unix(snapshot.Timestamp, 0)
+	if replayTime != "" {
+		replayAt, err = parseReplayTime(replayTime)
+		if err != nil {
+			fmt.Printf("Failed to parse time (expected a unix timestamp or RFC3339): %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	err = ReplaySnapshot(l, conf, snapshot, replayAt, os.Stdout)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+//ReplaySnapshot does the work of Replay, writing its report to out
+func ReplaySnapshot(l logger.Logger, conf *config.Config, snapshot store.Snapshot, replayAt time.Time, out io.Writer) error {
+	timeProvider := newReplayTimeProvider(replayAt)
+
+	replayStore := store.NewStore(conf, newMemoryStoreAdapter(), l)
+	err := replayStore.RestoreSnapshot(snapshot)
+	if err != nil {
+		return fmt.Errorf("Failed to restore snapshot: %s", err.Error())
+	}
+
+	fmt.Fprintf(out, "Replay of snapshot taken at %s - Replaying at %s (timestamp %d)\n", time.Unix(snapshot.Timestamp, 0).UTC().Format(time.RFC3339), replayAt.UTC().Format(time.RFC3339), replayAt.Unix())
+	if snapshot.SchemaVersion != conf.StoreSchemaVersion {
+		fmt.Fprintf(out, "WARNING: the snapshot has schema version %d but the config has %d\n", snapshot.SchemaVersion, conf.StoreSchemaVersion)
+	}
+	err = replayStore.VerifyFreshness(replayAt)
+	if err == nil {
+		fmt.Fprintf(out, "Store is fresh\n")
+	} else {
+		fmt.Fprintf(out, "STORE IS NOT FRESH: %s\n", err.Error())
+	}
+	fmt.Fprintf(out, "====================\n")
+
+	//quarantine and stuck staging events are not start or stop commands, so the analyzer's are dropped
+	replayAnalyzer := analyzer.New(&discardingMessageBus{}, replayStore, metricsaccountant.New(replayStore), timeProvider, l, conf)
+
+	plan, err := replayAnalyzer.Plan()
+	if err != nil {
+		return fmt.Errorf("Analyzer failed: %s", err.Error())
+	}
+
+	fmt.Fprintf(out, "Analysis Plan:\n")
+	if plan.IsEmpty() {
+		fmt.Fprintf(out, "Nothing to do\n")
+	}
+	for _, line := range plan.Describe() {
+		fmt.Fprintf(out, "%s\n", line)
+	}
+
+	//apply the plan that was printed rather than planning again
+	err = replayAnalyzer.Apply(plan)
+	if err != nil {
+		return fmt.Errorf("Analyzer failed: %s", err.Error())
+	}
+
+	transport := &recordingTransport{conf: conf}
+	err = sender.New(replayStore, metricsaccountant.New(replayStore), conf, transport, timeProvider, sender.NewRateLimiter(conf), l).Send()
+	if err != nil {
+		return fmt.Errorf("Sender failed: %s", err.Error())
+	}
+
+	fmt.Fprintf(out, "====================\n")
+	if len(transport.sent) == 0 {
+		fmt.Fprintf(out, "Would publish: NOTHING\n")
+		return nil
+	}
+
+	fmt.Fprintf(out, "Would publish:\n")
+	for _, line := range transport.sent {
+		fmt.Fprintf(out, "  %s\n", line)
+	}
+
+	return nil
+}
+
+func parseReplayTime(replayTime string) (time.Time, error) {
+	timestamp, err := strconv.ParseInt(replayTime, 10, 64)
+	if err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+	return time.Parse(time.RFC3339, replayTime)
+}
@@ -0,0 +1,162 @@
+package hm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/yagnats"
+)
+
+//The replay runs the analyzer and sender against these instead of etcd, NATS and the clock.
+//Each implements only what a replay pass uses; the embedded interfaces are nil, so anything else panics.
+
+//replayTimeProvider stops the clock at the replay time.  Sleeps (the sender's publish retries) return at once.
+type replayTimeProvider struct {
+	timeprovider.TimeProvider
+	time time.Time
+}
+
+func newReplayTimeProvider(replayAt time.Time) *replayTimeProvider {
+	return &replayTimeProvider{
+		TimeProvider: timeprovider.NewTimeProvider(),
+		time:         replayAt,
+	}
+}
+
+func (provider *replayTimeProvider) Time() time.Time {
+	return provider.time
+}
+
+func (provider *replayTimeProvider) Sleep(d time.Duration) {}
+
+//discardingMessageBus drops everything published on it
+type discardingMessageBus struct {
+	yagnats.NATSClient
+}
+
+func (bus *discardingMessageBus) Publish(subject string, payload []byte) error {
+	return nil
+}
+
+//recordingTransport records the start and stop messages the sender would have published, with the NATS subject each would have gone to
+type recordingTransport struct {
+	conf *config.Config
+	sent []string
+}
+
+func (transport *recordingTransport) SendStart(message models.StartMessage, payload []byte) error {
+	transport.sent = append(transport.sent, fmt.Sprintf("%s %s", transport.conf.SenderNatsStartSubject, string(payload)))
+	return nil
+}
+
+func (transport *recordingTransport) SendStop(message models.StopMessage, payload []byte) error {
+	transport.sent = append(transport.sent, fmt.Sprintf("%s %s", transport.conf.SenderNatsStopSubject, string(payload)))
+	return nil
+}
+
+//memoryStoreAdapter keeps the store's leaf nodes in a map; directories are implied by the leaves' keys.
+//TTLs are ignored, so nothing expires during a replay.
+type memoryStoreAdapter struct {
+	storeadapter.StoreAdapter
+	values map[string][]byte
+}
+
+func newMemoryStoreAdapter() *memoryStoreAdapter {
+	return &memoryStoreAdapter{
+		values: map[string][]byte{},
+	}
+}
+
+func (adapter *memoryStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	for _, node := range nodes {
+		adapter.values[node.Key] = node.Value
+	}
+	return nil
+}
+
+func (adapter *memoryStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	value, present := adapter.values[key]
+	if present {
+		return storeadapter.StoreNode{Key: key, Value: value}, nil
+	}
+
+	if len(adapter.keysUnder(key)) > 0 {
+		return storeadapter.StoreNode{}, storeadapter.ErrorNodeIsDirectory
+	}
+
+	return storeadapter.StoreNode{}, storeadapter.ErrorKeyNotFound
+}
+
+func (adapter *memoryStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	value, present := adapter.values[key]
+	if present {
+		return storeadapter.StoreNode{Key: key, Value: value}, nil
+	}
+
+	keys := adapter.keysUnder(key)
+	if len(keys) == 0 {
+		return storeadapter.StoreNode{}, storeadapter.ErrorKeyNotFound
+	}
+
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	dir := storeadapter.StoreNode{Key: key, Dir: true, ChildNodes: []storeadapter.StoreNode{}}
+	listed := map[string]bool{}
+	for _, leafKey := range keys {
+		//the child of key that the leaf is under
+		childKey := prefix + strings.SplitN(strings.TrimPrefix(leafKey, prefix), "/", 2)[0]
+		if listed[childKey] {
+			continue
+		}
+		listed[childKey] = true
+
+		_, isLeaf := adapter.values[childKey]
+		if isLeaf {
+			dir.ChildNodes = append(dir.ChildNodes, storeadapter.StoreNode{Key: childKey, Value: adapter.values[childKey]})
+		} else {
+			child, _ := adapter.ListRecursively(childKey)
+			dir.ChildNodes = append(dir.ChildNodes, child)
+		}
+	}
+
+	return dir, nil
+}
+
+//Delete removes leaves and directories alike; like etcd, it fails for a key that is not there
+func (adapter *memoryStoreAdapter) Delete(keys ...string) error {
+	var firstErr error
+	for _, key := range keys {
+		_, present := adapter.values[key]
+		under := adapter.keysUnder(key)
+		if !present && len(under) == 0 {
+			if firstErr == nil {
+				firstErr = storeadapter.ErrorKeyNotFound
+			}
+			continue
+		}
+
+		delete(adapter.values, key)
+		for _, leafKey := range under {
+			delete(adapter.values, leafKey)
+		}
+	}
+	return firstErr
+}
+
+//keysUnder returns the sorted keys of the leaves below the directory key
+func (adapter *memoryStoreAdapter) keysUnder(key string) []string {
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	keys := []string{}
+	for leafKey := range adapter.values {
+		if strings.HasPrefix(leafKey, prefix) {
+			keys = append(keys, leafKey)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
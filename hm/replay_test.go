@@ -0,0 +1,116 @@
+package hm_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/hm"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Replaying a snapshot", func() {
+	var (
+		conf  *config.Config
+		store storepackage.Store
+		dea   appfixture.DeaFixture
+		out   *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		store = storepackage.NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+		dea = appfixture.NewDeaFixture()
+		out = &bytes.Buffer{}
+
+		store.BumpActualFreshness(time.Unix(100, 0))
+		store.BumpDesiredFreshness(time.Unix(100, 0))
+	})
+
+	replay := func() []string {
+		snapshot, err := store.TakeSnapshot(time.Unix(1000, 0))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ReplaySnapshot(fakelogger.NewFakeLogger(), conf, snapshot, time.Unix(1000, 0), out)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+
+	wouldPublish := func(lines []string) []string {
+		for i, line := range lines {
+			if line == "Would publish:" {
+				return lines[i+1:]
+			}
+		}
+		return []string{}
+	}
+
+	Context("when nothing needs to be done", func() {
+		It("should say so", func() {
+			lines := replay()
+			Ω(lines[0]).Should(Equal("Replay of snapshot taken at 1970-01-01T00:16:40Z - Replaying at 1970-01-01T00:16:40Z (timestamp 1000)"))
+			Ω(lines).Should(ContainElement("Store is fresh"))
+			Ω(lines).Should(ContainElement("Nothing to do"))
+			Ω(lines[len(lines)-1]).Should(Equal("Would publish: NOTHING"))
+		})
+	})
+
+	Context("when the snapshot holds a start message that is due and an instance that has crashed too often", func() {
+		var missingApp, crashedApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			conf.NumberOfCrashesBeforeQuarantine = 3
+
+			missingApp = dea.GetApp(0)
+			crashedApp = dea.GetApp(1)
+
+			store.SyncDesiredState(missingApp.DesiredState(1), crashedApp.DesiredState(1))
+			store.SyncHeartbeats(dea.HeartbeatWith(crashedApp.CrashedInstanceHeartbeatAtIndex(0)))
+			store.SaveCrashCounts(models.CrashCount{
+				AppGuid:       crashedApp.AppGuid,
+				AppVersion:    crashedApp.AppVersion,
+				InstanceIndex: 0,
+				CrashCount:    3,
+				CreatedAt:     900,
+			})
+			store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, missingApp.AppGuid, missingApp.AppVersion, 0, 1, models.PendingStartMessageReasonMissing))
+		})
+
+		It("should print only the start and stop messages the sender would publish", func() {
+			published := wouldPublish(replay())
+			Ω(published).Should(HaveLen(1))
+			Ω(published[0]).Should(HavePrefix("  " + conf.SenderNatsStartSubject + " {"))
+			Ω(published[0]).Should(ContainSubstring(missingApp.AppGuid))
+
+			Ω(out.String()).ShouldNot(ContainSubstring(conf.AnalyzerNatsQuarantinedSubject))
+		})
+
+		It("should quarantine the crashed instance in the replayed plan without publishing it", func() {
+			lines := replay()
+			Ω(strings.Join(lines, "\n")).Should(ContainSubstring(crashedApp.AppGuid))
+			for _, line := range wouldPublish(lines) {
+				Ω(line).ShouldNot(ContainSubstring(crashedApp.AppGuid))
+			}
+		})
+	})
+
+	It("should not touch the store the snapshot was taken from", func() {
+		app := dea.GetApp(0)
+		store.SyncDesiredState(app.DesiredState(1))
+		store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1, models.PendingStartMessageReasonMissing))
+
+		replay()
+
+		messages, err := store.GetPendingStartMessages()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(messages).Should(HaveLen(1))
+	})
+})
@@ -12,8 +12,9 @@ import (
 )
 
 func Send(l logger.Logger, conf *config.Config, poll bool) {
-	messageBus := connectToMessageBus(l, conf)
+	transport := buildCommandTransport(l, conf)
 	store, _ := connectToStore(l, conf)
+	rateLimiter := sender.NewRateLimiter(conf)
 
 	if poll {
 		l.Info("Starting Sender Daemon...")
@@ -21,7 +22,7 @@ func Send(l logger.Logger, conf *config.Config, poll bool) {
 		adapter, _ := connectToStoreAdapter(l, conf)
 
 		err := Daemonize("Sender", func() error {
-			return send(l, conf, messageBus, store)
+			return send(l, conf, transport, store, rateLimiter)
 		}, conf.SenderPollingInterval(), conf.SenderTimeout(), l, adapter)
 		if err != nil {
 			l.Error("Sender Daemon Errored", err)
@@ -29,7 +30,7 @@ func Send(l logger.Logger, conf *config.Config, poll bool) {
 		l.Info("Sender Daemon is Down")
 		os.Exit(1)
 	} else {
-		err := send(l, conf, messageBus, store)
+		err := send(l, conf, transport, store, rateLimiter)
 		if err != nil {
 			os.Exit(1)
 		} else {
@@ -38,10 +39,10 @@ func Send(l logger.Logger, conf *config.Config, poll bool) {
 	}
 }
 
-func send(l logger.Logger, conf *config.Config, messageBus yagnats.NATSClient, store store.Store) error {
+func send(l logger.Logger, conf *config.Config, transport sender.CommandTransport, store store.Store, rateLimiter *sender.RateLimiter) error {
 	l.Info("Sending...")
 
-	sender := sender.New(store, metricsaccountant.New(store), conf, messageBus, buildTimeProvider(l), l)
+	sender := sender.New(store, metricsaccountant.New(store), conf, transport, buildTimeProvider(l), rateLimiter, l)
 	err := sender.Send()
 
 	if err != nil {
@@ -52,3 +53,19 @@ func send(l logger.Logger, conf *config.Config, messageBus yagnats.NATSClient, s
 		return nil
 	}
 }
+
+//buildCommandTransport only connects to the message bus if the sender publishes over NATS
+func buildCommandTransport(l logger.Logger, conf *config.Config) sender.CommandTransport {
+	var messageBus yagnats.NATSClient
+	if sender.IsNATSTransport(conf) {
+		messageBus = connectToMessageBus(l, conf)
+	}
+
+	transport, err := sender.NewCommandTransport(conf, messageBus)
+	if err != nil {
+		l.Error("Failed to build the sender transport", err)
+		os.Exit(1)
+	}
+
+	return transport
+}
@@ -0,0 +1,42 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+func ShadowPolicyDiffs(l logger.Logger, conf *config.Config) {
+	store, _ := connectToStore(l, conf)
+
+	diffs, err := store.GetShadowPolicyDiffs()
+	if err != nil {
+		fmt.Printf("Failed to fetch shadow policy diffs: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Shadow Policy Diffs - %d diffs\n", len(diffs))
+	fmt.Printf("====================\n")
+
+	for _, diff := range diffs {
+		fmt.Printf("%s %s\n", time.Unix(diff.Timestamp, 0).UTC().Format(time.RFC3339), describeShadowPolicyDiff(diff))
+	}
+}
+
+func describeShadowPolicyDiff(diff models.ShadowPolicyDiff) string {
+	producedBy := diff.Policy
+	if diff.OnlyIn == models.ShadowPolicyDiffOnlyInShadow {
+		producedBy = diff.ShadowPolicy + " (shadow)"
+	}
+
+	message := fmt.Sprintf("index:%d", diff.IndexToStart)
+	if diff.MessageType == "stop" {
+		message = fmt.Sprintf("instance:%s", diff.InstanceGuid)
+	}
+
+	return fmt.Sprintf("only %s would %s Guid: %s | Version: %s %s reason:%s", producedBy, diff.MessageType, diff.AppGuid, diff.AppVersion, message, diff.Reason)
+}
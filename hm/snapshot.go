@@ -0,0 +1,34 @@
+package hm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+func Snapshot(l logger.Logger, conf *config.Config, out string) {
+	if out == "" {
+		fmt.Printf("Output file required\n")
+		os.Exit(1)
+	}
+
+	store, _ := connectToStore(l, conf)
+
+	snapshot, err := store.TakeSnapshot(buildTimeProvider(l).Time())
+	if err != nil {
+		fmt.Printf("Failed to take snapshot: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	err = ioutil.WriteFile(out, snapshot.ToJSON(), 0644)
+	if err != nil {
+		fmt.Printf("Failed to write snapshot: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote snapshot of %d nodes taken at %s to %s\n", len(snapshot.Nodes), time.Unix(snapshot.Timestamp, 0).UTC().Format(time.RFC3339), out)
+}
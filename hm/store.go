@@ -59,11 +59,50 @@ func dumpStructured(l logger.Logger, conf *config.Config) {
 	}
 	sort.Sort(appKeys)
 	for _, appKey := range appKeys {
-		dumpApp(apps[appKey], starts, stops, timeProvider)
+		dumpApp(apps[appKey], starts, stops, timeProvider, conf)
 	}
+
+	pendingStagings, err := store.GetPendingStagings()
+	if err != nil {
+		fmt.Printf("Failed to fetch pending stagings: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	dumpPendingStagings(pendingStagings, timeProvider, conf)
 }
 
-func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stops map[string]models.PendingStopMessage, timeProvider timeprovider.TimeProvider) {
+func dumpPendingStagings(pendingStagings map[string]models.PendingStaging, timeProvider timeprovider.TimeProvider, conf *config.Config) {
+	fmt.Printf("\n")
+	fmt.Printf("====================\n")
+	if len(pendingStagings) == 0 {
+		fmt.Printf("Pending Staging: NONE\n")
+		return
+	}
+
+	keys := sort.StringSlice{}
+	for key := range pendingStagings {
+		keys = append(keys, key)
+	}
+	sort.Sort(keys)
+
+	fmt.Printf("Pending Staging:\n")
+	for _, key := range keys {
+		pendingStaging := pendingStagings[key]
+		message := []string{}
+		message = append(message, fmt.Sprintf("Guid: %s | Version: %s", pendingStaging.AppGuid, pendingStaging.AppVersion))
+		message = append(message, fmt.Sprintf("pending:%s", pendingStaging.TimePending(timeProvider.Time())))
+		if pendingStaging.IsStuck(timeProvider.Time(), conf.StagingTimeout()) {
+			message = append(message, "STUCK")
+		}
+		if pendingStaging.IsReported() {
+			message = append(message, fmt.Sprintf("reported:%s", time.Unix(pendingStaging.ReportedAt, 0).UTC().Format(time.RFC3339)))
+		}
+
+		fmt.Printf("  %s\n", strings.Join(message, " "))
+	}
+}
+
+func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stops map[string]models.PendingStopMessage, timeProvider timeprovider.TimeProvider, conf *config.Config) {
 	fmt.Printf("\n")
 	fmt.Printf("Guid: %s | Version: %s\n", app.AppGuid, app.AppVersion)
 	if app.IsDesired() {
@@ -89,6 +128,14 @@ func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stop
 		fmt.Printf("\n")
 	}
 
+	if len(app.Quarantines) != 0 {
+		fmt.Printf("  QUARANTINED:")
+		for _, quarantine := range app.Quarantines {
+			fmt.Printf(" [%d]:%d crashes, since %s", quarantine.InstanceIndex, quarantine.CrashCount, time.Unix(quarantine.QuarantinedAt, 0).UTC().Format(time.RFC3339))
+		}
+		fmt.Printf("\n")
+	}
+
 	appStarts := []models.PendingStartMessage{}
 	appStops := []models.PendingStopMessage{}
 
@@ -110,11 +157,15 @@ func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stop
 			message := []string{}
 			message = append(message, fmt.Sprintf("[%d]", start.IndexToStart))
 			message = append(message, fmt.Sprintf("priority:%.2f", start.Priority))
+			message = append(message, fmt.Sprintf("effective_priority:%.2f", start.EffectivePriority(timeProvider.Time(), conf.StartPriorityAgingPerSecond())))
 			if start.SkipVerification {
 				message = append(message, "NO VERIFICATION")
 			}
 			if start.SentOn != 0 {
 				message = append(message, "send:SENT")
+				if start.AckState != models.PendingMessageAckStateNone {
+					message = append(message, fmt.Sprintf("ack:%s", start.AckState))
+				}
 				message = append(message, fmt.Sprintf("delete:%s", time.Unix(start.SentOn+int64(start.KeepAlive), 0).Sub(timeProvider.Time())))
 			} else {
 				message = append(message, fmt.Sprintf("send:%s", time.Unix(start.SendOn, 0).Sub(timeProvider.Time())))
@@ -131,6 +182,9 @@ func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stop
 			message = append(message, stop.InstanceGuid)
 			if stop.SentOn != 0 {
 				message = append(message, "send:SENT")
+				if stop.AckState != models.PendingMessageAckStateNone {
+					message = append(message, fmt.Sprintf("ack:%s", stop.AckState))
+				}
 				message = append(message, fmt.Sprintf("delete:%s", time.Unix(stop.SentOn+int64(stop.KeepAlive), 0).Sub(timeProvider.Time())))
 			} else {
 				message = append(message, fmt.Sprintf("send:%s", time.Unix(stop.SendOn, 0).Sub(timeProvider.Time())))
@@ -5,9 +5,11 @@ import (
 
 	"github.com/cloudfoundry/gosteno"
 
+	"github.com/cloudfoundry/hm9000/analyzer"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/hm"
+	"github.com/cloudfoundry/hm9000/sender"
 	"github.com/codegangsta/cli"
 
 	"os"
@@ -51,10 +53,15 @@ func main() {
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
 				cli.BoolFlag{"poll", "If true, poll repeatedly with an interval defined in config"},
+				cli.BoolFlag{"dry-run", "If true, print what the analyzer would enqueue without modifying the store"},
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "analyzer")
-				hm.Analyze(logger, conf, c.Bool("poll"))
+				if c.Bool("dry-run") {
+					hm.AnalyzeDryRun(logger, conf)
+				} else {
+					hm.Analyze(logger, conf, c.Bool("poll"))
+				}
 			},
 		},
 		{
@@ -119,6 +126,89 @@ func main() {
 				hm.Shred(logger, conf, c.Bool("poll"))
 			},
 		},
+		{
+			Name:        "history",
+			Description: "Prints the recorded analyzer and sender decisions for an app",
+			Usage:       "hm history --config=/path/to/config --app-guid=APP_GUID",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				cli.StringFlag{"app-guid", "", "The guid of the app"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "history")
+				hm.History(logger, conf, c.String("app-guid"))
+			},
+		},
+		{
+			Name:        "shadow_policy_diffs",
+			Description: "Prints the recent disagreements between the analyzer policy and its shadow policy",
+			Usage:       "hm shadow_policy_diffs --config=/path/to/config",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "shadow_policy_diffs")
+				hm.ShadowPolicyDiffs(logger, conf)
+			},
+		},
+		{
+			Name:        "lift_quarantine",
+			Description: "Lifts the quarantine on a crash-looping app so that HM9000 starts it again",
+			Usage:       "hm lift_quarantine --config=/path/to/config --app-guid=APP_GUID --app-version=APP_VERSION --index=INDEX",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				cli.StringFlag{"app-guid", "", "The guid of the app"},
+				cli.StringFlag{"app-version", "", "The version of the app"},
+				cli.IntFlag{"index", -1, "The index to lift the quarantine on (all indices if omitted)"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "lift_quarantine")
+				hm.LiftQuarantine(logger, conf, c.String("app-guid"), c.String("app-version"), c.Int("index"))
+			},
+		},
+		{
+			Name:        "app_policy",
+			Description: "Shows, sets or deletes the policy overriding HM9000's restart behaviour for an app",
+			Usage:       "hm app_policy --config=/path/to/config --app-guid=APP_GUID [--policy=JSON | --delete]",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				cli.StringFlag{"app-guid", "", "The guid of the app"},
+				cli.StringFlag{"policy", "", "The policy to set, as JSON (shows the current policy if omitted)"},
+				cli.BoolFlag{"delete", "If set, delete the app's policy"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "app_policy")
+				hm.AppPolicy(logger, conf, c.String("app-guid"), c.String("policy"), c.Bool("delete"))
+			},
+		},
+		{
+			Name:        "dead_letters",
+			Description: "Lists, requeues or purges the messages the sender gave up on",
+			Usage:       "hm dead_letters --config=/path/to/config [--requeue=KEY | --purge=KEY | --purge-all]",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				cli.StringFlag{"requeue", "", "The dead letter to put back in the queue"},
+				cli.StringFlag{"purge", "", "The dead letter to purge"},
+				cli.BoolFlag{"purge-all", "If set, purge every dead letter"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "dead_letters")
+				hm.DeadLetters(logger, conf, c.String("requeue"), c.String("purge"), c.Bool("purge-all"))
+			},
+		},
+		{
+			Name:        "allow_mass_stops",
+			Description: "Temporarily overrides the mass stop circuit breaker",
+			Usage:       "hm allow_mass_stops --config=/path/to/config [--revoke]",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				cli.BoolFlag{"revoke", "If set, revoke a previous override"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "allow_mass_stops")
+				hm.AllowMassStops(logger, conf, c.Bool("revoke"))
+			},
+		},
 		{
 			Name:        "dump",
 			Description: "Dumps contents of the data store",
@@ -132,6 +222,33 @@ func main() {
 				hm.Dump(logger, conf, c.Bool("raw"))
 			},
 		},
+		{
+			Name:        "snapshot",
+			Description: "Writes the parts of the store the analyzer and sender read to a file",
+			Usage:       "hm snapshot --config=/path/to/config --out=/path/to/snapshot.json",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				cli.StringFlag{"out", "", "Path to write the snapshot to"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "snapshot")
+				hm.Snapshot(logger, conf, c.String("out"))
+			},
+		},
+		{
+			Name:        "replay",
+			Description: "Replays an analyzer and sender pass against a snapshot, without etcd or NATS",
+			Usage:       "hm replay --config=/path/to/config --snapshot=/path/to/snapshot.json --time=TIME",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				cli.StringFlag{"snapshot", "", "Path to a snapshot written by hm snapshot"},
+				cli.StringFlag{"time", "", "The time to replay at, as a unix timestamp or RFC3339 (defaults to when the snapshot was taken)"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "replay")
+				hm.Replay(logger, conf, c.String("snapshot"), c.String("time"))
+			},
+		},
 	}
 
 	app.Run(os.Args)
@@ -145,6 +262,12 @@ func loadLoggerAndConfig(c *cli.Context, component string) (logger.Logger, *gost
 	}
 
 	conf, err := config.FromFile(configPath)
+	if err == nil {
+		err = analyzer.ValidateConfig(conf)
+	}
+	if err == nil {
+		err = sender.ValidateConfig(conf)
+	}
 	if err != nil {
 		fmt.Printf("Failed to load config: %s", err.Error())
 		os.Exit(1)
@@ -52,6 +52,10 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 	NumberOfDesiredApps := 0
 	NumberOfDesiredInstances := 0
 	NumberOfDesiredAppsPendingStaging := 0
+	NumberOfStuckStartingInstances := 0
+	NumberOfDesiredAppsStuckStaging := 0
+	NumberOfPendingStartMessages := 0
+	NumberOfPendingStopMessages := 0
 
 	defer func() {
 		context.Metrics = append(context.Metrics, instrumentation.Metric{
@@ -103,6 +107,26 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 			Name:  "NumberOfDesiredAppsPendingStaging",
 			Value: NumberOfDesiredAppsPendingStaging,
 		})
+
+		context.Metrics = append(context.Metrics, instrumentation.Metric{
+			Name:  "NumberOfStuckStartingInstances",
+			Value: NumberOfStuckStartingInstances,
+		})
+
+		context.Metrics = append(context.Metrics, instrumentation.Metric{
+			Name:  "NumberOfDesiredAppsStuckStaging",
+			Value: NumberOfDesiredAppsStuckStaging,
+		})
+
+		context.Metrics = append(context.Metrics, instrumentation.Metric{
+			Name:  "NumberOfPendingStartMessages",
+			Value: NumberOfPendingStartMessages,
+		})
+
+		context.Metrics = append(context.Metrics, instrumentation.Metric{
+			Name:  "NumberOfPendingStopMessages",
+			Value: NumberOfPendingStopMessages,
+		})
 	}()
 
 	messageMetrics, err := s.metricsAccountant.GetMetrics()
@@ -115,6 +139,23 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 		}
 	}
 
+	//the queues are read whether or not the store is fresh: a growing queue is what tells us the sender is not keeping up
+	pendingStartMessages, err := s.store.GetPendingStartMessages()
+	if err != nil {
+		s.logger.Error("Failed to fetch pending start messages", err)
+		NumberOfPendingStartMessages = -1
+	} else {
+		NumberOfPendingStartMessages = len(pendingStartMessages)
+	}
+
+	pendingStopMessages, err := s.store.GetPendingStopMessages()
+	if err != nil {
+		s.logger.Error("Failed to fetch pending stop messages", err)
+		NumberOfPendingStopMessages = -1
+	} else {
+		NumberOfPendingStopMessages = len(pendingStopMessages)
+	}
+
 	err = s.store.VerifyFreshness(s.timeProvider.Time())
 	if err != nil {
 		s.logger.Error("Failed to server metrics: store is not fresh", err)
@@ -128,6 +169,8 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 		NumberOfDesiredApps = -1
 		NumberOfDesiredInstances = -1
 		NumberOfDesiredAppsPendingStaging = -1
+		NumberOfStuckStartingInstances = -1
+		NumberOfDesiredAppsStuckStaging = -1
 		return
 	}
 
@@ -144,6 +187,8 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 		NumberOfDesiredApps = -1
 		NumberOfDesiredInstances = -1
 		NumberOfDesiredAppsPendingStaging = -1
+		NumberOfStuckStartingInstances = -1
+		NumberOfDesiredAppsStuckStaging = -1
 		return
 	}
 
@@ -172,6 +217,21 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 		NumberOfRunningInstances += app.NumberOfStartingOrRunningInstances()
 		NumberOfCrashedInstances += app.NumberOfCrashedInstances()
 		NumberOfCrashedIndices += app.NumberOfCrashedIndices()
+		NumberOfStuckStartingInstances += app.NumberOfStuckStartingInstances(s.timeProvider.Time(), s.config.StartingTimeout())
+	}
+
+	pendingStagings, err := s.store.GetPendingStagings()
+	if err != nil {
+		s.logger.Error("Failed to fetch pending stagings", err)
+		NumberOfDesiredAppsStuckStaging = -1
+		return
+	}
+
+	for appKey, pendingStaging := range pendingStagings {
+		app, found := apps[appKey]
+		if found && app.IsDesired() && app.Desired.PackageState == models.AppPackageStatePending && pendingStaging.IsStuck(s.timeProvider.Time(), s.config.StagingTimeout()) {
+			NumberOfDesiredAppsStuckStaging++
+		}
 	}
 
 	return
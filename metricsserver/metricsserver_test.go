@@ -24,10 +24,11 @@ var _ = Describe("Metrics Server", func() {
 		timeProvider      *faketimeprovider.FakeTimeProvider
 		metricsServer     *MetricsServer
 		metricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
+		conf              *config.Config
 	)
 
 	BeforeEach(func() {
-		conf, _ := config.DefaultConfig()
+		conf, _ = config.DefaultConfig()
 		storeAdapter = fakestoreadapter.New()
 		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
 		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
@@ -66,6 +67,37 @@ var _ = Describe("Metrics Server", func() {
 		})
 	})
 
+	Describe("queue metrics", func() {
+		BeforeEach(func() {
+			app := appfixture.NewAppFixture()
+			store.SavePendingStartMessages(
+				models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1, models.PendingStartMessageReasonMissing),
+				models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 1, 1, models.PendingStartMessageReasonMissing),
+			)
+			store.SavePendingStopMessages(
+				models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, "instance-guid", models.PendingStopMessageReasonExtra),
+			)
+		})
+
+		It("should emit the depth of the start and stop queues, even when the store is not fresh", func() {
+			context := metricsServer.Emit()
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfPendingStartMessages", Value: 2}))
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfPendingStopMessages", Value: 1}))
+		})
+
+		Context("when the queues fail to load", func() {
+			BeforeEach(func() {
+				storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("start", errors.New("oops"))
+			})
+
+			It("should emit -1 for the queue that failed", func() {
+				context := metricsServer.Emit()
+				Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfPendingStartMessages", Value: -1}))
+				Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfPendingStopMessages", Value: 1}))
+			})
+		})
+	})
+
 	Describe("app metrics", func() {
 		It("should have a name", func() {
 			context := metricsServer.Emit()
@@ -85,6 +117,8 @@ var _ = Describe("Metrics Server", func() {
 				Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredApps", Value: -1}))
 				Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredInstances", Value: -1}))
 				Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsPendingStaging", Value: -1}))
+				Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfStuckStartingInstances", Value: -1}))
+				Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsStuckStaging", Value: -1}))
 			})
 		})
 
@@ -116,6 +150,8 @@ var _ = Describe("Metrics Server", func() {
 					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredApps", Value: -1}))
 					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredInstances", Value: -1}))
 					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsPendingStaging", Value: -1}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfStuckStartingInstances", Value: -1}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsStuckStaging", Value: -1}))
 				})
 			})
 
@@ -139,6 +175,31 @@ var _ = Describe("Metrics Server", func() {
 					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredApps", Value: 0}))
 					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredInstances", Value: 0}))
 					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsPendingStaging", Value: 1}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsStuckStaging", Value: 0}))
+				})
+
+				Context("and it has been pending for longer than the staging timeout", func() {
+					BeforeEach(func() {
+						conf.StagingTimeoutInHeartbeats = 90
+						store.SavePendingStagings(models.NewPendingStaging(timeProvider.Time().Add(-conf.StagingTimeout()-time.Second), a.AppGuid, a.AppVersion))
+					})
+
+					It("should count it as stuck in staging", func() {
+						context := metricsServer.Emit()
+						Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsStuckStaging", Value: 1}))
+					})
+				})
+
+				Context("when the pending stagings fail to load", func() {
+					BeforeEach(func() {
+						storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("staging", errors.New("oops"))
+					})
+
+					It("should emit -1 for the number of apps stuck in staging", func() {
+						context := metricsServer.Emit()
+						Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsPendingStaging", Value: 1}))
+						Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsStuckStaging", Value: -1}))
+					})
 				})
 			})
 
@@ -191,6 +252,45 @@ var _ = Describe("Metrics Server", func() {
 				})
 			})
 
+			Context("when a desired app has an instance stuck in STARTING", func() {
+				BeforeEach(func() {
+					conf.StartingTimeoutInHeartbeats = 6
+
+					store.SyncDesiredState(a.DesiredState(3))
+
+					stuckHB := a.InstanceAtIndex(1).Heartbeat()
+					stuckHB.State = models.InstanceStateStarting
+					stuckHB.StateTimestamp = 0
+
+					startingHB := a.InstanceAtIndex(2).Heartbeat()
+					startingHB.State = models.InstanceStateStarting
+					startingHB.StateTimestamp = 90
+
+					store.SyncHeartbeats(dea.HeartbeatWith(
+						a.InstanceAtIndex(0).Heartbeat(),
+						stuckHB,
+						startingHB,
+					))
+				})
+
+				It("should count the stuck instance", func() {
+					context := metricsServer.Emit()
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfRunningInstances", Value: 3}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfStuckStartingInstances", Value: 1}))
+				})
+
+				Context("when stuck instance detection is disabled", func() {
+					BeforeEach(func() {
+						conf.StartingTimeoutInHeartbeats = 0
+					})
+
+					It("should not count any stuck instances", func() {
+						context := metricsServer.Emit()
+						Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfStuckStartingInstances", Value: 0}))
+					})
+				})
+			})
+
 			Context("when a desired app has crashed instances on some of the indices", func() {
 				BeforeEach(func() {
 					store.SyncDesiredState(a.DesiredState(3))
@@ -14,17 +14,19 @@ type App struct {
 	Desired            DesiredAppState
 	InstanceHeartbeats []InstanceHeartbeat
 	CrashCounts        map[int]CrashCount
+	Quarantines        map[int]Quarantine
 
 	instanceHeartbeatsByIndex map[int][]InstanceHeartbeat
 }
 
-func NewApp(appGuid string, appVersion string, desired DesiredAppState, instanceHeartbeats []InstanceHeartbeat, crashCounts map[int]CrashCount) *App {
+func NewApp(appGuid string, appVersion string, desired DesiredAppState, instanceHeartbeats []InstanceHeartbeat, crashCounts map[int]CrashCount, quarantines map[int]Quarantine) *App {
 	return &App{
 		AppGuid:                   appGuid,
 		AppVersion:                appVersion,
 		Desired:                   desired,
 		InstanceHeartbeats:        instanceHeartbeats,
 		CrashCounts:               crashCounts,
+		Quarantines:               quarantines,
 		instanceHeartbeatsByIndex: nil,
 	}
 }
@@ -37,6 +39,13 @@ func (a *App) ToJSON() []byte {
 		i++
 	}
 
+	quarantines := make([]Quarantine, len(a.Quarantines))
+	i = 0
+	for _, quarantine := range a.Quarantines {
+		quarantines[i] = quarantine
+		i++
+	}
+
 	appForJson := struct {
 		AppGuid    string `json:"droplet"`
 		AppVersion string `json:"version"`
@@ -44,12 +53,14 @@ func (a *App) ToJSON() []byte {
 		Desired            DesiredAppState     `json:"desired"`
 		InstanceHeartbeats []InstanceHeartbeat `json:"instance_heartbeats"`
 		CrashCounts        []CrashCount        `json:"crash_counts"`
+		Quarantines        []Quarantine        `json:"quarantines"`
 	}{
 		a.AppGuid,
 		a.AppVersion,
 		a.Desired,
 		a.InstanceHeartbeats,
 		crashCounts,
+		quarantines,
 	}
 
 	result, _ := json.Marshal(appForJson)
@@ -74,12 +85,18 @@ func (a *App) LogDescription() map[string]string {
 		crashCounts = append(crashCounts, fmt.Sprintf(`{"InstanceIndex":%d, "CrashCount":%d}`, crashCount.InstanceIndex, crashCount.CrashCount))
 	}
 
+	quarantinedIndices := []string{}
+	for _, quarantine := range a.Quarantines {
+		quarantinedIndices = append(quarantinedIndices, fmt.Sprintf("%d", quarantine.InstanceIndex))
+	}
+
 	return map[string]string{
 		"AppGuid":            a.AppGuid,
 		"AppVersion":         a.AppVersion,
 		"Desired":            desired,
 		"InstanceHeartbeats": "[" + strings.Join(instanceHeartbeats, ",") + "]",
 		"CrashCounts":        "[" + strings.Join(crashCounts, ",") + "]",
+		"QuarantinedIndices": "[" + strings.Join(quarantinedIndices, ",") + "]",
 	}
 }
 
@@ -202,6 +219,24 @@ func (a *App) HasStartingOrRunningInstanceAtIndex(index int) bool {
 	return false
 }
 
+func (a *App) StuckStartingInstancesAtIndex(index int, currentTime time.Time, timeout time.Duration) (instances []InstanceHeartbeat) {
+	instances = []InstanceHeartbeat{}
+	for _, heartbeat := range a.InstanceHeartbeatsAtIndex(index) {
+		if heartbeat.IsStuckStarting(currentTime, timeout) {
+			instances = append(instances, heartbeat)
+		}
+	}
+
+	return instances
+}
+
+//HasOnlyStuckStartingInstancesAtIndex returns true if there are STARTING or RUNNING instances
+//at the index and all of them are stuck in STARTING.
+func (a *App) HasOnlyStuckStartingInstancesAtIndex(index int, currentTime time.Time, timeout time.Duration) bool {
+	numberOfStuckInstances := len(a.StuckStartingInstancesAtIndex(index, currentTime, timeout))
+	return numberOfStuckInstances > 0 && numberOfStuckInstances == len(a.StartingOrRunningInstancesAtIndex(index))
+}
+
 func (a *App) HasCrashedInstanceAtIndex(index int) bool {
 	for _, heartbeat := range a.InstanceHeartbeatsAtIndex(index) {
 		if heartbeat.IsCrashed() {
@@ -226,6 +261,11 @@ func (a *App) CrashCountAtIndex(instanceIndex int, currentTime time.Time) CrashC
 	}
 }
 
+func (a *App) IsIndexQuarantined(instanceIndex int) bool {
+	_, found := a.Quarantines[instanceIndex]
+	return found
+}
+
 func (a *App) NumberOfDesiredIndicesReporting() (count int) {
 	for index := 0; a.IsIndexDesired(index); index++ {
 		if len(a.InstanceHeartbeatsAtIndex(index)) > 0 {
@@ -246,6 +286,16 @@ func (a *App) NumberOfStartingOrRunningInstances() (count int) {
 	return count
 }
 
+func (a *App) NumberOfStuckStartingInstances(currentTime time.Time, timeout time.Duration) (count int) {
+	for _, heartbeat := range a.InstanceHeartbeats {
+		if heartbeat.IsStuckStarting(currentTime, timeout) {
+			count++
+		}
+	}
+
+	return count
+}
+
 func (a *App) NumberOfCrashedInstances() (count int) {
 	for _, heartbeat := range a.InstanceHeartbeats {
 		if heartbeat.IsCrashed() {
@@ -277,6 +327,12 @@ func (a *App) InstanceHeartbeatsAtIndex(index int) (heartbeats []InstanceHeartbe
 	}
 }
 
+//IndexInstanceHeartbeats builds the lookup of heartbeats by index that App's methods otherwise build on first use.
+//Building it writes to the app, so call this before sharing an app between goroutines.
+func (a *App) IndexInstanceHeartbeats() {
+	a.verifyInstanceHeartbeatsByIndexIsReady()
+}
+
 func (a *App) verifyInstanceHeartbeatsByIndexIsReady() {
 	if a.instanceHeartbeatsByIndex == nil {
 		a.instanceHeartbeatsByIndex = make(map[int][]InstanceHeartbeat)
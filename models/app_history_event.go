@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+type AppHistoryEventType string
+
+const (
+	AppHistoryEventStartEnqueued AppHistoryEventType = "START_ENQUEUED"
+	AppHistoryEventStartSkipped  AppHistoryEventType = "START_SKIPPED"
+	AppHistoryEventStartSent     AppHistoryEventType = "START_SENT"
+	AppHistoryEventStartNotSent  AppHistoryEventType = "START_NOT_SENT"
+	AppHistoryEventStartDeleted  AppHistoryEventType = "START_DELETED"
+
+	AppHistoryEventStartAckResolved  AppHistoryEventType = "START_ACK_RESOLVED"
+	AppHistoryEventStartDeadLettered AppHistoryEventType = "START_DEAD_LETTERED"
+
+	AppHistoryEventStopEnqueued AppHistoryEventType = "STOP_ENQUEUED"
+	AppHistoryEventStopSkipped  AppHistoryEventType = "STOP_SKIPPED"
+	AppHistoryEventStopSent     AppHistoryEventType = "STOP_SENT"
+	AppHistoryEventStopNotSent  AppHistoryEventType = "STOP_NOT_SENT"
+	AppHistoryEventStopDeleted  AppHistoryEventType = "STOP_DELETED"
+	AppHistoryEventStopRefused  AppHistoryEventType = "STOP_REFUSED"
+
+	AppHistoryEventStopAckResolved  AppHistoryEventType = "STOP_ACK_RESOLVED"
+	AppHistoryEventStopDeadLettered AppHistoryEventType = "STOP_DEAD_LETTERED"
+
+	AppHistoryEventQuarantined       AppHistoryEventType = "QUARANTINED"
+	AppHistoryEventCrashCountDecayed AppHistoryEventType = "CRASH_COUNT_DECAYED"
+)
+
+//An AppHistoryEvent records a single decision the analyzer or sender made about an app.
+//A decision repeated pass after pass for the same message is recorded once: Repeats counts the repeats
+//and FirstTimestamp is when the decision was first made (see MergedInto).
+type AppHistoryEvent struct {
+	EventId     string              `json:"event_id"`
+	Timestamp   int64               `json:"timestamp"`
+	Component   string              `json:"component"`
+	EventType   AppHistoryEventType `json:"event_type"`
+	Description string              `json:"description"`
+	AppGuid     string              `json:"droplet"`
+	AppVersion  string              `json:"version"`
+	MessageId   string              `json:"message_id"`
+	Details     map[string]string   `json:"details"`
+
+	Repeats        int   `json:"repeats,omitempty"`
+	FirstTimestamp int64 `json:"first_timestamp,omitempty"`
+}
+
+func NewAppHistoryEvent(now time.Time, component string, eventType AppHistoryEventType, description string, message PendingMessage, details map[string]string) AppHistoryEvent {
+	return AppHistoryEvent{
+		EventId:     Guid(),
+		Timestamp:   now.Unix(),
+		Component:   component,
+		EventType:   eventType,
+		Description: description,
+		AppGuid:     message.AppGuid,
+		AppVersion:  message.AppVersion,
+		MessageId:   message.MessageId,
+		Details:     details,
+	}
+}
+
+func NewAppHistoryEventFromJSON(encoded []byte) (AppHistoryEvent, error) {
+	event := AppHistoryEvent{}
+	err := json.Unmarshal(encoded, &event)
+	if err != nil {
+		return AppHistoryEvent{}, err
+	}
+	return event, nil
+}
+
+func (event AppHistoryEvent) ToJSON() []byte {
+	encoded, _ := json.Marshal(event)
+	return encoded
+}
+
+func (event AppHistoryEvent) StoreKey() string {
+	return event.EventId
+}
+
+//IsRepeatOf is true for an event that records the same decision about the same message as another
+func (event AppHistoryEvent) IsRepeatOf(another AppHistoryEvent) bool {
+	return event.MessageId != "" && event.MessageId == another.MessageId && event.EventType == another.EventType && event.Description == another.Description
+}
+
+//MergedInto folds the event into an earlier event it repeats: the result replaces the earlier event (it has its id)
+//and counts one more repeat since the earlier event's first timestamp
+func (event AppHistoryEvent) MergedInto(earlier AppHistoryEvent) AppHistoryEvent {
+	event.EventId = earlier.EventId
+	event.Repeats = earlier.Repeats + 1
+	event.FirstTimestamp = earlier.FirstTimestamp
+	if event.FirstTimestamp == 0 {
+		event.FirstTimestamp = earlier.Timestamp
+	}
+	return event
+}
+
+type sortableAppHistoryEventsByTimestamp []AppHistoryEvent
+
+func (s sortableAppHistoryEventsByTimestamp) Len() int      { return len(s) }
+func (s sortableAppHistoryEventsByTimestamp) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortableAppHistoryEventsByTimestamp) Less(i, j int) bool {
+	return s[i].Timestamp < s[j].Timestamp
+}
+
+//SortAppHistoryEventsByTimestamp returns the events oldest first
+func SortAppHistoryEventsByTimestamp(events []AppHistoryEvent) []AppHistoryEvent {
+	sortedEvents := make(sortableAppHistoryEventsByTimestamp, len(events))
+	copy(sortedEvents, events)
+	sort.Stable(sortedEvents)
+	return sortedEvents
+}
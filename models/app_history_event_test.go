@@ -0,0 +1,98 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("AppHistoryEvent", func() {
+	var event AppHistoryEvent
+	var message PendingStartMessage
+
+	BeforeEach(func() {
+		message = NewPendingStartMessage(time.Unix(100, 0), 10, 4, "app-guid", "app-version", 1, 0.5, PendingStartMessageReasonCrashed)
+		event = NewAppHistoryEvent(time.Unix(120, 0), "sender", AppHistoryEventStartSent, "instance is not running at desired index", message.PendingMessage, message.LogDescription())
+	})
+
+	Describe("NewAppHistoryEvent", func() {
+		It("should populate the event from the message", func() {
+			Ω(event.EventId).ShouldNot(BeEmpty())
+			Ω(event.Timestamp).Should(BeNumerically("==", 120))
+			Ω(event.Component).Should(Equal("sender"))
+			Ω(event.EventType).Should(Equal(AppHistoryEventStartSent))
+			Ω(event.Description).Should(Equal("instance is not running at desired index"))
+			Ω(event.AppGuid).Should(Equal("app-guid"))
+			Ω(event.AppVersion).Should(Equal("app-version"))
+			Ω(event.MessageId).Should(Equal(message.MessageId))
+			Ω(event.Details).Should(Equal(message.LogDescription()))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("should round trip", func() {
+			decoded, err := NewAppHistoryEventFromJSON(event.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(event))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewAppHistoryEventFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("should be the event id", func() {
+			Ω(event.StoreKey()).Should(Equal(event.EventId))
+		})
+	})
+
+	Describe("repeated events", func() {
+		It("should be a repeat only of the same decision about the same message", func() {
+			repeat := NewAppHistoryEvent(time.Unix(130, 0), "sender", AppHistoryEventStartSent, "instance is not running at desired index", message.PendingMessage, message.LogDescription())
+			Ω(repeat.IsRepeatOf(event)).Should(BeTrue())
+
+			otherDescription := NewAppHistoryEvent(time.Unix(130, 0), "sender", AppHistoryEventStartSent, "start message sent", message.PendingMessage, message.LogDescription())
+			Ω(otherDescription.IsRepeatOf(event)).Should(BeFalse())
+
+			otherType := NewAppHistoryEvent(time.Unix(130, 0), "sender", AppHistoryEventStartNotSent, "instance is not running at desired index", message.PendingMessage, message.LogDescription())
+			Ω(otherType.IsRepeatOf(event)).Should(BeFalse())
+
+			otherMessage := NewPendingStartMessage(time.Unix(100, 0), 10, 4, "app-guid", "app-version", 1, 0.5, PendingStartMessageReasonCrashed)
+			otherMessageEvent := NewAppHistoryEvent(time.Unix(130, 0), "sender", AppHistoryEventStartSent, "instance is not running at desired index", otherMessage.PendingMessage, otherMessage.LogDescription())
+			Ω(otherMessageEvent.IsRepeatOf(event)).Should(BeFalse())
+		})
+
+		It("should never consider events without a message repeats", func() {
+			a := AppHistoryEvent{EventType: AppHistoryEventQuarantined, Description: "quarantined"}
+			Ω(a.IsRepeatOf(a)).Should(BeFalse())
+		})
+
+		It("should merge a repeat into the earlier event, counting the repeats", func() {
+			repeat := NewAppHistoryEvent(time.Unix(130, 0), "sender", AppHistoryEventStartSent, "instance is not running at desired index", message.PendingMessage, message.LogDescription())
+			merged := repeat.MergedInto(event)
+			Ω(merged.EventId).Should(Equal(event.EventId))
+			Ω(merged.Timestamp).Should(BeNumerically("==", 130))
+			Ω(merged.FirstTimestamp).Should(BeNumerically("==", 120))
+			Ω(merged.Repeats).Should(Equal(1))
+
+			again := NewAppHistoryEvent(time.Unix(140, 0), "sender", AppHistoryEventStartSent, "instance is not running at desired index", message.PendingMessage, message.LogDescription()).MergedInto(merged)
+			Ω(again.EventId).Should(Equal(event.EventId))
+			Ω(again.Timestamp).Should(BeNumerically("==", 140))
+			Ω(again.FirstTimestamp).Should(BeNumerically("==", 120))
+			Ω(again.Repeats).Should(Equal(2))
+		})
+	})
+
+	Describe("SortAppHistoryEventsByTimestamp", func() {
+		It("should sort the events oldest first", func() {
+			a := AppHistoryEvent{EventId: "a", Timestamp: 30}
+			b := AppHistoryEvent{EventId: "b", Timestamp: 10}
+			c := AppHistoryEvent{EventId: "c", Timestamp: 20}
+			Ω(SortAppHistoryEventsByTimestamp([]AppHistoryEvent{a, b, c})).Should(Equal([]AppHistoryEvent{b, c, a}))
+		})
+	})
+})
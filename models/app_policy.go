@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+//An AppPolicy overrides HM9000's global restart behaviour for a single app (across all of its versions).
+//Zero values mean "use the global setting".
+type AppPolicy struct {
+	AppGuid string `json:"droplet"`
+
+	GracePeriodInHeartbeats            int `json:"grace_period_in_heartbeats,omitempty"`
+	MaximumBackoffDelayInHeartbeats    int `json:"maximum_backoff_delay_in_heartbeats,omitempty"`
+	NumberOfCrashesBeforeBackoffBegins int `json:"number_of_crashes_before_backoff_begins,omitempty"`
+
+	NeverRestart        bool `json:"never_restart"`
+	DoNotStopDuplicates bool `json:"do_not_stop_duplicates"`
+}
+
+func NewAppPolicyFromJSON(encoded []byte) (AppPolicy, error) {
+	policy := AppPolicy{}
+	err := json.Unmarshal(encoded, &policy)
+	if err != nil {
+		return AppPolicy{}, err
+	}
+	return policy, nil
+}
+
+func (policy AppPolicy) ToJSON() []byte {
+	result, _ := json.Marshal(policy)
+	return result
+}
+
+func (policy AppPolicy) StoreKey() string {
+	return policy.AppGuid
+}
+
+func (policy AppPolicy) LogDescription() map[string]string {
+	return map[string]string{
+		"AppGuid":                            policy.AppGuid,
+		"GracePeriodInHeartbeats":            strconv.Itoa(policy.GracePeriodInHeartbeats),
+		"MaximumBackoffDelayInHeartbeats":    strconv.Itoa(policy.MaximumBackoffDelayInHeartbeats),
+		"NumberOfCrashesBeforeBackoffBegins": strconv.Itoa(policy.NumberOfCrashesBeforeBackoffBegins),
+		"NeverRestart":                       strconv.FormatBool(policy.NeverRestart),
+		"DoNotStopDuplicates":                strconv.FormatBool(policy.DoNotStopDuplicates),
+	}
+}
@@ -0,0 +1,61 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppPolicy", func() {
+	var policy AppPolicy
+
+	BeforeEach(func() {
+		policy = AppPolicy{
+			AppGuid:                            "abc",
+			GracePeriodInHeartbeats:            18,
+			MaximumBackoffDelayInHeartbeats:    30,
+			NumberOfCrashesBeforeBackoffBegins: 1,
+			NeverRestart:                       true,
+			DoNotStopDuplicates:                true,
+		}
+	})
+
+	Describe("ToJSON", func() {
+		It("should have the right fields", func() {
+			json := string(policy.ToJSON())
+			Ω(json).Should(ContainSubstring(`"droplet":"abc"`))
+			Ω(json).Should(ContainSubstring(`"grace_period_in_heartbeats":18`))
+			Ω(json).Should(ContainSubstring(`"maximum_backoff_delay_in_heartbeats":30`))
+			Ω(json).Should(ContainSubstring(`"number_of_crashes_before_backoff_begins":1`))
+			Ω(json).Should(ContainSubstring(`"never_restart":true`))
+			Ω(json).Should(ContainSubstring(`"do_not_stop_duplicates":true`))
+		})
+
+		It("should omit overrides that are not set", func() {
+			json := string(AppPolicy{AppGuid: "abc"}.ToJSON())
+			Ω(json).ShouldNot(ContainSubstring("grace_period_in_heartbeats"))
+			Ω(json).ShouldNot(ContainSubstring("maximum_backoff_delay_in_heartbeats"))
+			Ω(json).ShouldNot(ContainSubstring("number_of_crashes_before_backoff_begins"))
+		})
+	})
+
+	Describe("NewAppPolicyFromJSON", func() {
+		It("should create the right policy", func() {
+			decoded, err := NewAppPolicyFromJSON(policy.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(policy))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewAppPolicyFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("should return the app guid", func() {
+			Ω(policy.StoreKey()).Should(Equal("abc"))
+		})
+	})
+})
@@ -16,6 +16,7 @@ var _ = Describe("App", func() {
 		desired            DesiredAppState
 		instanceHeartbeats []InstanceHeartbeat
 		crashCounts        map[int]CrashCount
+		quarantines        map[int]Quarantine
 	)
 
 	instance := func(instanceIndex int) appfixture.Instance {
@@ -29,7 +30,7 @@ var _ = Describe("App", func() {
 	}
 
 	app := func() *App {
-		return NewApp(appGuid, appVersion, desired, instanceHeartbeats, crashCounts)
+		return NewApp(appGuid, appVersion, desired, instanceHeartbeats, crashCounts, quarantines)
 	}
 
 	BeforeEach(func() {
@@ -41,6 +42,7 @@ var _ = Describe("App", func() {
 		desired = DesiredAppState{}
 		instanceHeartbeats = []InstanceHeartbeat{}
 		crashCounts = make(map[int]CrashCount)
+		quarantines = make(map[int]Quarantine)
 	})
 
 	Describe("LogDescription", func() {
@@ -104,6 +106,21 @@ var _ = Describe("App", func() {
 				Ω(app().LogDescription()["CrashCounts"]).Should(ContainSubstring(`"CrashCount":3`))
 			})
 		})
+
+		Context("When there are quarantined indices", func() {
+			It("should report on them", func() {
+				Ω(app().LogDescription()["QuarantinedIndices"]).Should(Equal("[]"))
+
+				quarantines[2] = Quarantine{
+					AppGuid:       appGuid,
+					AppVersion:    appVersion,
+					InstanceIndex: 2,
+					CrashCount:    10,
+				}
+
+				Ω(app().LogDescription()["QuarantinedIndices"]).Should(Equal("[2]"))
+			})
+		})
 	})
 
 	Describe("ToJSON", func() {
@@ -114,6 +131,7 @@ var _ = Describe("App", func() {
 			Ω(jsonRepresentation).Should(ContainSubstring(`"desired":{`))
 			Ω(jsonRepresentation).Should(ContainSubstring(`"instance_heartbeats":[`))
 			Ω(jsonRepresentation).Should(ContainSubstring(`"crash_counts":[`))
+			Ω(jsonRepresentation).Should(ContainSubstring(`"quarantines":[`))
 		})
 	})
 
@@ -361,6 +379,59 @@ var _ = Describe("App", func() {
 		})
 	})
 
+	Describe("Stuck STARTING instances", func() {
+		var currentTime time.Time
+		var timeout time.Duration
+
+		stuckHeartbeat := func(instanceIndex int) InstanceHeartbeat {
+			hb := heartbeat(instanceIndex, InstanceStateStarting)
+			hb.StateTimestamp = float64(currentTime.Add(-2 * timeout).Unix())
+			return hb
+		}
+
+		BeforeEach(func() {
+			currentTime = time.Unix(1000, 0)
+			timeout = 30 * time.Second
+
+			startingHeartbeat := heartbeat(2, InstanceStateStarting)
+			startingHeartbeat.StateTimestamp = float64(currentTime.Unix())
+
+			instanceHeartbeats = []InstanceHeartbeat{
+				stuckHeartbeat(0),
+				stuckHeartbeat(1),
+				heartbeat(1, InstanceStateRunning),
+				startingHeartbeat,
+				heartbeat(3, InstanceStateCrashed),
+			}
+		})
+
+		Describe("StuckStartingInstancesAtIndex", func() {
+			It("should return the instances at the passed in index that have been STARTING for longer than the timeout", func() {
+				Ω(app().StuckStartingInstancesAtIndex(0, currentTime, timeout)).Should(Equal([]InstanceHeartbeat{stuckHeartbeat(0)}))
+				Ω(app().StuckStartingInstancesAtIndex(1, currentTime, timeout)).Should(Equal([]InstanceHeartbeat{stuckHeartbeat(1)}))
+				Ω(app().StuckStartingInstancesAtIndex(2, currentTime, timeout)).Should(BeEmpty())
+				Ω(app().StuckStartingInstancesAtIndex(3, currentTime, timeout)).Should(BeEmpty())
+				Ω(app().StuckStartingInstancesAtIndex(0, currentTime, 0)).Should(BeEmpty())
+			})
+		})
+
+		Describe("HasOnlyStuckStartingInstancesAtIndex", func() {
+			It("should return true if all the starting/running instances at the passed in index are stuck", func() {
+				Ω(app().HasOnlyStuckStartingInstancesAtIndex(0, currentTime, timeout)).Should(BeTrue())
+				Ω(app().HasOnlyStuckStartingInstancesAtIndex(1, currentTime, timeout)).Should(BeFalse())
+				Ω(app().HasOnlyStuckStartingInstancesAtIndex(2, currentTime, timeout)).Should(BeFalse())
+				Ω(app().HasOnlyStuckStartingInstancesAtIndex(3, currentTime, timeout)).Should(BeFalse())
+			})
+		})
+
+		Describe("NumberOfStuckStartingInstances", func() {
+			It("should return the number of instances that have been STARTING for longer than the timeout", func() {
+				Ω(app().NumberOfStuckStartingInstances(currentTime, timeout)).Should(Equal(2))
+				Ω(app().NumberOfStuckStartingInstances(currentTime, 0)).Should(Equal(0))
+			})
+		})
+	})
+
 	Describe("HasCrashedInstanceAtIndex", func() {
 		It("should return true if there is a crashed instance at the passed in index", func() {
 			Ω(app().HasCrashedInstanceAtIndex(1)).Should(BeFalse())
@@ -406,6 +477,23 @@ var _ = Describe("App", func() {
 		})
 	})
 
+	Describe("IsIndexQuarantined", func() {
+		BeforeEach(func() {
+			quarantines[1] = Quarantine{
+				AppGuid:       fixture.AppGuid,
+				AppVersion:    fixture.AppVersion,
+				InstanceIndex: 1,
+				CrashCount:    10,
+				QuarantinedAt: 17,
+			}
+		})
+
+		It("should only be true for indices with a quarantine", func() {
+			Ω(app().IsIndexQuarantined(0)).Should(BeFalse())
+			Ω(app().IsIndexQuarantined(1)).Should(BeTrue())
+		})
+	})
+
 	Describe("NumberOfDesiredIndicesReporting", func() {
 		It("should return the number of desired indices that have at least one heartbeat reporting (regardless of state)", func() {
 			Ω(app().NumberOfDesiredIndicesReporting()).Should(Equal(0))
@@ -11,6 +11,8 @@ type CrashCount struct {
 	InstanceIndex int    `json:"instance_index"`
 	CrashCount    int    `json:"crash_count"`
 	CreatedAt     int64  `json:"created_at"`
+	LastCrashedAt int64  `json:"last_crashed_at"`
+	LastResetAt   int64  `json:"last_reset_at"`
 }
 
 func NewCrashCountFromJSON(encoded []byte) (CrashCount, error) {
@@ -16,6 +16,8 @@ var _ = Describe("CrashCount", func() {
 			InstanceIndex: 1,
 			CrashCount:    12,
 			CreatedAt:     172,
+			LastCrashedAt: 180,
+			LastResetAt:   150,
 		}
 	})
 
@@ -27,6 +29,8 @@ var _ = Describe("CrashCount", func() {
 			Ω(json).Should(ContainSubstring(`"instance_index":1`))
 			Ω(json).Should(ContainSubstring(`"crash_count":12`))
 			Ω(json).Should(ContainSubstring(`"created_at":172`))
+			Ω(json).Should(ContainSubstring(`"last_crashed_at":180`))
+			Ω(json).Should(ContainSubstring(`"last_reset_at":150`))
 		})
 	})
 
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//A DeadLetter is a start or stop message the sender gave up on after sending it too many times without effect.
+//It keeps the message and its send attempts so that an operator can look into it, and requeue or purge it.
+//The analyzer does not enqueue messages with the same StoreKey while the dead letter exists.
+type DeadLetter struct {
+	MessageType    string               `json:"message_type"`
+	MessageKey     string               `json:"message_key"`
+	AppGuid        string               `json:"droplet"`
+	AppVersion     string               `json:"version"`
+	StartMessage   *PendingStartMessage `json:"start_message,omitempty"`
+	StopMessage    *PendingStopMessage  `json:"stop_message,omitempty"`
+	Attempts       int                  `json:"attempts"`
+	FirstAttemptAt int64                `json:"first_attempt_at"`
+	LastAttemptAt  int64                `json:"last_attempt_at"`
+	DeadLetteredAt int64                `json:"dead_lettered_at"`
+}
+
+func NewStartDeadLetter(now time.Time, message PendingStartMessage, attempts SendAttempts) DeadLetter {
+	deadLetter := newDeadLetter(now, message.PendingMessage, attempts)
+	deadLetter.StartMessage = &message
+	return deadLetter
+}
+
+func NewStopDeadLetter(now time.Time, message PendingStopMessage, attempts SendAttempts) DeadLetter {
+	deadLetter := newDeadLetter(now, message.PendingMessage, attempts)
+	deadLetter.StopMessage = &message
+	return deadLetter
+}
+
+func newDeadLetter(now time.Time, message PendingMessage, attempts SendAttempts) DeadLetter {
+	return DeadLetter{
+		MessageType:    attempts.MessageType,
+		MessageKey:     attempts.MessageKey,
+		AppGuid:        message.AppGuid,
+		AppVersion:     message.AppVersion,
+		Attempts:       attempts.Count,
+		FirstAttemptAt: attempts.FirstAttemptAt,
+		LastAttemptAt:  attempts.LastAttemptAt,
+		DeadLetteredAt: now.Unix(),
+	}
+}
+
+func NewDeadLetterFromJSON(encoded []byte) (DeadLetter, error) {
+	deadLetter := DeadLetter{}
+	err := json.Unmarshal(encoded, &deadLetter)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	return deadLetter, nil
+}
+
+func (deadLetter DeadLetter) ToJSON() []byte {
+	encoded, _ := json.Marshal(deadLetter)
+	return encoded
+}
+
+//StoreKey matches the StoreKey of the message's SendAttempts
+func (deadLetter DeadLetter) StoreKey() string {
+	return deadLetter.MessageType + "-" + deadLetter.MessageKey
+}
+
+func (deadLetter DeadLetter) LogDescription() map[string]string {
+	description := map[string]string{
+		"MessageType":    deadLetter.MessageType,
+		"MessageKey":     deadLetter.MessageKey,
+		"AppGuid":        deadLetter.AppGuid,
+		"AppVersion":     deadLetter.AppVersion,
+		"Attempts":       strconv.Itoa(deadLetter.Attempts),
+		"FirstAttemptAt": time.Unix(deadLetter.FirstAttemptAt, 0).String(),
+		"LastAttemptAt":  time.Unix(deadLetter.LastAttemptAt, 0).String(),
+		"DeadLetteredAt": time.Unix(deadLetter.DeadLetteredAt, 0).String(),
+	}
+	if deadLetter.StartMessage != nil {
+		description["IndexToStart"] = strconv.Itoa(deadLetter.StartMessage.IndexToStart)
+		description["StartReason"] = string(deadLetter.StartMessage.StartReason)
+	}
+	if deadLetter.StopMessage != nil {
+		description["InstanceGuid"] = deadLetter.StopMessage.InstanceGuid
+		description["StopReason"] = string(deadLetter.StopMessage.StopReason)
+	}
+	return description
+}
+
+type sortableDeadLettersByDeadLetteredAt []DeadLetter
+
+func (s sortableDeadLettersByDeadLetteredAt) Len() int      { return len(s) }
+func (s sortableDeadLettersByDeadLetteredAt) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortableDeadLettersByDeadLetteredAt) Less(i, j int) bool {
+	if s[i].DeadLetteredAt == s[j].DeadLetteredAt {
+		return s[i].StoreKey() < s[j].StoreKey()
+	}
+	return s[i].DeadLetteredAt < s[j].DeadLetteredAt
+}
+
+//SortDeadLettersByDeadLetteredAt returns the dead letters oldest first
+func SortDeadLettersByDeadLetteredAt(deadLetters map[string]DeadLetter) []DeadLetter {
+	sortedDeadLetters := sortableDeadLettersByDeadLetteredAt{}
+	for _, deadLetter := range deadLetters {
+		sortedDeadLetters = append(sortedDeadLetters, deadLetter)
+	}
+	sort.Sort(sortedDeadLetters)
+	return sortedDeadLetters
+}
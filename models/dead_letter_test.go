@@ -0,0 +1,86 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("DeadLetter", func() {
+	var startMessage PendingStartMessage
+	var stopMessage PendingStopMessage
+	var startDeadLetter DeadLetter
+	var stopDeadLetter DeadLetter
+
+	BeforeEach(func() {
+		startMessage = NewPendingStartMessage(time.Unix(100, 0), 30, 0, "app-guid", "app-version", 1, 1.0, PendingStartMessageReasonMissing)
+		stopMessage = NewPendingStopMessage(time.Unix(100, 0), 30, 0, "app-guid", "app-version", "instance-guid", PendingStopMessageReasonExtra)
+
+		startDeadLetter = NewStartDeadLetter(time.Unix(200, 0), startMessage, NewStartSendAttempts(startMessage).Attempted(time.Unix(130, 0)).Attempted(time.Unix(170, 0)))
+		stopDeadLetter = NewStopDeadLetter(time.Unix(200, 0), stopMessage, NewStopSendAttempts(stopMessage).Attempted(time.Unix(130, 0)))
+	})
+
+	Describe("creating dead letters", func() {
+		It("should keep the message and its send attempts", func() {
+			Ω(startDeadLetter.MessageType).Should(Equal("start"))
+			Ω(startDeadLetter.MessageKey).Should(Equal("app-guid-app-version-1"))
+			Ω(startDeadLetter.AppGuid).Should(Equal("app-guid"))
+			Ω(startDeadLetter.AppVersion).Should(Equal("app-version"))
+			Ω(*startDeadLetter.StartMessage).Should(Equal(startMessage))
+			Ω(startDeadLetter.StopMessage).Should(BeNil())
+			Ω(startDeadLetter.Attempts).Should(Equal(2))
+			Ω(startDeadLetter.FirstAttemptAt).Should(BeNumerically("==", 130))
+			Ω(startDeadLetter.LastAttemptAt).Should(BeNumerically("==", 170))
+			Ω(startDeadLetter.DeadLetteredAt).Should(BeNumerically("==", 200))
+
+			Ω(stopDeadLetter.MessageType).Should(Equal("stop"))
+			Ω(*stopDeadLetter.StopMessage).Should(Equal(stopMessage))
+			Ω(stopDeadLetter.StartMessage).Should(BeNil())
+		})
+
+		It("should have the same store key as the message's send attempts", func() {
+			Ω(startDeadLetter.StoreKey()).Should(Equal(NewStartSendAttempts(startMessage).StoreKey()))
+			Ω(stopDeadLetter.StoreKey()).Should(Equal(NewStopSendAttempts(stopMessage).StoreKey()))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("should round trip", func() {
+			decoded, err := NewDeadLetterFromJSON(startDeadLetter.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(startDeadLetter))
+
+			decoded, err = NewDeadLetterFromJSON(stopDeadLetter.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(stopDeadLetter))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewDeadLetterFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("LogDescription", func() {
+		It("should describe the message", func() {
+			Ω(startDeadLetter.LogDescription()).Should(HaveKeyWithValue("IndexToStart", "1"))
+			Ω(startDeadLetter.LogDescription()).Should(HaveKeyWithValue("Attempts", "2"))
+			Ω(stopDeadLetter.LogDescription()).Should(HaveKeyWithValue("InstanceGuid", "instance-guid"))
+			Ω(stopDeadLetter.LogDescription()).Should(HaveKeyWithValue("StopReason", "EXTRA"))
+		})
+	})
+
+	Describe("SortDeadLettersByDeadLetteredAt", func() {
+		It("should return the dead letters oldest first", func() {
+			stopDeadLetter.DeadLetteredAt = 150
+			sorted := SortDeadLettersByDeadLetteredAt(map[string]DeadLetter{
+				startDeadLetter.StoreKey(): startDeadLetter,
+				stopDeadLetter.StoreKey():  stopDeadLetter,
+			})
+			Ω(sorted).Should(Equal([]DeadLetter{stopDeadLetter, startDeadLetter}))
+		})
+	})
+})
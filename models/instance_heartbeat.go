@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type InstanceState string
@@ -91,6 +92,17 @@ func (instance InstanceHeartbeat) IsStarting() bool {
 	return instance.State == InstanceStateStarting
 }
 
+//IsStuckStarting returns true if the instance has been STARTING for longer than timeout.
+//A zero timeout disables the check.
+func (instance InstanceHeartbeat) IsStuckStarting(currentTime time.Time, timeout time.Duration) bool {
+	if timeout <= 0 || !instance.IsStarting() {
+		return false
+	}
+
+	startedStartingAt := time.Unix(int64(instance.StateTimestamp), 0)
+	return currentTime.Sub(startedStartingAt) > timeout
+}
+
 func (instance InstanceHeartbeat) IsRunning() bool {
 	return instance.State == InstanceStateRunning
 }
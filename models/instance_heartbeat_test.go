@@ -4,6 +4,7 @@ import (
 	. "github.com/cloudfoundry/hm9000/models"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"time"
 )
 
 var _ = Describe("InstanceHeartbeat", func() {
@@ -156,5 +157,15 @@ var _ = Describe("InstanceHeartbeat", func() {
 			instance.State = InstanceStateStarting
 			Ω(instance.IsStartingOrRunning()).Should(BeTrue())
 		})
+
+		It("should return the correct answer to IsStuckStarting", func() {
+			currentTime := time.Unix(1200, 0)
+			instance.State = InstanceStateStarting
+			Ω(instance.IsStuckStarting(currentTime, 60*time.Second)).Should(BeTrue())
+			Ω(instance.IsStuckStarting(currentTime, 90*time.Second)).Should(BeFalse())
+			Ω(instance.IsStuckStarting(currentTime, 0)).Should(BeFalse())
+			instance.State = InstanceStateRunning
+			Ω(instance.IsStuckStarting(currentTime, 60*time.Second)).Should(BeFalse())
+		})
 	})
 })
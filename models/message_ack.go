@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+//A MessageAck is published by a DEA on the ack subject when it acts on a start or stop message.
+//The listener stamps ReceivedAt when it hears the ack.
+type MessageAck struct {
+	MessageId  string `json:"message_id"`
+	DeaGuid    string `json:"dea,omitempty"`
+	ReceivedAt int64  `json:"received_at,omitempty"`
+}
+
+func NewMessageAckFromJSON(encoded []byte) (MessageAck, error) {
+	ack := MessageAck{}
+	err := json.Unmarshal(encoded, &ack)
+	if err != nil {
+		return MessageAck{}, err
+	}
+	return ack, nil
+}
+
+func (ack MessageAck) ToJSON() []byte {
+	encoded, _ := json.Marshal(ack)
+	return encoded
+}
+
+func (ack MessageAck) StoreKey() string {
+	return ack.MessageId
+}
+
+func (ack MessageAck) LogDescription() map[string]string {
+	return map[string]string{
+		"MessageId": ack.MessageId,
+		"DeaGuid":   ack.DeaGuid,
+	}
+}
@@ -0,0 +1,63 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MessageAck", func() {
+	var ack MessageAck
+
+	BeforeEach(func() {
+		ack = MessageAck{
+			MessageId:  "message-id",
+			DeaGuid:    "dea-guid",
+			ReceivedAt: 172,
+		}
+	})
+
+	Describe("ToJSON", func() {
+		It("should have the right fields", func() {
+			json := string(ack.ToJSON())
+			Ω(json).Should(ContainSubstring(`"message_id":"message-id"`))
+			Ω(json).Should(ContainSubstring(`"dea":"dea-guid"`))
+			Ω(json).Should(ContainSubstring(`"received_at":172`))
+		})
+	})
+
+	Describe("NewMessageAckFromJSON", func() {
+		It("should create the right ack", func() {
+			decoded, err := NewMessageAckFromJSON(ack.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(ack))
+		})
+
+		It("should accept an ack that only carries the message id", func() {
+			decoded, err := NewMessageAckFromJSON([]byte(`{"message_id":"message-id"}`))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(MessageAck{MessageId: "message-id"}))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewMessageAckFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("should return the message id", func() {
+			Ω(ack.StoreKey()).Should(Equal("message-id"))
+		})
+	})
+
+	Describe("LogDescription", func() {
+		It("should return the right map", func() {
+			Ω(ack.LogDescription()).Should(Equal(map[string]string{
+				"MessageId": "message-id",
+				"DeaGuid":   "dea-guid",
+			}))
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+//Start and stop messages may be signed with a secret shared between the sender and the DEAs.
+//A signed message is published as a SignedMessage envelope whose payload is the message's JSON, byte for byte.
+//The signature is the hex encoded HMAC-SHA256 of the signed_at timestamp, a ".", and the payload, so any
+//verifier can recompute it from the bytes it received without knowing how the message was encoded.
+//Signing covers the time the message was signed at: a verifier rejects messages signed outside its replay window.
+//Within the window a captured message can still be replayed; a verifier that cares should also drop message_ids it has seen.
+
+var (
+	MessageNotSignedError                 = errors.New("Message is not signed")
+	MessageSignatureInvalidError          = errors.New("Message signature is invalid")
+	MessageSignedOutsideReplayWindowError = errors.New("Message was signed outside the replay window")
+)
+
+type SignedMessage struct {
+	Payload   string `json:"payload"`
+	SignedAt  int64  `json:"signed_at"`
+	Signature string `json:"signature"`
+}
+
+//SignMessage wraps payload in an envelope signed with secret at now
+func SignMessage(secret string, payload []byte, now time.Time) SignedMessage {
+	message := SignedMessage{
+		Payload:  string(payload),
+		SignedAt: now.Unix(),
+	}
+	message.Signature = hex.EncodeToString(message.computeSignature(secret))
+	return message
+}
+
+func NewSignedMessageFromJSON(encoded []byte) (SignedMessage, error) {
+	message := SignedMessage{}
+	err := json.Unmarshal(encoded, &message)
+	if err != nil {
+		return SignedMessage{}, err
+	}
+	return message, nil
+}
+
+func (message SignedMessage) ToJSON() []byte {
+	result, _ := json.Marshal(message)
+	return result
+}
+
+//Verify returns the payload only for a message signed with secret no further than replayWindow from now (in either direction, to allow for clock skew)
+func (message SignedMessage) Verify(secret string, now time.Time, replayWindow time.Duration) ([]byte, error) {
+	if message.Signature == "" {
+		return nil, MessageNotSignedError
+	}
+
+	signature, err := hex.DecodeString(message.Signature)
+	if err != nil {
+		return nil, MessageSignatureInvalidError
+	}
+
+	if !hmac.Equal(signature, message.computeSignature(secret)) {
+		return nil, MessageSignatureInvalidError
+	}
+
+	age := now.Sub(time.Unix(message.SignedAt, 0))
+	if age > replayWindow || age < -replayWindow {
+		return nil, MessageSignedOutsideReplayWindowError
+	}
+
+	return []byte(message.Payload), nil
+}
+
+func (message SignedMessage) computeSignature(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(message.SignedAt, 10) + "."))
+	mac.Write([]byte(message.Payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,110 @@
+package models_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Message signatures", func() {
+	var (
+		now          time.Time
+		replayWindow time.Duration
+		payload      []byte
+	)
+
+	BeforeEach(func() {
+		now = time.Unix(1000, 0)
+		replayWindow = time.Minute
+		payload = StopMessage{
+			AppGuid:       "abc",
+			AppVersion:    "123",
+			InstanceGuid:  "def",
+			InstanceIndex: 1,
+			IsDuplicate:   true,
+			MessageId:     "msg-id",
+		}.ToJSON()
+	})
+
+	It("should wrap the exact payload in an envelope, with the time it was signed at", func() {
+		signed := SignMessage("secret", payload, now)
+		Ω(signed.Payload).Should(Equal(string(payload)))
+		Ω(signed.SignedAt).Should(BeNumerically("==", 1000))
+
+		decoded, err := NewSignedMessageFromJSON(signed.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(signed))
+	})
+
+	It("should sign the timestamp and the payload bytes, so that other languages can verify the signature", func() {
+		signed := SignMessage("secret", payload, now)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte("1000." + string(payload)))
+		Ω(signed.Signature).Should(Equal(hex.EncodeToString(mac.Sum(nil))))
+	})
+
+	It("should return the payload of a message signed with the same secret within the replay window", func() {
+		signed := SignMessage("secret", payload, now)
+		for _, verifiedAt := range []time.Time{now, now.Add(replayWindow), now.Add(-replayWindow)} {
+			verified, err := signed.Verify("secret", verifiedAt, replayWindow)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(verified).Should(Equal(payload))
+		}
+	})
+
+	It("should verify the bytes it received, whatever fields they hold", func() {
+		signed := SignMessage("secret", []byte(`{"message_id":"msg-id","a_field_added_later":true}`), now)
+		decoded, err := NewSignedMessageFromJSON(signed.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		verified, err := decoded.Verify("secret", now, replayWindow)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(verified)).Should(Equal(`{"message_id":"msg-id","a_field_added_later":true}`))
+	})
+
+	It("should reject an unsigned message", func() {
+		_, err := SignedMessage{Payload: string(payload), SignedAt: 1000}.Verify("secret", now, replayWindow)
+		Ω(err).Should(Equal(MessageNotSignedError))
+	})
+
+	It("should reject a message signed with a different secret", func() {
+		signed := SignMessage("other-secret", payload, now)
+		_, err := signed.Verify("secret", now, replayWindow)
+		Ω(err).Should(Equal(MessageSignatureInvalidError))
+	})
+
+	It("should reject a payload that was tampered with", func() {
+		signed := SignMessage("secret", payload, now)
+		signed.Payload = string(StopMessage{AppGuid: "abc"}.ToJSON())
+		_, err := signed.Verify("secret", now, replayWindow)
+		Ω(err).Should(Equal(MessageSignatureInvalidError))
+	})
+
+	It("should reject a message whose timestamp was moved", func() {
+		signed := SignMessage("secret", payload, now)
+		signed.SignedAt = now.Add(time.Hour).Unix()
+		_, err := signed.Verify("secret", now.Add(time.Hour), replayWindow)
+		Ω(err).Should(Equal(MessageSignatureInvalidError))
+	})
+
+	It("should reject a garbled signature", func() {
+		signed := SignMessage("secret", payload, now)
+		signed.Signature = "∂"
+		_, err := signed.Verify("secret", now, replayWindow)
+		Ω(err).Should(Equal(MessageSignatureInvalidError))
+	})
+
+	It("should reject a message signed outside the replay window", func() {
+		signed := SignMessage("secret", payload, now)
+		_, err := signed.Verify("secret", now.Add(replayWindow+time.Second), replayWindow)
+		Ω(err).Should(Equal(MessageSignedOutsideReplayWindowError))
+		_, err = signed.Verify("secret", now.Add(-replayWindow-time.Second), replayWindow)
+		Ω(err).Should(Equal(MessageSignedOutsideReplayWindowError))
+	})
+})
@@ -10,10 +10,11 @@ import (
 type PendingStartMessageReason string
 
 const (
-	PendingStartMessageReasonInvalid    PendingStartMessageReason = ""
-	PendingStartMessageReasonCrashed    PendingStartMessageReason = "CRASHED"
-	PendingStartMessageReasonMissing    PendingStartMessageReason = "MISSING"
-	PendingStartMessageReasonEvacuating PendingStartMessageReason = "EVACUATING"
+	PendingStartMessageReasonInvalid       PendingStartMessageReason = ""
+	PendingStartMessageReasonCrashed       PendingStartMessageReason = "CRASHED"
+	PendingStartMessageReasonMissing       PendingStartMessageReason = "MISSING"
+	PendingStartMessageReasonEvacuating    PendingStartMessageReason = "EVACUATING"
+	PendingStartMessageReasonStuckStarting PendingStartMessageReason = "STUCK_STARTING"
 )
 
 type PendingStopMessageReason string
@@ -23,15 +24,31 @@ const (
 	PendingStopMessageReasonExtra              PendingStopMessageReason = "EXTRA"
 	PendingStopMessageReasonDuplicate          PendingStopMessageReason = "DUPLICATE"
 	PendingStopMessageReasonEvacuationComplete PendingStopMessageReason = "EVACUATION_COMPLETE"
+	PendingStopMessageReasonStuckStarting      PendingStopMessageReason = "STUCK_STARTING"
+	PendingStopMessageReasonOutdatedVersion    PendingStopMessageReason = "OUTDATED_VERSION"
+)
+
+//A sent message's AckState tracks whether the DEA acknowledged it.
+//Messages are only marked AWAITING when ack tracking is enabled.
+type PendingMessageAckState string
+
+const (
+	PendingMessageAckStateNone         PendingMessageAckState = ""
+	PendingMessageAckStateAwaiting     PendingMessageAckState = "AWAITING"
+	PendingMessageAckStateAcknowledged PendingMessageAckState = "ACKNOWLEDGED"
+	PendingMessageAckStateTimedOut     PendingMessageAckState = "TIMED_OUT"
+	PendingMessageAckStateSuperseded   PendingMessageAckState = "SUPERSEDED"
 )
 
 type PendingMessage struct {
-	MessageId  string `json:"message_id"`
-	SendOn     int64  `json:"send_on"`
-	SentOn     int64  `json:"sent_on"`
-	KeepAlive  int    `json:"keep_alive"`
-	AppGuid    string `json:"droplet"`
-	AppVersion string `json:"version"`
+	MessageId  string                 `json:"message_id"`
+	EnqueuedOn int64                  `json:"enqueued_on,omitempty"`
+	SendOn     int64                  `json:"send_on"`
+	SentOn     int64                  `json:"sent_on"`
+	KeepAlive  int                    `json:"keep_alive"`
+	AppGuid    string                 `json:"droplet"`
+	AppVersion string                 `json:"version"`
+	AckState   PendingMessageAckState `json:"ack_state,omitempty"`
 }
 
 type PendingStartMessage struct {
@@ -50,6 +67,7 @@ type PendingStopMessage struct {
 
 func newPendingMessage(now time.Time, delayInSeconds int, keepAliveInSeconds int, appGuid string, appVersion string) PendingMessage {
 	return PendingMessage{
+		EnqueuedOn: now.Unix(),
 		SendOn:     now.Add(time.Duration(delayInSeconds) * time.Second).Unix(),
 		SentOn:     0,
 		KeepAlive:  keepAliveInSeconds,
@@ -60,7 +78,7 @@ func newPendingMessage(now time.Time, delayInSeconds int, keepAliveInSeconds int
 }
 
 func (message PendingMessage) pendingLogDescription() map[string]string {
-	return map[string]string{
+	description := map[string]string{
 		"SendOn":     time.Unix(message.SendOn, 0).String(),
 		"SentOn":     time.Unix(message.SentOn, 0).String(),
 		"KeepAlive":  strconv.Itoa(int(message.KeepAlive)),
@@ -68,6 +86,10 @@ func (message PendingMessage) pendingLogDescription() map[string]string {
 		"AppGuid":    message.AppGuid,
 		"AppVersion": message.AppVersion,
 	}
+	if message.AckState != PendingMessageAckStateNone {
+		description["AckState"] = string(message.AckState)
+	}
+	return description
 }
 
 func (message PendingMessage) pendingEqual(another PendingMessage) bool {
@@ -75,7 +97,8 @@ func (message PendingMessage) pendingEqual(another PendingMessage) bool {
 		message.SentOn == another.SentOn &&
 		message.KeepAlive == another.KeepAlive &&
 		message.AppGuid == another.AppGuid &&
-		message.AppVersion == another.AppVersion
+		message.AppVersion == another.AppVersion &&
+		message.AckState == another.AckState
 }
 
 func (message PendingMessage) HasBeenSent() bool {
@@ -86,6 +109,24 @@ func (message PendingMessage) IsTimeToSend(currentTime time.Time) bool {
 	return !message.HasBeenSent() && message.SendOn <= currentTime.Unix()
 }
 
+func (message PendingMessage) IsAwaitingAck() bool {
+	return message.HasBeenSent() && message.AckState == PendingMessageAckStateAwaiting
+}
+
+//HasAckTimedOut is true once a message has been awaiting an ack for longer than ackTimeout
+func (message PendingMessage) HasAckTimedOut(currentTime time.Time, ackTimeout time.Duration) bool {
+	return message.IsAwaitingAck() && time.Unix(message.SentOn, 0).Add(ackTimeout).Unix() <= currentTime.Unix()
+}
+
+//SendLatency is the time from the message being enqueued to it being sent, including any delay it was enqueued with.
+//It is zero for messages enqueued before EnqueuedOn was recorded.
+func (message PendingMessage) SendLatency(sentAt time.Time) time.Duration {
+	if message.EnqueuedOn == 0 {
+		return 0
+	}
+	return time.Duration(sentAt.Unix()-message.EnqueuedOn) * time.Second
+}
+
 func (message PendingMessage) IsExpired(currentTime time.Time) bool {
 	return message.HasBeenSent() && message.SentOn+int64(message.KeepAlive) <= currentTime.Unix()
 }
@@ -108,23 +149,48 @@ func NewPendingStartMessageFromJSON(encoded []byte) (PendingStartMessage, error)
 	return message, nil
 }
 
-type sortablePendingStartMessagesByPriority []PendingStartMessage
+//EffectivePriority is the message's priority plus agingPerSecond for every second the message has been waiting to be sent.
+//Aging keeps a steady stream of high priority starts from starving older, lower priority ones.
+func (message PendingStartMessage) EffectivePriority(currentTime time.Time, agingPerSecond float64) float64 {
+	waitingFor := currentTime.Unix() - message.SendOn
+	if waitingFor <= 0 {
+		return message.Priority
+	}
+	return message.Priority + float64(waitingFor)*agingPerSecond
+}
+
+type sortablePendingStartMessagesByPriority struct {
+	messages       []PendingStartMessage
+	currentTime    time.Time
+	agingPerSecond float64
+}
 
-func (s sortablePendingStartMessagesByPriority) Len() int      { return len(s) }
-func (s sortablePendingStartMessagesByPriority) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortablePendingStartMessagesByPriority) Len() int { return len(s.messages) }
+func (s sortablePendingStartMessagesByPriority) Swap(i, j int) {
+	s.messages[i], s.messages[j] = s.messages[j], s.messages[i]
+}
 func (s sortablePendingStartMessagesByPriority) Less(i, j int) bool {
-	return s[i].Priority < s[j].Priority
+	return s.messages[i].EffectivePriority(s.currentTime, s.agingPerSecond) < s.messages[j].EffectivePriority(s.currentTime, s.agingPerSecond)
 }
 
 func SortStartMessagesByPriority(messages map[string]PendingStartMessage) []PendingStartMessage {
-	sortedStartMessages := make(sortablePendingStartMessagesByPriority, len(messages))
+	return SortStartMessagesByEffectivePriority(messages, time.Unix(0, 0), 0)
+}
+
+//SortStartMessagesByEffectivePriority returns the messages in order of decreasing EffectivePriority
+func SortStartMessagesByEffectivePriority(messages map[string]PendingStartMessage, currentTime time.Time, agingPerSecond float64) []PendingStartMessage {
+	sortedStartMessages := sortablePendingStartMessagesByPriority{
+		messages:       make([]PendingStartMessage, len(messages)),
+		currentTime:    currentTime,
+		agingPerSecond: agingPerSecond,
+	}
 	i := 0
 	for _, message := range messages {
-		sortedStartMessages[i] = message
+		sortedStartMessages.messages[i] = message
 		i++
 	}
 	sort.Sort(sort.Reverse(sortedStartMessages))
-	return sortedStartMessages
+	return sortedStartMessages.messages
 }
 
 func (message PendingStartMessage) StoreKey() string {
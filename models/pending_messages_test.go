@@ -25,6 +25,7 @@ var _ = Describe("Pending Messages", func() {
 
 		Describe("Creating new start messages programatically", func() {
 			It("should populate the start message correctly, and compute the correct SendOn time", func() {
+				Ω(message.EnqueuedOn).Should(BeNumerically("==", 100))
 				Ω(message.SendOn).Should(BeNumerically("==", 130))
 				Ω(message.SentOn).Should(BeNumerically("==", 0))
 				Ω(message.KeepAlive).Should(BeNumerically("==", 10))
@@ -40,6 +41,7 @@ var _ = Describe("Pending Messages", func() {
 			Context("when passed valid JSON", func() {
 				It("should parse correctly", func() {
 					parsed, err := NewPendingStartMessageFromJSON([]byte(`{
+                        "enqueued_on": 100,
                         "send_on": 130,
                         "sent_on": 0,
                         "keep_alive": 10,
@@ -94,6 +96,11 @@ var _ = Describe("Pending Messages", func() {
 					"StartReason":      "CRASHED",
 				}))
 			})
+
+			It("should include the ack state once there is one", func() {
+				message.AckState = PendingMessageAckStateAwaiting
+				Ω(message.LogDescription()).Should(HaveKeyWithValue("AckState", "AWAITING"))
+			})
 		})
 
 		Describe("Equality", func() {
@@ -136,6 +143,10 @@ var _ = Describe("Pending Messages", func() {
 				mutatedMessage = anotherMessage
 				mutatedMessage.StartReason = PendingStartMessageReasonMissing
 				Ω(message.Equal(mutatedMessage)).Should(BeFalse())
+
+				mutatedMessage = anotherMessage
+				mutatedMessage.AckState = PendingMessageAckStateAwaiting
+				Ω(message.Equal(mutatedMessage)).Should(BeFalse())
 			})
 		})
 
@@ -152,6 +163,33 @@ var _ = Describe("Pending Messages", func() {
 				Ω(sortedStartMessage[1].Priority).Should(Equal(0.7))
 				Ω(sortedStartMessage[2].Priority).Should(Equal(0.5))
 			})
+
+			It("should sort older messages ahead of newer ones when the priority ages", func() {
+				startMessages := make(map[string]PendingStartMessage)
+				startMessages["A"] = NewPendingStartMessage(time.Unix(100, 0), 0, 10, "app-guid", "app-version", 1, 0.1, PendingStartMessageReasonMissing)
+				startMessages["B"] = NewPendingStartMessage(time.Unix(160, 0), 0, 10, "app-guid", "app-version", 1, 0.5, PendingStartMessageReasonMissing)
+				startMessages["C"] = NewPendingStartMessage(time.Unix(200, 0), 0, 10, "app-guid", "app-version", 1, 1.0, PendingStartMessageReasonMissing)
+
+				sortedStartMessage := SortStartMessagesByEffectivePriority(startMessages, time.Unix(200, 0), 0.01)
+				Ω(sortedStartMessage).Should(HaveLen(3))
+				Ω(sortedStartMessage[0].Priority).Should(Equal(0.1))
+				Ω(sortedStartMessage[1].Priority).Should(Equal(1.0))
+				Ω(sortedStartMessage[2].Priority).Should(Equal(0.5))
+			})
+		})
+
+		Describe("EffectivePriority", func() {
+			It("should grow with the time the message has been waiting to be sent", func() {
+				message := NewPendingStartMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", 1, 0.5, PendingStartMessageReasonMissing)
+				Ω(message.EffectivePriority(time.Unix(100, 0), 0.01)).Should(Equal(0.5))
+				Ω(message.EffectivePriority(time.Unix(130, 0), 0.01)).Should(Equal(0.5))
+				Ω(message.EffectivePriority(time.Unix(180, 0), 0.01)).Should(BeNumerically("~", 1.0, 0.0001))
+			})
+
+			It("should not age if aging is disabled", func() {
+				message := NewPendingStartMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", 1, 0.5, PendingStartMessageReasonMissing)
+				Ω(message.EffectivePriority(time.Unix(1000, 0), 0)).Should(Equal(0.5))
+			})
 		})
 	})
 
@@ -167,6 +205,7 @@ var _ = Describe("Pending Messages", func() {
 
 		Describe("Creating new stop messages programatically", func() {
 			It("should populate the stop message correctly, and compute the correct SendOn time", func() {
+				Ω(message.EnqueuedOn).Should(BeNumerically("==", 100))
 				Ω(message.SendOn).Should(BeNumerically("==", 130))
 				Ω(message.SentOn).Should(BeNumerically("==", 0))
 				Ω(message.KeepAlive).Should(BeNumerically("==", 10))
@@ -181,6 +220,7 @@ var _ = Describe("Pending Messages", func() {
 			Context("when passed valid JSON", func() {
 				It("should parse correctly", func() {
 					parsed, err := NewPendingStopMessageFromJSON([]byte(`{
+                        "enqueued_on": 100,
                         "send_on": 130,
                         "sent_on": 0,
                         "keep_alive": 10,
@@ -276,6 +316,17 @@ var _ = Describe("Pending Messages", func() {
 			message = PendingMessage{}
 		})
 
+		Describe("SendLatency", func() {
+			It("should be the time from the message being enqueued to it being sent", func() {
+				message.EnqueuedOn = 100
+				Ω(message.SendLatency(time.Unix(145, 0))).Should(Equal(45 * time.Second))
+			})
+
+			It("should be zero for messages enqueued before the enqueue time was recorded", func() {
+				Ω(message.SendLatency(time.Unix(145, 0))).Should(BeZero())
+			})
+		})
+
 		Context("when it was sent", func() {
 			BeforeEach(func() {
 				message.SentOn = 130
@@ -304,6 +355,38 @@ var _ = Describe("Pending Messages", func() {
 			It("should not be ready to send", func() {
 				Ω(message.IsTimeToSend(time.Unix(131, 0))).Should(BeFalse())
 			})
+
+			Context("when it is awaiting an ack", func() {
+				BeforeEach(func() {
+					message.AckState = PendingMessageAckStateAwaiting
+				})
+
+				It("should be awaiting an ack", func() {
+					Ω(message.IsAwaitingAck()).Should(BeTrue())
+				})
+
+				It("should time out once the ack timeout has passed", func() {
+					Ω(message.HasAckTimedOut(time.Unix(159, 0), 30*time.Second)).Should(BeFalse())
+					Ω(message.HasAckTimedOut(time.Unix(160, 0), 30*time.Second)).Should(BeTrue())
+				})
+			})
+
+			Context("when its ack state has been resolved", func() {
+				BeforeEach(func() {
+					message.AckState = PendingMessageAckStateAcknowledged
+				})
+
+				It("should not be awaiting an ack, or time out", func() {
+					Ω(message.IsAwaitingAck()).Should(BeFalse())
+					Ω(message.HasAckTimedOut(time.Unix(1000, 0), 30*time.Second)).Should(BeFalse())
+				})
+			})
+
+			Context("when ack tracking is disabled", func() {
+				It("should not be awaiting an ack", func() {
+					Ω(message.IsAwaitingAck()).Should(BeFalse())
+				})
+			})
 		})
 
 		Context("when it was not yet sent", func() {
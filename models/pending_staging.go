@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+//A PendingStaging records when HM9000 first saw a desired app whose package was still PENDING.
+//ReportedAt is set once the analyzer has announced that the app is stuck in staging, so that it is only announced once.
+type PendingStaging struct {
+	AppGuid      string `json:"droplet"`
+	AppVersion   string `json:"version"`
+	PendingSince int64  `json:"pending_since"`
+	ReportedAt   int64  `json:"reported_at"`
+}
+
+func NewPendingStaging(now time.Time, appGuid string, appVersion string) PendingStaging {
+	return PendingStaging{
+		AppGuid:      appGuid,
+		AppVersion:   appVersion,
+		PendingSince: now.Unix(),
+	}
+}
+
+func NewPendingStagingFromJSON(encoded []byte) (PendingStaging, error) {
+	pendingStaging := PendingStaging{}
+	err := json.Unmarshal(encoded, &pendingStaging)
+	if err != nil {
+		return PendingStaging{}, err
+	}
+	return pendingStaging, nil
+}
+
+func (pendingStaging PendingStaging) ToJSON() []byte {
+	result, _ := json.Marshal(pendingStaging)
+	return result
+}
+
+func (pendingStaging PendingStaging) StoreKey() string {
+	return pendingStaging.AppGuid + "," + pendingStaging.AppVersion
+}
+
+func (pendingStaging PendingStaging) LogDescription() map[string]string {
+	return map[string]string{
+		"AppGuid":      pendingStaging.AppGuid,
+		"AppVersion":   pendingStaging.AppVersion,
+		"PendingSince": strconv.FormatInt(pendingStaging.PendingSince, 10),
+		"ReportedAt":   strconv.FormatInt(pendingStaging.ReportedAt, 10),
+	}
+}
+
+func (pendingStaging PendingStaging) TimePending(currentTime time.Time) time.Duration {
+	return currentTime.Sub(time.Unix(pendingStaging.PendingSince, 0))
+}
+
+//IsStuck is always false when the staging timeout is disabled (0)
+func (pendingStaging PendingStaging) IsStuck(currentTime time.Time, stagingTimeout time.Duration) bool {
+	return stagingTimeout > 0 && pendingStaging.TimePending(currentTime) > stagingTimeout
+}
+
+func (pendingStaging PendingStaging) IsReported() bool {
+	return pendingStaging.ReportedAt != 0
+}
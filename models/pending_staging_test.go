@@ -0,0 +1,77 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("PendingStaging", func() {
+	var pendingStaging PendingStaging
+
+	BeforeEach(func() {
+		pendingStaging = NewPendingStaging(time.Unix(100, 0), "abc", "123")
+	})
+
+	Describe("ToJSON", func() {
+		It("should have the right fields", func() {
+			json := string(pendingStaging.ToJSON())
+			Ω(json).Should(ContainSubstring(`"droplet":"abc"`))
+			Ω(json).Should(ContainSubstring(`"version":"123"`))
+			Ω(json).Should(ContainSubstring(`"pending_since":100`))
+			Ω(json).Should(ContainSubstring(`"reported_at":0`))
+		})
+	})
+
+	Describe("NewPendingStagingFromJSON", func() {
+		It("should create the right pending staging", func() {
+			decoded, err := NewPendingStagingFromJSON(pendingStaging.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(pendingStaging))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewPendingStagingFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("should return appguid,appversion", func() {
+			Ω(pendingStaging.StoreKey()).Should(Equal("abc,123"))
+		})
+	})
+
+	Describe("LogDescription", func() {
+		It("should return the right map", func() {
+			pendingStaging.ReportedAt = 200
+			Ω(pendingStaging.LogDescription()).Should(Equal(map[string]string{
+				"AppGuid":      "abc",
+				"AppVersion":   "123",
+				"PendingSince": "100",
+				"ReportedAt":   "200",
+			}))
+		})
+	})
+
+	Describe("IsStuck", func() {
+		It("should be true once the app has been pending for longer than the staging timeout", func() {
+			Ω(pendingStaging.IsStuck(time.Unix(160, 0), time.Minute)).Should(BeFalse())
+			Ω(pendingStaging.IsStuck(time.Unix(161, 0), time.Minute)).Should(BeTrue())
+		})
+
+		It("should never be true when the staging timeout is disabled", func() {
+			Ω(pendingStaging.IsStuck(time.Unix(100000, 0), 0)).Should(BeFalse())
+		})
+	})
+
+	Describe("IsReported", func() {
+		It("should be true once a report time has been recorded", func() {
+			Ω(pendingStaging.IsReported()).Should(BeFalse())
+			pendingStaging.ReportedAt = 200
+			Ω(pendingStaging.IsReported()).Should(BeTrue())
+		})
+	})
+})
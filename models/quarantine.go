@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+//A Quarantine marks an app index that crashed too often for HM9000 to keep restarting it.
+//The analyzer will not enqueue starts for a quarantined index until an operator lifts the quarantine.
+type Quarantine struct {
+	AppGuid       string `json:"droplet"`
+	AppVersion    string `json:"version"`
+	InstanceIndex int    `json:"instance_index"`
+	CrashCount    int    `json:"crash_count"`
+	QuarantinedAt int64  `json:"quarantined_at"`
+}
+
+func NewQuarantineFromJSON(encoded []byte) (Quarantine, error) {
+	quarantine := Quarantine{}
+	err := json.Unmarshal(encoded, &quarantine)
+	if err != nil {
+		return Quarantine{}, err
+	}
+	return quarantine, nil
+}
+
+func (quarantine Quarantine) ToJSON() []byte {
+	result, _ := json.Marshal(quarantine)
+	return result
+}
+
+func (quarantine Quarantine) StoreKey() string {
+	return quarantine.AppGuid + "-" + quarantine.AppVersion + "-" + strconv.Itoa(quarantine.InstanceIndex)
+}
+
+func (quarantine Quarantine) LogDescription() map[string]string {
+	return map[string]string{
+		"AppGuid":       quarantine.AppGuid,
+		"AppVersion":    quarantine.AppVersion,
+		"InstanceIndex": strconv.Itoa(quarantine.InstanceIndex),
+		"CrashCount":    strconv.Itoa(quarantine.CrashCount),
+		"QuarantinedAt": strconv.FormatInt(quarantine.QuarantinedAt, 10),
+	}
+}
@@ -0,0 +1,64 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quarantine", func() {
+	var quarantine Quarantine
+
+	BeforeEach(func() {
+		quarantine = Quarantine{
+			AppGuid:       "abc",
+			AppVersion:    "123",
+			InstanceIndex: 1,
+			CrashCount:    12,
+			QuarantinedAt: 172,
+		}
+	})
+
+	Describe("ToJSON", func() {
+		It("should have the right fields", func() {
+			json := string(quarantine.ToJSON())
+			Ω(json).Should(ContainSubstring(`"droplet":"abc"`))
+			Ω(json).Should(ContainSubstring(`"version":"123"`))
+			Ω(json).Should(ContainSubstring(`"instance_index":1`))
+			Ω(json).Should(ContainSubstring(`"crash_count":12`))
+			Ω(json).Should(ContainSubstring(`"quarantined_at":172`))
+		})
+	})
+
+	Describe("NewQuarantineFromJSON", func() {
+		It("should create right quarantine", func() {
+			decoded, err := NewQuarantineFromJSON(quarantine.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(quarantine))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewQuarantineFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("should return appguid-appversion-index", func() {
+			Ω(quarantine.StoreKey()).Should(Equal("abc-123-1"))
+		})
+	})
+
+	Describe("LogDescription", func() {
+		It("should return the right map", func() {
+			Ω(quarantine.LogDescription()).Should(Equal(map[string]string{
+				"AppGuid":       "abc",
+				"AppVersion":    "123",
+				"InstanceIndex": "1",
+				"CrashCount":    "12",
+				"QuarantinedAt": "172",
+			}))
+		})
+	})
+})
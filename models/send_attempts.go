@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+//SendAttempts counts how many times the sender has sent a start or stop message for the same StoreKey without it having an effect.
+//The count starts afresh once a send has an effect (see the sender) and when no message is sent for the key for a while.
+type SendAttempts struct {
+	MessageType    string `json:"message_type"`
+	MessageKey     string `json:"message_key"`
+	Count          int    `json:"count"`
+	FirstAttemptAt int64  `json:"first_attempt_at"`
+	LastAttemptAt  int64  `json:"last_attempt_at"`
+}
+
+func NewStartSendAttempts(message PendingStartMessage) SendAttempts {
+	return SendAttempts{
+		MessageType: "start",
+		MessageKey:  message.StoreKey(),
+	}
+}
+
+func NewStopSendAttempts(message PendingStopMessage) SendAttempts {
+	return SendAttempts{
+		MessageType: "stop",
+		MessageKey:  message.StoreKey(),
+	}
+}
+
+func NewSendAttemptsFromJSON(encoded []byte) (SendAttempts, error) {
+	attempts := SendAttempts{}
+	err := json.Unmarshal(encoded, &attempts)
+	if err != nil {
+		return SendAttempts{}, err
+	}
+	return attempts, nil
+}
+
+//Attempted returns the attempts with one more send, made at now
+func (attempts SendAttempts) Attempted(now time.Time) SendAttempts {
+	if attempts.Count == 0 {
+		attempts.FirstAttemptAt = now.Unix()
+	}
+	attempts.Count++
+	attempts.LastAttemptAt = now.Unix()
+	return attempts
+}
+
+func (attempts SendAttempts) ToJSON() []byte {
+	encoded, _ := json.Marshal(attempts)
+	return encoded
+}
+
+func (attempts SendAttempts) StoreKey() string {
+	return attempts.MessageType + "-" + attempts.MessageKey
+}
+
+func (attempts SendAttempts) LogDescription() map[string]string {
+	return map[string]string{
+		"MessageType":    attempts.MessageType,
+		"MessageKey":     attempts.MessageKey,
+		"Count":          strconv.Itoa(attempts.Count),
+		"FirstAttemptAt": time.Unix(attempts.FirstAttemptAt, 0).String(),
+		"LastAttemptAt":  time.Unix(attempts.LastAttemptAt, 0).String(),
+	}
+}
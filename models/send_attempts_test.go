@@ -0,0 +1,73 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("SendAttempts", func() {
+	var startMessage PendingStartMessage
+	var stopMessage PendingStopMessage
+
+	BeforeEach(func() {
+		startMessage = NewPendingStartMessage(time.Unix(100, 0), 30, 0, "app-guid", "app-version", 1, 1.0, PendingStartMessageReasonMissing)
+		stopMessage = NewPendingStopMessage(time.Unix(100, 0), 30, 0, "app-guid", "app-version", "instance-guid", PendingStopMessageReasonExtra)
+	})
+
+	Describe("creating send attempts for a message", func() {
+		It("should identify the message by its type and store key", func() {
+			startAttempts := NewStartSendAttempts(startMessage)
+			Ω(startAttempts.Count).Should(BeZero())
+			Ω(startAttempts.StoreKey()).Should(Equal("start-app-guid-app-version-1"))
+
+			stopAttempts := NewStopSendAttempts(stopMessage)
+			Ω(stopAttempts.Count).Should(BeZero())
+			Ω(stopAttempts.StoreKey()).Should(Equal("stop-instance-guid"))
+		})
+	})
+
+	Describe("Attempted", func() {
+		It("should count the attempt and remember when the first and last attempts were made", func() {
+			attempts := NewStartSendAttempts(startMessage).Attempted(time.Unix(130, 0))
+			Ω(attempts.Count).Should(Equal(1))
+			Ω(attempts.FirstAttemptAt).Should(BeNumerically("==", 130))
+			Ω(attempts.LastAttemptAt).Should(BeNumerically("==", 130))
+
+			attempts = attempts.Attempted(time.Unix(170, 0))
+			Ω(attempts.Count).Should(Equal(2))
+			Ω(attempts.FirstAttemptAt).Should(BeNumerically("==", 130))
+			Ω(attempts.LastAttemptAt).Should(BeNumerically("==", 170))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("should round trip", func() {
+			attempts := NewStopSendAttempts(stopMessage).Attempted(time.Unix(130, 0))
+			decoded, err := NewSendAttemptsFromJSON(attempts.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(attempts))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewSendAttemptsFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("LogDescription", func() {
+		It("should return the right map", func() {
+			attempts := NewStartSendAttempts(startMessage).Attempted(time.Unix(130, 0))
+			Ω(attempts.LogDescription()).Should(Equal(map[string]string{
+				"MessageType":    "start",
+				"MessageKey":     "app-guid-app-version-1",
+				"Count":          "1",
+				"FirstAttemptAt": time.Unix(130, 0).String(),
+				"LastAttemptAt":  time.Unix(130, 0).String(),
+			}))
+		})
+	})
+})
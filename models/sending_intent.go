@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//A SendingIntent is recorded, keyed by MessageId, just before the sender publishes a start or stop message,
+//and deleted once the sender has saved the message as sent.  An intent that outlives its pass means the sender
+//died in between: the message may well have been published, so the next sender must not publish it again.
+type SendingIntent struct {
+	MessageId   string `json:"message_id"`
+	MessageType string `json:"message_type"`
+	MessageKey  string `json:"message_key"`
+	RecordedAt  int64  `json:"recorded_at"`
+}
+
+func NewStartSendingIntent(now time.Time, message PendingStartMessage) SendingIntent {
+	return SendingIntent{
+		MessageId:   message.MessageId,
+		MessageType: "start",
+		MessageKey:  message.StoreKey(),
+		RecordedAt:  now.Unix(),
+	}
+}
+
+func NewStopSendingIntent(now time.Time, message PendingStopMessage) SendingIntent {
+	return SendingIntent{
+		MessageId:   message.MessageId,
+		MessageType: "stop",
+		MessageKey:  message.StoreKey(),
+		RecordedAt:  now.Unix(),
+	}
+}
+
+func NewSendingIntentFromJSON(encoded []byte) (SendingIntent, error) {
+	intent := SendingIntent{}
+	err := json.Unmarshal(encoded, &intent)
+	if err != nil {
+		return SendingIntent{}, err
+	}
+	return intent, nil
+}
+
+func (intent SendingIntent) ToJSON() []byte {
+	encoded, _ := json.Marshal(intent)
+	return encoded
+}
+
+func (intent SendingIntent) StoreKey() string {
+	return intent.MessageId
+}
+
+func (intent SendingIntent) LogDescription() map[string]string {
+	return map[string]string{
+		"MessageId":   intent.MessageId,
+		"MessageType": intent.MessageType,
+		"MessageKey":  intent.MessageKey,
+		"RecordedAt":  time.Unix(intent.RecordedAt, 0).String(),
+	}
+}
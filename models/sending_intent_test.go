@@ -0,0 +1,63 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("SendingIntent", func() {
+	var startMessage PendingStartMessage
+	var stopMessage PendingStopMessage
+
+	BeforeEach(func() {
+		startMessage = NewPendingStartMessage(time.Unix(100, 0), 30, 0, "app-guid", "app-version", 1, 1.0, PendingStartMessageReasonMissing)
+		stopMessage = NewPendingStopMessage(time.Unix(100, 0), 30, 0, "app-guid", "app-version", "instance-guid", PendingStopMessageReasonExtra)
+	})
+
+	Describe("creating an intent to send a message", func() {
+		It("should identify the message by its id, type and store key", func() {
+			startIntent := NewStartSendingIntent(time.Unix(130, 0), startMessage)
+			Ω(startIntent.MessageId).Should(Equal(startMessage.MessageId))
+			Ω(startIntent.MessageType).Should(Equal("start"))
+			Ω(startIntent.MessageKey).Should(Equal("app-guid-app-version-1"))
+			Ω(startIntent.RecordedAt).Should(BeNumerically("==", 130))
+
+			stopIntent := NewStopSendingIntent(time.Unix(130, 0), stopMessage)
+			Ω(stopIntent.MessageId).Should(Equal(stopMessage.MessageId))
+			Ω(stopIntent.MessageType).Should(Equal("stop"))
+			Ω(stopIntent.MessageKey).Should(Equal("instance-guid"))
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("should be the message id", func() {
+			intent := NewStartSendingIntent(time.Unix(130, 0), startMessage)
+			Ω(intent.StoreKey()).Should(Equal(startMessage.MessageId))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("should round trip", func() {
+			intent := NewStopSendingIntent(time.Unix(130, 0), stopMessage)
+			decoded, err := NewSendingIntentFromJSON(intent.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(intent))
+		})
+
+		It("should have the right fields", func() {
+			json := string(NewStartSendingIntent(time.Unix(130, 0), startMessage).ToJSON())
+			Ω(json).Should(ContainSubstring(`"message_type":"start"`))
+			Ω(json).Should(ContainSubstring(`"message_key":"app-guid-app-version-1"`))
+			Ω(json).Should(ContainSubstring(`"recorded_at":130`))
+		})
+
+		It("should error when passed invalid json", func() {
+			intent, err := NewSendingIntentFromJSON([]byte("∂"))
+			Ω(intent).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type ShadowPolicyDiffSide string
+
+const (
+	ShadowPolicyDiffOnlyInPolicy ShadowPolicyDiffSide = "POLICY"
+	ShadowPolicyDiffOnlyInShadow ShadowPolicyDiffSide = "SHADOW"
+)
+
+//A ShadowPolicyDiff records a start or stop message that only one of the analyzer's policy and its shadow policy produced in an analysis pass.
+//Start messages are identified by their index and stop messages by their instance guid; the same message with a different reason counts as a diff on both sides.
+type ShadowPolicyDiff struct {
+	DiffId       string               `json:"diff_id"`
+	Timestamp    int64                `json:"timestamp"`
+	Policy       string               `json:"policy"`
+	ShadowPolicy string               `json:"shadow_policy"`
+	OnlyIn       ShadowPolicyDiffSide `json:"only_in"`
+	AppGuid      string               `json:"droplet"`
+	AppVersion   string               `json:"version"`
+	MessageType  string               `json:"message_type"`
+	IndexToStart int                  `json:"index,omitempty"`
+	InstanceGuid string               `json:"instance,omitempty"`
+	Reason       string               `json:"reason"`
+}
+
+func NewShadowPolicyStartDiff(now time.Time, policy string, shadowPolicy string, onlyIn ShadowPolicyDiffSide, message PendingStartMessage) ShadowPolicyDiff {
+	return ShadowPolicyDiff{
+		DiffId:       Guid(),
+		Timestamp:    now.Unix(),
+		Policy:       policy,
+		ShadowPolicy: shadowPolicy,
+		OnlyIn:       onlyIn,
+		AppGuid:      message.AppGuid,
+		AppVersion:   message.AppVersion,
+		MessageType:  "start",
+		IndexToStart: message.IndexToStart,
+		Reason:       string(message.StartReason),
+	}
+}
+
+func NewShadowPolicyStopDiff(now time.Time, policy string, shadowPolicy string, onlyIn ShadowPolicyDiffSide, message PendingStopMessage) ShadowPolicyDiff {
+	return ShadowPolicyDiff{
+		DiffId:       Guid(),
+		Timestamp:    now.Unix(),
+		Policy:       policy,
+		ShadowPolicy: shadowPolicy,
+		OnlyIn:       onlyIn,
+		AppGuid:      message.AppGuid,
+		AppVersion:   message.AppVersion,
+		MessageType:  "stop",
+		InstanceGuid: message.InstanceGuid,
+		Reason:       string(message.StopReason),
+	}
+}
+
+func NewShadowPolicyDiffFromJSON(encoded []byte) (ShadowPolicyDiff, error) {
+	diff := ShadowPolicyDiff{}
+	err := json.Unmarshal(encoded, &diff)
+	if err != nil {
+		return ShadowPolicyDiff{}, err
+	}
+	return diff, nil
+}
+
+func (diff ShadowPolicyDiff) ToJSON() []byte {
+	encoded, _ := json.Marshal(diff)
+	return encoded
+}
+
+func (diff ShadowPolicyDiff) StoreKey() string {
+	return diff.DiffId
+}
+
+func (diff ShadowPolicyDiff) LogDescription() map[string]string {
+	description := map[string]string{
+		"Policy":       diff.Policy,
+		"ShadowPolicy": diff.ShadowPolicy,
+		"OnlyIn":       string(diff.OnlyIn),
+		"AppGuid":      diff.AppGuid,
+		"AppVersion":   diff.AppVersion,
+		"MessageType":  diff.MessageType,
+		"Reason":       diff.Reason,
+	}
+	if diff.MessageType == "start" {
+		description["IndexToStart"] = strconv.Itoa(diff.IndexToStart)
+	} else {
+		description["InstanceGuid"] = diff.InstanceGuid
+	}
+	return description
+}
+
+type sortableShadowPolicyDiffsByTimestamp []ShadowPolicyDiff
+
+func (s sortableShadowPolicyDiffsByTimestamp) Len() int      { return len(s) }
+func (s sortableShadowPolicyDiffsByTimestamp) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortableShadowPolicyDiffsByTimestamp) Less(i, j int) bool {
+	return s[i].Timestamp < s[j].Timestamp
+}
+
+//SortShadowPolicyDiffsByTimestamp returns the diffs oldest first
+func SortShadowPolicyDiffsByTimestamp(diffs []ShadowPolicyDiff) []ShadowPolicyDiff {
+	sortedDiffs := make(sortableShadowPolicyDiffsByTimestamp, len(diffs))
+	copy(sortedDiffs, diffs)
+	sort.Stable(sortedDiffs)
+	return sortedDiffs
+}
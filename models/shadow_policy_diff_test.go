@@ -0,0 +1,92 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("ShadowPolicyDiff", func() {
+	var (
+		startMessage PendingStartMessage
+		stopMessage  PendingStopMessage
+		startDiff    ShadowPolicyDiff
+		stopDiff     ShadowPolicyDiff
+	)
+
+	BeforeEach(func() {
+		startMessage = NewPendingStartMessage(time.Unix(100, 0), 10, 4, "app-guid", "app-version", 2, 0.5, PendingStartMessageReasonCrashed)
+		stopMessage = NewPendingStopMessage(time.Unix(100, 0), 10, 4, "app-guid", "app-version", "instance-guid", PendingStopMessageReasonExtra)
+		startDiff = NewShadowPolicyStartDiff(time.Unix(120, 0), "default", "cautious", ShadowPolicyDiffOnlyInPolicy, startMessage)
+		stopDiff = NewShadowPolicyStopDiff(time.Unix(120, 0), "default", "cautious", ShadowPolicyDiffOnlyInShadow, stopMessage)
+	})
+
+	Describe("NewShadowPolicyStartDiff", func() {
+		It("should populate the diff from the start message", func() {
+			Ω(startDiff.DiffId).ShouldNot(BeEmpty())
+			Ω(startDiff.Timestamp).Should(BeNumerically("==", 120))
+			Ω(startDiff.Policy).Should(Equal("default"))
+			Ω(startDiff.ShadowPolicy).Should(Equal("cautious"))
+			Ω(startDiff.OnlyIn).Should(Equal(ShadowPolicyDiffOnlyInPolicy))
+			Ω(startDiff.AppGuid).Should(Equal("app-guid"))
+			Ω(startDiff.AppVersion).Should(Equal("app-version"))
+			Ω(startDiff.MessageType).Should(Equal("start"))
+			Ω(startDiff.IndexToStart).Should(Equal(2))
+			Ω(startDiff.InstanceGuid).Should(BeEmpty())
+			Ω(startDiff.Reason).Should(Equal("CRASHED"))
+		})
+	})
+
+	Describe("NewShadowPolicyStopDiff", func() {
+		It("should populate the diff from the stop message", func() {
+			Ω(stopDiff.DiffId).ShouldNot(BeEmpty())
+			Ω(stopDiff.OnlyIn).Should(Equal(ShadowPolicyDiffOnlyInShadow))
+			Ω(stopDiff.MessageType).Should(Equal("stop"))
+			Ω(stopDiff.InstanceGuid).Should(Equal("instance-guid"))
+			Ω(stopDiff.Reason).Should(Equal("EXTRA"))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("should round trip", func() {
+			decoded, err := NewShadowPolicyDiffFromJSON(startDiff.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(startDiff))
+
+			decoded, err = NewShadowPolicyDiffFromJSON(stopDiff.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(stopDiff))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewShadowPolicyDiffFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("should be the diff id", func() {
+			Ω(startDiff.StoreKey()).Should(Equal(startDiff.DiffId))
+		})
+	})
+
+	Describe("LogDescription", func() {
+		It("should describe the message the diff is about", func() {
+			Ω(startDiff.LogDescription()["IndexToStart"]).Should(Equal("2"))
+			Ω(startDiff.LogDescription()).ShouldNot(HaveKey("InstanceGuid"))
+			Ω(stopDiff.LogDescription()["InstanceGuid"]).Should(Equal("instance-guid"))
+			Ω(stopDiff.LogDescription()).ShouldNot(HaveKey("IndexToStart"))
+		})
+	})
+
+	Describe("SortShadowPolicyDiffsByTimestamp", func() {
+		It("should sort the diffs oldest first", func() {
+			a := ShadowPolicyDiff{DiffId: "a", Timestamp: 30}
+			b := ShadowPolicyDiff{DiffId: "b", Timestamp: 10}
+			c := ShadowPolicyDiff{DiffId: "c", Timestamp: 20}
+			Ω(SortShadowPolicyDiffsByTimestamp([]ShadowPolicyDiff{a, b, c})).Should(Equal([]ShadowPolicyDiff{b, c, a}))
+		})
+	})
+})
@@ -0,0 +1,97 @@
+package sender
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/yagnats"
+)
+
+//A CommandTransport delivers the sender's start and stop messages to the runtimes.
+//payload holds the exact bytes to deliver: the message's JSON or, when signing is enabled, its signed envelope.
+type CommandTransport interface {
+	SendStart(message models.StartMessage, payload []byte) error
+	SendStop(message models.StopMessage, payload []byte) error
+}
+
+const (
+	NATSTransportName    = "nats"
+	WebhookTransportName = "webhook"
+	FileTransportName    = "file"
+)
+
+//IsNATSTransport is true when the transport named by conf.SenderTransport needs a message bus
+func IsNATSTransport(conf *config.Config) bool {
+	return conf.SenderTransport == NATSTransportName || conf.SenderTransport == ""
+}
+
+//ValidateConfig rejects a config that names a transport the sender does not have.
+//hm9000 calls it when it loads the config.
+func ValidateConfig(conf *config.Config) error {
+	switch conf.SenderTransport {
+	case NATSTransportName, WebhookTransportName, FileTransportName, "":
+		return nil
+	default:
+		return fmt.Errorf("Unknown sender transport: %s", conf.SenderTransport)
+	}
+}
+
+//NewCommandTransport builds the transport named by conf.SenderTransport.
+//messageBus is only used by the NATS transport and may be nil for the others.
+func NewCommandTransport(conf *config.Config, messageBus yagnats.NATSClient) (CommandTransport, error) {
+	switch conf.SenderTransport {
+	case NATSTransportName, "":
+		return NewNATSTransport(messageBus, conf), nil
+	case WebhookTransportName:
+		if conf.SenderWebhookStartURL == "" || conf.SenderWebhookStopURL == "" {
+			return nil, fmt.Errorf("The %s sender transport needs both a start and a stop URL", WebhookTransportName)
+		}
+		return NewWebhookTransport(conf.SenderWebhookStartURL, conf.SenderWebhookStopURL, conf.SenderWebhookTimeout()), nil
+	case FileTransportName:
+		if conf.SenderTransportFile == "" {
+			return nil, fmt.Errorf("The %s sender transport needs a file", FileTransportName)
+		}
+		return NewFileTransport(conf.SenderTransportFile), nil
+	default:
+		return nil, fmt.Errorf("Unknown sender transport: %s", conf.SenderTransport)
+	}
+}
+
+//NATSTransport publishes start and stop messages on the sender's NATS subjects (this is the default transport)
+type NATSTransport struct {
+	messageBus   yagnats.NATSClient
+	startSubject string
+	stopSubject  string
+}
+
+func NewNATSTransport(messageBus yagnats.NATSClient, conf *config.Config) *NATSTransport {
+	return &NATSTransport{
+		messageBus:   messageBus,
+		startSubject: conf.SenderNatsStartSubject,
+		stopSubject:  conf.SenderNatsStopSubject,
+	}
+}
+
+func (transport *NATSTransport) SendStart(message models.StartMessage, payload []byte) error {
+	return natsPublishError(transport.messageBus.Publish(transport.startSubject, payload))
+}
+
+func (transport *NATSTransport) SendStop(message models.StopMessage, payload []byte) error {
+	return natsPublishError(transport.messageBus.Publish(transport.stopSubject, payload))
+}
+
+//natsPublishError marks the errors NATS returns for a message it will never accept (too large, or for an invalid subject) as permanent.
+//NATS only tells them apart by their text.
+func natsPublishError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := strings.ToLower(err.Error())
+	if strings.Contains(message, "maximum payload") || strings.Contains(message, "invalid subject") {
+		return &PermanentPublishError{Err: err}
+	}
+	return err
+}
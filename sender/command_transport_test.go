@@ -0,0 +1,117 @@
+package sender_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/sender"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CommandTransport", func() {
+	var (
+		conf       *config.Config
+		messageBus *fakeyagnats.FakeYagnats
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		messageBus = fakeyagnats.New()
+	})
+
+	Describe("NewCommandTransport", func() {
+		It("should default to NATS", func() {
+			transport, err := NewCommandTransport(conf, messageBus)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(transport).Should(BeAssignableToTypeOf(&NATSTransport{}))
+			Ω(IsNATSTransport(conf)).Should(BeTrue())
+
+			conf.SenderTransport = ""
+			transport, err = NewCommandTransport(conf, messageBus)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(transport).Should(BeAssignableToTypeOf(&NATSTransport{}))
+		})
+
+		It("should build a webhook transport, if it has both URLs", func() {
+			conf.SenderTransport = "webhook"
+			conf.SenderWebhookStartURL = "http://runtime.example.com/start"
+
+			_, err := NewCommandTransport(conf, nil)
+			Ω(err).Should(HaveOccurred())
+
+			conf.SenderWebhookStopURL = "http://runtime.example.com/stop"
+			transport, err := NewCommandTransport(conf, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(transport).Should(BeAssignableToTypeOf(&WebhookTransport{}))
+			Ω(IsNATSTransport(conf)).Should(BeFalse())
+		})
+
+		It("should build a file transport, if it has a file", func() {
+			conf.SenderTransport = "file"
+
+			_, err := NewCommandTransport(conf, nil)
+			Ω(err).Should(HaveOccurred())
+
+			conf.SenderTransportFile = "/tmp/commands.jsonl"
+			transport, err := NewCommandTransport(conf, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(transport).Should(BeAssignableToTypeOf(&FileTransport{}))
+		})
+
+		It("should error for an unknown transport", func() {
+			conf.SenderTransport = "carrier-pigeon"
+			_, err := NewCommandTransport(conf, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("ValidateConfig", func() {
+		It("should accept every transport, and the empty name as the default", func() {
+			for _, transport := range []string{"", "nats", "webhook", "file"} {
+				conf.SenderTransport = transport
+				Ω(ValidateConfig(conf)).Should(Succeed())
+			}
+		})
+
+		It("should reject a transport the sender does not have", func() {
+			conf.SenderTransport = "carrier-pigeon"
+			Ω(ValidateConfig(conf)).Should(MatchError("Unknown sender transport: carrier-pigeon"))
+		})
+	})
+
+	Describe("NATSTransport", func() {
+		It("should publish start and stop messages on the sender's subjects", func() {
+			transport := NewNATSTransport(messageBus, conf)
+			startMessage := models.StartMessage{MessageId: "start-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceIndex: 1}
+			stopMessage := models.StopMessage{MessageId: "stop-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceGuid: "instance-guid", InstanceIndex: 2}
+
+			Ω(transport.SendStart(startMessage, startMessage.ToJSON())).ShouldNot(HaveOccurred())
+			Ω(transport.SendStop(stopMessage, stopMessage.ToJSON())).ShouldNot(HaveOccurred())
+
+			Ω(messageBus.PublishedMessages[conf.SenderNatsStartSubject]).Should(HaveLen(1))
+			Ω([]byte(messageBus.PublishedMessages[conf.SenderNatsStartSubject][0].Payload)).Should(Equal(startMessage.ToJSON()))
+			Ω(messageBus.PublishedMessages[conf.SenderNatsStopSubject]).Should(HaveLen(1))
+			Ω([]byte(messageBus.PublishedMessages[conf.SenderNatsStopSubject][0].Payload)).Should(Equal(stopMessage.ToJSON()))
+		})
+
+		It("should only mark the errors NATS will never get past as permanent", func() {
+			transport := NewNATSTransport(messageBus, conf)
+			startMessage := models.StartMessage{MessageId: "start-id"}
+
+			for _, natsError := range []string{"nats: maximum payload exceeded", "-ERR 'Invalid Subject'"} {
+				messageBus.PublishError = errors.New(natsError)
+				err := transport.SendStart(startMessage, startMessage.ToJSON())
+				Ω(IsPermanentPublishError(err)).Should(BeTrue())
+				Ω(err.Error()).Should(Equal(natsError))
+			}
+
+			messageBus.PublishError = errors.New("write tcp: broken pipe")
+			err := transport.SendStart(startMessage, startMessage.ToJSON())
+			Ω(err).Should(Equal(messageBus.PublishError))
+			Ω(IsPermanentPublishError(err)).Should(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,73 @@
+package sender
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//FileTransport appends the payload of every start and stop message to a file, one JSON command per line.
+//It is meant for tests and dry runs: nothing reads the file but ReadFileTransportCommands.
+type FileTransport struct {
+	path string
+}
+
+//A FileTransportCommand is one line of a FileTransport's file: exactly one of Start and Stop is set, to the payload that was sent
+type FileTransportCommand struct {
+	Start json.RawMessage `json:"start,omitempty"`
+	Stop  json.RawMessage `json:"stop,omitempty"`
+}
+
+func NewFileTransport(path string) *FileTransport {
+	return &FileTransport{
+		path: path,
+	}
+}
+
+func (transport *FileTransport) SendStart(message models.StartMessage, payload []byte) error {
+	return transport.append(FileTransportCommand{Start: payload})
+}
+
+func (transport *FileTransport) SendStop(message models.StopMessage, payload []byte) error {
+	return transport.append(FileTransportCommand{Stop: payload})
+}
+
+func (transport *FileTransport) append(command FileTransportCommand) error {
+	encoded, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(transport.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(encoded, '\n'))
+	return err
+}
+
+//ReadFileTransportCommands returns the commands a FileTransport has written to path, in the order they were sent
+func ReadFileTransportCommands(path string) ([]FileTransportCommand, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	commands := []FileTransportCommand{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		command := FileTransportCommand{}
+		err = json.Unmarshal(scanner.Bytes(), &command)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, scanner.Err()
+}
@@ -0,0 +1,61 @@
+package sender_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/sender"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileTransport", func() {
+	var (
+		dir       string
+		path      string
+		transport *FileTransport
+	)
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "file-transport")
+		path = filepath.Join(dir, "commands.jsonl")
+		transport = NewFileTransport(path)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should append every command to the file, in order", func() {
+		startMessage := models.StartMessage{MessageId: "start-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceIndex: 1}
+		stopMessage := models.StopMessage{MessageId: "stop-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceGuid: "instance-guid", InstanceIndex: 2}
+
+		Ω(transport.SendStart(startMessage, startMessage.ToJSON())).ShouldNot(HaveOccurred())
+		Ω(transport.SendStop(stopMessage, stopMessage.ToJSON())).ShouldNot(HaveOccurred())
+
+		commands, err := ReadFileTransportCommands(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(commands).Should(HaveLen(2))
+		Ω([]byte(commands[0].Start)).Should(Equal(startMessage.ToJSON()))
+		Ω(commands[0].Stop).Should(BeNil())
+		Ω(commands[1].Start).Should(BeNil())
+		Ω([]byte(commands[1].Stop)).Should(Equal(stopMessage.ToJSON()))
+	})
+
+	It("should write one JSON command per line", func() {
+		transport.SendStart(models.StartMessage{MessageId: "start-id"}, models.StartMessage{MessageId: "start-id"}.ToJSON())
+
+		contents, _ := ioutil.ReadFile(path)
+		Ω(string(contents)).Should(Equal(`{"start":{"message_id":"start-id","droplet":"","version":"","instance_index":0}}` + "\n"))
+	})
+
+	Context("when the file cannot be written", func() {
+		It("should return an error", func() {
+			transport = NewFileTransport(filepath.Join(dir, "missing", "commands.jsonl"))
+			err := transport.SendStart(models.StartMessage{}, models.StartMessage{}.ToJSON())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,143 @@
+package sender
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+var MessageBusDownError = errors.New("Message bus looks down, not publishing for the rest of this pass")
+
+//A PermanentPublishError is returned by a CommandTransport for a message it will never deliver, however often it is retried
+type PermanentPublishError struct {
+	Err error
+}
+
+func (err *PermanentPublishError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *PermanentPublishError) Unwrap() error {
+	return err.Err
+}
+
+//IsPermanentPublishError is true for a PermanentPublishError, or an error wrapping one.
+//Everything else (connection errors, timeouts, a reconnecting client) is worth retrying.
+func IsPermanentPublishError(err error) bool {
+	var permanentErr *PermanentPublishError
+	return errors.As(err, &permanentErr)
+}
+
+//A Publisher publishes the sender's messages through a CommandTransport, retrying failed publishes with a doubling (but capped) backoff.
+//Once enough messages in a row could not be published even with retries, the message bus (whatever the transport) looks down
+//and the publisher refuses to publish anything else: the messages stay in the queue for the next pass.
+//A sender uses a new Publisher on every pass.
+type Publisher struct {
+	transport    CommandTransport
+	conf         *config.Config
+	timeProvider timeprovider.TimeProvider
+	logger       logger.Logger
+
+	startFailures             int
+	stopFailures              int
+	consecutiveFailedMessages int
+}
+
+func NewPublisher(transport CommandTransport, conf *config.Config, timeProvider timeprovider.TimeProvider, logger logger.Logger) *Publisher {
+	return &Publisher{
+		transport:    transport,
+		conf:         conf,
+		timeProvider: timeProvider,
+		logger:       logger,
+	}
+}
+
+//PublishStart signs the message first, if signing is enabled
+func (publisher *Publisher) PublishStart(message models.StartMessage) error {
+	payload := publisher.payload(message.ToJSON())
+	return publisher.publish("start", &publisher.startFailures, func() error {
+		return publisher.transport.SendStart(message, payload)
+	})
+}
+
+//PublishStop signs the message first, if signing is enabled
+func (publisher *Publisher) PublishStop(message models.StopMessage) error {
+	payload := publisher.payload(message.ToJSON())
+	return publisher.publish("stop", &publisher.stopFailures, func() error {
+		return publisher.transport.SendStop(message, payload)
+	})
+}
+
+//payload wraps the message's JSON in a signed envelope when signing is enabled
+func (publisher *Publisher) payload(messageJSON []byte) []byte {
+	if !publisher.conf.IsMessageSigningEnabled() {
+		return messageJSON
+	}
+	return models.SignMessage(publisher.conf.SenderMessageSigningSecret, messageJSON, publisher.timeProvider.Time()).ToJSON()
+}
+
+//publish returns the last publish error once the retries are used up, the first one if it is permanent,
+//and MessageBusDownError without trying once the message bus looks down
+func (publisher *Publisher) publish(command string, failures *int, send func() error) error {
+	if publisher.IsMessageBusDown() {
+		return MessageBusDownError
+	}
+
+	backoff := publisher.conf.SenderPublishRetryBackoff()
+	var err error
+	for attempt := 0; attempt <= publisher.conf.SenderPublishRetries; attempt++ {
+		if attempt > 0 {
+			publisher.timeProvider.Sleep(backoff)
+			backoff *= 2
+			if maximumBackoff := publisher.conf.SenderPublishMaxRetryBackoff(); maximumBackoff > 0 && backoff > maximumBackoff {
+				backoff = maximumBackoff
+			}
+		}
+
+		err = send()
+		if err == nil {
+			publisher.consecutiveFailedMessages = 0
+			return nil
+		}
+
+		*failures++
+		description := map[string]string{
+			"Command": command,
+			"Attempt": strconv.Itoa(attempt + 1),
+		}
+
+		//a permanent error is about the message, not the message bus
+		if IsPermanentPublishError(err) {
+			publisher.logger.Error("Failed to publish, not retrying: the error is permanent", err, description)
+			return err
+		}
+
+		publisher.logger.Error("Failed to publish", err, description)
+	}
+
+	publisher.consecutiveFailedMessages++
+	if publisher.IsMessageBusDown() {
+		publisher.logger.Error("Message bus looks down, not publishing for the rest of this pass", err, map[string]string{
+			"Messages that failed in a row": strconv.Itoa(publisher.consecutiveFailedMessages),
+		})
+	}
+	return err
+}
+
+func (publisher *Publisher) IsMessageBusDown() bool {
+	return publisher.conf.SenderPublishFailuresBeforeGivingUp > 0 && publisher.consecutiveFailedMessages >= publisher.conf.SenderPublishFailuresBeforeGivingUp
+}
+
+//StartFailures counts every failed attempt to publish a start message, retries included
+func (publisher *Publisher) StartFailures() int {
+	return publisher.startFailures
+}
+
+//StopFailures counts every failed attempt to publish a stop message, retries included
+func (publisher *Publisher) StopFailures() int {
+	return publisher.stopFailures
+}
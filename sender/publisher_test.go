@@ -0,0 +1,243 @@
+package sender_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/sender"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//flakyMessageBus fails the next len(publishErrors) publishes, in order, and records every attempt
+type flakyMessageBus struct {
+	*fakeyagnats.FakeYagnats
+	publishErrors []error
+	attempts      []string
+}
+
+func newFlakyMessageBus(publishErrors ...error) *flakyMessageBus {
+	return &flakyMessageBus{
+		FakeYagnats:   fakeyagnats.New(),
+		publishErrors: publishErrors,
+		attempts:      []string{},
+	}
+}
+
+func (bus *flakyMessageBus) Publish(subject string, payload []byte) error {
+	bus.attempts = append(bus.attempts, subject)
+	if len(bus.publishErrors) > 0 {
+		err := bus.publishErrors[0]
+		bus.publishErrors = bus.publishErrors[1:]
+		if err != nil {
+			return err
+		}
+	}
+	return bus.FakeYagnats.Publish(subject, payload)
+}
+
+//sleepRecordingTimeProvider records how long it was asked to sleep, without sleeping
+type sleepRecordingTimeProvider struct {
+	*faketimeprovider.FakeTimeProvider
+	sleeps []time.Duration
+}
+
+func (timeProvider *sleepRecordingTimeProvider) Sleep(duration time.Duration) {
+	timeProvider.sleeps = append(timeProvider.sleeps, duration)
+}
+
+var _ = Describe("Publisher", func() {
+	var (
+		conf         *config.Config
+		timeProvider *sleepRecordingTimeProvider
+		messageBus   *flakyMessageBus
+		publisher    *Publisher
+		transient    error
+		startMessage models.StartMessage
+		stopMessage  models.StopMessage
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.SenderPublishRetries = 2
+		conf.SenderPublishRetryBackoffInMilliseconds = 100
+		conf.SenderPublishFailuresBeforeGivingUp = 2
+
+		timeProvider = &sleepRecordingTimeProvider{FakeTimeProvider: &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}}
+		transient = errors.New("connection reset by peer")
+
+		startMessage = models.StartMessage{MessageId: "start-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceIndex: 1}
+		stopMessage = models.StopMessage{MessageId: "stop-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceGuid: "instance-guid", InstanceIndex: 1}
+	})
+
+	JustBeforeEach(func() {
+		publisher = NewPublisher(NewNATSTransport(messageBus, conf), conf, timeProvider, fakelogger.NewFakeLogger())
+	})
+
+	Context("when the publish succeeds", func() {
+		BeforeEach(func() {
+			messageBus = newFlakyMessageBus()
+		})
+
+		It("should publish the message once", func() {
+			err := publisher.PublishStart(startMessage)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.attempts).Should(Equal([]string{"hm9000.start"}))
+			Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+			Ω([]byte(messageBus.PublishedMessages["hm9000.start"][0].Payload)).Should(Equal(startMessage.ToJSON()))
+			Ω(publisher.StartFailures()).Should(BeZero())
+		})
+	})
+
+	Context("when the publish fails with a transient error", func() {
+		BeforeEach(func() {
+			messageBus = newFlakyMessageBus(transient, transient)
+		})
+
+		It("should retry, backing off, until it succeeds", func() {
+			err := publisher.PublishStart(startMessage)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.attempts).Should(HaveLen(3))
+			Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+			Ω(timeProvider.sleeps).Should(Equal([]time.Duration{100 * time.Millisecond, 200 * time.Millisecond}))
+		})
+
+		It("should count the failed attempts on the subject", func() {
+			publisher.PublishStart(startMessage)
+			Ω(publisher.StartFailures()).Should(Equal(2))
+			Ω(publisher.StopFailures()).Should(BeZero())
+		})
+	})
+
+	Context("when the retries are used up", func() {
+		BeforeEach(func() {
+			messageBus = newFlakyMessageBus(transient, transient, transient)
+		})
+
+		It("should return the error", func() {
+			err := publisher.PublishStop(stopMessage)
+			Ω(err).Should(Equal(transient))
+			Ω(messageBus.attempts).Should(HaveLen(3))
+			Ω(publisher.StopFailures()).Should(Equal(3))
+			Ω(publisher.IsMessageBusDown()).Should(BeFalse())
+		})
+	})
+
+	Context("when the backoff would double past the maximum", func() {
+		BeforeEach(func() {
+			conf.SenderPublishRetries = 4
+			conf.SenderPublishMaxRetryBackoffInMilliseconds = 300
+			messageBus = newFlakyMessageBus(transient, transient, transient, transient, transient)
+		})
+
+		It("should wait no longer than the maximum between retries", func() {
+			err := publisher.PublishStart(startMessage)
+			Ω(err).Should(Equal(transient))
+			Ω(messageBus.attempts).Should(HaveLen(5))
+			Ω(timeProvider.sleeps).Should(Equal([]time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}))
+		})
+	})
+
+	Context("when the publish fails with a permanent error", func() {
+		var permanent error
+
+		BeforeEach(func() {
+			permanent = errors.New("Maximum Payload Exceeded")
+			messageBus = newFlakyMessageBus(permanent)
+		})
+
+		It("should not retry", func() {
+			err := publisher.PublishStart(startMessage)
+			Ω(IsPermanentPublishError(err)).Should(BeTrue())
+			Ω(errors.Is(err, permanent)).Should(BeTrue())
+			Ω(messageBus.attempts).Should(HaveLen(1))
+			Ω(timeProvider.sleeps).Should(BeEmpty())
+			Ω(publisher.StartFailures()).Should(Equal(1))
+		})
+	})
+
+	Context("when enough messages in a row fail", func() {
+		BeforeEach(func() {
+			messageBus = newFlakyMessageBus(transient, transient, transient, transient, transient, transient)
+		})
+
+		It("should consider the message bus down and stop publishing", func() {
+			publisher.PublishStart(startMessage)
+			Ω(publisher.IsMessageBusDown()).Should(BeFalse())
+			publisher.PublishStart(startMessage)
+			Ω(publisher.IsMessageBusDown()).Should(BeTrue())
+
+			err := publisher.PublishStop(stopMessage)
+			Ω(err).Should(Equal(MessageBusDownError))
+			Ω(messageBus.attempts).Should(HaveLen(6))
+		})
+
+		Context("when giving up is disabled", func() {
+			BeforeEach(func() {
+				conf.SenderPublishFailuresBeforeGivingUp = 0
+			})
+
+			It("should keep publishing", func() {
+				publisher.PublishStart(startMessage)
+				publisher.PublishStart(startMessage)
+				Ω(publisher.IsMessageBusDown()).Should(BeFalse())
+
+				err := publisher.PublishStop(stopMessage)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when a message gets through between failures", func() {
+		BeforeEach(func() {
+			messageBus = newFlakyMessageBus(transient, transient, transient, nil, transient, transient, transient)
+		})
+
+		It("should start counting the failed messages afresh", func() {
+			publisher.PublishStart(startMessage)
+			publisher.PublishStart(startMessage)
+			publisher.PublishStart(startMessage)
+			Ω(publisher.IsMessageBusDown()).Should(BeFalse())
+		})
+	})
+
+	Context("when message signing is enabled", func() {
+		BeforeEach(func() {
+			conf.SenderMessageSigningSecret = "secret"
+			messageBus = newFlakyMessageBus()
+		})
+
+		It("should publish start and stop messages in envelopes signed with the secret, at the current time", func() {
+			publisher.PublishStart(startMessage)
+			publisher.PublishStop(stopMessage)
+
+			signedStart, err := models.NewSignedMessageFromJSON([]byte(messageBus.PublishedMessages["hm9000.start"][0].Payload))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(signedStart.SignedAt).Should(Equal(timeProvider.Time().Unix()))
+			payload, err := signedStart.Verify("secret", timeProvider.Time(), conf.SenderSignatureReplayWindow())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(payload).Should(Equal(startMessage.ToJSON()))
+
+			signedStop, err := models.NewSignedMessageFromJSON([]byte(messageBus.PublishedMessages["hm9000.stop"][0].Payload))
+			Ω(err).ShouldNot(HaveOccurred())
+			payload, err = signedStop.Verify("secret", timeProvider.Time(), conf.SenderSignatureReplayWindow())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(payload).Should(Equal(stopMessage.ToJSON()))
+		})
+	})
+
+	Describe("IsPermanentPublishError", func() {
+		It("should only consider PermanentPublishErrors permanent, however they are wrapped", func() {
+			permanent := &PermanentPublishError{Err: errors.New("nope")}
+			Ω(IsPermanentPublishError(permanent)).Should(BeTrue())
+			Ω(IsPermanentPublishError(fmt.Errorf("sending: %w", permanent))).Should(BeTrue())
+			Ω(IsPermanentPublishError(errors.New("write tcp: broken pipe"))).Should(BeFalse())
+		})
+	})
+})
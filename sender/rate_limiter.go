@@ -0,0 +1,127 @@
+package sender
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+)
+
+//A tokenBucket holds at most limit tokens and refills, continuously, from empty to full over the rate limit period
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+//A RateLimiter keeps a token bucket per app guid and per DEA guid across sender passes.
+//Every message sent takes a token from each of its buckets; a message whose buckets are empty is left in the queue for a later pass.
+//A message that was allowed but then not sent gets its tokens back.
+//The buckets live in memory, so a sender that restarts (or takes over leadership) starts with full buckets.
+type RateLimiter struct {
+	conf       *config.Config
+	appBuckets map[string]*tokenBucket
+	deaBuckets map[string]*tokenBucket
+}
+
+func NewRateLimiter(conf *config.Config) *RateLimiter {
+	return &RateLimiter{
+		conf:       conf,
+		appBuckets: map[string]*tokenBucket{},
+		deaBuckets: map[string]*tokenBucket{},
+	}
+}
+
+//AllowStart takes a token from the app's bucket if it has one
+func (limiter *RateLimiter) AllowStart(now time.Time, appGuid string) bool {
+	return limiter.allow(now, appGuid, "")
+}
+
+//AllowStop takes a token from both the app's and the DEA's bucket, but only if both have one
+func (limiter *RateLimiter) AllowStop(now time.Time, appGuid string, deaGuid string) bool {
+	return limiter.allow(now, appGuid, deaGuid)
+}
+
+//RefundStart gives back the token AllowStart took, for a start message that was not sent after all
+func (limiter *RateLimiter) RefundStart(now time.Time, appGuid string) {
+	limiter.refund(now, appGuid, "")
+}
+
+//RefundStop gives back the tokens AllowStop took, for a stop message that was not sent after all
+func (limiter *RateLimiter) RefundStop(now time.Time, appGuid string, deaGuid string) {
+	limiter.refund(now, appGuid, deaGuid)
+}
+
+func (limiter *RateLimiter) allow(now time.Time, appGuid string, deaGuid string) bool {
+	buckets := []*tokenBucket{}
+	if limiter.conf.SenderPerAppRateLimit > 0 {
+		buckets = append(buckets, limiter.refilledBucket(limiter.appBuckets, appGuid, limiter.conf.SenderPerAppRateLimit, now))
+	}
+	if limiter.conf.SenderPerDeaRateLimit > 0 && deaGuid != "" {
+		buckets = append(buckets, limiter.refilledBucket(limiter.deaBuckets, deaGuid, limiter.conf.SenderPerDeaRateLimit, now))
+	}
+
+	for _, bucket := range buckets {
+		if bucket.tokens < 1 {
+			return false
+		}
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true
+}
+
+func (limiter *RateLimiter) refund(now time.Time, appGuid string, deaGuid string) {
+	if limiter.conf.SenderPerAppRateLimit > 0 {
+		refundToken(limiter.refilledBucket(limiter.appBuckets, appGuid, limiter.conf.SenderPerAppRateLimit, now), limiter.conf.SenderPerAppRateLimit)
+	}
+	if limiter.conf.SenderPerDeaRateLimit > 0 && deaGuid != "" {
+		refundToken(limiter.refilledBucket(limiter.deaBuckets, deaGuid, limiter.conf.SenderPerDeaRateLimit, now), limiter.conf.SenderPerDeaRateLimit)
+	}
+}
+
+func refundToken(bucket *tokenBucket, limit int) {
+	bucket.tokens++
+	if bucket.tokens > float64(limit) {
+		bucket.tokens = float64(limit)
+	}
+}
+
+//Forget drops the buckets that have refilled completely, so that the limiter does not grow with every app it has ever seen
+func (limiter *RateLimiter) Forget(now time.Time) {
+	limiter.forgetFullBuckets(limiter.appBuckets, limiter.conf.SenderPerAppRateLimit, now)
+	limiter.forgetFullBuckets(limiter.deaBuckets, limiter.conf.SenderPerDeaRateLimit, now)
+}
+
+func (limiter *RateLimiter) forgetFullBuckets(buckets map[string]*tokenBucket, limit int, now time.Time) {
+	for key := range buckets {
+		if limiter.refilledBucket(buckets, key, limit, now).tokens >= float64(limit) {
+			delete(buckets, key)
+		}
+	}
+}
+
+func (limiter *RateLimiter) refilledBucket(buckets map[string]*tokenBucket, key string, limit int, now time.Time) *tokenBucket {
+	bucket, found := buckets[key]
+	if !found {
+		bucket = &tokenBucket{
+			tokens:     float64(limit),
+			lastRefill: now,
+		}
+		buckets[key] = bucket
+		return bucket
+	}
+
+	period := limiter.conf.SenderRateLimitPeriod()
+	if period <= 0 {
+		bucket.tokens = float64(limit)
+	} else if now.After(bucket.lastRefill) {
+		bucket.tokens += float64(limit) * float64(now.Sub(bucket.lastRefill)) / float64(period)
+	}
+
+	if bucket.tokens > float64(limit) {
+		bucket.tokens = float64(limit)
+	}
+	bucket.lastRefill = now
+	return bucket
+}
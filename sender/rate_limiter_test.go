@@ -0,0 +1,125 @@
+package sender_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/sender"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("RateLimiter", func() {
+	var (
+		conf    *config.Config
+		limiter *RateLimiter
+		now     time.Time
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.SenderPerAppRateLimit = 2
+		conf.SenderPerDeaRateLimit = 3
+		conf.SenderRateLimitPeriodInHeartbeats = 6
+		limiter = NewRateLimiter(conf)
+		now = time.Unix(1000, 0)
+	})
+
+	Context("when the limits are disabled", func() {
+		BeforeEach(func() {
+			conf.SenderPerAppRateLimit = 0
+			conf.SenderPerDeaRateLimit = 0
+		})
+
+		It("should allow everything", func() {
+			for i := 0; i < 100; i++ {
+				Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+				Ω(limiter.AllowStop(now, "app", "dea")).Should(BeTrue())
+			}
+		})
+	})
+
+	Describe("the per-app limit", func() {
+		It("should allow a burst of up to the limit per app", func() {
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStart(now, "app")).Should(BeFalse())
+			Ω(limiter.AllowStop(now, "app", "other-dea")).Should(BeFalse())
+
+			Ω(limiter.AllowStart(now, "other-app")).Should(BeTrue())
+		})
+
+		It("should refill the bucket over the rate limit period", func() {
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+
+			Ω(limiter.AllowStart(now.Add(20*time.Second), "app")).Should(BeFalse())
+			Ω(limiter.AllowStart(now.Add(30*time.Second), "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now.Add(30*time.Second), "app")).Should(BeFalse())
+
+			Ω(limiter.AllowStart(now.Add(10*time.Minute), "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now.Add(10*time.Minute), "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now.Add(10*time.Minute), "app")).Should(BeFalse())
+		})
+	})
+
+	Describe("the per-DEA limit", func() {
+		It("should only apply to stops", func() {
+			Ω(limiter.AllowStop(now, "app-1", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-2", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-3", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-4", "dea")).Should(BeFalse())
+			Ω(limiter.AllowStop(now, "app-4", "other-dea")).Should(BeTrue())
+		})
+
+		It("should not take a token from either bucket when one of them is empty", func() {
+			Ω(limiter.AllowStop(now, "app-1", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-2", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-3", "dea")).Should(BeTrue())
+
+			Ω(limiter.AllowStop(now, "app-1", "dea")).Should(BeFalse())
+			Ω(limiter.AllowStart(now, "app-1")).Should(BeTrue())
+		})
+	})
+
+	Describe("refunds", func() {
+		It("should give back the token a start took", func() {
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			limiter.RefundStart(now, "app")
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now, "app")).Should(BeFalse())
+		})
+
+		It("should give back the tokens a stop took from both buckets", func() {
+			Ω(limiter.AllowStop(now, "app-1", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-2", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-3", "dea")).Should(BeTrue())
+			limiter.RefundStop(now, "app-3", "dea")
+			Ω(limiter.AllowStop(now, "app-4", "dea")).Should(BeTrue())
+			Ω(limiter.AllowStop(now, "app-5", "dea")).Should(BeFalse())
+		})
+
+		It("should not overfill a bucket", func() {
+			limiter.RefundStart(now, "app")
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now, "app")).Should(BeFalse())
+		})
+	})
+
+	Describe("Forget", func() {
+		It("should forget the buckets that have refilled", func() {
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now, "app")).Should(BeTrue())
+
+			limiter.Forget(now.Add(30 * time.Second))
+			Ω(limiter.AllowStart(now.Add(30*time.Second), "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now.Add(30*time.Second), "app")).Should(BeFalse())
+
+			limiter.Forget(now.Add(10 * time.Minute))
+			Ω(limiter.AllowStart(now.Add(10*time.Minute), "app")).Should(BeTrue())
+			Ω(limiter.AllowStart(now.Add(10*time.Minute), "app")).Should(BeTrue())
+		})
+	})
+})
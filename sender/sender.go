@@ -9,7 +9,8 @@ import (
 	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
-	"github.com/cloudfoundry/yagnats"
+	"sort"
+	"strconv"
 )
 
 type Sender struct {
@@ -18,36 +19,73 @@ type Sender struct {
 	logger logger.Logger
 
 	apps         map[string]*models.App
-	messageBus   yagnats.NATSClient
+	publisher    *Publisher
 	timeProvider timeprovider.TimeProvider
+	rateLimiter  *RateLimiter
 
 	numberOfStartMessagesSent int
+	numberOfStopMessagesSent  int
 	sentStartMessages         []models.PendingStartMessage
 	startMessagesToSave       []models.PendingStartMessage
 	startMessagesToDelete     []models.PendingStartMessage
 	sentStopMessages          []models.PendingStopMessage
+	notSentStartMessages      []models.PendingStartMessage
+	expiredStartMessages      []models.PendingStartMessage
+	notSentStopMessages       []models.PendingStopMessage
+	expiredStopMessages       []models.PendingStopMessage
 	stopMessagesToSave        []models.PendingStopMessage
 	stopMessagesToDelete      []models.PendingStopMessage
 	metricsAccountant         metricsaccountant.MetricsAccountant
+	history                   []models.AppHistoryEvent
+
+	acks                  map[string]models.MessageAck
+	acksToDelete          []models.MessageAck
+	resolvedStartMessages []models.PendingStartMessage
+	resolvedStopMessages  []models.PendingStopMessage
+
+	sendAttempts         map[string]models.SendAttempts
+	sendAttemptsToSave   []models.SendAttempts
+	sendAttemptsToDelete []models.SendAttempts
+	deadLetters          []models.DeadLetter
+
+	sendingIntents         map[string]models.SendingIntent
+	sendingIntentsToDelete []models.SendingIntent
 
 	didSucceed bool
 }
 
-func New(store store.Store, metricsAccountant metricsaccountant.MetricsAccountant, conf *config.Config, messageBus yagnats.NATSClient, timeProvider timeprovider.TimeProvider, logger logger.Logger) *Sender {
+//The rate limiter is shared by successive senders so that its buckets carry over from pass to pass
+func New(store store.Store, metricsAccountant metricsaccountant.MetricsAccountant, conf *config.Config, transport CommandTransport, timeProvider timeprovider.TimeProvider, rateLimiter *RateLimiter, logger logger.Logger) *Sender {
 	return &Sender{
-		store:                 store,
-		conf:                  conf,
-		logger:                logger,
-		messageBus:            messageBus,
-		timeProvider:          timeProvider,
-		sentStartMessages:     []models.PendingStartMessage{},
-		startMessagesToSave:   []models.PendingStartMessage{},
-		startMessagesToDelete: []models.PendingStartMessage{},
-		sentStopMessages:      []models.PendingStopMessage{},
-		stopMessagesToSave:    []models.PendingStopMessage{},
-		stopMessagesToDelete:  []models.PendingStopMessage{},
-		metricsAccountant:     metricsAccountant,
-		didSucceed:            true,
+		store:                  store,
+		conf:                   conf,
+		logger:                 logger,
+		publisher:              NewPublisher(transport, conf, timeProvider, logger),
+		timeProvider:           timeProvider,
+		rateLimiter:            rateLimiter,
+		sentStartMessages:      []models.PendingStartMessage{},
+		startMessagesToSave:    []models.PendingStartMessage{},
+		startMessagesToDelete:  []models.PendingStartMessage{},
+		sentStopMessages:       []models.PendingStopMessage{},
+		notSentStartMessages:   []models.PendingStartMessage{},
+		expiredStartMessages:   []models.PendingStartMessage{},
+		notSentStopMessages:    []models.PendingStopMessage{},
+		expiredStopMessages:    []models.PendingStopMessage{},
+		stopMessagesToSave:     []models.PendingStopMessage{},
+		stopMessagesToDelete:   []models.PendingStopMessage{},
+		metricsAccountant:      metricsAccountant,
+		history:                []models.AppHistoryEvent{},
+		acks:                   map[string]models.MessageAck{},
+		acksToDelete:           []models.MessageAck{},
+		resolvedStartMessages:  []models.PendingStartMessage{},
+		resolvedStopMessages:   []models.PendingStopMessage{},
+		sendAttempts:           map[string]models.SendAttempts{},
+		sendAttemptsToSave:     []models.SendAttempts{},
+		sendAttemptsToDelete:   []models.SendAttempts{},
+		deadLetters:            []models.DeadLetter{},
+		sendingIntents:         map[string]models.SendingIntent{},
+		sendingIntentsToDelete: []models.SendingIntent{},
+		didSucceed:             true,
 	}
 }
 
@@ -76,6 +114,31 @@ func (sender *Sender) Send() error {
 		return err
 	}
 
+	if sender.conf.IsAckTrackingEnabled() {
+		sender.acks, err = sender.store.GetMessageAcks()
+		if err != nil {
+			sender.logger.Error("Failed to fetch acks", err)
+			return err
+		}
+	}
+
+	if sender.conf.SenderDeadLetterThreshold > 0 {
+		sender.sendAttempts, err = sender.store.GetSendAttempts()
+		if err != nil {
+			sender.logger.Error("Failed to fetch send attempts", err)
+			return err
+		}
+	}
+
+	sender.sendingIntents, err = sender.store.GetSendingIntents()
+	if err != nil {
+		sender.logger.Error("Failed to fetch sending intents", err)
+		return err
+	}
+
+	sender.rateLimiter.Forget(sender.timeProvider.Time())
+
+	sender.reconcileSendingIntents(pendingStartMessages, pendingStopMessages)
 	sender.sendStartMessages(pendingStartMessages)
 	sender.sendStopMessages(pendingStopMessages)
 
@@ -85,28 +148,105 @@ func (sender *Sender) Send() error {
 		sender.didSucceed = false
 	}
 
+	err = sender.metricsAccountant.IncrementSendLatencyMetrics(sender.timeProvider.Time(), sender.sentStartMessages, sender.sentStopMessages)
+	if err != nil {
+		sender.logger.Error("Failed to increment send latency metrics", err)
+		sender.didSucceed = false
+	}
+
+	err = sender.metricsAccountant.IncrementDeletedMessageMetrics(sender.notSentStartMessages, sender.expiredStartMessages, sender.notSentStopMessages, sender.expiredStopMessages)
+	if err != nil {
+		sender.logger.Error("Failed to increment deleted message metrics", err)
+		sender.didSucceed = false
+	}
+
+	err = sender.metricsAccountant.IncrementAckOutcomeMetrics(sender.resolvedStartMessages, sender.resolvedStopMessages)
+	if err != nil {
+		sender.logger.Error("Failed to increment ack metrics", err)
+		sender.didSucceed = false
+	}
+
+	startPublishFailures := sender.publisher.StartFailures()
+	stopPublishFailures := sender.publisher.StopFailures()
+	err = sender.metricsAccountant.IncrementPublishFailureMetrics(startPublishFailures, stopPublishFailures, sender.publisher.IsMessageBusDown())
+	if err != nil {
+		sender.logger.Error("Failed to increment publish failure metrics", err)
+		sender.didSucceed = false
+	}
+
+	err = sender.metricsAccountant.IncrementDeadLetterMetrics(sender.deadLetters)
+	if err != nil {
+		sender.logger.Error("Failed to increment dead letter metrics", err)
+		sender.didSucceed = false
+	}
+
+	err = sender.store.SaveDeadLetters(sender.deadLetters...)
+	if err != nil {
+		sender.logger.Error("Failed to save dead letters", err)
+		sender.didSucceed = false
+	}
+
+	err = sender.store.SaveSendAttempts(sender.sendAttemptsToSave...)
+	if err != nil {
+		sender.logger.Error("Failed to save send attempts", err)
+		sender.didSucceed = false
+	}
+
+	err = sender.store.DeleteSendAttempts(sender.sendAttemptsToDelete...)
+	if err != nil {
+		sender.logger.Error("Failed to delete send attempts", err)
+		sender.didSucceed = false
+	}
+
+	savedQueues := true
+
 	err = sender.store.SavePendingStartMessages(sender.startMessagesToSave...)
 	if err != nil {
 		sender.logger.Error("Failed to save start messages", err)
 		sender.didSucceed = false
+		savedQueues = false
 	}
 
 	err = sender.store.DeletePendingStartMessages(sender.startMessagesToDelete...)
 	if err != nil {
 		sender.logger.Error("Failed to delete start messages", err)
 		sender.didSucceed = false
+		savedQueues = false
 	}
 
 	err = sender.store.SavePendingStopMessages(sender.stopMessagesToSave...)
 	if err != nil {
 		sender.logger.Error("Failed to save stop messages", err)
 		sender.didSucceed = false
+		savedQueues = false
 	}
 
 	err = sender.store.DeletePendingStopMessages(sender.stopMessagesToDelete...)
 	if err != nil {
 		sender.logger.Error("Failed to delete stop messages", err)
 		sender.didSucceed = false
+		savedQueues = false
+	}
+
+	//the intents of the messages sent this pass must outlive any failure to save them as sent, so the next pass reconciles them
+	if savedQueues {
+		err = sender.store.DeleteSendingIntents(sender.sendingIntentsToDelete...)
+		if err != nil {
+			sender.logger.Error("Failed to delete sending intents", err)
+			sender.didSucceed = false
+		}
+	}
+
+	err = sender.store.DeleteMessageAcks(sender.acksToDelete...)
+	if err != nil {
+		sender.logger.Error("Failed to delete acks", err)
+		sender.didSucceed = false
+	}
+
+	err = sender.store.SaveAppHistoryEvents(sender.history...)
+	if err != nil {
+		sender.logger.Error("Failed to record app history", err)
+		sender.didSucceed = false
 	}
 
 	if !sender.didSucceed {
@@ -117,76 +257,432 @@ func (sender *Sender) Send() error {
 }
 
 func (sender *Sender) sendStartMessages(startMessages map[string]models.PendingStartMessage) {
-	sortedStartMessages := models.SortStartMessagesByPriority(startMessages)
+	sortedStartMessages := models.SortStartMessagesByEffectivePriority(startMessages, sender.timeProvider.Time(), sender.conf.StartPriorityAgingPerSecond())
 
 	for _, startMessage := range sortedStartMessages {
 		if startMessage.IsTimeToSend(sender.timeProvider.Time()) {
 			sender.sendStartMessage(startMessage)
+		} else if startMessage.IsAwaitingAck() {
+			sender.resolveStartMessageAck(startMessage)
 		} else if startMessage.IsExpired(sender.timeProvider.Time()) {
+			sender.expiredStartMessages = append(sender.expiredStartMessages, startMessage)
 			sender.queueStartMessageForDeletion(startMessage, "expired start message")
 		}
 	}
 }
 
 func (sender *Sender) sendStopMessages(stopMessages map[string]models.PendingStopMessage) {
-	for _, stopMessage := range stopMessages {
+	stopMessagesToSend := []models.PendingStopMessage{}
+	messagesToSend := []models.StopMessage{}
+
+	//stops are sent in a fixed order so that the same stops are held back by the limits on every pass
+	keys := sort.StringSlice{}
+	for key := range stopMessages {
+		keys = append(keys, key)
+	}
+	sort.Sort(keys)
+
+	for _, key := range keys {
+		stopMessage := stopMessages[key]
 		if stopMessage.IsTimeToSend(sender.timeProvider.Time()) {
-			sender.sendStopMessage(stopMessage)
+			messageToSend, shouldSend := sender.stopMessageToSend(stopMessage)
+			if !shouldSend {
+				sender.forgetSendAttempts(models.NewStopSendAttempts(stopMessage))
+				sender.notSentStopMessages = append(sender.notSentStopMessages, stopMessage)
+				sender.queueStopMessageForDeletion(stopMessage, "stop message that will not be sent")
+			} else if sender.shouldDeadLetter(sender.stopSendAttempts(stopMessage)) {
+				sender.deadLetterStopMessage(stopMessage)
+			} else {
+				stopMessagesToSend = append(stopMessagesToSend, stopMessage)
+				messagesToSend = append(messagesToSend, messageToSend)
+			}
+		} else if stopMessage.IsAwaitingAck() {
+			sender.resolveStopMessageAck(stopMessage)
 		} else if stopMessage.IsExpired(sender.timeProvider.Time()) {
+			sender.expiredStopMessages = append(sender.expiredStopMessages, stopMessage)
 			sender.queueStopMessageForDeletion(stopMessage, "expired stop message")
 		}
 	}
+
+	if sender.shouldRefuseMassStop(len(stopMessagesToSend)) {
+		for _, stopMessage := range stopMessagesToSend {
+			sender.recordStopHistory(models.AppHistoryEventStopNotSent, "mass stop circuit breaker tripped, will retry", stopMessage)
+		}
+		return
+	}
+
+	for i, stopMessage := range stopMessagesToSend {
+		if sender.publisher.IsMessageBusDown() {
+			sender.recordStopHistory(models.AppHistoryEventStopNotSent, "message bus looks down, will retry", stopMessage)
+			continue
+		}
+
+		if sender.conf.SenderStopMessageLimit > 0 && sender.numberOfStopMessagesSent >= sender.conf.SenderStopMessageLimit {
+			sender.recordStopHistory(models.AppHistoryEventStopNotSent, "sender stop message limit reached, will retry", stopMessage)
+			continue
+		}
+
+		if !sender.rateLimiter.AllowStop(sender.timeProvider.Time(), stopMessage.AppGuid, sender.deaGuidOf(stopMessage)) {
+			sender.logger.Info("Not sending stop message: rate limit reached, will retry", stopMessage.LogDescription())
+			sender.recordStopHistory(models.AppHistoryEventStopNotSent, "app or DEA rate limit reached, will retry", stopMessage)
+			continue
+		}
+
+		sender.sendStopMessage(stopMessage, messagesToSend[i])
+	}
+}
+
+//deaGuidOf returns the DEA running the instance a stop message is for
+func (sender *Sender) deaGuidOf(stopMessage models.PendingStopMessage) string {
+	app, found := sender.apps[sender.store.AppKey(stopMessage.AppGuid, stopMessage.AppVersion)]
+	if !found {
+		return ""
+	}
+	return app.InstanceWithGuid(stopMessage.InstanceGuid).DeaGuid
+}
+
+//shouldRefuseMassStop trips the mass-stop circuit breaker if sending numberOfStops stop messages would stop too many running instances.
+//Refused stop messages stay in the store and are retried on the next pass.
+func (sender *Sender) shouldRefuseMassStop(numberOfStops int) bool {
+	numberOfRunningInstances := 0
+	for _, app := range sender.apps {
+		numberOfRunningInstances += app.NumberOfStartingOrRunningInstances()
+	}
+
+	if !sender.conf.ExceedsMassStopThreshold(numberOfStops, numberOfRunningInstances) {
+		return false
+	}
+
+	details := map[string]string{
+		"Number of stops":             strconv.Itoa(numberOfStops),
+		"Number of running instances": strconv.Itoa(numberOfRunningInstances),
+	}
+
+	allowed, err := sender.store.AreMassStopsAllowed()
+	if err != nil {
+		sender.logger.Error("Failed to check for a mass stop override", err)
+	}
+
+	if allowed {
+		sender.logger.Info("Mass stop circuit breaker overridden, sending stop messages", details)
+		return false
+	}
+
+	sender.logger.Error("Refusing to send stop messages (run `hm9000 allow_mass_stops` to override)", store.MassStopCircuitBreakerTrippedError, details)
+
+	err = sender.metricsAccountant.TrackMassStopCircuitBreakerTrip(numberOfStops)
+	if err != nil {
+		sender.logger.Error("Failed to track mass stop circuit breaker trip", err)
+		sender.didSucceed = false
+	}
+
+	return true
 }
 
 func (sender *Sender) sendStartMessage(startMessage models.PendingStartMessage) {
 	messageToSend, shouldSend := sender.startMessageToSend(startMessage)
 	if shouldSend {
-		if sender.numberOfStartMessagesSent < sender.conf.SenderMessageLimit {
+		if sender.shouldDeadLetter(sender.startSendAttempts(startMessage)) {
+			sender.deadLetterStartMessage(startMessage)
+		} else if sender.publisher.IsMessageBusDown() {
+			sender.recordStartHistory(models.AppHistoryEventStartNotSent, "message bus looks down, will retry", startMessage)
+		} else if sender.numberOfStartMessagesSent >= sender.conf.SenderMessageLimit {
+			sender.recordStartHistory(models.AppHistoryEventStartNotSent, "sender message limit reached, will retry", startMessage)
+		} else if !sender.rateLimiter.AllowStart(sender.timeProvider.Time(), startMessage.AppGuid) {
+			sender.logger.Info("Not sending start message: app rate limit reached, will retry", startMessage.LogDescription())
+			sender.recordStartHistory(models.AppHistoryEventStartNotSent, "app rate limit reached, will retry", startMessage)
+		} else {
+			intent := models.NewStartSendingIntent(sender.timeProvider.Time(), startMessage)
+			if !sender.recordSendingIntent(intent) {
+				sender.rateLimiter.RefundStart(sender.timeProvider.Time(), startMessage.AppGuid)
+				return
+			}
+
 			sender.logger.Info("Sending message", startMessage.LogDescription())
-			err := sender.messageBus.Publish(sender.conf.SenderNatsStartSubject, messageToSend.ToJSON())
+			err := sender.publisher.PublishStart(messageToSend)
 
 			if err != nil {
 				sender.logger.Error("Failed to send start message", err, startMessage.LogDescription())
 				sender.didSucceed = false
+				sender.abandonSendingIntent(intent)
+				sender.rateLimiter.RefundStart(sender.timeProvider.Time(), startMessage.AppGuid)
 				return
 			}
 
 			sender.sentStartMessages = append(sender.sentStartMessages, startMessage)
-
-			if startMessage.KeepAlive == 0 {
-				sender.queueStartMessageForDeletion(startMessage, "a sent start message with no keep alive")
-			} else {
-				sender.markStartMessageSent(startMessage)
-			}
+			sender.recordStartHistory(models.AppHistoryEventStartSent, "start message sent", startMessage)
+			sender.recordSendAttempt(sender.startSendAttempts(startMessage))
+			sender.saveSentStartMessage(startMessage)
+			sender.sendingIntentsToDelete = append(sender.sendingIntentsToDelete, intent)
 
 			sender.numberOfStartMessagesSent += 1
 		}
 	} else {
+		sender.forgetSendAttempts(models.NewStartSendAttempts(startMessage))
+		sender.notSentStartMessages = append(sender.notSentStartMessages, startMessage)
 		sender.queueStartMessageForDeletion(startMessage, "start message that will not be sent")
 	}
 }
 
-func (sender *Sender) sendStopMessage(stopMessage models.PendingStopMessage) {
-	messageToSend, shouldSend := sender.stopMessageToSend(stopMessage)
-	if shouldSend {
-		err := sender.messageBus.Publish(sender.conf.SenderNatsStopSubject, messageToSend.ToJSON())
+func (sender *Sender) sendStopMessage(stopMessage models.PendingStopMessage, messageToSend models.StopMessage) {
+	intent := models.NewStopSendingIntent(sender.timeProvider.Time(), stopMessage)
+	if !sender.recordSendingIntent(intent) {
+		sender.rateLimiter.RefundStop(sender.timeProvider.Time(), stopMessage.AppGuid, sender.deaGuidOf(stopMessage))
+		return
+	}
 
-		if err != nil {
-			sender.logger.Error("Failed to send stop message", err, stopMessage.LogDescription())
-			sender.didSucceed = false
-			return
-		}
+	err := sender.publisher.PublishStop(messageToSend)
+
+	if err != nil {
+		sender.logger.Error("Failed to send stop message", err, stopMessage.LogDescription())
+		sender.didSucceed = false
+		sender.abandonSendingIntent(intent)
+		sender.rateLimiter.RefundStop(sender.timeProvider.Time(), stopMessage.AppGuid, sender.deaGuidOf(stopMessage))
+		return
+	}
+
+	sender.sentStopMessages = append(sender.sentStopMessages, stopMessage)
+	sender.recordStopHistory(models.AppHistoryEventStopSent, "stop message sent", stopMessage)
+	sender.recordSendAttempt(sender.stopSendAttempts(stopMessage))
+	sender.saveSentStopMessage(stopMessage)
+	sender.sendingIntentsToDelete = append(sender.sendingIntentsToDelete, intent)
+	sender.numberOfStopMessagesSent += 1
+}
+
+//saveSentStartMessage keeps a sent start message in the queue (marked as sent) or deletes it
+func (sender *Sender) saveSentStartMessage(startMessage models.PendingStartMessage) {
+	if sender.conf.IsAckTrackingEnabled() {
+		startMessage.AckState = models.PendingMessageAckStateAwaiting
+		sender.markStartMessageSent(startMessage)
+	} else if startMessage.KeepAlive == 0 {
+		sender.queueStartMessageForDeletion(startMessage, "a sent start message with no keep alive")
+	} else {
+		sender.markStartMessageSent(startMessage)
+	}
+}
+
+//saveSentStopMessage keeps a sent stop message in the queue (marked as sent) or deletes it
+func (sender *Sender) saveSentStopMessage(stopMessage models.PendingStopMessage) {
+	if sender.conf.IsAckTrackingEnabled() {
+		stopMessage.AckState = models.PendingMessageAckStateAwaiting
+		sender.markStopMessageSent(stopMessage)
+	} else if stopMessage.KeepAlive == 0 {
+		sender.queueStopMessageForDeletion(stopMessage, "sent stop message with no keep alive")
+	} else {
+		sender.markStopMessageSent(stopMessage)
+	}
+}
+
+//recordSendingIntent saves the intent before the message is published; a message whose intent could not be saved is not published
+func (sender *Sender) recordSendingIntent(intent models.SendingIntent) bool {
+	err := sender.store.SaveSendingIntents(intent)
+	if err != nil {
+		sender.logger.Error("Failed to record sending intent, not sending message", err, intent.LogDescription())
+		sender.didSucceed = false
+		return false
+	}
+	return true
+}
+
+//abandonSendingIntent deletes the intent of a message that failed to publish, so that the next pass sends it
+func (sender *Sender) abandonSendingIntent(intent models.SendingIntent) {
+	err := sender.store.DeleteSendingIntents(intent)
+	if err != nil {
+		sender.logger.Error("Failed to delete sending intent", err, intent.LogDescription())
+	}
+}
 
-		sender.sentStopMessages = append(sender.sentStopMessages, stopMessage)
+//reconcileSendingIntents deals with the intents left behind by a sender that died between publishing messages and saving them as sent.
+//Such a message may have been published, so it is saved as sent (and taken out of this pass) instead of being published again:
+//a message is published at most once for its MessageId.
+func (sender *Sender) reconcileSendingIntents(startMessages map[string]models.PendingStartMessage, stopMessages map[string]models.PendingStopMessage) {
+	for _, intent := range sender.sendingIntents {
+		sender.sendingIntentsToDelete = append(sender.sendingIntentsToDelete, intent)
+
+		if intent.MessageType == "start" {
+			startMessage, found := startMessages[intent.MessageKey]
+			if !found || startMessage.MessageId != intent.MessageId || startMessage.HasBeenSent() {
+				continue
+			}
 
-		if stopMessage.KeepAlive == 0 {
-			sender.queueStopMessageForDeletion(stopMessage, "sent stop message with no keep alive")
+			sender.logger.Info("Not sending start message again: a previous sender may have sent it", startMessage.LogDescription(), intent.LogDescription())
+			sender.recordStartHistory(models.AppHistoryEventStartSent, "start message may have been sent by a sender that stopped before saving it, not sending it again", startMessage)
+			sender.saveSentStartMessage(startMessage)
+			delete(startMessages, intent.MessageKey)
 		} else {
-			sender.markStopMessageSent(stopMessage)
+			stopMessage, found := stopMessages[intent.MessageKey]
+			if !found || stopMessage.MessageId != intent.MessageId || stopMessage.HasBeenSent() {
+				continue
+			}
+
+			sender.logger.Info("Not sending stop message again: a previous sender may have sent it", stopMessage.LogDescription(), intent.LogDescription())
+			sender.recordStopHistory(models.AppHistoryEventStopSent, "stop message may have been sent by a sender that stopped before saving it, not sending it again", stopMessage)
+			sender.saveSentStopMessage(stopMessage)
+			delete(stopMessages, intent.MessageKey)
 		}
+	}
+}
+
+//A sent message that is awaiting an ack is kept in the queue (even with no keep alive) until it is acknowledged,
+//superseded by the instance coming up (or going away) without an ack, or times out
+func (sender *Sender) resolveStartMessageAck(startMessage models.PendingStartMessage) {
+	ackState := sender.startMessageAckState(startMessage)
+	if ackState == models.PendingMessageAckStateAwaiting {
+		return
+	}
+
+	startMessage.AckState = ackState
+	sender.logger.Info("Resolved start message ack", startMessage.LogDescription())
+	sender.resolvedStartMessages = append(sender.resolvedStartMessages, startMessage)
+	sender.recordStartHistory(models.AppHistoryEventStartAckResolved, startAckDescriptions[ackState], startMessage)
+
+	if startMessage.IsExpired(sender.timeProvider.Time()) {
+		sender.expiredStartMessages = append(sender.expiredStartMessages, startMessage)
+		sender.queueStartMessageForDeletion(startMessage, "expired start message")
 	} else {
-		sender.queueStopMessageForDeletion(stopMessage, "stop message that will not be sent")
+		sender.startMessagesToSave = append(sender.startMessagesToSave, startMessage)
+	}
+}
+
+func (sender *Sender) resolveStopMessageAck(stopMessage models.PendingStopMessage) {
+	ackState := sender.stopMessageAckState(stopMessage)
+	if ackState == models.PendingMessageAckStateAwaiting {
+		return
+	}
+
+	stopMessage.AckState = ackState
+	sender.logger.Info("Resolved stop message ack", stopMessage.LogDescription())
+	sender.resolvedStopMessages = append(sender.resolvedStopMessages, stopMessage)
+	sender.recordStopHistory(models.AppHistoryEventStopAckResolved, stopAckDescriptions[ackState], stopMessage)
+
+	if stopMessage.IsExpired(sender.timeProvider.Time()) {
+		sender.expiredStopMessages = append(sender.expiredStopMessages, stopMessage)
+		sender.queueStopMessageForDeletion(stopMessage, "expired stop message")
+	} else {
+		sender.stopMessagesToSave = append(sender.stopMessagesToSave, stopMessage)
+	}
+}
+
+var startAckDescriptions = map[models.PendingMessageAckState]string{
+	models.PendingMessageAckStateAcknowledged: "start message acknowledged",
+	models.PendingMessageAckStateSuperseded:   "instance is running (or no longer desired) but the start message was never acknowledged",
+	models.PendingMessageAckStateTimedOut:     "start message was not acknowledged in time",
+}
+
+var stopAckDescriptions = map[models.PendingMessageAckState]string{
+	models.PendingMessageAckStateAcknowledged: "stop message acknowledged",
+	models.PendingMessageAckStateSuperseded:   "instance is gone but the stop message was never acknowledged",
+	models.PendingMessageAckStateTimedOut:     "stop message was not acknowledged in time",
+}
+
+func (sender *Sender) startMessageAckState(startMessage models.PendingStartMessage) models.PendingMessageAckState {
+	ack, acknowledged := sender.acks[startMessage.MessageId]
+	if acknowledged {
+		sender.acksToDelete = append(sender.acksToDelete, ack)
+		return models.PendingMessageAckStateAcknowledged
+	}
+
+	app, found := sender.apps[sender.store.AppKey(startMessage.AppGuid, startMessage.AppVersion)]
+	if !found || !app.IsDesired() || !app.IsIndexDesired(startMessage.IndexToStart) || app.HasRunningInstanceAtIndex(startMessage.IndexToStart) {
+		return models.PendingMessageAckStateSuperseded
+	}
+
+	if startMessage.HasAckTimedOut(sender.timeProvider.Time(), sender.conf.SenderAckTimeout()) {
+		return models.PendingMessageAckStateTimedOut
 	}
+
+	return models.PendingMessageAckStateAwaiting
+}
+
+func (sender *Sender) stopMessageAckState(stopMessage models.PendingStopMessage) models.PendingMessageAckState {
+	ack, acknowledged := sender.acks[stopMessage.MessageId]
+	if acknowledged {
+		sender.acksToDelete = append(sender.acksToDelete, ack)
+		return models.PendingMessageAckStateAcknowledged
+	}
+
+	app, found := sender.apps[sender.store.AppKey(stopMessage.AppGuid, stopMessage.AppVersion)]
+	if !found || app.InstanceWithGuid(stopMessage.InstanceGuid).InstanceGuid == "" {
+		return models.PendingMessageAckStateSuperseded
+	}
+
+	if stopMessage.HasAckTimedOut(sender.timeProvider.Time(), sender.conf.SenderAckTimeout()) {
+		return models.PendingMessageAckStateTimedOut
+	}
+
+	return models.PendingMessageAckStateAwaiting
+}
+
+//startSendAttempts returns the ineffective sends of messages with the start message's StoreKey so far.
+//A start that got the instance to heartbeat at all (even if it then crashed) had an effect, so the count starts afresh;
+//crash loops are dealt with by quarantining.
+func (sender *Sender) startSendAttempts(startMessage models.PendingStartMessage) models.SendAttempts {
+	attempts := models.NewStartSendAttempts(startMessage)
+	existingAttempts, found := sender.sendAttempts[attempts.StoreKey()]
+	if !found {
+		return attempts
+	}
+
+	app, found := sender.apps[sender.store.AppKey(startMessage.AppGuid, startMessage.AppVersion)]
+	if found && len(app.InstanceHeartbeatsAtIndex(startMessage.IndexToStart)) > 0 {
+		return attempts
+	}
+
+	return existingAttempts
+}
+
+//stopSendAttempts returns the sends of messages with the stop message's StoreKey so far.
+//A stop that is sent again has not had an effect: the instance is still there.
+func (sender *Sender) stopSendAttempts(stopMessage models.PendingStopMessage) models.SendAttempts {
+	attempts := models.NewStopSendAttempts(stopMessage)
+	existingAttempts, found := sender.sendAttempts[attempts.StoreKey()]
+	if !found {
+		return attempts
+	}
+	return existingAttempts
+}
+
+func (sender *Sender) shouldDeadLetter(attempts models.SendAttempts) bool {
+	return sender.conf.SenderDeadLetterThreshold > 0 && attempts.Count >= sender.conf.SenderDeadLetterThreshold
+}
+
+func (sender *Sender) recordSendAttempt(attempts models.SendAttempts) {
+	if sender.conf.SenderDeadLetterThreshold == 0 {
+		return
+	}
+	sender.sendAttemptsToSave = append(sender.sendAttemptsToSave, attempts.Attempted(sender.timeProvider.Time()))
+}
+
+//forgetSendAttempts starts the count afresh once a message is no longer needed
+func (sender *Sender) forgetSendAttempts(attempts models.SendAttempts) {
+	_, found := sender.sendAttempts[attempts.StoreKey()]
+	if found {
+		sender.sendAttemptsToDelete = append(sender.sendAttemptsToDelete, attempts)
+	}
+}
+
+//Dead-lettered messages are taken out of the queue and are not sent; the analyzer will not enqueue them again
+//until an operator requeues or purges the dead letter
+func (sender *Sender) deadLetterStartMessage(startMessage models.PendingStartMessage) {
+	attempts := sender.startSendAttempts(startMessage)
+	deadLetter := models.NewStartDeadLetter(sender.timeProvider.Time(), startMessage, attempts)
+
+	sender.logger.Info("Dead-lettering start message: sent too many times without effect", startMessage.LogDescription(), attempts.LogDescription())
+	sender.deadLetters = append(sender.deadLetters, deadLetter)
+	sender.sendAttemptsToDelete = append(sender.sendAttemptsToDelete, attempts)
+	sender.startMessagesToDelete = append(sender.startMessagesToDelete, startMessage)
+	sender.recordStartHistory(models.AppHistoryEventStartDeadLettered, fmt.Sprintf("start message sent %d times without effect", attempts.Count), startMessage)
+}
+
+func (sender *Sender) deadLetterStopMessage(stopMessage models.PendingStopMessage) {
+	attempts := sender.stopSendAttempts(stopMessage)
+	deadLetter := models.NewStopDeadLetter(sender.timeProvider.Time(), stopMessage, attempts)
+
+	sender.logger.Info("Dead-lettering stop message: sent too many times without effect", stopMessage.LogDescription(), attempts.LogDescription())
+	sender.deadLetters = append(sender.deadLetters, deadLetter)
+	sender.sendAttemptsToDelete = append(sender.sendAttemptsToDelete, attempts)
+	sender.stopMessagesToDelete = append(sender.stopMessagesToDelete, stopMessage)
+	sender.recordStopHistory(models.AppHistoryEventStopDeadLettered, fmt.Sprintf("stop message sent %d times without effect", attempts.Count), stopMessage)
 }
 
 func (sender *Sender) markStartMessageSent(startMessage models.PendingStartMessage) {
@@ -202,11 +698,21 @@ func (sender *Sender) markStopMessageSent(stopMessage models.PendingStopMessage)
 func (sender *Sender) queueStartMessageForDeletion(startMessage models.PendingStartMessage, reason string) {
 	sender.logger.Info(fmt.Sprintf("Deleting %s", reason), startMessage.LogDescription())
 	sender.startMessagesToDelete = append(sender.startMessagesToDelete, startMessage)
+	sender.recordStartHistory(models.AppHistoryEventStartDeleted, reason, startMessage)
 }
 
 func (sender *Sender) queueStopMessageForDeletion(stopMessage models.PendingStopMessage, reason string) {
 	sender.logger.Info(fmt.Sprintf("Deleting %s", reason), stopMessage.LogDescription())
 	sender.stopMessagesToDelete = append(sender.stopMessagesToDelete, stopMessage)
+	sender.recordStopHistory(models.AppHistoryEventStopDeleted, reason, stopMessage)
+}
+
+func (sender *Sender) recordStartHistory(eventType models.AppHistoryEventType, description string, startMessage models.PendingStartMessage) {
+	sender.history = append(sender.history, models.NewAppHistoryEvent(sender.timeProvider.Time(), "sender", eventType, description, startMessage.PendingMessage, startMessage.LogDescription()))
+}
+
+func (sender *Sender) recordStopHistory(eventType models.AppHistoryEventType, description string, stopMessage models.PendingStopMessage) {
+	sender.history = append(sender.history, models.NewAppHistoryEvent(sender.timeProvider.Time(), "sender", eventType, description, stopMessage.PendingMessage, stopMessage.LogDescription()))
 }
 
 func (sender *Sender) startMessageToSend(message models.PendingStartMessage) (models.StartMessage, bool) {
@@ -227,21 +733,30 @@ func (sender *Sender) startMessageToSend(message models.PendingStartMessage) (mo
 
 	if !found {
 		sender.logger.Info("Skipping sending start message: app is no longer desired", message.LogDescription())
+		sender.recordStartHistory(models.AppHistoryEventStartNotSent, "app is no longer desired", message)
 		return models.StartMessage{}, false
 	}
 
 	if !app.IsDesired() {
 		sender.logger.Info("Skipping sending start message: app is no longer desired", message.LogDescription(), app.LogDescription())
+		sender.recordStartHistory(models.AppHistoryEventStartNotSent, "app is no longer desired", message)
 		return models.StartMessage{}, false
 	}
 
 	if !app.IsIndexDesired(message.IndexToStart) {
 		sender.logger.Info("Skipping sending start message: instance index is beyond the desired # of instances", message.LogDescription(), app.LogDescription())
+		sender.recordStartHistory(models.AppHistoryEventStartNotSent, "instance index is beyond the desired # of instances", message)
 		return models.StartMessage{}, false
 	}
 
+	if message.StartReason == models.PendingStartMessageReasonStuckStarting && app.HasOnlyStuckStartingInstancesAtIndex(message.IndexToStart, sender.timeProvider.Time(), sender.conf.StartingTimeout()) {
+		sender.logger.Info("Sending start message: instance at desired index is stuck in STARTING", message.LogDescription(), app.LogDescription())
+		return messageToSend, true
+	}
+
 	if app.HasStartingOrRunningInstanceAtIndex(message.IndexToStart) {
 		sender.logger.Info("Skipping sending start message: instance is already running", message.LogDescription(), app.LogDescription())
+		sender.recordStartHistory(models.AppHistoryEventStartNotSent, "instance is already running", message)
 		return models.StartMessage{}, false
 	}
 
@@ -249,12 +764,22 @@ func (sender *Sender) startMessageToSend(message models.PendingStartMessage) (mo
 	return messageToSend, true
 }
 
+func (sender *Sender) desiredVersionOf(appGuid string) *models.App {
+	for _, app := range sender.apps {
+		if app.AppGuid == appGuid && app.IsDesired() {
+			return app
+		}
+	}
+	return nil
+}
+
 func (sender *Sender) stopMessageToSend(message models.PendingStopMessage) (models.StopMessage, bool) {
 	appKey := sender.store.AppKey(message.AppGuid, message.AppVersion)
 	app, found := sender.apps[appKey]
 
 	if !found {
 		sender.logger.Info("Skipping sending stop message: instance is no longer running", message.LogDescription())
+		sender.recordStopHistory(models.AppHistoryEventStopNotSent, "instance is no longer running", message)
 		return models.StopMessage{}, false
 	}
 
@@ -267,6 +792,15 @@ func (sender *Sender) stopMessageToSend(message models.PendingStopMessage) (mode
 		MessageId:     message.MessageId,
 	}
 
+	if message.StopReason == models.PendingStopMessageReasonOutdatedVersion && !app.IsDesired() {
+		desiredVersion := sender.desiredVersionOf(app.AppGuid)
+		if desiredVersion != nil && desiredVersion.IsIndexDesired(instanceToStop.InstanceIndex) && !desiredVersion.HasRunningInstanceAtIndex(instanceToStop.InstanceIndex) {
+			sender.logger.Info("Skipping sending stop message: the desired version is not running at the outdated instance's index", message.LogDescription(), app.LogDescription())
+			sender.recordStopHistory(models.AppHistoryEventStopNotSent, "the desired version is not running at the outdated instance's index", message)
+			return models.StopMessage{}, false
+		}
+	}
+
 	if !app.IsDesired() {
 		sender.logger.Info("Sending stop message: instance is running, app is no longer desired", message.LogDescription(), app.LogDescription())
 		messageToSend.IsDuplicate = false
@@ -285,6 +819,12 @@ func (sender *Sender) stopMessageToSend(message models.PendingStopMessage) (mode
 		return messageToSend, true
 	}
 
+	if message.StopReason == models.PendingStopMessageReasonStuckStarting && instanceToStop.IsStuckStarting(sender.timeProvider.Time(), sender.conf.StartingTimeout()) {
+		sender.logger.Info("Sending stop message: instance is stuck in STARTING", message.LogDescription(), app.LogDescription())
+		messageToSend.IsDuplicate = len(app.StartingOrRunningInstancesAtIndex(instanceToStop.InstanceIndex)) > 1
+		return messageToSend, true
+	}
+
 	if len(app.StartingOrRunningInstancesAtIndex(instanceToStop.InstanceIndex)) > 1 {
 		sender.logger.Info("Sending stop message: instance is a duplicate running at a desired index", message.LogDescription(), app.LogDescription())
 		messageToSend.IsDuplicate = true
@@ -292,5 +832,6 @@ func (sender *Sender) stopMessageToSend(message models.PendingStopMessage) (mode
 	}
 
 	sender.logger.Info("Skipping sending stop message: instance is running on a desired index (and there are no other instances running at that index)", message.LogDescription(), app.LogDescription())
+	sender.recordStopHistory(models.AppHistoryEventStopNotSent, "instance is running on a desired index (and there are no other instances running at that index)", message)
 	return models.StopMessage{}, false
 }
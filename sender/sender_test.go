@@ -44,7 +44,7 @@ var _ = Describe("Sender", func() {
 
 		storeAdapter = fakestoreadapter.New()
 		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
-		sender = New(store, metricsAccountant, conf, messageBus, timeProvider, fakelogger.NewFakeLogger())
+		sender = New(store, metricsAccountant, conf, NewNATSTransport(messageBus, conf), timeProvider, NewRateLimiter(conf), fakelogger.NewFakeLogger())
 		store.BumpActualFreshness(time.Unix(10, 0))
 		store.BumpDesiredFreshness(time.Unix(10, 0))
 	})
@@ -169,6 +169,30 @@ var _ = Describe("Sender", func() {
 				Ω(metricsAccountant.IncrementedStarts).Should(ContainElement(pendingMessage))
 			})
 
+			It("should record that the message was sent in the app's history", func() {
+				history, _ := store.GetAppHistory(app.AppGuid)
+				sentEvents := []models.AppHistoryEvent{}
+				for _, event := range history {
+					if event.EventType == models.AppHistoryEventStartSent {
+						sentEvents = append(sentEvents, event)
+					}
+				}
+				Ω(sentEvents).Should(HaveLen(1))
+				Ω(sentEvents[0].Component).Should(Equal("sender"))
+				Ω(sentEvents[0].MessageId).Should(Equal(pendingMessage.MessageId))
+				Ω(sentEvents[0].Timestamp).Should(Equal(int64(130)))
+			})
+
+			Context("when recording the app's history fails", func() {
+				BeforeEach(func() {
+					storeSetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("history", errors.New("oops"))
+				})
+
+				It("should return an error", func() {
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+
 			It("should not error", func() {
 				Ω(err).ShouldNot(HaveOccurred())
 			})
@@ -253,6 +277,13 @@ var _ = Describe("Sender", func() {
 					Ω(messages).Should(BeEmpty())
 					Ω(messageBus.PublishedMessages).ShouldNot(HaveKey("hm9000.start"))
 				})
+
+				It("should record the deletion in the app's history", func() {
+					history, _ := store.GetAppHistory(app.AppGuid)
+					Ω(history).Should(HaveLen(1))
+					Ω(history[0].EventType).Should(Equal(models.AppHistoryEventStartDeleted))
+					Ω(history[0].Description).Should(Equal("expired start message"))
+				})
 			})
 
 			Context("and the keep alive has not elapsed", func() {
@@ -451,10 +482,11 @@ var _ = Describe("Sender", func() {
 		var indexToStart int
 		var pendingMessage models.PendingStartMessage
 		var skipVerification bool
+		var startReason models.PendingStartMessageReason
 
 		JustBeforeEach(func() {
 			timeProvider.TimeToProvide = time.Unix(130, 0)
-			pendingMessage = models.NewPendingStartMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, indexToStart, 1.0, models.PendingStartMessageReasonInvalid)
+			pendingMessage = models.NewPendingStartMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, indexToStart, 1.0, startReason)
 			pendingMessage.SentOn = 0
 			pendingMessage.SkipVerification = skipVerification
 			store.SavePendingStartMessages(
@@ -468,6 +500,7 @@ var _ = Describe("Sender", func() {
 			err = nil
 			indexToStart = 0
 			skipVerification = false
+			startReason = models.PendingStartMessageReasonInvalid
 		})
 
 		assertMessageWasNotSent := func() {
@@ -483,6 +516,16 @@ var _ = Describe("Sender", func() {
 			It("should not increment the metrics", func() {
 				Ω(metricsAccountant.IncrementedStarts).Should(BeEmpty())
 			})
+
+			It("should record why the message was not sent in the app's history", func() {
+				history, _ := store.GetAppHistory(app.AppGuid)
+				eventTypes := []models.AppHistoryEventType{}
+				for _, event := range history {
+					Ω(event.MessageId).Should(Equal(pendingMessage.MessageId))
+					eventTypes = append(eventTypes, event.EventType)
+				}
+				Ω(eventTypes).Should(ConsistOf(models.AppHistoryEventStartNotSent, models.AppHistoryEventStartDeleted))
+			})
 		}
 
 		assertMessageWasSent := func() {
@@ -556,6 +599,37 @@ var _ = Describe("Sender", func() {
 
 					assertMessageWasNotSent()
 				})
+
+				Context("when the instance reporting at that index is stuck in STARTING", func() {
+					BeforeEach(func() {
+						conf.StartingTimeoutInHeartbeats = 6
+
+						heartbeat := app.InstanceAtIndex(0).Heartbeat()
+						heartbeat.State = models.InstanceStateStarting
+						heartbeat.StateTimestamp = 0
+						store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+					})
+
+					Context("and the message is replacing the stuck instance", func() {
+						BeforeEach(func() {
+							startReason = models.PendingStartMessageReasonStuckStarting
+						})
+
+						assertMessageWasSent()
+
+						Context("but stuck instance detection is disabled", func() {
+							BeforeEach(func() {
+								conf.StartingTimeoutInHeartbeats = 0
+							})
+
+							assertMessageWasNotSent()
+						})
+					})
+
+					Context("and the message is not replacing the stuck instance", func() {
+						assertMessageWasNotSent()
+					})
+				})
 			})
 
 			Context("when the index-to-start is beyond the # of desired instances", func() {
@@ -588,10 +662,11 @@ var _ = Describe("Sender", func() {
 		var err error
 		var indexToStop int
 		var pendingMessage models.PendingStopMessage
+		var stopReason models.PendingStopMessageReason
 
 		JustBeforeEach(func() {
 			timeProvider.TimeToProvide = time.Unix(130, 0)
-			pendingMessage = models.NewPendingStopMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, app.InstanceAtIndex(indexToStop).InstanceGuid, models.PendingStopMessageReasonInvalid)
+			pendingMessage = models.NewPendingStopMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, app.InstanceAtIndex(indexToStop).InstanceGuid, stopReason)
 			pendingMessage.SentOn = 0
 			store.SavePendingStopMessages(
 				pendingMessage,
@@ -602,6 +677,7 @@ var _ = Describe("Sender", func() {
 
 		BeforeEach(func() {
 			indexToStop = 0
+			stopReason = models.PendingStopMessageReasonInvalid
 		})
 
 		assertMessageWasNotSent := func() {
@@ -718,6 +794,36 @@ var _ = Describe("Sender", func() {
 				assertMessageWasSent(0, true)
 			})
 
+			Context("When the instance-to-stop was stopped for being stuck in STARTING", func() {
+				var heartbeat models.InstanceHeartbeat
+
+				BeforeEach(func() {
+					conf.StartingTimeoutInHeartbeats = 6
+					stopReason = models.PendingStopMessageReasonStuckStarting
+
+					heartbeat = app.InstanceAtIndex(0).Heartbeat()
+					heartbeat.State = models.InstanceStateStarting
+					heartbeat.StateTimestamp = 0
+				})
+
+				Context("and it is still stuck", func() {
+					BeforeEach(func() {
+						store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+					})
+
+					assertMessageWasSent(0, false)
+				})
+
+				Context("and it is no longer stuck", func() {
+					BeforeEach(func() {
+						heartbeat.State = models.InstanceStateRunning
+						store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+					})
+
+					assertMessageWasNotSent()
+				})
+			})
+
 			Context("When instance is not running", func() {
 				assertMessageWasNotSent()
 			})
@@ -734,6 +840,1001 @@ var _ = Describe("Sender", func() {
 			Context("when the instance is not running", func() {
 				assertMessageWasNotSent()
 			})
+
+			Context("when the instance was stopped for being an outdated version", func() {
+				var desiredVersion appfixture.AppFixture
+
+				BeforeEach(func() {
+					stopReason = models.PendingStopMessageReasonOutdatedVersion
+
+					desiredVersion = dea.GetApp(1)
+					desiredVersion.AppGuid = app.AppGuid
+					store.SyncDesiredState(desiredVersion.DesiredState(1))
+				})
+
+				Context("and the desired version is running at its index", func() {
+					BeforeEach(func() {
+						store.SyncHeartbeats(dea.HeartbeatWith(
+							app.InstanceAtIndex(0).Heartbeat(),
+							desiredVersion.InstanceAtIndex(0).Heartbeat(),
+						))
+					})
+
+					assertMessageWasSent(0, false)
+				})
+
+				Context("and the desired version is not running at its index", func() {
+					BeforeEach(func() {
+						store.SyncHeartbeats(dea.HeartbeatWith(
+							app.InstanceAtIndex(0).Heartbeat(),
+						))
+					})
+
+					assertMessageWasNotSent()
+				})
+			})
+		})
+	})
+
+	Context("when there are more start messages than the sender may send", func() {
+		var otherApp appfixture.AppFixture
+		var oldStartMessage, newStartMessage models.PendingStartMessage
+
+		BeforeEach(func() {
+			otherApp = dea.GetApp(1)
+			conf.SenderMessageLimit = 1
+
+			store.SyncDesiredState(app.DesiredState(1), otherApp.DesiredState(1))
+
+			oldStartMessage = models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 0.2, models.PendingStartMessageReasonMissing)
+			newStartMessage = models.NewPendingStartMessage(time.Unix(130, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+			store.SavePendingStartMessages(oldStartMessage, newStartMessage)
+
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+		})
+
+		It("should send the highest priority message", func() {
+			err := sender.Send()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+
+			startMessage, _ := models.NewStartMessageFromJSON(messageBus.PublishedMessages["hm9000.start"][0].Payload)
+			Ω(startMessage.MessageId).Should(Equal(newStartMessage.MessageId))
+		})
+
+		Context("when start priorities age", func() {
+			BeforeEach(func() {
+				conf.StartPriorityAgingPerHeartbeat = 1.0
+			})
+
+			It("should send the message that has been waiting the longest first", func() {
+				err := sender.Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+
+				startMessage, _ := models.NewStartMessageFromJSON(messageBus.PublishedMessages["hm9000.start"][0].Payload)
+				Ω(startMessage.MessageId).Should(Equal(oldStartMessage.MessageId))
+			})
+		})
+	})
+
+	Context("when there are more stop messages than the sender may send", func() {
+		var stopMessages []models.PendingStopMessage
+
+		BeforeEach(func() {
+			conf.SenderStopMessageLimit = 2
+
+			store.SyncHeartbeats(app.Heartbeat(3))
+			stopMessages = []models.PendingStopMessage{}
+			for i := 0; i < 3; i++ {
+				stopMessage := models.NewPendingStopMessage(time.Unix(100, 0), 10, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(i).InstanceGuid, models.PendingStopMessageReasonExtra)
+				stopMessages = append(stopMessages, stopMessage)
+			}
+			store.SavePendingStopMessages(stopMessages...)
+			timeProvider.TimeToProvide = time.Unix(110, 0)
+		})
+
+		It("should only send up to the limit and keep the rest around", func() {
+			err := sender.Send()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(2))
+
+			remainingStopMessages, _ := store.GetPendingStopMessages()
+			Ω(remainingStopMessages).Should(HaveLen(1))
+
+			history, _ := store.GetAppHistory(app.AppGuid)
+			notSent := []models.AppHistoryEvent{}
+			for _, event := range history {
+				if event.EventType == models.AppHistoryEventStopNotSent {
+					notSent = append(notSent, event)
+				}
+			}
+			Ω(notSent).Should(HaveLen(1))
+			Ω(notSent[0].Description).Should(Equal("sender stop message limit reached, will retry"))
+		})
+
+		Context("when the stop message limit is 0", func() {
+			BeforeEach(func() {
+				conf.SenderStopMessageLimit = 0
+			})
+
+			It("should send every stop message", func() {
+				err := sender.Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(3))
+			})
+		})
+	})
+
+	Describe("ack tracking", func() {
+		var sendAt func(timestamp int64) error
+
+		BeforeEach(func() {
+			conf.SenderNatsAckSubject = "hm9000.ack"
+			conf.SenderAckTimeoutInHeartbeats = 3
+
+			sendAt = func(timestamp int64) error {
+				timeProvider.TimeToProvide = time.Unix(timestamp, 0)
+				return New(store, metricsAccountant, conf, NewNATSTransport(messageBus, conf), timeProvider, NewRateLimiter(conf), fakelogger.NewFakeLogger()).Send()
+			}
+		})
+
+		ackHistory := func(appGuid string) []string {
+			history, _ := store.GetAppHistory(appGuid)
+			descriptions := []string{}
+			for _, event := range history {
+				if event.EventType == models.AppHistoryEventStartAckResolved || event.EventType == models.AppHistoryEventStopAckResolved {
+					descriptions = append(descriptions, string(event.EventType)+": "+event.Description)
+				}
+			}
+			return descriptions
+		}
+
+		Context("when a start message is sent", func() {
+			var startMessage models.PendingStartMessage
+			var keepAlive int
+
+			BeforeEach(func() {
+				keepAlive = 0
+			})
+
+			JustBeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1))
+				startMessage = models.NewPendingStartMessage(time.Unix(100, 0), 0, keepAlive, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+				store.SavePendingStartMessages(startMessage)
+
+				err := sendAt(130)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+			})
+
+			It("should keep the message around, awaiting an ack, even with no keep alive", func() {
+				messages, _ := store.GetPendingStartMessages()
+				Ω(messages).Should(HaveLen(1))
+				Ω(messages[startMessage.StoreKey()].SentOn).Should(BeNumerically("==", 130))
+				Ω(messages[startMessage.StoreKey()].AckState).Should(Equal(models.PendingMessageAckStateAwaiting))
+			})
+
+			Context("and it is acknowledged", func() {
+				JustBeforeEach(func() {
+					store.SaveMessageAcks(models.MessageAck{MessageId: startMessage.MessageId, ReceivedAt: 131})
+					err := sendAt(140)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should record the outcome in the metrics and the app's history", func() {
+					Ω(metricsAccountant.ResolvedStarts).Should(HaveLen(1))
+					Ω(metricsAccountant.ResolvedStarts[0].MessageId).Should(Equal(startMessage.MessageId))
+					Ω(metricsAccountant.ResolvedStarts[0].AckState).Should(Equal(models.PendingMessageAckStateAcknowledged))
+					Ω(ackHistory(app.AppGuid)).Should(Equal([]string{"START_ACK_RESOLVED: start message acknowledged"}))
+				})
+
+				It("should delete the message, since it has no keep alive, and the ack", func() {
+					messages, _ := store.GetPendingStartMessages()
+					Ω(messages).Should(BeEmpty())
+					acks, _ := store.GetMessageAcks()
+					Ω(acks).Should(BeEmpty())
+				})
+
+				It("should not send the message again", func() {
+					Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+				})
+
+				Context("when the message has a keep alive", func() {
+					BeforeEach(func() {
+						keepAlive = 30
+					})
+
+					It("should keep the message, marked as acknowledged, until it expires", func() {
+						messages, _ := store.GetPendingStartMessages()
+						Ω(messages).Should(HaveLen(1))
+						Ω(messages[startMessage.StoreKey()].AckState).Should(Equal(models.PendingMessageAckStateAcknowledged))
+
+						err := sendAt(160)
+						Ω(err).ShouldNot(HaveOccurred())
+						messages, _ = store.GetPendingStartMessages()
+						Ω(messages).Should(BeEmpty())
+						Ω(ackHistory(app.AppGuid)).Should(HaveLen(1))
+					})
+				})
+			})
+
+			Context("and no ack has arrived yet", func() {
+				JustBeforeEach(func() {
+					err := sendAt(159)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should keep waiting", func() {
+					messages, _ := store.GetPendingStartMessages()
+					Ω(messages[startMessage.StoreKey()].AckState).Should(Equal(models.PendingMessageAckStateAwaiting))
+					Ω(metricsAccountant.ResolvedStarts).Should(BeEmpty())
+					Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+				})
+			})
+
+			Context("and no ack arrives within the ack timeout", func() {
+				JustBeforeEach(func() {
+					err := sendAt(160)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should record that the message timed out and delete it", func() {
+					Ω(metricsAccountant.ResolvedStarts).Should(HaveLen(1))
+					Ω(metricsAccountant.ResolvedStarts[0].AckState).Should(Equal(models.PendingMessageAckStateTimedOut))
+					Ω(ackHistory(app.AppGuid)).Should(Equal([]string{"START_ACK_RESOLVED: start message was not acknowledged in time"}))
+
+					messages, _ := store.GetPendingStartMessages()
+					Ω(messages).Should(BeEmpty())
+				})
+			})
+
+			Context("and the instance comes up without an ack", func() {
+				JustBeforeEach(func() {
+					store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+					err := sendAt(140)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should record that the message was superseded", func() {
+					Ω(metricsAccountant.ResolvedStarts).Should(HaveLen(1))
+					Ω(metricsAccountant.ResolvedStarts[0].AckState).Should(Equal(models.PendingMessageAckStateSuperseded))
+					Ω(ackHistory(app.AppGuid)).Should(Equal([]string{"START_ACK_RESOLVED: instance is running (or no longer desired) but the start message was never acknowledged"}))
+				})
+			})
+		})
+
+		Context("when a stop message is sent", func() {
+			var stopMessage models.PendingStopMessage
+
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+				stopMessage = models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra)
+				store.SavePendingStopMessages(stopMessage)
+
+				err := sendAt(130)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(1))
+			})
+
+			It("should keep the message around, awaiting an ack", func() {
+				messages, _ := store.GetPendingStopMessages()
+				Ω(messages).Should(HaveLen(1))
+				Ω(messages[stopMessage.StoreKey()].AckState).Should(Equal(models.PendingMessageAckStateAwaiting))
+			})
+
+			Context("and it is acknowledged", func() {
+				BeforeEach(func() {
+					store.SaveMessageAcks(models.MessageAck{MessageId: stopMessage.MessageId})
+					err := sendAt(140)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should record the outcome and delete the message", func() {
+					Ω(metricsAccountant.ResolvedStops).Should(HaveLen(1))
+					Ω(metricsAccountant.ResolvedStops[0].AckState).Should(Equal(models.PendingMessageAckStateAcknowledged))
+					Ω(ackHistory(app.AppGuid)).Should(Equal([]string{"STOP_ACK_RESOLVED: stop message acknowledged"}))
+
+					messages, _ := store.GetPendingStopMessages()
+					Ω(messages).Should(BeEmpty())
+				})
+			})
+
+			Context("and the instance goes away without an ack", func() {
+				BeforeEach(func() {
+					store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(1).Heartbeat()))
+					err := sendAt(140)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should record that the message was superseded", func() {
+					Ω(metricsAccountant.ResolvedStops).Should(HaveLen(1))
+					Ω(metricsAccountant.ResolvedStops[0].AckState).Should(Equal(models.PendingMessageAckStateSuperseded))
+				})
+			})
+
+			Context("and no ack arrives within the ack timeout", func() {
+				BeforeEach(func() {
+					err := sendAt(160)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should record that the message timed out", func() {
+					Ω(metricsAccountant.ResolvedStops).Should(HaveLen(1))
+					Ω(metricsAccountant.ResolvedStops[0].AckState).Should(Equal(models.PendingMessageAckStateTimedOut))
+				})
+			})
+		})
+
+		Context("when fetching the acks fails", func() {
+			BeforeEach(func() {
+				storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("acks", errors.New("oops"))
+			})
+
+			It("should return an error and not send any messages", func() {
+				err := sendAt(130)
+				Ω(err).Should(Equal(errors.New("oops")))
+				Ω(messageBus.PublishedMessages).Should(BeEmpty())
+			})
+		})
+
+		Context("when recording the ack metrics fails", func() {
+			BeforeEach(func() {
+				metricsAccountant.IncrementAckOutcomeMetricsError = errors.New("oops")
+			})
+
+			It("should return an error", func() {
+				err := sendAt(130)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("dead-lettering", func() {
+		var sendAt func(timestamp int64) error
+
+		BeforeEach(func() {
+			conf.SenderDeadLetterThreshold = 2
+
+			sendAt = func(timestamp int64) error {
+				timeProvider.TimeToProvide = time.Unix(timestamp, 0)
+				return New(store, metricsAccountant, conf, NewNATSTransport(messageBus, conf), timeProvider, NewRateLimiter(conf), fakelogger.NewFakeLogger()).Send()
+			}
+		})
+
+		deadLetterHistory := func(appGuid string) []string {
+			history, _ := store.GetAppHistory(appGuid)
+			descriptions := []string{}
+			for _, event := range history {
+				if event.EventType == models.AppHistoryEventStartDeadLettered || event.EventType == models.AppHistoryEventStopDeadLettered {
+					descriptions = append(descriptions, string(event.EventType)+": "+event.Description)
+				}
+			}
+			return descriptions
+		}
+
+		Context("when a start message keeps being sent without the instance ever heartbeating", func() {
+			var startMessage models.PendingStartMessage
+
+			enqueueAndSendAt := func(timestamp int64) {
+				startMessage = models.NewPendingStartMessage(time.Unix(timestamp-30, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+				store.SavePendingStartMessages(startMessage)
+				err := sendAt(timestamp)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1))
+				enqueueAndSendAt(130)
+				enqueueAndSendAt(140)
+			})
+
+			It("should count the attempts", func() {
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(2))
+
+				attempts, _ := store.GetSendAttempts()
+				Ω(attempts).Should(HaveLen(1))
+				Ω(attempts["start-"+startMessage.StoreKey()].Count).Should(Equal(2))
+				Ω(attempts["start-"+startMessage.StoreKey()].FirstAttemptAt).Should(BeNumerically("==", 130))
+				Ω(attempts["start-"+startMessage.StoreKey()].LastAttemptAt).Should(BeNumerically("==", 140))
+			})
+
+			Context("once the threshold is reached", func() {
+				BeforeEach(func() {
+					enqueueAndSendAt(150)
+				})
+
+				It("should not send the message and should delete it", func() {
+					Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(2))
+					messages, _ := store.GetPendingStartMessages()
+					Ω(messages).Should(BeEmpty())
+				})
+
+				It("should move the message, with its attempts, to the dead letters", func() {
+					deadLetters, _ := store.GetDeadLetters()
+					Ω(deadLetters).Should(HaveLen(1))
+					deadLetter := deadLetters["start-"+startMessage.StoreKey()]
+					Ω(deadLetter.StartMessage.MessageId).Should(Equal(startMessage.MessageId))
+					Ω(deadLetter.Attempts).Should(Equal(2))
+					Ω(deadLetter.FirstAttemptAt).Should(BeNumerically("==", 130))
+					Ω(deadLetter.LastAttemptAt).Should(BeNumerically("==", 140))
+					Ω(deadLetter.DeadLetteredAt).Should(BeNumerically("==", 150))
+
+					attempts, _ := store.GetSendAttempts()
+					Ω(attempts).Should(BeEmpty())
+				})
+
+				It("should record the dead letter in the metrics and the app's history", func() {
+					Ω(metricsAccountant.DeadLetters).Should(HaveLen(1))
+					Ω(metricsAccountant.DeadLetters[0].MessageType).Should(Equal("start"))
+					Ω(deadLetterHistory(app.AppGuid)).Should(Equal([]string{"START_DEAD_LETTERED: start message sent 2 times without effect"}))
+				})
+			})
+
+			Context("when the instance heartbeats in between, even if it then crashes", func() {
+				BeforeEach(func() {
+					store.SyncHeartbeats(dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0)))
+					enqueueAndSendAt(150)
+				})
+
+				It("should start counting afresh", func() {
+					Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(3))
+
+					attempts, _ := store.GetSendAttempts()
+					Ω(attempts["start-"+startMessage.StoreKey()].Count).Should(Equal(1))
+					Ω(attempts["start-"+startMessage.StoreKey()].FirstAttemptAt).Should(BeNumerically("==", 150))
+
+					deadLetters, _ := store.GetDeadLetters()
+					Ω(deadLetters).Should(BeEmpty())
+				})
+			})
+
+			Context("when the message will no longer be sent", func() {
+				BeforeEach(func() {
+					store.SyncDesiredState()
+					enqueueAndSendAt(150)
+				})
+
+				It("should forget the attempts", func() {
+					attempts, _ := store.GetSendAttempts()
+					Ω(attempts).Should(BeEmpty())
+
+					deadLetters, _ := store.GetDeadLetters()
+					Ω(deadLetters).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("when a stop message keeps being sent without the instance going away", func() {
+			var stopMessage models.PendingStopMessage
+
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+				for _, timestamp := range []int64{130, 140, 150} {
+					stopMessage = models.NewPendingStopMessage(time.Unix(timestamp-30, 0), 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra)
+					store.SavePendingStopMessages(stopMessage)
+					err := sendAt(timestamp)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+			})
+
+			It("should dead-letter it once the threshold is reached", func() {
+				Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(2))
+
+				messages, _ := store.GetPendingStopMessages()
+				Ω(messages).Should(BeEmpty())
+
+				deadLetters, _ := store.GetDeadLetters()
+				Ω(deadLetters).Should(HaveLen(1))
+				Ω(deadLetters["stop-"+stopMessage.StoreKey()].StopMessage.InstanceGuid).Should(Equal(app.InstanceAtIndex(0).InstanceGuid))
+
+				Ω(metricsAccountant.DeadLetters).Should(HaveLen(1))
+				Ω(deadLetterHistory(app.AppGuid)).Should(Equal([]string{"STOP_DEAD_LETTERED: stop message sent 2 times without effect"}))
+			})
+		})
+
+		Context("when dead-lettering is disabled", func() {
+			BeforeEach(func() {
+				conf.SenderDeadLetterThreshold = 0
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing))
+				err := sendAt(130)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should not count the attempts", func() {
+				attempts, _ := store.GetSendAttempts()
+				Ω(attempts).Should(BeEmpty())
+			})
+		})
+
+		Context("when fetching the send attempts fails", func() {
+			BeforeEach(func() {
+				storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("send-attempts", errors.New("oops"))
+			})
+
+			It("should return an error and not send any messages", func() {
+				err := sendAt(130)
+				Ω(err).Should(Equal(errors.New("oops")))
+				Ω(messageBus.PublishedMessages).Should(BeEmpty())
+			})
+		})
+
+		Context("when saving the send attempts fails", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing))
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("send-attempts", errors.New("oops"))
+			})
+
+			It("should return an error", func() {
+				err := sendAt(130)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("message lifecycle metrics", func() {
+		var sentStart, unsentStart, expiredStart models.PendingStartMessage
+		var unsentStop models.PendingStopMessage
+
+		BeforeEach(func() {
+			otherApp := dea.GetApp(1)
+			store.SyncDesiredState(app.DesiredState(1))
+
+			sentStart = models.NewPendingStartMessage(time.Unix(100, 0), 10, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+			unsentStart = models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+			expiredStart = models.NewPendingStartMessage(time.Unix(100, 0), 0, 10, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonCrashed)
+			expiredStart.SentOn = 110
+			unsentStop = models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, "instance-guid", models.PendingStopMessageReasonExtra)
+
+			store.SavePendingStartMessages(sentStart, unsentStart, expiredStart)
+			store.SavePendingStopMessages(unsentStop)
+
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+			err := sender.Send()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should track the send latency of the sent messages", func() {
+			Ω(metricsAccountant.LatencySentAt).Should(Equal(time.Unix(130, 0)))
+			Ω(metricsAccountant.LatencyStarts).Should(HaveLen(1))
+			Ω(metricsAccountant.LatencyStarts[0].MessageId).Should(Equal(sentStart.MessageId))
+			Ω(metricsAccountant.LatencyStarts[0].SendLatency(metricsAccountant.LatencySentAt)).Should(Equal(30 * time.Second))
+			Ω(metricsAccountant.LatencyStops).Should(BeEmpty())
+		})
+
+		It("should count the messages deleted without being sent, and the expired ones", func() {
+			Ω(metricsAccountant.NotSentStarts).Should(HaveLen(1))
+			Ω(metricsAccountant.NotSentStarts[0].MessageId).Should(Equal(unsentStart.MessageId))
+			Ω(metricsAccountant.ExpiredStarts).Should(HaveLen(1))
+			Ω(metricsAccountant.ExpiredStarts[0].MessageId).Should(Equal(expiredStart.MessageId))
+			Ω(metricsAccountant.NotSentStops).Should(HaveLen(1))
+			Ω(metricsAccountant.ExpiredStops).Should(BeEmpty())
+		})
+	})
+
+	Describe("publish failures", func() {
+		var flakyBus *flakyMessageBus
+
+		BeforeEach(func() {
+			conf.SenderPublishRetries = 1
+			conf.SenderPublishFailuresBeforeGivingUp = 2
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+
+			store.SyncDesiredState(app.DesiredState(4))
+			for index := 0; index < 4; index++ {
+				store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, index, 1.0, models.PendingStartMessageReasonMissing))
+			}
+		})
+
+		send := func() error {
+			return New(store, metricsAccountant, conf, NewNATSTransport(flakyBus, conf), timeProvider, NewRateLimiter(conf), fakelogger.NewFakeLogger()).Send()
+		}
+
+		Context("when a publish fails and then succeeds on retry", func() {
+			BeforeEach(func() {
+				flakyBus = newFlakyMessageBus(errors.New("connection reset by peer"))
+			})
+
+			It("should send every message and count the failure", func() {
+				err := send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(flakyBus.PublishedMessages["hm9000.start"]).Should(HaveLen(4))
+				Ω(metricsAccountant.StartPublishFailures).Should(Equal(1))
+				Ω(metricsAccountant.MessageBusDownReported).Should(BeFalse())
+			})
+		})
+
+		Context("when the message bus is down", func() {
+			var err error
+
+			BeforeEach(func() {
+				down := errors.New("connection refused")
+				flakyBus = newFlakyMessageBus(down, down, down, down, down, down, down, down)
+				err = send()
+			})
+
+			It("should return an error", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("should stop publishing once enough messages in a row have failed", func() {
+				Ω(flakyBus.attempts).Should(HaveLen(4))
+				Ω(flakyBus.PublishedMessages).Should(BeEmpty())
+			})
+
+			It("should keep every message for the next pass", func() {
+				messages, _ := store.GetPendingStartMessages()
+				Ω(messages).Should(HaveLen(4))
+			})
+
+			It("should record why the remaining messages were not sent", func() {
+				history, _ := store.GetAppHistory(app.AppGuid)
+				notSent := 0
+				for _, event := range history {
+					if event.EventType == models.AppHistoryEventStartNotSent && event.Description == "message bus looks down, will retry" {
+						notSent++
+					}
+				}
+				Ω(notSent).Should(Equal(2))
+			})
+
+			It("should record the failures in the metrics", func() {
+				Ω(metricsAccountant.StartPublishFailures).Should(Equal(4))
+				Ω(metricsAccountant.StopPublishFailures).Should(BeZero())
+				Ω(metricsAccountant.MessageBusDownReported).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("idempotent sending", func() {
+		var otherApp appfixture.AppFixture
+		var startMessage models.PendingStartMessage
+		var stopMessage models.PendingStopMessage
+
+		newLeader := func(bus *fakeyagnats.FakeYagnats) *Sender {
+			return New(store, metricsAccountant, conf, NewNATSTransport(bus, conf), timeProvider, NewRateLimiter(conf), fakelogger.NewFakeLogger())
+		}
+
+		historyDescriptions := func(appGuid string) []string {
+			history, _ := store.GetAppHistory(appGuid)
+			descriptions := []string{}
+			for _, event := range history {
+				descriptions = append(descriptions, event.Description)
+			}
+			return descriptions
+		}
+
+		BeforeEach(func() {
+			otherApp = dea.GetApp(1)
+			store.SyncDesiredState(app.DesiredState(1))
+			store.SyncHeartbeats(otherApp.Heartbeat(1))
+
+			startMessage = models.NewPendingStartMessage(time.Unix(100, 0), 0, 30, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+			stopMessage = models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, otherApp.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra)
+			store.SavePendingStartMessages(startMessage)
+			store.SavePendingStopMessages(stopMessage)
+
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+		})
+
+		It("should forget the intents once the messages are saved as sent", func() {
+			err := sender.Send()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+			Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(1))
+
+			intents, _ := store.GetSendingIntents()
+			Ω(intents).Should(BeEmpty())
+		})
+
+		Context("when the sender dies between publishing the messages and saving them as sent", func() {
+			var newBus *fakeyagnats.FakeYagnats
+
+			BeforeEach(func() {
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("start", errors.New("oops"))
+				storeAdapter.DeleteErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("stop", errors.New("oops"))
+				err := sender.Send()
+				Ω(err).Should(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+				Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(1))
+
+				storeAdapter.SetErrInjector = nil
+				storeAdapter.DeleteErrInjector = nil
+			})
+
+			It("should leave the intents behind", func() {
+				intents, _ := store.GetSendingIntents()
+				Ω(intents).Should(HaveLen(2))
+				Ω(intents).Should(HaveKey(startMessage.MessageId))
+				Ω(intents).Should(HaveKey(stopMessage.MessageId))
+			})
+
+			Context("and a new sender takes over", func() {
+				var err error
+
+				BeforeEach(func() {
+					newBus = fakeyagnats.New()
+					timeProvider.TimeToProvide = time.Unix(135, 0)
+					err = newLeader(newBus).Send()
+				})
+
+				It("should not error", func() {
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("should not publish the messages again", func() {
+					Ω(newBus.PublishedMessages).Should(BeEmpty())
+				})
+
+				It("should save the messages as sent instead", func() {
+					startMessages, _ := store.GetPendingStartMessages()
+					Ω(startMessages).Should(HaveLen(1))
+					Ω(startMessages[startMessage.StoreKey()].SentOn).Should(BeNumerically("==", 135))
+
+					stopMessages, _ := store.GetPendingStopMessages()
+					Ω(stopMessages).Should(BeEmpty())
+				})
+
+				It("should forget the intents", func() {
+					intents, _ := store.GetSendingIntents()
+					Ω(intents).Should(BeEmpty())
+				})
+
+				It("should not count the messages as sent again", func() {
+					Ω(metricsAccountant.IncrementedStarts).Should(BeEmpty())
+					Ω(metricsAccountant.IncrementedStops).Should(BeEmpty())
+				})
+
+				It("should record why the messages were not sent again in the apps' history", func() {
+					Ω(historyDescriptions(app.AppGuid)).Should(ContainElement("start message may have been sent by a sender that stopped before saving it, not sending it again"))
+					Ω(historyDescriptions(otherApp.AppGuid)).Should(ContainElement("stop message may have been sent by a sender that stopped before saving it, not sending it again"))
+				})
+			})
+		})
+
+		Context("when the publish fails", func() {
+			BeforeEach(func() {
+				messageBus.PublishError = errors.New("oops")
+				err := sender.Send()
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("should forget the intents, so that the next pass sends the messages", func() {
+				intents, _ := store.GetSendingIntents()
+				Ω(intents).Should(BeEmpty())
+
+				newBus := fakeyagnats.New()
+				err := newLeader(newBus).Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(newBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+				Ω(newBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the intent cannot be recorded", func() {
+			var err error
+
+			BeforeEach(func() {
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("sending-intents", errors.New("oops"))
+				err = sender.Send()
+			})
+
+			It("should return an error and not publish the messages", func() {
+				Ω(err).Should(HaveOccurred())
+				Ω(messageBus.PublishedMessages).Should(BeEmpty())
+			})
+
+			It("should leave the messages in the queue", func() {
+				startMessages, _ := store.GetPendingStartMessages()
+				Ω(startMessages[startMessage.StoreKey()].HasBeenSent()).Should(BeFalse())
+				stopMessages, _ := store.GetPendingStopMessages()
+				Ω(stopMessages).Should(HaveLen(1))
+			})
+		})
+
+		Context("when an intent is left behind for a message that is gone", func() {
+			BeforeEach(func() {
+				gone := models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 3, 1.0, models.PendingStartMessageReasonMissing)
+				store.SaveSendingIntents(models.NewStartSendingIntent(time.Unix(120, 0), gone))
+			})
+
+			It("should forget it and send the queued messages as usual", func() {
+				err := sender.Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(1))
+
+				intents, _ := store.GetSendingIntents()
+				Ω(intents).Should(BeEmpty())
+			})
+		})
+
+		Context("when fetching the intents fails", func() {
+			BeforeEach(func() {
+				storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("sending-intents", errors.New("oops"))
+			})
+
+			It("should return an error and not send any messages", func() {
+				err := sender.Send()
+				Ω(err).Should(Equal(errors.New("oops")))
+				Ω(messageBus.PublishedMessages).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("rate limiting", func() {
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			otherApp = dea.GetApp(1)
+			conf.SenderPerAppRateLimit = 1
+			conf.SenderRateLimitPeriodInHeartbeats = 6
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+		})
+
+		Context("when an app has more start messages than its rate limit allows", func() {
+			var startMessages []models.PendingStartMessage
+
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(2), otherApp.DesiredState(1))
+				startMessages = []models.PendingStartMessage{
+					models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing),
+					models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonMissing),
+					models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, 0, 0.1, models.PendingStartMessageReasonMissing),
+				}
+				store.SavePendingStartMessages(startMessages...)
+			})
+
+			It("should not let the app starve the other apps", func() {
+				err := sender.Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(2))
+
+				sentAppGuids := []string{}
+				for _, message := range messageBus.PublishedMessages["hm9000.start"] {
+					startMessage, _ := models.NewStartMessageFromJSON(message.Payload)
+					sentAppGuids = append(sentAppGuids, startMessage.AppGuid)
+				}
+				Ω(sentAppGuids).Should(ConsistOf(app.AppGuid, otherApp.AppGuid))
+			})
+
+			It("should leave the rate limited message in the queue and record why", func() {
+				sender.Send()
+
+				remainingStartMessages, _ := store.GetPendingStartMessages()
+				Ω(remainingStartMessages).Should(HaveLen(1))
+
+				history, _ := store.GetAppHistory(app.AppGuid)
+				Ω(history).Should(ContainElement(WithTransform(func(event models.AppHistoryEvent) string {
+					return string(event.EventType) + ": " + event.Description
+				}, Equal("START_NOT_SENT: app rate limit reached, will retry"))))
+			})
+
+			It("should send the rate limited message once the app's bucket has refilled", func() {
+				rateLimiter := NewRateLimiter(conf)
+				New(store, metricsAccountant, conf, NewNATSTransport(messageBus, conf), timeProvider, rateLimiter, fakelogger.NewFakeLogger()).Send()
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(2))
+
+				timeProvider.TimeToProvide = time.Unix(140, 0)
+				New(store, metricsAccountant, conf, NewNATSTransport(messageBus, conf), timeProvider, rateLimiter, fakelogger.NewFakeLogger()).Send()
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(2))
+
+				timeProvider.TimeToProvide = time.Unix(190, 0)
+				New(store, metricsAccountant, conf, NewNATSTransport(messageBus, conf), timeProvider, rateLimiter, fakelogger.NewFakeLogger()).Send()
+				Ω(messageBus.PublishedMessages["hm9000.start"]).Should(HaveLen(3))
+
+				remainingStartMessages, _ := store.GetPendingStartMessages()
+				Ω(remainingStartMessages).Should(BeEmpty())
+			})
+
+			It("should give the app its token back when a message fails to publish", func() {
+				conf.SenderPublishRetries = 0
+				flakyBus := newFlakyMessageBus(errors.New("connection reset by peer"))
+				New(store, metricsAccountant, conf, NewNATSTransport(flakyBus, conf), timeProvider, NewRateLimiter(conf), fakelogger.NewFakeLogger()).Send()
+
+				Ω(flakyBus.attempts).Should(HaveLen(3))
+				sentAppGuids := []string{}
+				for _, message := range flakyBus.PublishedMessages["hm9000.start"] {
+					startMessage, _ := models.NewStartMessageFromJSON(message.Payload)
+					sentAppGuids = append(sentAppGuids, startMessage.AppGuid)
+				}
+				Ω(sentAppGuids).Should(ConsistOf(app.AppGuid, otherApp.AppGuid))
+			})
+		})
+
+		Context("when a DEA has more stop messages than its rate limit allows", func() {
+			BeforeEach(func() {
+				conf.SenderPerAppRateLimit = 0
+				conf.SenderPerDeaRateLimit = 2
+
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+					otherApp.InstanceAtIndex(0).Heartbeat(),
+				))
+				store.SavePendingStopMessages(
+					models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra),
+					models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonExtra),
+					models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, otherApp.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra),
+				)
+			})
+
+			It("should only send as many stops to the DEA as the limit allows and keep the rest around", func() {
+				err := sender.Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(2))
+
+				remainingStopMessages, _ := store.GetPendingStopMessages()
+				Ω(remainingStopMessages).Should(HaveLen(1))
+			})
+		})
+	})
+
+	Context("when sending the stop messages would trip the mass stop circuit breaker", func() {
+		var stopMessages []models.PendingStopMessage
+
+		BeforeEach(func() {
+			conf.MassStopThresholdInstances = 2
+
+			store.SyncHeartbeats(app.Heartbeat(3))
+			stopMessages = []models.PendingStopMessage{}
+			for i := 0; i < 3; i++ {
+				stopMessage := models.NewPendingStopMessage(time.Unix(100, 0), 10, 4, app.AppGuid, app.AppVersion, app.InstanceAtIndex(i).InstanceGuid, models.PendingStopMessageReasonExtra)
+				stopMessages = append(stopMessages, stopMessage)
+			}
+			store.SavePendingStopMessages(stopMessages...)
+			timeProvider.TimeToProvide = time.Unix(110, 0)
+		})
+
+		It("should not send the stop messages but should keep them around", func() {
+			err := sender.Send()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(BeEmpty())
+
+			remainingStopMessages, _ := store.GetPendingStopMessages()
+			Ω(remainingStopMessages).Should(HaveLen(3))
+		})
+
+		It("should track the trip", func() {
+			sender.Send()
+			Ω(metricsAccountant.MassStopCircuitBreakerTrips).Should(Equal(1))
+			Ω(metricsAccountant.RefusedStops).Should(Equal(3))
+		})
+
+		It("should record that the messages were not sent", func() {
+			sender.Send()
+			history, _ := store.GetAppHistory(app.AppGuid)
+			Ω(history).Should(HaveLen(3))
+			for _, event := range history {
+				Ω(event.EventType).Should(Equal(models.AppHistoryEventStopNotSent))
+				Ω(event.Description).Should(Equal("mass stop circuit breaker tripped, will retry"))
+			}
+		})
+
+		Context("when mass stops have been allowed", func() {
+			BeforeEach(func() {
+				store.AllowMassStops(timeProvider.Time())
+			})
+
+			It("should send the stop messages", func() {
+				err := sender.Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(3))
+				Ω(metricsAccountant.MassStopCircuitBreakerTrips).Should(BeZero())
+			})
+		})
+
+		Context("when only some of the stop messages should be sent", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1))
+			})
+
+			It("should only count the messages that would actually be sent", func() {
+				err := sender.Send()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages["hm9000.stop"]).Should(HaveLen(2))
+			})
 		})
 	})
 
@@ -744,7 +1845,7 @@ var _ = Describe("Sender", func() {
 			conf, _ = config.DefaultConfig()
 			conf.SenderMessageLimit = 20
 
-			sender = New(store, metricsAccountant, conf, messageBus, timeProvider, fakelogger.NewFakeLogger())
+			sender = New(store, metricsAccountant, conf, NewNATSTransport(messageBus, conf), timeProvider, NewRateLimiter(conf), fakelogger.NewFakeLogger())
 
 			desiredStates := []models.DesiredAppState{}
 			for i := 0; i < 40; i += 1 {
@@ -0,0 +1,70 @@
+package sender
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+//WebhookTransport POSTs the payload of each start and stop message to a URL, with the message's id as the Idempotency-Key header.
+//Any response other than a 2xx is a failed send.  A 4xx (other than a 408 or a 429) will not go away on retry, so it is a PermanentPublishError.
+type WebhookTransport struct {
+	startURL string
+	stopURL  string
+	client   *http.Client
+}
+
+func NewWebhookTransport(startURL string, stopURL string, timeout time.Duration) *WebhookTransport {
+	return &WebhookTransport{
+		startURL: startURL,
+		stopURL:  stopURL,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (transport *WebhookTransport) SendStart(message models.StartMessage, payload []byte) error {
+	return transport.post(transport.startURL, message.MessageId, payload)
+}
+
+func (transport *WebhookTransport) SendStop(message models.StopMessage, payload []byte) error {
+	return transport.post(transport.stopURL, message.MessageId, payload)
+}
+
+func (transport *WebhookTransport) post(url string, messageId string, payload []byte) error {
+	request, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Idempotency-Key", messageId)
+
+	response, err := transport.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	//drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		err = fmt.Errorf("Webhook %s responded with %s", url, response.Status)
+		if isPermanentWebhookStatus(response.StatusCode) {
+			return &PermanentPublishError{Err: err}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func isPermanentWebhookStatus(statusCode int) bool {
+	if statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests {
+		return false
+	}
+	return statusCode >= 400 && statusCode <= 499
+}
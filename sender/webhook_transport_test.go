@@ -0,0 +1,132 @@
+package sender_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/sender"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type webhookRequest struct {
+	method      string
+	path        string
+	contentType string
+	messageId   string
+	body        []byte
+}
+
+var _ = Describe("WebhookTransport", func() {
+	var (
+		server       *httptest.Server
+		requests     []webhookRequest
+		statusCode   int
+		transport    *WebhookTransport
+		startMessage models.StartMessage
+		stopMessage  models.StopMessage
+	)
+
+	BeforeEach(func() {
+		requests = []webhookRequest{}
+		statusCode = http.StatusOK
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, webhookRequest{
+				method:      r.Method,
+				path:        r.URL.Path,
+				contentType: r.Header.Get("Content-Type"),
+				messageId:   r.Header.Get("Idempotency-Key"),
+				body:        body,
+			})
+			w.WriteHeader(statusCode)
+		}))
+
+		transport = NewWebhookTransport(server.URL+"/start", server.URL+"/stop", time.Second)
+		startMessage = models.StartMessage{MessageId: "start-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceIndex: 1}
+		stopMessage = models.StopMessage{MessageId: "stop-id", AppGuid: "app-guid", AppVersion: "app-version", InstanceGuid: "instance-guid", InstanceIndex: 2}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should POST the JSON of a start message to the start URL", func() {
+		err := transport.SendStart(startMessage, startMessage.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(requests).Should(HaveLen(1))
+		Ω(requests[0].method).Should(Equal("POST"))
+		Ω(requests[0].path).Should(Equal("/start"))
+		Ω(requests[0].contentType).Should(Equal("application/json"))
+		Ω(requests[0].messageId).Should(Equal("start-id"))
+		Ω(requests[0].body).Should(Equal(startMessage.ToJSON()))
+	})
+
+	It("should POST the JSON of a stop message to the stop URL", func() {
+		err := transport.SendStop(stopMessage, stopMessage.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(requests).Should(HaveLen(1))
+		Ω(requests[0].path).Should(Equal("/stop"))
+		Ω(requests[0].messageId).Should(Equal("stop-id"))
+		Ω(requests[0].body).Should(Equal(stopMessage.ToJSON()))
+	})
+
+	Context("when the webhook responds with anything other than a 2xx", func() {
+		BeforeEach(func() {
+			statusCode = http.StatusServiceUnavailable
+		})
+
+		It("should return an error", func() {
+			err := transport.SendStart(startMessage, startMessage.ToJSON())
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("503"))
+		})
+
+		It("should be worth retrying", func() {
+			err := transport.SendStart(startMessage, startMessage.ToJSON())
+			Ω(IsPermanentPublishError(err)).Should(BeFalse())
+		})
+	})
+
+	Context("when the webhook responds with a 4xx", func() {
+		BeforeEach(func() {
+			statusCode = http.StatusBadRequest
+		})
+
+		It("should return a permanent error", func() {
+			err := transport.SendStart(startMessage, startMessage.ToJSON())
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("400"))
+			Ω(IsPermanentPublishError(err)).Should(BeTrue())
+		})
+
+		Context("that asks to be retried later", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusTooManyRequests
+			})
+
+			It("should not return a permanent error", func() {
+				err := transport.SendStart(startMessage, startMessage.ToJSON())
+				Ω(err).Should(HaveOccurred())
+				Ω(IsPermanentPublishError(err)).Should(BeFalse())
+			})
+		})
+	})
+
+	Context("when the webhook cannot be reached", func() {
+		BeforeEach(func() {
+			server.Close()
+		})
+
+		It("should return an error", func() {
+			err := transport.SendStop(stopMessage, stopMessage.ToJSON())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -12,6 +12,12 @@ func New(store storepackage.Store) *Shredder {
 	return &Shredder{store}
 }
 
+//Shred prunes the quarantines of apps that are no longer desired, then compacts the store
 func (s *Shredder) Shred() error {
+	err := s.store.PruneQuarantines()
+	if err != nil {
+		return err
+	}
+
 	return s.store.Compact()
 }
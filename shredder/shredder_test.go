@@ -1,7 +1,10 @@
 package shredder_test
 
 import (
+	"time"
+
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
 	. "github.com/cloudfoundry/hm9000/shredder"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
@@ -14,6 +17,7 @@ import (
 var _ = Describe("Shredder", func() {
 	var (
 		shredder     *Shredder
+		store        storepackage.Store
 		storeAdapter *fakestoreadapter.FakeStoreAdapter
 	)
 
@@ -21,7 +25,7 @@ var _ = Describe("Shredder", func() {
 		storeAdapter = fakestoreadapter.New()
 		conf, _ := config.DefaultConfig()
 		conf.StoreSchemaVersion = 2
-		store := storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
 		shredder = New(store)
 
 		storeAdapter.SetMulti([]storeadapter.StoreNode{
@@ -65,6 +69,25 @@ var _ = Describe("Shredder", func() {
 		Ω(err).ShouldNot(HaveOccurred())
 	})
 
+	Context("when an app that is no longer desired is quarantined", func() {
+		var quarantine models.Quarantine
+
+		BeforeEach(func() {
+			quarantine = models.Quarantine{AppGuid: "app-guid", AppVersion: "app-version", InstanceIndex: 0, CrashCount: 5}
+			store.SaveQuarantines(quarantine)
+			store.BumpDesiredFreshness(time.Unix(100, 0))
+
+			err := shredder.Shred()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should prune the quarantine", func() {
+			quarantines, err := store.GetQuarantines()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(quarantines).Should(BeEmpty())
+		})
+	})
+
 	It("should not delete anything that isn't under the hm namespace", func() {
 		_, err := storeAdapter.Get("/let/me/be")
 		Ω(err).ShouldNot(HaveOccurred())
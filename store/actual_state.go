@@ -44,6 +44,7 @@ func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) e
 
 	nodesToSave := []storeadapter.StoreNode{}
 	keysToDelete := []string{}
+	dirtyAppKeys := []string{}
 	numberOfInstanceHeartbeats := 0
 
 	store.instanceHeartbeatCacheMutex.Lock()
@@ -61,6 +62,7 @@ func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) e
 			}
 
 			nodesToSave = append(nodesToSave, store.storeNodeForInstanceHeartbeat(incomingInstanceHeartbeat))
+			dirtyAppKeys = append(dirtyAppKeys, store.AppKey(incomingInstanceHeartbeat.AppGuid, incomingInstanceHeartbeat.AppVersion))
 			store.instanceHeartbeatCache[incomingInstanceHeartbeat.InstanceGuid] = incomingInstanceHeartbeat
 		}
 
@@ -70,6 +72,7 @@ func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) e
 			if existingInstanceHeartbeat.DeaGuid == incomingHeartbeat.DeaGuid && !incomingInstanceGuids[existingInstanceHeartbeat.InstanceGuid] {
 				key := store.instanceHeartbeatStoreKey(existingInstanceHeartbeat.AppGuid, existingInstanceHeartbeat.AppVersion, existingInstanceHeartbeat.InstanceGuid)
 				keysToDelete = append(keysToDelete, key)
+				dirtyAppKeys = append(dirtyAppKeys, store.AppKey(existingInstanceHeartbeat.AppGuid, existingInstanceHeartbeat.AppVersion))
 				cacheKeysToDelete = append(cacheKeysToDelete, existingInstanceHeartbeat.InstanceGuid)
 			}
 		}
@@ -99,6 +102,11 @@ func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) e
 		return err
 	}
 
+	err = store.markAppsDirty(dirtyAppKeys...)
+	if err != nil {
+		return err
+	}
+
 	store.logger.Debug(fmt.Sprintf("Save Duration Actual"), map[string]string{
 		"Number of Heartbeats":          fmt.Sprintf("%d", len(incomingHeartbeats)),
 		"Number of Instance Heartbeats": fmt.Sprintf("%d", numberOfInstanceHeartbeats),
@@ -143,6 +151,11 @@ func (store *RealStore) GetInstanceHeartbeats() (results []models.InstanceHeartb
 		return []models.InstanceHeartbeat{}, err
 	}
 
+	err = store.markAppsDirty(store.appKeysForInstanceHeartbeatKeys(expiredKeys)...)
+	if err != nil {
+		return []models.InstanceHeartbeat{}, err
+	}
+
 	return results, nil
 }
 
@@ -171,6 +184,13 @@ func (store *RealStore) GetInstanceHeartbeatsForApp(appGuid string, appVersion s
 		return []models.InstanceHeartbeat{}, err
 	}
 
+	if len(expiredKeys) > 0 {
+		err = store.markAppsDirty(store.AppKey(appGuid, appVersion))
+		if err != nil {
+			return []models.InstanceHeartbeat{}, err
+		}
+	}
+
 	return results, nil
 }
 
@@ -197,6 +217,16 @@ func (store *RealStore) heartbeatsForNode(node storeadapter.StoreNode, unexpired
 	return results, toDelete, nil
 }
 
+//expired heartbeats disappear without a write, so the apps they belonged to are marked dirty when they are cleaned up
+func (store *RealStore) appKeysForInstanceHeartbeatKeys(keys []string) []string {
+	appKeys := []string{}
+	for _, key := range keys {
+		components := strings.Split(key, "/")
+		appKeys = append(appKeys, components[len(components)-2])
+	}
+	return appKeys
+}
+
 func (store *RealStore) unexpiredDeas() (results map[string]bool, err error) {
 	results = map[string]bool{}
 
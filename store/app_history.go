@@ -0,0 +1,110 @@
+package store
+
+import (
+	"fmt"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"time"
+)
+
+func (store *RealStore) appHistoryStoreKey(appGuid string) string {
+	return store.SchemaRoot() + "/apps/history/" + appGuid
+}
+
+//SaveAppHistoryEvents stores the events under their app guid and trims each app's history
+//down to the configured maximum, dropping the oldest events first.
+//An event that repeats the latest event recorded for its message is merged into it rather than stored anew,
+//so a decision made on every pass (e.g. skipping an already queued message) takes up a single event.
+func (store *RealStore) SaveAppHistoryEvents(events ...models.AppHistoryEvent) error {
+	t := time.Now()
+
+	eventsByApp := map[string][]models.AppHistoryEvent{}
+	for _, event := range events {
+		eventsByApp[event.AppGuid] = append(eventsByApp[event.AppGuid], event)
+	}
+
+	nodes := []storeadapter.StoreNode{}
+	keysToDelete := []string{}
+	numberOfMergedEvents := 0
+	for appGuid, appEvents := range eventsByApp {
+		history, err := store.GetAppHistory(appGuid)
+		if err != nil {
+			return err
+		}
+
+		storedEventIds := map[string]bool{}
+		eventsById := map[string]models.AppHistoryEvent{}
+		latestByMessageId := map[string]models.AppHistoryEvent{}
+		for _, event := range history {
+			storedEventIds[event.EventId] = true
+			eventsById[event.EventId] = event
+			latestByMessageId[event.MessageId] = event
+		}
+
+		eventIdsToSave := map[string]bool{}
+		for _, event := range models.SortAppHistoryEventsByTimestamp(appEvents) {
+			latest, found := latestByMessageId[event.MessageId]
+			if found && event.IsRepeatOf(latest) {
+				event = event.MergedInto(latest)
+				numberOfMergedEvents++
+			}
+			eventsById[event.EventId] = event
+			latestByMessageId[event.MessageId] = event
+			eventIdsToSave[event.EventId] = true
+		}
+
+		updatedHistory := []models.AppHistoryEvent{}
+		for _, event := range eventsById {
+			updatedHistory = append(updatedHistory, event)
+		}
+		updatedHistory = models.SortAppHistoryEventsByTimestamp(updatedHistory)
+
+		for i, event := range updatedHistory {
+			if i < len(updatedHistory)-store.config.AppHistoryMaxEvents {
+				if storedEventIds[event.EventId] {
+					keysToDelete = append(keysToDelete, store.appHistoryStoreKey(appGuid)+"/"+event.StoreKey())
+				}
+			} else if eventIdsToSave[event.EventId] {
+				nodes = append(nodes, storeadapter.StoreNode{
+					Key:   store.appHistoryStoreKey(appGuid) + "/" + event.StoreKey(),
+					Value: event.ToJSON(),
+					TTL:   uint64(store.config.AppHistoryTTL().Seconds()),
+				})
+			}
+		}
+	}
+
+	err := store.adapter.SetMulti(nodes)
+	if err != nil {
+		return err
+	}
+
+	err = store.adapter.Delete(keysToDelete...)
+
+	store.logger.Debug(fmt.Sprintf("Save Duration App History"), map[string]string{
+		"Number of Items":         fmt.Sprintf("%d", len(events)),
+		"Number of Items Merged":  fmt.Sprintf("%d", numberOfMergedEvents),
+		"Number of Items Trimmed": fmt.Sprintf("%d", len(keysToDelete)),
+		"Duration":                fmt.Sprintf("%.4f seconds", time.Since(t).Seconds()),
+	})
+	return err
+}
+
+//GetAppHistory returns the recorded events for all versions of the app, oldest first
+func (store *RealStore) GetAppHistory(appGuid string) ([]models.AppHistoryEvent, error) {
+	nodes, err := store.fetchNodesUnderDir(store.appHistoryStoreKey(appGuid))
+	if err != nil {
+		return []models.AppHistoryEvent{}, err
+	}
+
+	events := []models.AppHistoryEvent{}
+	for _, node := range nodes {
+		event, err := models.NewAppHistoryEventFromJSON(node.Value)
+		if err != nil {
+			return []models.AppHistoryEvent{}, err
+		}
+		events = append(events, event)
+	}
+
+	return models.SortAppHistoryEventsByTimestamp(events), nil
+}
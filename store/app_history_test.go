@@ -0,0 +1,157 @@
+package store_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"time"
+)
+
+var _ = Describe("App History", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		message      models.PendingStartMessage
+		otherMessage models.PendingStopMessage
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		conf.AppHistoryMaxEvents = 3
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		message = models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", 1, 1.0, models.PendingStartMessageReasonCrashed)
+		otherMessage = models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, "other-app-guid", "app-version", "instance-guid", models.PendingStopMessageReasonExtra)
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("Saving and fetching history", func() {
+		var events []models.AppHistoryEvent
+
+		BeforeEach(func() {
+			events = []models.AppHistoryEvent{
+				models.NewAppHistoryEvent(time.Unix(120, 0), "sender", models.AppHistoryEventStartSent, "sent", message.PendingMessage, message.LogDescription()),
+				models.NewAppHistoryEvent(time.Unix(110, 0), "analyzer", models.AppHistoryEventStartEnqueued, "crashed", message.PendingMessage, message.LogDescription()),
+				models.NewAppHistoryEvent(time.Unix(110, 0), "analyzer", models.AppHistoryEventStopEnqueued, "extra", otherMessage.PendingMessage, otherMessage.LogDescription()),
+			}
+
+			err := store.SaveAppHistoryEvents(events...)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("stores the events under the app guid with the configured TTL", func() {
+			node, err := storeAdapter.Get("/hm/v1/apps/history/app-guid/" + events[0].StoreKey())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(MatchJSON(events[0].ToJSON()))
+			Ω(node.TTL).Should(BeNumerically("<=", uint64(conf.AppHistoryTTL().Seconds())))
+		})
+
+		It("returns the history for the requested app, oldest first", func() {
+			history, err := store.GetAppHistory("app-guid")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(history).Should(Equal([]models.AppHistoryEvent{events[1], events[0]}))
+
+			history, err = store.GetAppHistory("other-app-guid")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(history).Should(Equal([]models.AppHistoryEvent{events[2]}))
+		})
+
+		Context("when there is no history for the app", func() {
+			It("returns an empty list", func() {
+				history, err := store.GetAppHistory("no-such-app")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(history).Should(BeEmpty())
+			})
+		})
+
+		Context("when an event repeats the latest event for its message", func() {
+			var repeats []models.AppHistoryEvent
+
+			BeforeEach(func() {
+				repeats = []models.AppHistoryEvent{
+					models.NewAppHistoryEvent(time.Unix(130, 0), "analyzer", models.AppHistoryEventStartSkipped, "crashed", message.PendingMessage, message.LogDescription()),
+					models.NewAppHistoryEvent(time.Unix(131, 0), "analyzer", models.AppHistoryEventStartSkipped, "crashed", message.PendingMessage, message.LogDescription()),
+				}
+				for _, repeat := range repeats {
+					err := store.SaveAppHistoryEvents(repeat)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+			})
+
+			It("merges the repeats into a single event, counting them", func() {
+				history, err := store.GetAppHistory("app-guid")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(history).Should(HaveLen(3))
+				Ω(history[0]).Should(Equal(events[1]))
+				Ω(history[1]).Should(Equal(events[0]))
+				Ω(history[2].EventId).Should(Equal(repeats[0].EventId))
+				Ω(history[2].Timestamp).Should(BeNumerically("==", 131))
+				Ω(history[2].FirstTimestamp).Should(BeNumerically("==", 130))
+				Ω(history[2].Repeats).Should(Equal(1))
+			})
+
+			It("does not push the other events out of the history", func() {
+				for i := 0; i < 10; i++ {
+					err := store.SaveAppHistoryEvents(models.NewAppHistoryEvent(time.Unix(int64(140+i), 0), "analyzer", models.AppHistoryEventStartSkipped, "crashed", message.PendingMessage, message.LogDescription()))
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				history, err := store.GetAppHistory("app-guid")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(history).Should(HaveLen(3))
+				Ω(history[0]).Should(Equal(events[1]))
+				Ω(history[2].Repeats).Should(Equal(11))
+			})
+
+			It("records the decision anew once a different decision came in between", func() {
+				sent := models.NewAppHistoryEvent(time.Unix(150, 0), "sender", models.AppHistoryEventStartSent, "sent", message.PendingMessage, message.LogDescription())
+				skipped := models.NewAppHistoryEvent(time.Unix(160, 0), "analyzer", models.AppHistoryEventStartSkipped, "crashed", message.PendingMessage, message.LogDescription())
+				err := store.SaveAppHistoryEvents(sent, skipped)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				history, err := store.GetAppHistory("app-guid")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(history).Should(HaveLen(3))
+				Ω(history[1].EventId).Should(Equal(sent.EventId))
+				Ω(history[2].EventId).Should(Equal(skipped.EventId))
+				Ω(history[2].Repeats).Should(BeZero())
+			})
+		})
+
+		Context("when an app's history grows beyond the maximum", func() {
+			It("drops the oldest events", func() {
+				newer := []models.AppHistoryEvent{
+					models.NewAppHistoryEvent(time.Unix(130, 0), "analyzer", models.AppHistoryEventStartSkipped, "crashed", message.PendingMessage, message.LogDescription()),
+					models.NewAppHistoryEvent(time.Unix(140, 0), "sender", models.AppHistoryEventStartDeleted, "expired start message", message.PendingMessage, message.LogDescription()),
+				}
+				err := store.SaveAppHistoryEvents(newer...)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				history, err := store.GetAppHistory("app-guid")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(history).Should(Equal([]models.AppHistoryEvent{events[0], newer[0], newer[1]}))
+
+				history, err = store.GetAppHistory("other-app-guid")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(history).Should(HaveLen(1))
+			})
+		})
+	})
+})
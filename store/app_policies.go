@@ -0,0 +1,19 @@
+package store
+
+import (
+	"github.com/cloudfoundry/hm9000/models"
+	"reflect"
+)
+
+func (store *RealStore) SaveAppPolicies(policies ...models.AppPolicy) error {
+	return store.save(policies, store.SchemaRoot()+"/apps/policies", 0)
+}
+
+func (store *RealStore) GetAppPolicies() (map[string]models.AppPolicy, error) {
+	slice, err := store.get(store.SchemaRoot()+"/apps/policies", reflect.TypeOf(map[string]models.AppPolicy{}), reflect.ValueOf(models.NewAppPolicyFromJSON))
+	return slice.Interface().(map[string]models.AppPolicy), err
+}
+
+func (store *RealStore) DeleteAppPolicies(policies ...models.AppPolicy) error {
+	return store.delete(policies, store.SchemaRoot()+"/apps/policies")
+}
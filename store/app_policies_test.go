@@ -0,0 +1,81 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"github.com/cloudfoundry/storeadapter/storenodematchers"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Storing AppPolicies", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		policy1      models.AppPolicy
+		policy2      models.AppPolicy
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		policy1 = models.AppPolicy{AppGuid: "ABC", GracePeriodInHeartbeats: 18}
+		policy2 = models.AppPolicy{AppGuid: "DEF", NeverRestart: true}
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		err = store.SaveAppPolicies(policy1, policy2)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("Saving policies", func() {
+		It("stores the passed in policies under the app guid", func() {
+			node, err := storeAdapter.Get("/hm/v1/apps/policies/ABC")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node).Should(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
+				Key:   "/hm/v1/apps/policies/ABC",
+				Value: policy1.ToJSON(),
+				TTL:   0,
+			}))
+		})
+	})
+
+	Describe("Fetching policies", func() {
+		It("returns the policies keyed by app guid", func() {
+			policies, err := store.GetAppPolicies()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policies).Should(Equal(map[string]models.AppPolicy{
+				"ABC": policy1,
+				"DEF": policy2,
+			}))
+		})
+	})
+
+	Describe("Deleting policies", func() {
+		It("removes the policies", func() {
+			err := store.DeleteAppPolicies(policy1)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			policies, err := store.GetAppPolicies()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policies).Should(Equal(map[string]models.AppPolicy{
+				"DEF": policy2,
+			}))
+		})
+	})
+})
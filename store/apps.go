@@ -16,6 +16,7 @@ func (store *RealStore) GetApp(appGuid string, appVersion string) (*models.App,
 	representation := &appRepresentation{
 		actualState: []models.InstanceHeartbeat{},
 		crashCounts: []models.CrashCount{},
+		quarantines: []models.Quarantine{},
 	}
 
 	var err error
@@ -45,6 +46,13 @@ func (store *RealStore) GetApp(appGuid string, appVersion string) (*models.App,
 	}
 	dtCrash := time.Since(tCrash).Seconds()
 
+	tQuarantine := time.Now()
+	representation.quarantines, err = store.getQuarantinesForApp(appGuid, appVersion)
+	if err != nil {
+		return nil, err
+	}
+	dtQuarantine := time.Since(tQuarantine).Seconds()
+
 	app, err := representation.buildApp()
 	if app == nil {
 		return nil, AppNotFoundError
@@ -55,6 +63,7 @@ func (store *RealStore) GetApp(appGuid string, appVersion string) (*models.App,
 		"Time to Fetch Desired":      fmt.Sprintf("%.4f seconds", dtDesired),
 		"Time to Fetch Actual":       fmt.Sprintf("%.4f seconds", dtActual),
 		"Time to Fetch Crash Counts": fmt.Sprintf("%.4f seconds", dtCrash),
+		"Time to Fetch Quarantines":  fmt.Sprintf("%.4f seconds", dtQuarantine),
 	})
 
 	return app, err
@@ -101,6 +110,18 @@ func (store *RealStore) GetApps() (results map[string]*models.App, err error) {
 		representation.crashCounts = append(representation.crashCounts, crashCount)
 	}
 
+	tQuarantine := time.Now()
+	quarantines, err := store.GetQuarantines()
+	dtQuarantine := time.Since(tQuarantine).Seconds()
+
+	if err != nil {
+		return results, err
+	}
+	for _, quarantine := range quarantines {
+		representation := representations.representationForAppGuidVersion(quarantine.AppGuid, quarantine.AppVersion)
+		representation.quarantines = append(representation.quarantines, quarantine)
+	}
+
 	for _, appRepresentation := range representations {
 		if appRepresentation.representsAnApp() {
 			app, err := appRepresentation.buildApp()
@@ -119,6 +140,7 @@ func (store *RealStore) GetApps() (results map[string]*models.App, err error) {
 		"Time to Fetch Desired":      fmt.Sprintf("%.4f seconds", dtDesired),
 		"Time to Fetch Actual":       fmt.Sprintf("%.4f seconds", dtActual),
 		"Time to Fetch Crash Counts": fmt.Sprintf("%.4f seconds", dtCrash),
+		"Time to Fetch Quarantines":  fmt.Sprintf("%.4f seconds", dtQuarantine),
 	})
 
 	return results, nil
@@ -133,6 +155,7 @@ func (representations appRepresentations) representationForAppGuidVersion(appGui
 		representations[id] = &appRepresentation{
 			actualState: []models.InstanceHeartbeat{},
 			crashCounts: []models.CrashCount{},
+			quarantines: []models.Quarantine{},
 		}
 	}
 	return representations[id]
@@ -142,6 +165,7 @@ type appRepresentation struct {
 	desiredState models.DesiredAppState
 	actualState  []models.InstanceHeartbeat
 	crashCounts  []models.CrashCount
+	quarantines  []models.Quarantine
 }
 
 func (representation *appRepresentation) hasDesired() bool {
@@ -178,5 +202,10 @@ func (representation *appRepresentation) buildApp() (*models.App, error) {
 		crashCounts[crashCount.InstanceIndex] = crashCount
 	}
 
-	return models.NewApp(appGuid, appVersion, desiredState, actualState, crashCounts), nil
+	quarantines := make(map[int]models.Quarantine)
+	for _, quarantine := range representation.quarantines {
+		quarantines[quarantine.InstanceIndex] = quarantine
+	}
+
+	return models.NewApp(appGuid, appVersion, desiredState, actualState, crashCounts, quarantines), nil
 }
@@ -26,6 +26,7 @@ var _ = Describe("Apps", func() {
 		app3       appfixture.AppFixture
 		app4       appfixture.AppFixture
 		crashCount []models.CrashCount
+		quarantine models.Quarantine
 	)
 
 	conf, _ = config.DefaultConfig()
@@ -82,9 +83,18 @@ var _ = Describe("Apps", func() {
 			},
 		}
 
+		quarantine = models.Quarantine{
+			AppGuid:       app1.AppGuid,
+			AppVersion:    app1.AppVersion,
+			InstanceIndex: 2,
+			CrashCount:    17,
+			QuarantinedAt: 100,
+		}
+
 		store.SyncHeartbeats(dea.HeartbeatWith(actualState...))
 		store.SyncDesiredState(desiredState...)
 		store.SaveCrashCounts(crashCount...)
+		store.SaveQuarantines(quarantine)
 	})
 
 	Describe("AppKey", func() {
@@ -113,12 +123,15 @@ var _ = Describe("Apps", func() {
 				Ω(a1.InstanceHeartbeats).Should(ContainElement(app1.InstanceAtIndex(2).Heartbeat()))
 				Ω(a1.CrashCounts[1]).Should(Equal(crashCount[0]))
 				Ω(a1.CrashCounts[2]).Should(Equal(crashCount[1]))
+				Ω(a1.Quarantines).Should(HaveLen(1))
+				Ω(a1.Quarantines[2]).Should(Equal(quarantine))
 
 				a2 := apps[app2.AppGuid+","+app2.AppVersion]
 				Ω(a2.Desired).Should(BeZero())
 				Ω(a2.InstanceHeartbeats).Should(HaveLen(1))
 				Ω(a2.InstanceHeartbeats).Should(ContainElement(app2.InstanceAtIndex(0).Heartbeat()))
 				Ω(a2.CrashCounts[0]).Should(Equal(crashCount[2]))
+				Ω(a2.Quarantines).Should(BeEmpty())
 
 				a3 := apps[app3.AppGuid+","+app3.AppVersion]
 				Ω(a3.Desired).Should(EqualDesiredState(app3.DesiredState(1)))
@@ -154,6 +167,8 @@ var _ = Describe("Apps", func() {
 					Ω(app.InstanceHeartbeats).Should(ContainElement(app1.InstanceAtIndex(2).Heartbeat()))
 					Ω(app.CrashCounts[1]).Should(Equal(crashCount[0]))
 					Ω(app.CrashCounts[2]).Should(Equal(crashCount[1]))
+					Ω(app.Quarantines).Should(HaveLen(1))
+					Ω(app.Quarantines[2]).Should(Equal(quarantine))
 				})
 			})
 
@@ -15,16 +15,34 @@ func (store *RealStore) crashCountStoreKey(crashCount models.CrashCount) string
 func (store *RealStore) SaveCrashCounts(crashCounts ...models.CrashCount) error {
 	t := time.Now()
 
+	policies := map[string]models.AppPolicy{}
+	if len(crashCounts) > 0 {
+		var err error
+		policies, err = store.GetAppPolicies()
+		if err != nil {
+			return err
+		}
+	}
+
 	nodes := make([]storeadapter.StoreNode, len(crashCounts))
 	for i, crashCount := range crashCounts {
 		nodes[i] = storeadapter.StoreNode{
 			Key:   store.crashCountStoreKey(crashCount),
 			Value: crashCount.ToJSON(),
-			TTL:   uint64(store.config.MaximumBackoffDelay().Seconds()) * 2,
+			TTL:   store.crashCountTTL(policies[crashCount.AppGuid]),
 		}
 	}
 
 	err := store.adapter.SetMulti(nodes)
+	if err != nil {
+		return err
+	}
+
+	dirtyAppKeys := []string{}
+	for _, crashCount := range crashCounts {
+		dirtyAppKeys = append(dirtyAppKeys, store.AppKey(crashCount.AppGuid, crashCount.AppVersion))
+	}
+	err = store.markAppsDirty(dirtyAppKeys...)
 
 	store.logger.Debug(fmt.Sprintf("Save Duration Crash Counts"), map[string]string{
 		"Number of Items": fmt.Sprintf("%d", len(crashCounts)),
@@ -33,6 +51,16 @@ func (store *RealStore) SaveCrashCounts(crashCounts ...models.CrashCount) error
 	return err
 }
 
+//crashCountTTL keeps a crash count around for twice the app's maximum backoff delay,
+//honouring the app policy's override of the global maximum
+func (store *RealStore) crashCountTTL(policy models.AppPolicy) uint64 {
+	maximumBackoffDelay := store.config.MaximumBackoffDelay()
+	if policy.MaximumBackoffDelayInHeartbeats > 0 {
+		maximumBackoffDelay = time.Duration(policy.MaximumBackoffDelayInHeartbeats*int(store.config.HeartbeatPeriod)) * time.Second
+	}
+	return uint64(maximumBackoffDelay.Seconds()) * 2
+}
+
 func (store *RealStore) getCrashCounts() (results []models.CrashCount, err error) {
 	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/apps/crashes")
 
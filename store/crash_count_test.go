@@ -69,4 +69,19 @@ var _ = Describe("Crash Count", func() {
 			}))
 		})
 	})
+
+	Describe("Saving crash state for an app with a policy", func() {
+		BeforeEach(func() {
+			err := store.SaveAppPolicies(models.AppPolicy{AppGuid: crashCount3.AppGuid, MaximumBackoffDelayInHeartbeats: 500})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = store.SaveCrashCounts(crashCount3)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("keeps the crash state for twice the policy's maximum backoff delay", func() {
+			node, err := storeAdapter.Get("/hm/v1/apps/crashes/" + crashCount3.AppGuid + "," + crashCount3.AppVersion + "/3")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(BeNumerically("~", 500*conf.HeartbeatPeriod*2, 1))
+		})
+	})
 })
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"reflect"
+)
+
+//Send attempts expire when no message has been sent for their key for the dead letter window, so only sends in quick succession add up
+func (store *RealStore) SaveSendAttempts(attempts ...models.SendAttempts) error {
+	return store.save(attempts, store.SchemaRoot()+"/send-attempts", uint64(store.config.SenderDeadLetterWindow().Seconds()))
+}
+
+func (store *RealStore) GetSendAttempts() (map[string]models.SendAttempts, error) {
+	slice, err := store.get(store.SchemaRoot()+"/send-attempts", reflect.TypeOf(map[string]models.SendAttempts{}), reflect.ValueOf(models.NewSendAttemptsFromJSON))
+	return slice.Interface().(map[string]models.SendAttempts), err
+}
+
+//Send attempts that expired before they could be deleted are not an error
+func (store *RealStore) DeleteSendAttempts(attempts ...models.SendAttempts) error {
+	err := store.delete(attempts, store.SchemaRoot()+"/send-attempts")
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+//Dead letters are stored without a TTL: they only go away when an operator requeues or purges them
+func (store *RealStore) SaveDeadLetters(deadLetters ...models.DeadLetter) error {
+	return store.save(deadLetters, store.SchemaRoot()+"/dead-letters", 0)
+}
+
+func (store *RealStore) GetDeadLetters() (map[string]models.DeadLetter, error) {
+	slice, err := store.get(store.SchemaRoot()+"/dead-letters", reflect.TypeOf(map[string]models.DeadLetter{}), reflect.ValueOf(models.NewDeadLetterFromJSON))
+	return slice.Interface().(map[string]models.DeadLetter), err
+}
+
+//Deleting a dead letter marks its app dirty so that the analyzer can enqueue the message again if need be
+func (store *RealStore) DeleteDeadLetters(deadLetters ...models.DeadLetter) error {
+	err := store.delete(deadLetters, store.SchemaRoot()+"/dead-letters")
+	if err != nil {
+		return err
+	}
+
+	dirtyAppKeys := []string{}
+	for _, deadLetter := range deadLetters {
+		dirtyAppKeys = append(dirtyAppKeys, store.AppKey(deadLetter.AppGuid, deadLetter.AppVersion))
+	}
+	return store.markAppsDirty(dirtyAppKeys...)
+}
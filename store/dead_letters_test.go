@@ -0,0 +1,145 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"github.com/cloudfoundry/storeadapter/storenodematchers"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Storing send attempts and dead letters", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		startMessage models.PendingStartMessage
+		stopMessage  models.PendingStopMessage
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		conf.AnalyzerFullSweepIntervalInHeartbeats = 6
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		startMessage = models.NewPendingStartMessage(time.Unix(100, 0), 10, 0, "ABC", "123", 1, 1.0, models.PendingStartMessageReasonMissing)
+		stopMessage = models.NewPendingStopMessage(time.Unix(100, 0), 10, 0, "DEF", "456", "XYZ", models.PendingStopMessageReasonExtra)
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("send attempts", func() {
+		var startAttempts, stopAttempts models.SendAttempts
+
+		BeforeEach(func() {
+			startAttempts = models.NewStartSendAttempts(startMessage).Attempted(time.Unix(110, 0))
+			stopAttempts = models.NewStopSendAttempts(stopMessage).Attempted(time.Unix(110, 0)).Attempted(time.Unix(140, 0))
+
+			err := store.SaveSendAttempts(startAttempts, stopAttempts)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("stores them with the dead letter window as TTL", func() {
+			node, err := storeAdapter.ListRecursively("/hm/v1/send-attempts")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes).Should(HaveLen(2))
+			Ω(node.ChildNodes).Should(ContainElement(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
+				Key:   "/hm/v1/send-attempts/start-ABC-123-1",
+				Value: startAttempts.ToJSON(),
+				TTL:   600,
+			})))
+		})
+
+		It("can fetch them keyed by store key", func() {
+			attempts, err := store.GetSendAttempts()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(attempts).Should(Equal(map[string]models.SendAttempts{
+				"start-ABC-123-1": startAttempts,
+				"stop-XYZ":        stopAttempts,
+			}))
+		})
+
+		It("can delete them", func() {
+			err := store.DeleteSendAttempts(startAttempts)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			attempts, err := store.GetSendAttempts()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(attempts).Should(HaveLen(1))
+			Ω(attempts).Should(HaveKey("stop-XYZ"))
+		})
+	})
+
+	Describe("dead letters", func() {
+		var startDeadLetter, stopDeadLetter models.DeadLetter
+
+		BeforeEach(func() {
+			startDeadLetter = models.NewStartDeadLetter(time.Unix(200, 0), startMessage, models.NewStartSendAttempts(startMessage).Attempted(time.Unix(110, 0)))
+			stopDeadLetter = models.NewStopDeadLetter(time.Unix(200, 0), stopMessage, models.NewStopSendAttempts(stopMessage).Attempted(time.Unix(110, 0)))
+
+			err := store.SaveDeadLetters(startDeadLetter, stopDeadLetter)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("stores them without a TTL", func() {
+			node, err := storeAdapter.ListRecursively("/hm/v1/dead-letters")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes).Should(HaveLen(2))
+			Ω(node.ChildNodes).Should(ContainElement(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
+				Key:   "/hm/v1/dead-letters/stop-XYZ",
+				Value: stopDeadLetter.ToJSON(),
+				TTL:   0,
+			})))
+		})
+
+		It("can fetch them keyed by store key", func() {
+			deadLetters, err := store.GetDeadLetters()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deadLetters).Should(HaveLen(2))
+			Ω(deadLetters["start-ABC-123-1"]).Should(Equal(startDeadLetter))
+			Ω(deadLetters["stop-XYZ"]).Should(Equal(stopDeadLetter))
+		})
+
+		It("can delete them, marking their apps dirty", func() {
+			err := store.DeleteDeadLetters(startDeadLetter)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			deadLetters, err := store.GetDeadLetters()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deadLetters).Should(HaveLen(1))
+			Ω(deadLetters).Should(HaveKey("stop-XYZ"))
+
+			dirtyAppKeys, err := store.GetDirtyAppKeys()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dirtyAppKeys).Should(ConsistOf("ABC,123"))
+		})
+
+		Context("when there are no dead letters", func() {
+			BeforeEach(func() {
+				err := store.DeleteDeadLetters(startDeadLetter, stopDeadLetter)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns an empty map", func() {
+				deadLetters, err := store.GetDeadLetters()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(deadLetters).Should(BeEmpty())
+			})
+		})
+	})
+})
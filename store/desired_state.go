@@ -25,6 +25,7 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 
 	newDesiredStateKeys := make(map[string]bool, 0)
 	nodesToSave := make([]storeadapter.StoreNode, 0)
+	dirtyAppKeys := []string{}
 	for _, newDesiredState := range newDesiredStates {
 		key := newDesiredState.StoreKey()
 		newDesiredStateKeys[key] = true
@@ -35,6 +36,7 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 				Key:   store.desiredStateStoreKey(newDesiredState),
 				Value: newDesiredState.ToCSV(),
 			})
+			dirtyAppKeys = append(dirtyAppKeys, store.AppKey(newDesiredState.AppGuid, newDesiredState.AppVersion))
 		}
 	}
 
@@ -50,6 +52,7 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 	for key, currentDesiredState := range currentDesiredStates {
 		if !newDesiredStateKeys[key] {
 			keysToDelete = append(keysToDelete, store.desiredStateStoreKey(currentDesiredState))
+			dirtyAppKeys = append(dirtyAppKeys, store.AppKey(currentDesiredState.AppGuid, currentDesiredState.AppVersion))
 		}
 	}
 
@@ -61,6 +64,11 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 		return err
 	}
 
+	err = store.markAppsDirty(dirtyAppKeys...)
+	if err != nil {
+		return err
+	}
+
 	store.logger.Debug(fmt.Sprintf("Save Duration Desired"), map[string]string{
 		"Number of Items Synced":  fmt.Sprintf("%d", len(newDesiredStates)),
 		"Number of Items Saved":   fmt.Sprintf("%d", len(nodesToSave)),
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"sort"
+	"strings"
+)
+
+//Apps are marked dirty whenever something the analyzer cares about changes, so that incremental
+//analysis passes only need to look at those apps.  Marking is skipped entirely unless incremental
+//analysis is enabled (i.e. AnalyzerFullSweepIntervalInHeartbeats > 0).
+//
+//Every mark is unique, so an app marked dirty again while a pass analyzes it keeps its new mark when
+//the pass clears the marks it read, unless the new mark lands in the short window inside ClearDirtyApps (see there).
+func (store *RealStore) markAppsDirty(appKeys ...string) error {
+	if store.config.AnalyzerFullSweepInterval() == 0 || len(appKeys) == 0 {
+		return nil
+	}
+
+	marked := map[string]bool{}
+	nodes := []storeadapter.StoreNode{}
+	for _, appKey := range appKeys {
+		if marked[appKey] {
+			continue
+		}
+		marked[appKey] = true
+		nodes = append(nodes, storeadapter.StoreNode{
+			Key:   store.dirtyAppStoreKey(appKey),
+			Value: []byte(models.Guid()),
+		})
+	}
+
+	return store.adapter.SetMulti(nodes)
+}
+
+//GetDirtyApps returns the current mark of every dirty app, by app key
+func (store *RealStore) GetDirtyApps() (map[string]string, error) {
+	nodes, err := store.fetchNodesUnderDir(store.SchemaRoot() + "/apps/dirty")
+	if err != nil {
+		return map[string]string{}, err
+	}
+
+	marks := map[string]string{}
+	for _, node := range nodes {
+		marks[strings.TrimPrefix(node.Key, store.dirtyAppStoreKey(""))] = string(node.Value)
+	}
+
+	return marks, nil
+}
+
+func (store *RealStore) GetDirtyAppKeys() ([]string, error) {
+	marks, err := store.GetDirtyApps()
+	if err != nil {
+		return []string{}, err
+	}
+
+	appKeys := sort.StringSlice{}
+	for appKey := range marks {
+		appKeys = append(appKeys, appKey)
+	}
+	sort.Sort(appKeys)
+
+	return appKeys, nil
+}
+
+//ClearDirtyApps clears the dirty apps whose mark is still the one given (as returned by GetDirtyApps).
+//Apps that have been marked dirty again since stay dirty.
+//
+//The store adapter has no compare-and-delete, so the marks are checked first and deleted afterwards:
+//an app marked dirty again between the two loses its new mark, and is only analyzed again by the next full sweep.
+func (store *RealStore) ClearDirtyApps(marks map[string]string) error {
+	keysToDelete := []string{}
+	for appKey, mark := range marks {
+		node, err := store.adapter.Get(store.dirtyAppStoreKey(appKey))
+		if err == storeadapter.ErrorKeyNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if string(node.Value) == mark {
+			keysToDelete = append(keysToDelete, node.Key)
+		}
+	}
+
+	if len(keysToDelete) == 0 {
+		return nil
+	}
+
+	err := store.adapter.Delete(keysToDelete...)
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+//GetAppsWithKeys fetches the apps one at a time.  Keys that no longer represent an app are omitted.
+func (store *RealStore) GetAppsWithKeys(appKeys ...string) (map[string]*models.App, error) {
+	results := map[string]*models.App{}
+	for _, appKey := range appKeys {
+		appGuidVersion := strings.SplitN(appKey, ",", 2)
+		if len(appGuidVersion) != 2 {
+			continue
+		}
+
+		app, err := store.GetApp(appGuidVersion[0], appGuidVersion[1])
+		if err == AppNotFoundError {
+			continue
+		} else if err != nil {
+			return map[string]*models.App{}, err
+		}
+
+		results[appKey] = app
+	}
+
+	return results, nil
+}
+
+func (store *RealStore) dirtyAppStoreKey(appKey string) string {
+	return store.SchemaRoot() + "/apps/dirty/" + appKey
+}
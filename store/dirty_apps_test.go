@@ -0,0 +1,173 @@
+package store_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+)
+
+var _ = Describe("Dirty apps", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		dea          appfixture.DeaFixture
+		app1         appfixture.AppFixture
+		app2         appfixture.AppFixture
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		dea = appfixture.NewDeaFixture()
+		app1 = dea.GetApp(0)
+		app2 = dea.GetApp(1)
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Context("when incremental analysis is disabled", func() {
+		BeforeEach(func() {
+			store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		})
+
+		It("should not mark any apps dirty", func() {
+			err := store.SyncDesiredState(app1.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			dirtyAppKeys, err := store.GetDirtyAppKeys()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dirtyAppKeys).Should(BeEmpty())
+		})
+	})
+
+	Context("when incremental analysis is enabled", func() {
+		BeforeEach(func() {
+			conf.AnalyzerFullSweepIntervalInHeartbeats = 6
+			store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		})
+
+		It("should mark apps whose desired state changed", func() {
+			err := store.SyncDesiredState(app1.DesiredState(1), app2.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+			marks, err := store.GetDirtyApps()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(marks).Should(HaveLen(2))
+			err = store.ClearDirtyApps(marks)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.SyncDesiredState(app1.DesiredState(2), app2.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			dirtyAppKeys, err := store.GetDirtyAppKeys()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dirtyAppKeys).Should(Equal([]string{store.AppKey(app1.AppGuid, app1.AppVersion)}))
+		})
+
+		It("should mark apps whose heartbeats changed", func() {
+			err := store.SyncHeartbeats(dea.HeartbeatWith(app2.InstanceAtIndex(0).Heartbeat()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			dirtyAppKeys, err := store.GetDirtyAppKeys()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dirtyAppKeys).Should(Equal([]string{store.AppKey(app2.AppGuid, app2.AppVersion)}))
+		})
+
+		It("should mark apps whose crash counts changed", func() {
+			err := store.SaveCrashCounts(models.CrashCount{AppGuid: app1.AppGuid, AppVersion: app1.AppVersion, InstanceIndex: 0, CrashCount: 1})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			dirtyAppKeys, err := store.GetDirtyAppKeys()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dirtyAppKeys).Should(Equal([]string{store.AppKey(app1.AppGuid, app1.AppVersion)}))
+		})
+
+		It("should ignore clearing apps that are not dirty", func() {
+			err := store.ClearDirtyApps(map[string]string{"Marzipan,Armadillo": "mark"})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should not clear an app that was marked dirty again after its mark was read", func() {
+			err := store.SyncDesiredState(app1.DesiredState(1), app2.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+			marks, err := store.GetDirtyApps()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.SyncDesiredState(app1.DesiredState(2), app2.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.ClearDirtyApps(marks)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			dirtyAppKeys, err := store.GetDirtyAppKeys()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dirtyAppKeys).Should(Equal([]string{store.AppKey(app1.AppGuid, app1.AppVersion)}))
+		})
+
+		Context("when an app is marked dirty again after its mark is checked but before it is deleted", func() {
+			It("should lose the new mark, leaving the app to the next full sweep", func() {
+				err := store.SyncDesiredState(app1.DesiredState(1))
+				Ω(err).ShouldNot(HaveOccurred())
+				marks, err := store.GetDirtyApps()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				markingAdapter := &markAfterGetStoreAdapter{
+					StoreAdapter: storeAdapter,
+					mark: func() {
+						err := store.SyncDesiredState(app1.DesiredState(2))
+						Ω(err).ShouldNot(HaveOccurred())
+					},
+				}
+				err = NewStore(conf, markingAdapter, fakelogger.NewFakeLogger()).ClearDirtyApps(marks)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				dirtyAppKeys, err := store.GetDirtyAppKeys()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(dirtyAppKeys).Should(BeEmpty())
+			})
+		})
+
+		Describe("GetAppsWithKeys", func() {
+			It("should return the apps that exist", func() {
+				err := store.SyncDesiredState(app1.DesiredState(1))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				apps, err := store.GetAppsWithKeys(store.AppKey(app1.AppGuid, app1.AppVersion), "Marzipan,Armadillo")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(apps).Should(HaveLen(1))
+				Ω(apps).Should(HaveKey(store.AppKey(app1.AppGuid, app1.AppVersion)))
+			})
+		})
+	})
+})
+
+//markAfterGetStoreAdapter marks an app dirty once, right after the first Get
+type markAfterGetStoreAdapter struct {
+	storeadapter.StoreAdapter
+	mark   func()
+	marked bool
+}
+
+func (adapter *markAfterGetStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	node, err := adapter.StoreAdapter.Get(key)
+	if !adapter.marked {
+		adapter.marked = true
+		adapter.mark()
+	}
+	return node, err
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"time"
+)
+
+var MassStopCircuitBreakerTrippedError = errors.New("Mass stop circuit breaker tripped")
+
+//AllowMassStops lets the analyzer and sender issue more stops than the mass-stop circuit breaker allows.
+//The override expires after MassStopOverrideDurationInHeartbeats.
+func (store *RealStore) AllowMassStops(timestamp time.Time) error {
+	jsonTimestamp, _ := json.Marshal(models.FreshnessTimestamp{Timestamp: timestamp.Unix()})
+
+	return store.adapter.SetMulti([]storeadapter.StoreNode{
+		{
+			Key:   store.massStopOverrideKey(),
+			Value: jsonTimestamp,
+			TTL:   uint64(store.config.MassStopOverrideDurationInHeartbeats) * store.config.HeartbeatPeriod,
+		},
+	})
+}
+
+func (store *RealStore) AreMassStopsAllowed() (bool, error) {
+	_, err := store.adapter.Get(store.massStopOverrideKey())
+	if err == storeadapter.ErrorKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (store *RealStore) RevokeMassStopOverride() error {
+	err := store.adapter.Delete(store.massStopOverrideKey())
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+func (store *RealStore) massStopOverrideKey() string {
+	return store.SchemaRoot() + "/mass-stop-override"
+}
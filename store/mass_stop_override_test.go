@@ -0,0 +1,77 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("Mass stop override", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+	)
+
+	conf, _ = config.DefaultConfig()
+
+	BeforeEach(func() {
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err := storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	Context("when no override has been given", func() {
+		It("should not allow mass stops", func() {
+			allowed, err := store.AreMassStopsAllowed()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(allowed).Should(BeFalse())
+		})
+
+		It("should not fail to revoke", func() {
+			err := store.RevokeMassStopOverride()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when an override has been given", func() {
+		BeforeEach(func() {
+			err := store.AllowMassStops(time.Unix(100, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should allow mass stops", func() {
+			allowed, err := store.AreMassStopsAllowed()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(allowed).Should(BeTrue())
+		})
+
+		It("should expire the override", func() {
+			value, err := storeAdapter.Get("/hm/v1/mass-stop-override")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(value.TTL).Should(BeNumerically("==", conf.MassStopOverrideDuration().Seconds()))
+		})
+
+		Context("and then revoked", func() {
+			BeforeEach(func() {
+				err := store.RevokeMassStopOverride()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should no longer allow mass stops", func() {
+				allowed, err := store.AreMassStopsAllowed()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(allowed).Should(BeFalse())
+			})
+		})
+	})
+})
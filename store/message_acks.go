@@ -0,0 +1,31 @@
+package store
+
+import (
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"reflect"
+)
+
+//Acks outlive the ack timeout so that an ack heard before the sender saved its message as sent is still around to match it
+func (store *RealStore) messageAckTTL() uint64 {
+	return uint64(2 * store.config.SenderAckTimeout().Seconds())
+}
+
+func (store *RealStore) SaveMessageAcks(acks ...models.MessageAck) error {
+	return store.save(acks, store.SchemaRoot()+"/acks", store.messageAckTTL())
+}
+
+//GetMessageAcks returns the acks heard so far, keyed by MessageId
+func (store *RealStore) GetMessageAcks() (map[string]models.MessageAck, error) {
+	slice, err := store.get(store.SchemaRoot()+"/acks", reflect.TypeOf(map[string]models.MessageAck{}), reflect.ValueOf(models.NewMessageAckFromJSON))
+	return slice.Interface().(map[string]models.MessageAck), err
+}
+
+//An ack that expired before it could be deleted is not an error
+func (store *RealStore) DeleteMessageAcks(acks ...models.MessageAck) error {
+	err := store.delete(acks, store.SchemaRoot()+"/acks")
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
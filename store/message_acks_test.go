@@ -0,0 +1,109 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"github.com/cloudfoundry/storeadapter/storenodematchers"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Storing MessageAcks", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		ack1         models.MessageAck
+		ack2         models.MessageAck
+		ack3         models.MessageAck
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		ack1 = models.MessageAck{MessageId: "message-1", DeaGuid: "dea-a", ReceivedAt: 100}
+		ack2 = models.MessageAck{MessageId: "message-2", DeaGuid: "dea-b", ReceivedAt: 110}
+		ack3 = models.MessageAck{MessageId: "message-3", ReceivedAt: 120}
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("Saving acks", func() {
+		BeforeEach(func() {
+			err := store.SaveMessageAcks(ack1, ack2)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("stores the passed in acks with a TTL of twice the ack timeout", func() {
+			node, err := storeAdapter.ListRecursively("/hm/v1/acks")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes).Should(HaveLen(2))
+			Ω(node.ChildNodes).Should(ContainElement(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
+				Key:   "/hm/v1/acks/message-1",
+				Value: ack1.ToJSON(),
+				TTL:   60,
+			})))
+			Ω(node.ChildNodes).Should(ContainElement(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
+				Key:   "/hm/v1/acks/message-2",
+				Value: ack2.ToJSON(),
+				TTL:   60,
+			})))
+		})
+	})
+
+	Describe("Fetching acks", func() {
+		Context("when there are acks", func() {
+			BeforeEach(func() {
+				err := store.SaveMessageAcks(ack1, ack2)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns them keyed by message id", func() {
+				acks, err := store.GetMessageAcks()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(acks).Should(HaveLen(2))
+				Ω(acks["message-1"]).Should(Equal(ack1))
+				Ω(acks["message-2"]).Should(Equal(ack2))
+			})
+		})
+
+		Context("when there are no acks", func() {
+			It("returns an empty map and no error", func() {
+				acks, err := store.GetMessageAcks()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(acks).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Deleting acks", func() {
+		BeforeEach(func() {
+			err := store.SaveMessageAcks(ack1, ack2, ack3)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("deletes the passed in acks", func() {
+			err := store.DeleteMessageAcks(models.MessageAck{MessageId: "message-1"}, ack3)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			acks, err := store.GetMessageAcks()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(acks).Should(HaveLen(1))
+			Ω(acks).Should(HaveKey("message-2"))
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"github.com/cloudfoundry/hm9000/models"
+	"reflect"
+	"time"
+)
+
+//SyncPendingStagings keeps one PendingStaging per desired app whose package is PENDING.
+//Apps that were already pending keep their original timestamp; apps that are no longer pending are forgotten.
+func (store *RealStore) SyncPendingStagings(currentTime time.Time, desiredStates ...models.DesiredAppState) error {
+	currentPendingStagings, err := store.GetPendingStagings()
+	if err != nil {
+		return err
+	}
+
+	pendingAppKeys := map[string]bool{}
+	newPendingStagings := []models.PendingStaging{}
+	for _, desiredState := range desiredStates {
+		if desiredState.PackageState != models.AppPackageStatePending {
+			continue
+		}
+
+		pendingStaging := models.NewPendingStaging(currentTime, desiredState.AppGuid, desiredState.AppVersion)
+		pendingAppKeys[pendingStaging.StoreKey()] = true
+		if _, present := currentPendingStagings[pendingStaging.StoreKey()]; !present {
+			newPendingStagings = append(newPendingStagings, pendingStaging)
+		}
+	}
+
+	err = store.SavePendingStagings(newPendingStagings...)
+	if err != nil {
+		return err
+	}
+
+	stagedOrDeleted := []models.PendingStaging{}
+	for key, pendingStaging := range currentPendingStagings {
+		if !pendingAppKeys[key] {
+			stagedOrDeleted = append(stagedOrDeleted, pendingStaging)
+		}
+	}
+
+	return store.delete(stagedOrDeleted, store.SchemaRoot()+"/apps/staging")
+}
+
+func (store *RealStore) SavePendingStagings(pendingStagings ...models.PendingStaging) error {
+	return store.save(pendingStagings, store.SchemaRoot()+"/apps/staging", 0)
+}
+
+func (store *RealStore) GetPendingStagings() (map[string]models.PendingStaging, error) {
+	slice, err := store.get(store.SchemaRoot()+"/apps/staging", reflect.TypeOf(map[string]models.PendingStaging{}), reflect.ValueOf(models.NewPendingStagingFromJSON))
+	return slice.Interface().(map[string]models.PendingStaging), err
+}
@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+)
+
+var _ = Describe("Pending stagings", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		pendingApp   appfixture.AppFixture
+		stagedApp    appfixture.AppFixture
+		pending      models.DesiredAppState
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		pendingApp = appfixture.NewAppFixture()
+		stagedApp = appfixture.NewAppFixture()
+		pending = pendingApp.DesiredState(1)
+		pending.PackageState = models.AppPackageStatePending
+
+		err = store.SyncPendingStagings(time.Unix(100, 0), pending, stagedApp.DesiredState(1))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	It("records when each pending app was first seen", func() {
+		pendingStagings, err := store.GetPendingStagings()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(pendingStagings).Should(HaveLen(1))
+		Ω(pendingStagings[pending.StoreKey()]).Should(Equal(models.NewPendingStaging(time.Unix(100, 0), pendingApp.AppGuid, pendingApp.AppVersion)))
+	})
+
+	It("keeps the first seen timestamp while the app stays pending", func() {
+		err := store.SyncPendingStagings(time.Unix(200, 0), pending)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pendingStagings, err := store.GetPendingStagings()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(pendingStagings[pending.StoreKey()].PendingSince).Should(BeNumerically("==", 100))
+	})
+
+	It("forgets apps that are no longer pending", func() {
+		err := store.SyncPendingStagings(time.Unix(200, 0), pendingApp.DesiredState(1))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pendingStagings, err := store.GetPendingStagings()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(pendingStagings).Should(BeEmpty())
+	})
+})
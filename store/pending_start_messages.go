@@ -14,6 +14,16 @@ func (store *RealStore) GetPendingStartMessages() (map[string]models.PendingStar
 	return slice.Interface().(map[string]models.PendingStartMessage), err
 }
 
+//Deleting a pending message (e.g. because it expired) marks its app dirty so that the analyzer can re-enqueue it if need be
 func (store *RealStore) DeletePendingStartMessages(messages ...models.PendingStartMessage) error {
-	return store.delete(messages, store.SchemaRoot()+"/start")
+	err := store.delete(messages, store.SchemaRoot()+"/start")
+	if err != nil {
+		return err
+	}
+
+	dirtyAppKeys := []string{}
+	for _, message := range messages {
+		dirtyAppKeys = append(dirtyAppKeys, store.AppKey(message.AppGuid, message.AppVersion))
+	}
+	return store.markAppsDirty(dirtyAppKeys...)
 }
@@ -14,6 +14,16 @@ func (store *RealStore) GetPendingStopMessages() (map[string]models.PendingStopM
 	return slice.Interface().(map[string]models.PendingStopMessage), err
 }
 
+//Deleting a pending message (e.g. because it expired) marks its app dirty so that the analyzer can re-enqueue it if need be
 func (store *RealStore) DeletePendingStopMessages(messages ...models.PendingStopMessage) error {
-	return store.delete(messages, store.SchemaRoot()+"/stop")
+	err := store.delete(messages, store.SchemaRoot()+"/stop")
+	if err != nil {
+		return err
+	}
+
+	dirtyAppKeys := []string{}
+	for _, message := range messages {
+		dirtyAppKeys = append(dirtyAppKeys, store.AppKey(message.AppGuid, message.AppVersion))
+	}
+	return store.markAppsDirty(dirtyAppKeys...)
 }
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"fmt"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"strconv"
+	"time"
+)
+
+func (store *RealStore) quarantineStoreKey(quarantine models.Quarantine) string {
+	return store.SchemaRoot() + "/apps/quarantined/" + store.AppKey(quarantine.AppGuid, quarantine.AppVersion) + "/" + strconv.Itoa(quarantine.InstanceIndex)
+}
+
+//Quarantines are stored without a TTL: they only go away when an operator lifts them,
+//or once their app version is no longer desired (see PruneQuarantines)
+func (store *RealStore) SaveQuarantines(quarantines ...models.Quarantine) error {
+	t := time.Now()
+
+	nodes := make([]storeadapter.StoreNode, len(quarantines))
+	for i, quarantine := range quarantines {
+		nodes[i] = storeadapter.StoreNode{
+			Key:   store.quarantineStoreKey(quarantine),
+			Value: quarantine.ToJSON(),
+			TTL:   0,
+		}
+	}
+
+	err := store.adapter.SetMulti(nodes)
+
+	store.logger.Debug(fmt.Sprintf("Save Duration Quarantines"), map[string]string{
+		"Number of Items": fmt.Sprintf("%d", len(quarantines)),
+		"Duration":        fmt.Sprintf("%.4f seconds", time.Since(t).Seconds()),
+	})
+	return err
+}
+
+func (store *RealStore) GetQuarantines() (results []models.Quarantine, err error) {
+	appNodes, err := store.fetchNodesUnderDir(store.SchemaRoot() + "/apps/quarantined")
+	if err != nil {
+		return []models.Quarantine{}, err
+	}
+
+	results = []models.Quarantine{}
+	for _, appNode := range appNodes {
+		quarantines, err := store.quarantinesForNode(appNode)
+		if err != nil {
+			return []models.Quarantine{}, err
+		}
+		results = append(results, quarantines...)
+	}
+
+	return results, nil
+}
+
+func (store *RealStore) getQuarantinesForApp(appGuid string, appVersion string) (results []models.Quarantine, err error) {
+	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/apps/quarantined/" + store.AppKey(appGuid, appVersion))
+	if err == storeadapter.ErrorKeyNotFound {
+		return []models.Quarantine{}, nil
+	} else if err != nil {
+		return []models.Quarantine{}, err
+	}
+
+	return store.quarantinesForNode(node)
+}
+
+func (store *RealStore) quarantinesForNode(node storeadapter.StoreNode) (results []models.Quarantine, err error) {
+	for _, quarantineNode := range node.ChildNodes {
+		quarantine, err := models.NewQuarantineFromJSON(quarantineNode.Value)
+		if err != nil {
+			return []models.Quarantine{}, err
+		}
+
+		results = append(results, quarantine)
+	}
+	return results, nil
+}
+
+//PruneQuarantines deletes the quarantines of app versions that are no longer desired, which no one would lift otherwise.
+//It does nothing unless the desired state is fresh: a stale (or missing) desired state would prune every quarantine.
+func (store *RealStore) PruneQuarantines() error {
+	isDesiredStateFresh, err := store.IsDesiredStateFresh()
+	if err != nil {
+		return err
+	}
+	if !isDesiredStateFresh {
+		store.logger.Info("Not pruning quarantines: the desired state is not fresh")
+		return nil
+	}
+
+	desiredStates, err := store.GetDesiredState()
+	if err != nil {
+		return err
+	}
+
+	quarantines, err := store.GetQuarantines()
+	if err != nil {
+		return err
+	}
+
+	keysToDelete := []string{}
+	for _, quarantine := range quarantines {
+		_, isDesired := desiredStates[store.AppKey(quarantine.AppGuid, quarantine.AppVersion)]
+		if !isDesired {
+			store.logger.Info("Pruning quarantine of an app that is no longer desired", quarantine.LogDescription())
+			keysToDelete = append(keysToDelete, store.quarantineStoreKey(quarantine))
+		}
+	}
+
+	if len(keysToDelete) == 0 {
+		return nil
+	}
+
+	err = store.adapter.Delete(keysToDelete...)
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+//LiftQuarantines deletes the passed in quarantines along with the crash counts for their indices,
+//so that the analyzer starts the instances again from a clean slate
+func (store *RealStore) LiftQuarantines(quarantines ...models.Quarantine) error {
+	t := time.Now()
+
+	keysToDelete := []string{}
+	for _, quarantine := range quarantines {
+		keysToDelete = append(keysToDelete, store.quarantineStoreKey(quarantine))
+	}
+
+	err := store.adapter.Delete(keysToDelete...)
+	if err != nil {
+		return err
+	}
+
+	for _, quarantine := range quarantines {
+		err = store.adapter.Delete(store.crashCountStoreKey(models.CrashCount{
+			AppGuid:       quarantine.AppGuid,
+			AppVersion:    quarantine.AppVersion,
+			InstanceIndex: quarantine.InstanceIndex,
+		}))
+		if err != nil && err != storeadapter.ErrorKeyNotFound {
+			return err
+		}
+	}
+
+	dirtyAppKeys := []string{}
+	for _, quarantine := range quarantines {
+		dirtyAppKeys = append(dirtyAppKeys, store.AppKey(quarantine.AppGuid, quarantine.AppVersion))
+	}
+	err = store.markAppsDirty(dirtyAppKeys...)
+	if err != nil {
+		return err
+	}
+
+	store.logger.Debug(fmt.Sprintf("Lift Duration Quarantines"), map[string]string{
+		"Number of Items": fmt.Sprintf("%d", len(quarantines)),
+		"Duration":        fmt.Sprintf("%.4f seconds", time.Since(t).Seconds()),
+	})
+
+	return nil
+}
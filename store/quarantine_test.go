@@ -0,0 +1,141 @@
+package store_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter/storenodematchers"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+)
+
+var _ = Describe("Quarantine", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		quarantine1  models.Quarantine
+		quarantine2  models.Quarantine
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		quarantine1 = models.Quarantine{AppGuid: models.Guid(), AppVersion: models.Guid(), InstanceIndex: 1, CrashCount: 17, QuarantinedAt: 100}
+		quarantine2 = models.Quarantine{AppGuid: models.Guid(), AppVersion: models.Guid(), InstanceIndex: 0, CrashCount: 12, QuarantinedAt: 200}
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		err = store.SaveQuarantines(quarantine1, quarantine2)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("Saving quarantines", func() {
+		It("stores the passed in quarantines without a TTL", func() {
+			node, err := storeAdapter.Get("/hm/v1/apps/quarantined/" + quarantine1.AppGuid + "," + quarantine1.AppVersion + "/1")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node).Should(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
+				Key:   "/hm/v1/apps/quarantined/" + quarantine1.AppGuid + "," + quarantine1.AppVersion + "/1",
+				Value: quarantine1.ToJSON(),
+				TTL:   0,
+			}))
+		})
+	})
+
+	Describe("Fetching quarantines", func() {
+		It("returns all the quarantines", func() {
+			quarantines, err := store.GetQuarantines()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(quarantines).Should(HaveLen(2))
+			Ω(quarantines).Should(ContainElement(quarantine1))
+			Ω(quarantines).Should(ContainElement(quarantine2))
+		})
+	})
+
+	Describe("Lifting quarantines", func() {
+		var crashCount models.CrashCount
+
+		BeforeEach(func() {
+			crashCount = models.CrashCount{AppGuid: quarantine1.AppGuid, AppVersion: quarantine1.AppVersion, InstanceIndex: 1, CrashCount: 17}
+			err := store.SaveCrashCounts(crashCount)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.LiftQuarantines(quarantine1)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("deletes the quarantine", func() {
+			quarantines, err := store.GetQuarantines()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(quarantines).Should(Equal([]models.Quarantine{quarantine2}))
+		})
+
+		It("deletes the crash count for the quarantined index", func() {
+			_, err := storeAdapter.Get("/hm/v1/apps/crashes/" + crashCount.AppGuid + "," + crashCount.AppVersion + "/1")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+
+		Context("when there is no crash count for the quarantined index", func() {
+			It("does not error", func() {
+				err := store.LiftQuarantines(quarantine2)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Pruning quarantines", func() {
+		BeforeEach(func() {
+			err := store.SyncDesiredState(models.DesiredAppState{
+				AppGuid:           quarantine1.AppGuid,
+				AppVersion:        quarantine1.AppVersion,
+				NumberOfInstances: 2,
+				State:             models.AppStateStarted,
+				PackageState:      models.AppPackageStateStaged,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when the desired state is fresh", func() {
+			BeforeEach(func() {
+				err := store.BumpDesiredFreshness(time.Unix(100, 0))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("deletes the quarantines of app versions that are no longer desired", func() {
+				err := store.PruneQuarantines()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				quarantines, err := store.GetQuarantines()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(quarantines).Should(Equal([]models.Quarantine{quarantine1}))
+			})
+		})
+
+		Context("when the desired state is not fresh", func() {
+			It("leaves every quarantine alone", func() {
+				err := store.PruneQuarantines()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				quarantines, err := store.GetQuarantines()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(quarantines).Should(HaveLen(2))
+			})
+		})
+	})
+})
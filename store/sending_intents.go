@@ -0,0 +1,27 @@
+package store
+
+import (
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"reflect"
+)
+
+//Sending intents are stored without a TTL: an intent left behind by a sender that died must survive until the next sender reconciles it
+func (store *RealStore) SaveSendingIntents(intents ...models.SendingIntent) error {
+	return store.save(intents, store.SchemaRoot()+"/sending-intents", 0)
+}
+
+//GetSendingIntents returns the sending intents, keyed by MessageId
+func (store *RealStore) GetSendingIntents() (map[string]models.SendingIntent, error) {
+	slice, err := store.get(store.SchemaRoot()+"/sending-intents", reflect.TypeOf(map[string]models.SendingIntent{}), reflect.ValueOf(models.NewSendingIntentFromJSON))
+	return slice.Interface().(map[string]models.SendingIntent), err
+}
+
+//An intent that was already deleted is not an error
+func (store *RealStore) DeleteSendingIntents(intents ...models.SendingIntent) error {
+	err := store.delete(intents, store.SchemaRoot()+"/sending-intents")
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
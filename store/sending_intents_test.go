@@ -0,0 +1,114 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"github.com/cloudfoundry/storeadapter/storenodematchers"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Storing sending intents", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		startIntent  models.SendingIntent
+		stopIntent   models.SendingIntent
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		startMessage := models.NewPendingStartMessage(time.Unix(100, 0), 10, 0, "ABC", "123", 1, 1.0, models.PendingStartMessageReasonMissing)
+		stopMessage := models.NewPendingStopMessage(time.Unix(100, 0), 10, 0, "DEF", "456", "XYZ", models.PendingStopMessageReasonExtra)
+		startIntent = models.NewStartSendingIntent(time.Unix(110, 0), startMessage)
+		stopIntent = models.NewStopSendingIntent(time.Unix(110, 0), stopMessage)
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("Saving sending intents", func() {
+		BeforeEach(func() {
+			err := store.SaveSendingIntents(startIntent, stopIntent)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("stores the passed in intents, keyed by message id, with no TTL", func() {
+			node, err := storeAdapter.ListRecursively("/hm/v1/sending-intents")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes).Should(HaveLen(2))
+			Ω(node.ChildNodes).Should(ContainElement(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
+				Key:   "/hm/v1/sending-intents/" + startIntent.MessageId,
+				Value: startIntent.ToJSON(),
+				TTL:   0,
+			})))
+		})
+	})
+
+	Describe("Fetching sending intents", func() {
+		Context("when there are intents", func() {
+			BeforeEach(func() {
+				err := store.SaveSendingIntents(startIntent, stopIntent)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns them keyed by message id", func() {
+				intents, err := store.GetSendingIntents()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(intents).Should(Equal(map[string]models.SendingIntent{
+					startIntent.MessageId: startIntent,
+					stopIntent.MessageId:  stopIntent,
+				}))
+			})
+		})
+
+		Context("when there are no intents", func() {
+			It("returns an empty map and no error", func() {
+				intents, err := store.GetSendingIntents()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(intents).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Deleting sending intents", func() {
+		BeforeEach(func() {
+			err := store.SaveSendingIntents(startIntent, stopIntent)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("deletes the passed in intents", func() {
+			err := store.DeleteSendingIntents(startIntent)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			intents, err := store.GetSendingIntents()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(intents).Should(HaveLen(1))
+			Ω(intents).Should(HaveKey(stopIntent.MessageId))
+		})
+
+		It("does not error when the intent is already gone", func() {
+			err := store.DeleteSendingIntents(startIntent)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = store.DeleteSendingIntents(startIntent)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
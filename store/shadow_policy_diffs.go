@@ -0,0 +1,73 @@
+package store
+
+import (
+	"fmt"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"time"
+)
+
+func (store *RealStore) shadowPolicyDiffsStoreKey() string {
+	return store.SchemaRoot() + "/shadow-policy-diffs"
+}
+
+//SaveShadowPolicyDiffs appends the diffs to the shadow policy diff log and trims the log
+//down to the configured maximum, dropping the oldest diffs first
+func (store *RealStore) SaveShadowPolicyDiffs(diffs ...models.ShadowPolicyDiff) error {
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	t := time.Now()
+
+	nodes := make([]storeadapter.StoreNode, len(diffs))
+	for i, diff := range diffs {
+		nodes[i] = storeadapter.StoreNode{
+			Key:   store.shadowPolicyDiffsStoreKey() + "/" + diff.StoreKey(),
+			Value: diff.ToJSON(),
+		}
+	}
+
+	err := store.adapter.SetMulti(nodes)
+	if err != nil {
+		return err
+	}
+
+	log, err := store.GetShadowPolicyDiffs()
+	if err != nil {
+		return err
+	}
+
+	keysToDelete := []string{}
+	for i := 0; i < len(log)-store.config.AnalyzerShadowPolicyDiffLogMaxEntries; i++ {
+		keysToDelete = append(keysToDelete, store.shadowPolicyDiffsStoreKey()+"/"+log[i].StoreKey())
+	}
+
+	err = store.adapter.Delete(keysToDelete...)
+
+	store.logger.Debug(fmt.Sprintf("Save Duration Shadow Policy Diffs"), map[string]string{
+		"Number of Items":         fmt.Sprintf("%d", len(diffs)),
+		"Number of Items Trimmed": fmt.Sprintf("%d", len(keysToDelete)),
+		"Duration":                fmt.Sprintf("%.4f seconds", time.Since(t).Seconds()),
+	})
+	return err
+}
+
+//GetShadowPolicyDiffs returns the shadow policy diff log, oldest first
+func (store *RealStore) GetShadowPolicyDiffs() ([]models.ShadowPolicyDiff, error) {
+	nodes, err := store.fetchNodesUnderDir(store.shadowPolicyDiffsStoreKey())
+	if err != nil {
+		return []models.ShadowPolicyDiff{}, err
+	}
+
+	diffs := []models.ShadowPolicyDiff{}
+	for _, node := range nodes {
+		diff, err := models.NewShadowPolicyDiffFromJSON(node.Value)
+		if err != nil {
+			return []models.ShadowPolicyDiff{}, err
+		}
+		diffs = append(diffs, diff)
+	}
+
+	return models.SortShadowPolicyDiffsByTimestamp(diffs), nil
+}
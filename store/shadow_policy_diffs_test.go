@@ -0,0 +1,90 @@
+package store_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"time"
+)
+
+var _ = Describe("Shadow Policy Diffs", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+		startMessage models.PendingStartMessage
+		stopMessage  models.PendingStopMessage
+		diffs        []models.ShadowPolicyDiff
+	)
+
+	BeforeEach(func() {
+		var err error
+		conf, err = config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		conf.AnalyzerShadowPolicyDiffLogMaxEntries = 3
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		startMessage = models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", 1, 1.0, models.PendingStartMessageReasonCrashed)
+		stopMessage = models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", "instance-guid", models.PendingStopMessageReasonExtra)
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		diffs = []models.ShadowPolicyDiff{
+			models.NewShadowPolicyStartDiff(time.Unix(120, 0), "default", "cautious", models.ShadowPolicyDiffOnlyInPolicy, startMessage),
+			models.NewShadowPolicyStopDiff(time.Unix(110, 0), "default", "cautious", models.ShadowPolicyDiffOnlyInShadow, stopMessage),
+		}
+
+		err = store.SaveShadowPolicyDiffs(diffs...)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	It("stores the diffs under their id", func() {
+		node, err := storeAdapter.Get("/hm/v1/shadow-policy-diffs/" + diffs[0].StoreKey())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.Value).Should(MatchJSON(diffs[0].ToJSON()))
+	})
+
+	It("returns the diffs, oldest first", func() {
+		log, err := store.GetShadowPolicyDiffs()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(log).Should(Equal([]models.ShadowPolicyDiff{diffs[1], diffs[0]}))
+	})
+
+	Context("when there are no diffs", func() {
+		It("returns an empty list", func() {
+			storeAdapter.Delete("/hm/v1/shadow-policy-diffs")
+
+			log, err := store.GetShadowPolicyDiffs()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(log).Should(BeEmpty())
+		})
+	})
+
+	Context("when the log grows beyond the maximum", func() {
+		It("drops the oldest diffs", func() {
+			newer := []models.ShadowPolicyDiff{
+				models.NewShadowPolicyStartDiff(time.Unix(130, 0), "default", "cautious", models.ShadowPolicyDiffOnlyInShadow, startMessage),
+				models.NewShadowPolicyStopDiff(time.Unix(140, 0), "default", "cautious", models.ShadowPolicyDiffOnlyInPolicy, stopMessage),
+			}
+			err := store.SaveShadowPolicyDiffs(newer...)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			log, err := store.GetShadowPolicyDiffs()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(log).Should(Equal([]models.ShadowPolicyDiff{diffs[0], newer[0], newer[1]}))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/cloudfoundry/storeadapter"
+	"strings"
+	"time"
+)
+
+//A Snapshot is a copy of the parts of the store that the analyzer and sender read, taken at a point in time.
+//Node keys are relative to the schema root so that a snapshot can be restored into any store.
+type Snapshot struct {
+	Timestamp     int64          `json:"timestamp"`
+	SchemaVersion int            `json:"schema_version"`
+	Nodes         []SnapshotNode `json:"nodes"`
+}
+
+type SnapshotNode struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	TTL   uint64 `json:"ttl"`
+}
+
+func NewSnapshotFromJSON(encoded []byte) (Snapshot, error) {
+	snapshot := Snapshot{}
+	err := json.Unmarshal(encoded, &snapshot)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func (snapshot Snapshot) ToJSON() []byte {
+	encoded, _ := json.Marshal(snapshot)
+	return encoded
+}
+
+//snapshotDirs are captured in full; history, metrics, shadow policy diffs and dirty markers are left out
+func (store *RealStore) snapshotDirs() []string {
+	return []string{
+		"/apps/desired",
+		"/apps/actual",
+		"/apps/crashes",
+		"/apps/quarantined",
+		"/apps/policies",
+		"/apps/staging",
+		"/dea-presence",
+		"/start",
+		"/stop",
+		"/acks",
+		"/send-attempts",
+		"/sending-intents",
+		"/dead-letters",
+	}
+}
+
+//snapshotKeys are single nodes that may or may not be present
+func (store *RealStore) snapshotKeys() []string {
+	return []string{
+		store.config.DesiredFreshnessKey,
+		store.config.ActualFreshnessKey,
+		"/mass-stop-override",
+	}
+}
+
+//TakeSnapshot copies the desired and actual state, crash counts, quarantines, app policies, pending stagings,
+//pending messages and their acks, send attempts, sending intents and dead letters, freshness and the mass stop override out of the store.
+func (store *RealStore) TakeSnapshot(timestamp time.Time) (Snapshot, error) {
+	snapshot := Snapshot{
+		Timestamp:     timestamp.Unix(),
+		SchemaVersion: store.config.StoreSchemaVersion,
+		Nodes:         []SnapshotNode{},
+	}
+
+	for _, dir := range store.snapshotDirs() {
+		node, err := store.adapter.ListRecursively(store.SchemaRoot() + dir)
+		if err == storeadapter.ErrorKeyNotFound {
+			continue
+		} else if err != nil {
+			return Snapshot{}, err
+		}
+
+		snapshot.Nodes = append(snapshot.Nodes, store.snapshotLeafNodes(node)...)
+	}
+
+	for _, key := range store.snapshotKeys() {
+		node, err := store.adapter.Get(store.SchemaRoot() + key)
+		if err == storeadapter.ErrorKeyNotFound {
+			continue
+		} else if err != nil {
+			return Snapshot{}, err
+		}
+
+		snapshot.Nodes = append(snapshot.Nodes, store.snapshotLeafNodes(node)...)
+	}
+
+	return snapshot, nil
+}
+
+func (store *RealStore) snapshotLeafNodes(node storeadapter.StoreNode) []SnapshotNode {
+	if !node.Dir {
+		return []SnapshotNode{{
+			Key:   strings.TrimPrefix(node.Key, store.SchemaRoot()),
+			Value: string(node.Value),
+			TTL:   node.TTL,
+		}}
+	}
+
+	nodes := []SnapshotNode{}
+	for _, child := range node.ChildNodes {
+		nodes = append(nodes, store.snapshotLeafNodes(child)...)
+	}
+	return nodes
+}
+
+//RestoreSnapshot writes the snapshot's nodes into the store.  It is meant for an empty, in-memory store:
+//nothing already in the store is deleted, and the nodes are written without their TTLs so that the
+//snapshot stays exactly as it was taken for as long as it is being looked at.
+func (store *RealStore) RestoreSnapshot(snapshot Snapshot) error {
+	nodes := make([]storeadapter.StoreNode, len(snapshot.Nodes))
+	for i, node := range snapshot.Nodes {
+		nodes[i] = storeadapter.StoreNode{
+			Key:   store.SchemaRoot() + node.Key,
+			Value: []byte(node.Value),
+		}
+	}
+
+	return store.adapter.SetMulti(nodes)
+}
@@ -0,0 +1,166 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	. "github.com/cloudfoundry/hm9000/testhelpers/custommatchers"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	"github.com/cloudfoundry/storeadapter/workerpool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("Snapshots", func() {
+	var (
+		store        Store
+		storeAdapter storeadapter.StoreAdapter
+		conf         *config.Config
+
+		dea          appfixture.DeaFixture
+		app          appfixture.AppFixture
+		startMessage models.PendingStartMessage
+		stopMessage  models.PendingStopMessage
+		crashCount   models.CrashCount
+	)
+
+	conf, _ = config.DefaultConfig()
+
+	BeforeEach(func() {
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(), workerpool.NewWorkerPool(conf.StoreMaxConcurrentRequests))
+		err := storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		dea = appfixture.NewDeaFixture()
+		app = dea.GetApp(0)
+
+		startMessage = models.NewPendingStartMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonCrashed)
+		stopMessage = models.NewPendingStopMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, "instance-guid", models.PendingStopMessageReasonExtra)
+		crashCount = models.CrashCount{AppGuid: app.AppGuid, AppVersion: app.AppVersion, InstanceIndex: 1, CrashCount: 2}
+
+		store.SyncDesiredState(app.DesiredState(2))
+		store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+		store.SaveCrashCounts(crashCount)
+		store.SavePendingStartMessages(startMessage)
+		store.SavePendingStopMessages(stopMessage)
+		store.BumpDesiredFreshness(time.Unix(100, 0))
+		store.BumpActualFreshness(time.Unix(100, 0))
+		store.SaveMetric("StartCrashed", 3)
+		store.AllowMassStops(time.Unix(100, 0))
+		store.SaveAppHistoryEvents(models.NewAppHistoryEvent(time.Unix(100, 0), "analyzer", models.AppHistoryEventStartEnqueued, "crashed", startMessage.PendingMessage, startMessage.LogDescription()))
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("Taking a snapshot", func() {
+		It("should record the time and the schema version", func() {
+			snapshot, err := store.TakeSnapshot(time.Unix(200, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Timestamp).Should(BeNumerically("==", 200))
+			Ω(snapshot.SchemaVersion).Should(Equal(conf.StoreSchemaVersion))
+		})
+
+		It("should store node keys relative to the schema root and leave out what the analyzer and sender do not read", func() {
+			snapshot, err := store.TakeSnapshot(time.Unix(200, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			keys := []string{}
+			for _, node := range snapshot.Nodes {
+				keys = append(keys, node.Key)
+			}
+			Ω(keys).Should(ContainElement("/start/" + startMessage.StoreKey()))
+			Ω(keys).Should(ContainElement("/stop/" + stopMessage.StoreKey()))
+			Ω(keys).Should(ContainElement(conf.DesiredFreshnessKey))
+			Ω(keys).Should(ContainElement(conf.ActualFreshnessKey))
+			Ω(keys).Should(ContainElement("/mass-stop-override"))
+			Ω(keys).ShouldNot(ContainElement("/metrics/StartCrashed"))
+			for _, key := range keys {
+				Ω(key).ShouldNot(HavePrefix("/apps/history"))
+			}
+		})
+
+		It("should round trip through JSON", func() {
+			snapshot, err := store.TakeSnapshot(time.Unix(200, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			decoded, err := NewSnapshotFromJSON(snapshot.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(snapshot))
+		})
+
+		Context("when the store is empty", func() {
+			It("should return an empty snapshot", func() {
+				emptyStore := NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+
+				snapshot, err := emptyStore.TakeSnapshot(time.Unix(200, 0))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(snapshot.Nodes).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Restoring a snapshot", func() {
+		var restoredStore Store
+
+		BeforeEach(func() {
+			snapshot, err := store.TakeSnapshot(time.Unix(200, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			//as hm9000 replay does, restore the snapshot as it was read back from a file
+			decoded, err := NewSnapshotFromJSON(snapshot.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			restoredStore = NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+			err = restoredStore.RestoreSnapshot(decoded)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should restore the apps", func() {
+			apps, err := restoredStore.GetApps()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(apps).Should(HaveLen(1))
+
+			restoredApp := apps[app.AppGuid+","+app.AppVersion]
+			Ω(restoredApp.Desired).Should(EqualDesiredState(app.DesiredState(2)))
+			Ω(restoredApp.InstanceHeartbeats).Should(ConsistOf(app.InstanceAtIndex(0).Heartbeat()))
+			Ω(restoredApp.CrashCounts[1]).Should(Equal(crashCount))
+		})
+
+		It("should restore the pending messages", func() {
+			starts, err := restoredStore.GetPendingStartMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(starts).Should(Equal(map[string]models.PendingStartMessage{startMessage.StoreKey(): startMessage}))
+
+			stops, err := restoredStore.GetPendingStopMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stops).Should(Equal(map[string]models.PendingStopMessage{stopMessage.StoreKey(): stopMessage}))
+		})
+
+		It("should restore the freshness", func() {
+			err := restoredStore.VerifyFreshness(time.Unix(200, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should restore the mass stop override", func() {
+			allowed, err := restoredStore.AreMassStopsAllowed()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(allowed).Should(BeTrue())
+		})
+
+		It("should not restore the app history", func() {
+			history, err := restoredStore.GetAppHistory(app.AppGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(history).Should(BeEmpty())
+		})
+	})
+})
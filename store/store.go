@@ -36,16 +36,34 @@ type Store interface {
 	AppKey(appGuid string, appVersion string) string
 	GetApps() (map[string]*models.App, error)
 	GetApp(appGuid string, appVersion string) (*models.App, error)
+	GetAppsWithKeys(appKeys ...string) (map[string]*models.App, error)
+
+	GetDirtyApps() (map[string]string, error)
+	GetDirtyAppKeys() ([]string, error)
+	ClearDirtyApps(marks map[string]string) error
 
 	SyncDesiredState(desiredStates ...models.DesiredAppState) error
 	GetDesiredState() (map[string]models.DesiredAppState, error)
 
+	SyncPendingStagings(currentTime time.Time, desiredStates ...models.DesiredAppState) error
+	SavePendingStagings(pendingStagings ...models.PendingStaging) error
+	GetPendingStagings() (map[string]models.PendingStaging, error)
+
 	SyncHeartbeats(heartbeat ...models.Heartbeat) error
 	GetInstanceHeartbeats() (results []models.InstanceHeartbeat, err error)
 	GetInstanceHeartbeatsForApp(appGuid string, appVersion string) (results []models.InstanceHeartbeat, err error)
 
 	SaveCrashCounts(crashCounts ...models.CrashCount) error
 
+	SaveQuarantines(quarantines ...models.Quarantine) error
+	GetQuarantines() ([]models.Quarantine, error)
+	LiftQuarantines(quarantines ...models.Quarantine) error
+	PruneQuarantines() error
+
+	SaveAppPolicies(policies ...models.AppPolicy) error
+	GetAppPolicies() (map[string]models.AppPolicy, error)
+	DeleteAppPolicies(policies ...models.AppPolicy) error
+
 	SavePendingStartMessages(startMessages ...models.PendingStartMessage) error
 	GetPendingStartMessages() (map[string]models.PendingStartMessage, error)
 	DeletePendingStartMessages(startMessages ...models.PendingStartMessage) error
@@ -54,9 +72,38 @@ type Store interface {
 	GetPendingStopMessages() (map[string]models.PendingStopMessage, error)
 	DeletePendingStopMessages(stopMessages ...models.PendingStopMessage) error
 
+	SaveMessageAcks(acks ...models.MessageAck) error
+	GetMessageAcks() (map[string]models.MessageAck, error)
+	DeleteMessageAcks(acks ...models.MessageAck) error
+
+	SaveSendAttempts(attempts ...models.SendAttempts) error
+	GetSendAttempts() (map[string]models.SendAttempts, error)
+	DeleteSendAttempts(attempts ...models.SendAttempts) error
+
+	SaveSendingIntents(intents ...models.SendingIntent) error
+	GetSendingIntents() (map[string]models.SendingIntent, error)
+	DeleteSendingIntents(intents ...models.SendingIntent) error
+
+	SaveDeadLetters(deadLetters ...models.DeadLetter) error
+	GetDeadLetters() (map[string]models.DeadLetter, error)
+	DeleteDeadLetters(deadLetters ...models.DeadLetter) error
+
+	SaveAppHistoryEvents(events ...models.AppHistoryEvent) error
+	GetAppHistory(appGuid string) ([]models.AppHistoryEvent, error)
+
+	SaveShadowPolicyDiffs(diffs ...models.ShadowPolicyDiff) error
+	GetShadowPolicyDiffs() ([]models.ShadowPolicyDiff, error)
+
+	AllowMassStops(timestamp time.Time) error
+	AreMassStopsAllowed() (bool, error)
+	RevokeMassStopOverride() error
+
 	SaveMetric(metric string, value float64) error
 	GetMetric(metric string) (float64, error)
 
+	TakeSnapshot(timestamp time.Time) (Snapshot, error)
+	RestoreSnapshot(snapshot Snapshot) error
+
 	Compact() error
 }
 
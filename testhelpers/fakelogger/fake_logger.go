@@ -3,12 +3,15 @@ package fakelogger
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 )
 
 type FakeLogger struct {
 	LoggedSubjects []string
 	LoggedErrors   []error
 	LoggedMessages []string
+
+	lock *sync.Mutex
 }
 
 func NewFakeLogger() *FakeLogger {
@@ -16,20 +19,30 @@ func NewFakeLogger() *FakeLogger {
 		LoggedSubjects: []string{},
 		LoggedErrors:   []error{},
 		LoggedMessages: []string{},
+		lock:           &sync.Mutex{},
 	}
 }
 
 func (logger *FakeLogger) Info(subject string, messages ...map[string]string) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
 	logger.LoggedSubjects = append(logger.LoggedSubjects, subject)
 	logger.LoggedMessages = append(logger.LoggedMessages, logger.squashedMessage(messages...))
 }
 
 func (logger *FakeLogger) Debug(subject string, messages ...map[string]string) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
 	logger.LoggedSubjects = append(logger.LoggedSubjects, subject)
 	logger.LoggedMessages = append(logger.LoggedMessages, logger.squashedMessage(messages...))
 }
 
 func (logger *FakeLogger) Error(subject string, err error, messages ...map[string]string) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
 	logger.LoggedSubjects = append(logger.LoggedSubjects, subject)
 	logger.LoggedErrors = append(logger.LoggedErrors, err)
 	logger.LoggedMessages = append(logger.LoggedMessages, logger.squashedMessage(messages...))
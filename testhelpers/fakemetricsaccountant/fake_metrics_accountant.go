@@ -10,9 +10,38 @@ type FakeMetricsAccountant struct {
 	IncrementedStarts                []models.PendingStartMessage
 	IncrementedStops                 []models.PendingStopMessage
 
+	LatencySentAt time.Time
+	LatencyStarts []models.PendingStartMessage
+	LatencyStops  []models.PendingStopMessage
+
+	NotSentStarts []models.PendingStartMessage
+	ExpiredStarts []models.PendingStartMessage
+	NotSentStops  []models.PendingStopMessage
+	ExpiredStops  []models.PendingStopMessage
+
+	IncrementAckOutcomeMetricsError error
+	ResolvedStarts                  []models.PendingStartMessage
+	ResolvedStops                   []models.PendingStopMessage
+
+	DeadLetters []models.DeadLetter
+
+	StartPublishFailures   int
+	StopPublishFailures    int
+	MessageBusDownReported bool
+
 	TrackedDesiredStateSyncTime                  time.Duration
 	TrackedActualStateListenerStoreUsageFraction float64
 
+	MassStopCircuitBreakerTrips int
+	RefusedStops                int
+
+	TrackedAnalysisTime         time.Duration
+	TrackedAppsAnalyzedByWorker []int
+
+	ShadowPolicyDiffsTracked int
+	TrackedDiffsOnlyInPolicy int
+	TrackedDiffsOnlyInShadow int
+
 	GetMetricsError   error
 	GetMetricsMetrics map[string]float64
 
@@ -24,6 +53,15 @@ func New() *FakeMetricsAccountant {
 	return &FakeMetricsAccountant{
 		IncrementedStarts: []models.PendingStartMessage{},
 		IncrementedStops:  []models.PendingStopMessage{},
+		ResolvedStarts:    []models.PendingStartMessage{},
+		ResolvedStops:     []models.PendingStopMessage{},
+		DeadLetters:       []models.DeadLetter{},
+		LatencyStarts:     []models.PendingStartMessage{},
+		LatencyStops:      []models.PendingStopMessage{},
+		NotSentStarts:     []models.PendingStartMessage{},
+		ExpiredStarts:     []models.PendingStartMessage{},
+		NotSentStops:      []models.PendingStopMessage{},
+		ExpiredStops:      []models.PendingStopMessage{},
 
 		GetMetricsMetrics: map[string]float64{},
 	}
@@ -46,6 +84,40 @@ func (m *FakeMetricsAccountant) IncrementSentMessageMetrics(starts []models.Pend
 	return m.IncrementSentMessageMetricsError
 }
 
+func (m *FakeMetricsAccountant) IncrementSendLatencyMetrics(sentAt time.Time, starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
+	m.LatencySentAt = sentAt
+	m.LatencyStarts = starts
+	m.LatencyStops = stops
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementDeletedMessageMetrics(notSentStarts []models.PendingStartMessage, expiredStarts []models.PendingStartMessage, notSentStops []models.PendingStopMessage, expiredStops []models.PendingStopMessage) error {
+	m.NotSentStarts = notSentStarts
+	m.ExpiredStarts = expiredStarts
+	m.NotSentStops = notSentStops
+	m.ExpiredStops = expiredStops
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementAckOutcomeMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
+	m.ResolvedStarts = starts
+	m.ResolvedStops = stops
+
+	return m.IncrementAckOutcomeMetricsError
+}
+
+func (m *FakeMetricsAccountant) IncrementDeadLetterMetrics(deadLetters []models.DeadLetter) error {
+	m.DeadLetters = append(m.DeadLetters, deadLetters...)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementPublishFailureMetrics(startFailures int, stopFailures int, messageBusDown bool) error {
+	m.StartPublishFailures += startFailures
+	m.StopPublishFailures += stopFailures
+	m.MessageBusDownReported = m.MessageBusDownReported || messageBusDown
+	return nil
+}
+
 func (m *FakeMetricsAccountant) TrackDesiredStateSyncTime(dt time.Duration) error {
 	m.TrackedDesiredStateSyncTime = dt
 	return nil
@@ -56,6 +128,25 @@ func (m *FakeMetricsAccountant) TrackActualStateListenerStoreUsageFraction(usage
 	return nil
 }
 
+func (m *FakeMetricsAccountant) TrackMassStopCircuitBreakerTrip(refusedStops int) error {
+	m.MassStopCircuitBreakerTrips++
+	m.RefusedStops += refusedStops
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackAnalysis(dt time.Duration, appsAnalyzedByWorker []int) error {
+	m.TrackedAnalysisTime = dt
+	m.TrackedAppsAnalyzedByWorker = appsAnalyzedByWorker
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackShadowPolicyDiffs(onlyInPolicy int, onlyInShadow int) error {
+	m.ShadowPolicyDiffsTracked++
+	m.TrackedDiffsOnlyInPolicy = onlyInPolicy
+	m.TrackedDiffsOnlyInShadow = onlyInShadow
+	return nil
+}
+
 func (m *FakeMetricsAccountant) GetMetrics() (map[string]float64, error) {
 	return m.GetMetricsMetrics, m.GetMetricsError
 }
@@ -1,42 +1,84 @@
 package startstoplistener
 
 import (
+	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/yagnats"
 )
 
+//A StartStopListener records the start and stop messages published on the sender's subjects.
+//When message signing is enabled, messages whose signature does not verify are recorded as rejected instead.
 type StartStopListener struct {
-	Starts     []models.StartMessage
-	Stops      []models.StopMessage
+	Starts         []models.StartMessage
+	Stops          []models.StopMessage
+	RejectedStarts []models.StartMessage
+	RejectedStops  []models.StopMessage
+
+	//TimeProvider is the clock signatures are verified against; tests that fake the sender's time should fake this too
+	TimeProvider timeprovider.TimeProvider
+
 	messageBus yagnats.NATSClient
+	conf       *config.Config
 }
 
 func NewStartStopListener(messageBus yagnats.NATSClient, conf *config.Config) *StartStopListener {
 	listener := &StartStopListener{
-		messageBus: messageBus,
+		TimeProvider: timeprovider.NewTimeProvider(),
+		messageBus:   messageBus,
+		conf:         conf,
 	}
 
 	messageBus.Subscribe(conf.SenderNatsStartSubject, func(message *yagnats.Message) {
-		startMessage, err := models.NewStartMessageFromJSON([]byte(message.Payload))
+		payload, verified := listener.verify([]byte(message.Payload))
+		startMessage, err := models.NewStartMessageFromJSON(payload)
 		if err != nil {
 			panic(err)
 		}
+		if !verified {
+			listener.RejectedStarts = append(listener.RejectedStarts, startMessage)
+			return
+		}
 		listener.Starts = append(listener.Starts, startMessage)
 	})
 
 	messageBus.Subscribe(conf.SenderNatsStopSubject, func(message *yagnats.Message) {
-		stopMessage, err := models.NewStopMessageFromJSON([]byte(message.Payload))
+		payload, verified := listener.verify([]byte(message.Payload))
+		stopMessage, err := models.NewStopMessageFromJSON(payload)
 		if err != nil {
 			panic(err)
 		}
+		if !verified {
+			listener.RejectedStops = append(listener.RejectedStops, stopMessage)
+			return
+		}
 		listener.Stops = append(listener.Stops, stopMessage)
 	})
 
 	return listener
 }
 
+//verify unwraps a signed message when signing is enabled, returning its payload even if the signature does not verify
+func (listener *StartStopListener) verify(received []byte) (payload []byte, verified bool) {
+	if !listener.conf.IsMessageSigningEnabled() {
+		return received, true
+	}
+
+	signedMessage, err := models.NewSignedMessageFromJSON(received)
+	if err != nil {
+		panic(err)
+	}
+
+	payload, err = signedMessage.Verify(listener.conf.SenderMessageSigningSecret, listener.TimeProvider.Time(), listener.conf.SenderSignatureReplayWindow())
+	if err != nil {
+		return []byte(signedMessage.Payload), false
+	}
+	return payload, true
+}
+
 func (listener *StartStopListener) Reset() {
 	listener.Starts = make([]models.StartMessage, 0)
 	listener.Stops = make([]models.StopMessage, 0)
+	listener.RejectedStarts = make([]models.StartMessage, 0)
+	listener.RejectedStops = make([]models.StopMessage, 0)
 }